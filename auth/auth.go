@@ -1,9 +1,14 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/msal4/toastnotes/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,6 +30,11 @@ type ChangePasswordForm struct {
 	NewPassword     string `json:"newPassword" binding:"required,min=8"`
 }
 
+// LoginLinkForm is used to request a passwordless login link.
+type LoginLinkForm struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 // AccessTokenClaims ...
 type AccessTokenClaims struct {
 	UserID string `json:"userId"`
@@ -39,60 +49,78 @@ type RefreshTokenClaims struct {
 }
 
 const (
-	// AccessTokenAge is the token age in seconds.
-	AccessTokenAge = 300 // = 5 minutes
-
-	// RefreshTokenAge is the refresh token age in seconds.
-	RefreshTokenAge = 2.628e6 // = 1 month
-
 	// UserIDKey is the key used to set the user id in gin context.
 	UserIDKey = "userId"
 
-	// RefreshTokenKey is the key used to set the refresh token cookie
-	RefreshTokenKey = "herz"
-
-	// AccessTokenKey is the key used to set the refresh token cookie
-	AccessTokenKey = "seele"
+	// LoginNonceKey is the key used to set the login link nonce cookie, it binds the link to the browser that
+	// requested it.
+	LoginNonceKey = "nonce"
 
 	// PasswordHashCost is the cost used for hashing the user password.
 	PasswordHashCost = 11
 )
 
-// JWTSecret is the secret jwt key used to create tokens.
-var JWTSecret = []byte("mysecretkeygoeshere")
+// Tokens generates and parses the jwt tokens using the auth config.
+type Tokens struct {
+	config.Auth
+}
+
+// NewTokens creates a new Tokens using the given auth config.
+func NewTokens(cfg config.Auth) *Tokens {
+	return &Tokens{Auth: cfg}
+}
+
+// AccessTokenMaxAge is the access token cookie max age in seconds.
+func (t *Tokens) AccessTokenMaxAge() int {
+	return int(t.AccessTokenAge.Seconds())
+}
+
+// RefreshTokenMaxAge is the refresh token cookie max age in seconds.
+func (t *Tokens) RefreshTokenMaxAge() int {
+	return int(t.RefreshTokenAge.Seconds())
+}
 
 // GenerateAccessToken generates an access token using the refresh token.
-func GenerateAccessToken(userID string) (string, error) {
+func (t *Tokens) GenerateAccessToken(userID string) (string, error) {
 	claims := &AccessTokenClaims{
 		UserID: userID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(AccessTokenAge * time.Second).Unix(),
+			ExpiresAt: time.Now().Add(t.AccessTokenAge).Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString(JWTSecret)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return t.sign(claims)
 }
 
 // GenerateRefreshToken generates an access token using the refresh token.
-func GenerateRefreshToken(userID string, version int) (string, error) {
+func (t *Tokens) GenerateRefreshToken(userID string, version int) (string, error) {
 	claims := &RefreshTokenClaims{
 		UserID:       userID,
 		TokenVersion: version,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(RefreshTokenAge * time.Second).Unix(),
+			ExpiresAt: time.Now().Add(t.RefreshTokenAge).Unix(),
 		},
 	}
 
+	return t.sign(claims)
+}
+
+// ParseToken parses the token and returns the token obj or an error.
+func (t *Tokens) ParseToken(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(t.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (t *Tokens) sign(claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString(JWTSecret)
+	tokenString, err := token.SignedString([]byte(t.JWTSecret))
 	if err != nil {
 		return "", err
 	}
@@ -100,16 +128,20 @@ func GenerateRefreshToken(userID string, version int) (string, error) {
 	return tokenString, nil
 }
 
-// ParseToken parses the token and returns the token obj or an error.
-func ParseToken(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return JWTSecret, nil
-	})
-	if err != nil {
-		return nil, err
+// GenerateSecureToken generates a url safe random token.
+func GenerateSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
 
-	return token, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes a token generated by GenerateSecureToken so that it can be stored safely.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // HashPassword hashes the password string.
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"testing"
+
+	"github.com/msal4/toastnotes/config"
 )
 
 const (
@@ -9,14 +11,22 @@ const (
 	tokenVersion = 5
 )
 
+var tokens = newTestTokens()
+
+func newTestTokens() *Tokens {
+	cfg := config.Default().Auth
+	cfg.JWTSecret = "mysecretkeygoeshere"
+	return NewTokens(cfg)
+}
+
 func TestGenerateAccessToken(t *testing.T) {
-	tokenStr, err := GenerateAccessToken(userID)
+	tokenStr, err := tokens.GenerateAccessToken(userID)
 	if err != nil {
 		t.Error("failed to generate token:", err)
 	}
 
 	claims := AccessTokenClaims{}
-	token, err := ParseToken(tokenStr, &claims)
+	token, err := tokens.ParseToken(tokenStr, &claims)
 	if err != nil {
 		t.Fatal("failed to parse token:", err)
 	}
@@ -31,13 +41,13 @@ func TestGenerateAccessToken(t *testing.T) {
 }
 
 func TestGenerateRefreshToken(t *testing.T) {
-	tokenStr, err := GenerateRefreshToken(userID, 5)
+	tokenStr, err := tokens.GenerateRefreshToken(userID, 5)
 	if err != nil {
 		t.Error("failed to generate token:", err)
 	}
 
 	claims := RefreshTokenClaims{}
-	token, err := ParseToken(tokenStr, &claims)
+	token, err := tokens.ParseToken(tokenStr, &claims)
 	if err != nil {
 		t.Fatal("failed to parse token:", err)
 	}
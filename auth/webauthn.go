@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/msal4/toastnotes/config"
+)
+
+const (
+	// PasskeySessionKey is the key used to set the passkey ceremony session cookie.
+	PasskeySessionKey = "kaji"
+
+	// PasskeySessionAge is the passkey ceremony session age in seconds.
+	PasskeySessionAge = 300 // = 5 minutes
+)
+
+// PasskeyNameForm is used to name a passkey.
+type PasskeyNameForm struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// PasskeySessionClaims holds the state of a passkey registration or login ceremony between its begin and finish
+// requests.
+type PasskeySessionClaims struct {
+	Session webauthn.SessionData `json:"session"`
+	jwt.StandardClaims
+}
+
+// NewWebAuthn creates the webauthn relying party.
+func NewWebAuthn(cfg config.WebAuthn) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: "Toast Notes",
+		RPOrigins:     cfg.Origins,
+	})
+}
+
+// GeneratePasskeySessionToken signs the ceremony session data so it can be handed to the client.
+func (t *Tokens) GeneratePasskeySessionToken(session *webauthn.SessionData) (string, error) {
+	claims := &PasskeySessionClaims{
+		Session: *session,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(PasskeySessionAge * time.Second).Unix(),
+		},
+	}
+
+	return t.sign(claims)
+}
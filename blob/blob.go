@@ -0,0 +1,42 @@
+// Package blob stores the content of the attachments, on the local filesystem or in an S3 compatible bucket.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/msal4/toastnotes/config"
+)
+
+// The storage backends.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned when opening a blob that doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores the blobs by their key, the keys are slash separated paths.
+type Store interface {
+	// Put stores the size bytes read from r under key, replacing the blob stored there if any.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open opens the blob stored under key, it can be seeked so that ranges of it can be served.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete deletes the blob stored under key, deleting a missing blob isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the store of the configured backend.
+func New(cfg config.Storage) (Store, error) {
+	switch cfg.Backend {
+	case BackendLocal:
+		return NewLocal(cfg.Dir), nil
+	case BackendS3:
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,82 @@
+package blob_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/blob/blobtest"
+	"github.com/msal4/toastnotes/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	store := blob.NewLocal(dir)
+	blobtest.Run(t, store)
+
+	t.Run("keys_stay_in_the_directory", func(t *testing.T) {
+		ctx := context.Background()
+		for _, key := range []string{"../escape", "/abs", "a/../../b", ""} {
+			assert.NotNil(t, store.Put(ctx, key, strings.NewReader("x"), 1), key)
+		}
+	})
+
+	t.Run("no_temporary_files_are_left", func(t *testing.T) {
+		entries, err := os.ReadDir(filepath.Join(dir, "user", "note"))
+		assert.Nil(t, err)
+		for _, e := range entries {
+			assert.False(t, strings.HasPrefix(e.Name(), ".blob-"), e.Name())
+		}
+	})
+}
+
+func TestS3(t *testing.T) {
+	srv := blobtest.NewS3Server("access")
+	defer srv.Close()
+
+	cfg := config.Default().Storage
+	cfg.Backend = blob.BackendS3
+	cfg.S3Endpoint = srv.URL
+	cfg.S3Bucket = "toastnotes"
+	cfg.S3AccessKey = "access"
+	cfg.S3SecretKey = "secret"
+	cfg.S3PathStyle = true
+	store, err := blob.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobtest.Run(t, store)
+
+	t.Run("objects_are_stored_in_the_bucket", func(t *testing.T) {
+		obj, ok := srv.Object("/toastnotes/user/note/put")
+		assert.True(t, ok)
+		assert.Equal(t, "hello, attachments", string(obj))
+	})
+
+	t.Run("requests_signed_with_other_keys_fail", func(t *testing.T) {
+		other := *store.(*blob.S3)
+		other.AccessKey = "other"
+		_, err := other.Open(context.Background(), "user/note/put")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.Default().Storage
+	store, err := blob.New(cfg)
+	assert.Nil(t, err)
+	assert.IsType(t, &blob.Local{}, store)
+
+	cfg.Backend = "ftp"
+	_, err = blob.New(cfg)
+	assert.NotNil(t, err)
+
+	cfg.Backend = blob.BackendS3
+	cfg.S3Endpoint = "localhost:9000"
+	_, err = blob.New(cfg)
+	assert.NotNil(t, err)
+}
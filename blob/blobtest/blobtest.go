@@ -0,0 +1,168 @@
+// Package blobtest has a conformance suite for the blob stores and a fake S3 server to run it against.
+package blobtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/blob"
+	"github.com/stretchr/testify/assert"
+)
+
+// S3Server is an in-memory S3 compatible server storing the objects of path-style requests, like a local MinIO.
+// It only checks that the requests are signed with its access key, not their signatures.
+type S3Server struct {
+	*httptest.Server
+	AccessKey string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewS3Server starts a fake S3 server accepting the requests signed with accessKey, it must be closed when done.
+func NewS3Server(accessKey string) *S3Server {
+	s := &S3Server{AccessKey: accessKey, objects: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Object returns the content of the object stored at path (/bucket/key).
+func (s *S3Server) Object(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[path]
+	return obj, ok
+}
+
+func (s *S3Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/") || r.Header.Get("X-Amz-Date") == "" {
+		s.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	path := r.URL.Path
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(body)) != r.ContentLength {
+			s.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.mu.Lock()
+		s.objects[path] = body
+		s.mu.Unlock()
+	case http.MethodGet, http.MethodHead:
+		obj, ok := s.Object(path)
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj))
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, path)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *S3Server) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
+
+// Run runs the conformance suite against the store.
+func Run(t *testing.T, store blob.Store) {
+	ctx := context.Background()
+	content := "hello, attachments"
+
+	put := func(t *testing.T, key, content string) {
+		if err := store.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(t *testing.T, key string) string {
+		r, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		return string(b)
+	}
+
+	t.Run("put_and_open", func(t *testing.T) {
+		put(t, "user/note/put", content)
+		assert.Equal(t, content, read(t, "user/note/put"))
+	})
+
+	t.Run("put_replaces_the_blob", func(t *testing.T) {
+		put(t, "user/note/replace", content)
+		put(t, "user/note/replace", "replaced")
+		assert.Equal(t, "replaced", read(t, "user/note/replace"))
+	})
+
+	t.Run("put_fails_on_short_readers", func(t *testing.T) {
+		err := store.Put(ctx, "user/note/short", strings.NewReader("short"), 10)
+		assert.NotNil(t, err)
+		_, err = store.Open(ctx, "user/note/short")
+		assert.True(t, errors.Is(err, blob.ErrNotFound))
+	})
+
+	t.Run("empty_blobs", func(t *testing.T) {
+		put(t, "user/note/empty", "")
+		assert.Equal(t, "", read(t, "user/note/empty"))
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		put(t, "user/note/seek", content)
+		r, err := store.Open(ctx, "user/note/seek")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		size, err := r.Seek(0, io.SeekEnd)
+		assert.Nil(t, err)
+		assert.EqualValues(t, len(content), size)
+
+		_, err = r.Seek(7, io.SeekStart)
+		assert.Nil(t, err)
+		b := make([]byte, 5)
+		_, err = io.ReadFull(r, b)
+		assert.Nil(t, err)
+		assert.Equal(t, "attac", string(b))
+
+		_, err = r.Seek(-5, io.SeekEnd)
+		assert.Nil(t, err)
+		rest, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, "ments", string(rest))
+	})
+
+	t.Run("open_missing", func(t *testing.T) {
+		_, err := store.Open(ctx, "user/note/missing")
+		assert.True(t, errors.Is(err, blob.ErrNotFound))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		put(t, "user/note/delete", content)
+		assert.Nil(t, store.Delete(ctx, "user/note/delete"))
+		_, err := store.Open(ctx, "user/note/delete")
+		assert.True(t, errors.Is(err, blob.ErrNotFound))
+		assert.Nil(t, store.Delete(ctx, "user/note/delete"))
+	})
+}
@@ -0,0 +1,174 @@
+// Package cli implements the toastnotes command line, every command shares the app config and the models
+// repositories.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Command is a cli command, commands with subcommands dispatch on their first argument.
+type Command struct {
+	Name        string
+	Args        string // the arguments synopsis shown in the usage, e.g. "<name>"
+	Summary     string
+	Subcommands []*Command
+	Run         func(env *Env, args []string) error
+}
+
+// Env is the environment the commands run in.
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// UsageError is returned when a command is called with invalid arguments, it makes the cli exit with 2.
+type UsageError struct {
+	msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return &UsageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// Root is the toastnotes command, it runs serve when called without a command.
+var Root = &Command{
+	Name:    "toastnotes",
+	Summary: "The toast notes api server and admin tools.",
+	Subcommands: []*Command{
+		serveCmd,
+		migrateCmd,
+		userCmd,
+		notesCmd,
+		seedCmd,
+		configCmd,
+	},
+}
+
+// Run runs the command matching args and returns the process exit code.
+func Run(env *Env, args []string) int {
+	// keep `toastnotes [flags]` starting the server.
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		args = append([]string{serveCmd.Name}, args...)
+	}
+
+	err := Root.run(env, nil, args)
+	if err == nil {
+		return 0
+	}
+
+	var uerr *UsageError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &uerr):
+		fmt.Fprintln(env.Stderr, err)
+		return 2
+	default:
+		fmt.Fprintln(env.Stderr, "error:", err)
+		return 1
+	}
+}
+
+// Main runs the cli with the process args and standard streams and exits.
+func Main() {
+	os.Exit(Run(&Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}, os.Args[1:]))
+}
+
+func (cmd *Command) run(env *Env, parents []string, args []string) error {
+	path := append(append([]string{}, parents...), cmd.Name)
+
+	if len(cmd.Subcommands) == 0 {
+		return cmd.Run(env, args)
+	}
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		cmd.usage(env.Stdout, path)
+		if len(args) == 0 {
+			return usageErrorf("%s: missing command", strings.Join(path, " "))
+		}
+		return nil
+	}
+
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == args[0] {
+			return sub.run(env, path, args[1:])
+		}
+	}
+
+	cmd.usage(env.Stderr, path)
+	return usageErrorf("%s: unknown command %q", strings.Join(path, " "), args[0])
+}
+
+func (cmd *Command) usage(w io.Writer, path []string) {
+	fmt.Fprintf(w, "%s\n\nUsage:\n  %s <command> [flags]\n\nCommands:\n", cmd.Summary, strings.Join(path, " "))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, sub := range cmd.Subcommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", sub.Name, sub.Args, sub.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun \"%s <command> --help\" for the command flags.\n", strings.Join(path, " "))
+}
+
+// newFlagSet creates the flag set of a leaf command, parsing errors are returned instead of printed so that Run
+// reports them once.
+func newFlagSet(env *Env, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {
+		fs.SetOutput(env.Stderr)
+		defer fs.SetOutput(io.Discard)
+
+		fmt.Fprintf(env.Stderr, "Usage:\n  toastnotes %s [flags]\n\nFlags:\n", strings.TrimSpace(name+" "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadConfig registers the config flags in fs, parses args and loads the config.
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &UsageError{msg: err.Error()}
+	}
+	return cfg, nil
+}
+
+// openDB opens the database of cfg, the sql logs are discarded unless the log level is debug.
+func openDB(cfg *config.Config) (*gorm.DB, error) {
+	if cfg.Database.URL == "" {
+		return nil, usageErrorf("database.url is required (DATABASE_URL, --database-url)")
+	}
+
+	lgr := logger.Discard
+	if cfg.Log.Level == "debug" {
+		lgr = logger.Default
+	}
+
+	return models.OpenConnection(cfg.Database.URL, lgr)
+}
+
+// closeDB closes the db connection pool.
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
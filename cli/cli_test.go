@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/migrations"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func run(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = Run(&Env{Stdin: &bytes.Buffer{}, Stdout: &out, Stderr: &errOut}, args)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("prints_the_commands", func(t *testing.T) {
+		code, out, _ := run("--help")
+		assert.Equal(t, 0, code)
+		for _, name := range []string{"serve", "migrate", "user", "notes", "seed", "config"} {
+			assert.Contains(t, out, name)
+		}
+	})
+
+	t.Run("rejects_unknown_commands", func(t *testing.T) {
+		code, _, errOut := run("user", "delete")
+		assert.Equal(t, 2, code)
+		assert.Contains(t, errOut, `unknown command "delete"`)
+	})
+
+	t.Run("requires_a_subcommand", func(t *testing.T) {
+		code, _, _ := run("migrate")
+		assert.Equal(t, 2, code)
+	})
+
+	t.Run("rejects_unknown_flags", func(t *testing.T) {
+		code, _, errOut := run("notes", "export", "--nope")
+		assert.Equal(t, 2, code)
+		assert.Contains(t, errOut, "-nope")
+	})
+
+	t.Run("validates_the_user_form", func(t *testing.T) {
+		code, _, errOut := run("user", "create", "--email", "not-an-email", "--name", "Toast")
+		assert.Equal(t, 2, code)
+		assert.Contains(t, errOut, "invalid email")
+	})
+
+	t.Run("creates_migrations", func(t *testing.T) {
+		dir := t.TempDir()
+		code, out, _ := run("migrate", "create", "--dir", dir, "add_tags")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, filepath.Join(dir, "0001_add_tags.up.sql"))
+	})
+}
+
+func TestAdminCommands(t *testing.T) {
+	// a sqlite database is used unless TEST_DATABASE_URL is set.
+	testutils.LoadEnv()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		dsn = "sqlite://" + filepath.Join(t.TempDir(), "toastnotes.db")
+	}
+	t.Setenv("DATABASE_URL", dsn)
+
+	db, err := models.OpenConnection(dsn, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	migrator, _ := migrations.New(sqlDB, models.Dialect(db))
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM reminders")
+		db.Exec("DELETE FROM checklist_items")
+		db.Exec("DELETE FROM import_failures")
+		db.Exec("DELETE FROM import_jobs")
+		db.Exec("DELETE FROM attachments")
+		db.Exec("DELETE FROM notes")
+		db.Exec("DELETE FROM usages")
+		db.Exec("DELETE FROM users")
+		sqlDB.Close()
+	})
+
+	const email = "admin-cli@example.com"
+
+	t.Run("user_create", func(t *testing.T) {
+		code, out, _ := run("user", "create", "--email", email, "--name", "Admin", "--password", "password123")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, "created user "+email)
+
+		code, _, _ = run("user", "create", "--email", email, "--name", "Admin")
+		assert.Equal(t, 1, code)
+	})
+
+	t.Run("user_disable_and_enable", func(t *testing.T) {
+		code, _, _ := run("user", "disable", "--email", email)
+		assert.Equal(t, 0, code)
+
+		user := models.User{}
+		db.First(&user, "email = ?", email)
+		assert.True(t, user.Disabled())
+		assert.Equal(t, 1, user.TokenVersion)
+
+		code, _, _ = run("user", "enable", "--email", user.ID)
+		assert.Equal(t, 0, code)
+		db.First(&user, "email = ?", email)
+		assert.False(t, user.Disabled())
+	})
+
+	t.Run("user_plan", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(path, []byte("quota:\n  plans:\n    pro:\n      maxNotes: 100000\n"), 0o644)
+		t.Setenv("CONFIG_FILE", path)
+
+		code, out, _ := run("user", "plan", "--email", email, "--plan", "pro")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, "put user "+email+" on the pro plan")
+		user := models.User{}
+		db.First(&user, "email = ?", email)
+		assert.Equal(t, "pro", user.Plan)
+
+		code, _, _ = run("user", "plan", "--email", email, "--plan", "team")
+		assert.Equal(t, 2, code, "the plan must be configured")
+		code, _, _ = run("user", "plan", "--email", email)
+		assert.Equal(t, 0, code)
+		db.First(&user, "email = ?", email)
+		assert.Empty(t, user.Plan)
+	})
+
+	t.Run("user_reset_password", func(t *testing.T) {
+		code, out, _ := run("user", "reset-password", "--email", email)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, "generated password: ")
+
+		user := models.User{}
+		db.First(&user, "email = ?", email)
+		assert.False(t, auth.PasswordMatch(user.Password, "password123"))
+	})
+
+	t.Run("seed_and_notes_export", func(t *testing.T) {
+		code, _, _ := run("seed", "--email", "demo@example.com", "--notes", "7")
+		assert.Equal(t, 0, code)
+
+		code, out, _ := run("seed", "--email", "demo@example.com")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, "already exists")
+
+		code, out, _ = run("notes", "export", "--user", "demo@example.com")
+		assert.Equal(t, 0, code)
+
+		export := Export{}
+		assert.Nil(t, json.Unmarshal([]byte(out), &export))
+		assert.Equal(t, "demo@example.com", export.User.Email)
+		assert.Len(t, export.Notes, 7)
+	})
+
+	t.Run("notes_export_of_an_unknown_user", func(t *testing.T) {
+		code, _, errOut := run("notes", "export", "--user", "nobody@example.com")
+		assert.Equal(t, 1, code)
+		assert.Contains(t, errOut, "not found")
+	})
+}
@@ -0,0 +1,30 @@
+package cli
+
+var configCmd = &Command{
+	Name:    "config",
+	Summary: "Inspect the configuration.",
+	Subcommands: []*Command{
+		{Name: "print", Summary: "Print the loaded config as yaml followed by any validation errors.", Run: configPrint},
+	},
+}
+
+func configPrint(env *Env, args []string) error {
+	fs := newFlagSet(env, "config print", "")
+	redacted := fs.Bool("redacted", false, "hide secrets")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *redacted {
+		cfg = cfg.Redacted()
+	}
+
+	out, err := cfg.YAML()
+	if err != nil {
+		return err
+	}
+	env.Stdout.Write(out)
+
+	return cfg.Validate()
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/msal4/toastnotes/migrations"
+	"github.com/msal4/toastnotes/models"
+)
+
+var migrateCmd = &Command{
+	Name:    "migrate",
+	Summary: "Manage the database schema migrations.",
+	Subcommands: []*Command{
+		{Name: "up", Summary: "Apply all the pending migrations.", Run: migrateUp},
+		{Name: "down", Args: "[steps]", Summary: "Roll back the latest migrations (1 by default).", Run: migrateDown},
+		{Name: "status", Summary: "List the migrations and when they were applied.", Run: migrateStatus},
+		{Name: "create", Args: "<name>", Summary: "Create empty up and down files for a new migration.", Run: migrateCreate},
+	},
+}
+
+// openMigrator loads the config and creates a migrator connected to its database, close must be called when done.
+func openMigrator(env *Env, name, synopsis string, args []string) (m *migrations.Migrator, close func(), err error) {
+	fs := newFlagSet(env, name, synopsis)
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err = migrations.New(sqlDB, models.Dialect(db))
+	if err != nil {
+		sqlDB.Close()
+		return nil, nil, err
+	}
+
+	return m, func() { sqlDB.Close() }, nil
+}
+
+func printMigrations(env *Env, action string, done []migrations.Migration) {
+	for _, m := range done {
+		fmt.Fprintf(env.Stdout, "%s %04d_%s\n", action, m.Version, m.Name)
+	}
+}
+
+func migrateUp(env *Env, args []string) error {
+	migrator, close, err := openMigrator(env, "migrate up", "", args)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	done, err := migrator.Up(context.Background())
+	printMigrations(env, "up", done)
+	return err
+}
+
+func migrateDown(env *Env, args []string) error {
+	steps := 1
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return usageErrorf("migrate down: steps must be a positive number, got %q", args[0])
+		}
+		steps, args = n, args[1:]
+	}
+
+	migrator, close, err := openMigrator(env, "migrate down", "[steps]", args)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	done, err := migrator.Down(context.Background(), steps)
+	printMigrations(env, "down", done)
+	return err
+}
+
+func migrateStatus(env *Env, args []string) error {
+	migrator, close, err := openMigrator(env, "migrate status", "", args)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+func migrateCreate(env *Env, args []string) error {
+	fs := newFlagSet(env, "migrate create", "<name>")
+	dir := fs.String("dir", "", "the migrations directory (default "+migrations.Dir+" and "+migrations.SQLiteDir+")")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &UsageError{msg: err.Error()}
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("migrate create: expected a migration name")
+	}
+
+	// the migrations are created for both dialects unless a directory is given.
+	dirs := []string{migrations.Dir, migrations.SQLiteDir}
+	if *dir != "" {
+		dirs = []string{*dir}
+	}
+	for _, d := range dirs {
+		up, down, err := migrations.Create(d, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "created %s\ncreated %s\n", up, down)
+	}
+	return nil
+}
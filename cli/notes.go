@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/msal4/toastnotes/models"
+)
+
+var notesCmd = &Command{
+	Name:    "notes",
+	Summary: "Manage the user notes.",
+	Subcommands: []*Command{
+		{Name: "export", Summary: "Export the notes of a user as json.", Run: notesExport},
+	},
+}
+
+// Export is the notes export file format.
+type Export struct {
+	User       *models.User  `json:"user"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	Notes      []models.Note `json:"notes"`
+}
+
+func notesExport(env *Env, args []string) error {
+	fs := newFlagSet(env, "notes export", "")
+	key := fs.String("user", "", "the email or id of the user")
+	output := fs.String("output", "", "the file to write the export to, it's written to stdout if empty")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *key == "" {
+		fs.Usage()
+		return usageErrorf("notes export: --user is required")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	user, err := findUser(models.NewUserRepository(db), *key)
+	if err != nil {
+		return err
+	}
+
+	notes, err := models.NewNoteRepository(db).ListForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = env.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Export{User: user, ExportedAt: time.Now().UTC(), Notes: notes})
+}
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/controllers"
+	"github.com/msal4/toastnotes/events"
+	"github.com/msal4/toastnotes/health"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/mail"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/migrations"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/reminder"
+	"github.com/msal4/toastnotes/rpc"
+	"github.com/msal4/toastnotes/server"
+	"github.com/msal4/toastnotes/tracing"
+	"github.com/msal4/toastnotes/tus"
+	"github.com/msal4/toastnotes/validation"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var serveCmd = &Command{
+	Name:    "serve",
+	Summary: "Start the api server (the default command).",
+	Run:     serve,
+}
+
+func serve(env *Env, args []string) error {
+	cfg, err := loadConfig(newFlagSet(env, "serve", ""), args)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return &UsageError{msg: err.Error()}
+	}
+
+	setupLogger(cfg.Log)
+	validation.UseJSONFieldNames()
+	mail.DefaultMailer = mail.New(cfg.Mail)
+
+	// connect to db
+	db, err := models.OpenConnection(cfg.Database.URL, nil)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if err := checkMigrations(db, cfg.Database.RequireMigrations); err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("refusing to start: %w", err)
+	}
+
+	// metrics
+	m := metrics.New()
+	if cfg.Metrics.Enabled {
+		if err := m.InstrumentDB(db); err != nil {
+			sqlDB.Close()
+			return err
+		}
+	}
+
+	// tracing
+	tp, shutdownTracing, err := tracing.NewProvider(context.Background(), cfg.Tracing, env.Stdout)
+	if err != nil {
+		sqlDB.Close()
+		return err
+	}
+	tracing.Register(tp)
+	if cfg.Tracing.Exporter != tracing.ExporterNone {
+		if err := tracing.InstrumentDB(db, tp); err != nil {
+			sqlDB.Close()
+			return err
+		}
+	}
+
+	// attachments
+	blobs, err := blob.New(cfg.Storage)
+	if err != nil {
+		sqlDB.Close()
+		return err
+	}
+
+	// readiness
+	migrator, err := migrations.New(sqlDB, models.Dialect(db))
+	if err != nil {
+		sqlDB.Close()
+		return err
+	}
+	checker := health.New()
+	checker.Add("database", health.Ping(sqlDB))
+	checker.Add("migrations", health.Migrations(migrator))
+
+	// the note events go through postgres so that the instances get the changes made on each other.
+	var broker events.Broker = events.NewLocal()
+	var listener *events.Postgres
+	if models.Dialect(db) == migrations.Postgres {
+		listener = events.NewPostgres(sqlDB, cfg.Database.URL)
+		broker = listener
+	}
+
+	// router
+	stores := models.NewStores(db)
+	uploads := tus.NewStore(cfg.Storage.UploadDir, cfg.Storage.UploadExpiry)
+	router := controllers.SetupRouter(stores, cfg, controllers.Deps{
+		Checker: checker, Metrics: m, Tracer: tp, Blobs: blobs, Uploads: uploads, Events: broker,
+	})
+
+	// the router publishes the note changes made through it, the ones of the import worker and the grpc api are
+	// published too.
+	published := events.Stores(stores, broker)
+
+	srv := server.New(cfg.Server, router)
+	srv.OnDrain(checker.Drain)
+	// the event streams would keep the server from shutting down, their clients connect to the other instances.
+	srv.OnDrain(broker.Close)
+	srv.OnShutdown("database", func(ctx context.Context) error { return sqlDB.Close() })
+	srv.OnShutdown("tracing", shutdownTracing)
+
+	// workers
+	if listener != nil {
+		srv.Go("note events listener", listener.Listen)
+	}
+	loginLinks := stores.LoginLinks
+	srv.Go("login link cleanup", server.Every(time.Hour, func(ctx context.Context) {
+		if n, err := loginLinks.DeleteExpired(time.Now()); err != nil {
+			log.Error().Err(err).Msg("Failed to delete the expired login links")
+		} else if n > 0 {
+			log.Debug().Int64("count", n).Msg("Deleted the expired login links")
+		}
+	}))
+	srv.Go("upload cleanup", server.Every(time.Hour, func(ctx context.Context) {
+		if n, err := uploads.DeleteExpired(time.Now()); err != nil {
+			log.Error().Err(err).Msg("Failed to delete the expired uploads")
+		} else if n > 0 {
+			log.Debug().Int("count", n).Msg("Deleted the expired uploads")
+		}
+	}))
+
+	if cfg.Reminders.Scheduler {
+		scheduler := reminder.NewScheduler(stores.Reminders, map[string]reminder.Channel{
+			models.ChannelEmail:   &reminder.Email{Mailer: mail.DefaultMailer},
+			models.ChannelWebhook: reminder.NewWebhook(cfg.Reminders),
+		})
+		srv.Go("reminder scheduler", server.Every(cfg.Reminders.Interval, func(ctx context.Context) {
+			if n := scheduler.Run(ctx); n > 0 {
+				log.Debug().Int("count", n).Msg("Delivered the due reminders")
+			}
+		}))
+	}
+
+	if cfg.Imports.Worker {
+		worker := importer.NewWorker(published, blobs, models.NewQuotas(cfg.Quota), int64(cfg.Storage.MaxAttachmentSize))
+		srv.Go("import worker", server.Every(cfg.Imports.Interval, func(ctx context.Context) {
+			if n := worker.Run(ctx); n > 0 {
+				log.Debug().Int("count", n).Msg("Finished the pending imports")
+			}
+		}))
+	}
+
+	// the grpc api, it's stopped gracefully with the workers and forcefully if that takes longer than the timeout.
+	if cfg.GRPC.Addr != "" {
+		ln, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			sqlDB.Close()
+			return err
+		}
+		grpcSrv := rpc.New(published, cfg, m, log.Logger)
+		srv.Go("grpc server", func(ctx context.Context) {
+			go func() {
+				<-ctx.Done()
+				grpcSrv.GracefulStop()
+			}()
+			log.Info().Str("addr", ln.Addr().String()).Msg("gRPC server started")
+			if err := grpcSrv.Serve(ln); err != nil {
+				log.Error().Err(err).Msg("The gRPC server failed")
+			}
+		})
+		srv.OnShutdown("grpc", func(ctx context.Context) error {
+			grpcSrv.Stop()
+			return nil
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// the metrics admin server
+	var adminDone chan error
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle(cfg.Metrics.Path, m.Handler())
+		admin := server.New(cfg.Server, mux)
+		admin.HTTP.Addr = cfg.Metrics.Addr
+
+		ln, err := net.Listen("tcp", admin.HTTP.Addr)
+		if err != nil {
+			sqlDB.Close()
+			return err
+		}
+		adminDone = make(chan error, 1)
+		go func() { adminDone <- admin.Serve(ctx, ln) }()
+	}
+
+	err = srv.ListenAndServe(ctx)
+	stop()
+	if adminDone != nil {
+		err = errors.Join(err, <-adminDone)
+	}
+	return err
+}
+
+// checkMigrations logs the pending migrations and returns an error if there are any and they're required.
+func checkMigrations(db *gorm.DB, required bool) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(sqlDB, models.Dialect(db))
+	if err != nil {
+		return err
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if required {
+		return fmt.Errorf("%d pending migrations, run `toastnotes migrate up` first", len(pending))
+	}
+	log.Warn().Int("count", len(pending)).Msg("There are pending migrations, run `toastnotes migrate up`")
+	return nil
+}
+
+func setupLogger(cfg config.Log) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+
+	if cfg.Format == "json" {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		return
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/validation"
+	"gorm.io/gorm"
+)
+
+var userCmd = &Command{
+	Name:    "user",
+	Summary: "Manage the user accounts.",
+	Subcommands: []*Command{
+		{Name: "create", Summary: "Create a user, a password is generated when --password is not set.", Run: userCreate},
+		{Name: "disable", Summary: "Disable a user and revoke their sessions.", Run: userDisable},
+		{Name: "enable", Summary: "Re-enable a disabled user.", Run: userEnable},
+		{Name: "reset-password", Summary: "Reset a user password and revoke their sessions.", Run: userResetPassword},
+		{Name: "plan", Summary: "Put a user on one of the configured quota plans, an empty --plan is the default quota.", Run: userPlan},
+	},
+}
+
+// validate validates obj using the same rules as the api forms.
+func validate(obj interface{}) error {
+	validation.UseJSONFieldNames()
+
+	err := binding.Validator.ValidateStruct(obj)
+	var verr validator.ValidationErrors
+	if !errors.As(err, &verr) {
+		return err
+	}
+
+	problems := []string{}
+	for _, e := range validation.DescriptiveErrors(verr) {
+		problems = append(problems, fmt.Sprintf("invalid %s (%s)", e.Field, e.Reason))
+	}
+	return usageErrorf("%s", strings.Join(problems, ", "))
+}
+
+// findUser finds the user with the given email or id.
+func findUser(repo *models.UserRepository, key string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if strings.Contains(key, "@") {
+		user, err = repo.FindByEmail(key)
+	} else {
+		user, err = repo.RetrieveUser(key)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %q not found", key)
+	}
+	return user, err
+}
+
+// passwordOrGenerated returns the password or a new random one if it's empty.
+func passwordOrGenerated(password string) (string, bool, error) {
+	if password != "" {
+		return password, false, nil
+	}
+
+	password, err := auth.GenerateSecureToken()
+	return password, true, err
+}
+
+// flagSetup registers command specific flags.
+type flagSetup func(fs *flag.FlagSet)
+
+// withUser loads the config with the --email flag, opens the db and calls fn with the config, the user repository
+// and the user with the given email.
+func withUser(env *Env, name string, setup flagSetup, args []string, fn func(cfg *config.Config, repo *models.UserRepository, user *models.User) error) error {
+	flags := newFlagSet(env, name, "")
+	email := flags.String("email", "", "the user email or id")
+	if setup != nil {
+		setup(flags)
+	}
+
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if *email == "" {
+		flags.Usage()
+		return usageErrorf("%s: --email is required", name)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	repo := models.NewUserRepository(db)
+	user, err := findUser(repo, *email)
+	if err != nil {
+		return err
+	}
+
+	return fn(cfg, repo, user)
+}
+
+func userCreate(env *Env, args []string) error {
+	fs := newFlagSet(env, "user create", "")
+	form := auth.RegisterForm{}
+	fs.StringVar(&form.Email, "email", "", "the user email")
+	fs.StringVar(&form.Name, "name", "", "the user name")
+	fs.StringVar(&form.Password, "password", "", "the user password, a random one is generated and printed if empty")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var generated bool
+	if form.Password, generated, err = passwordOrGenerated(form.Password); err != nil {
+		return err
+	}
+	if err := validate(&form); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	repo := models.NewUserRepository(db)
+	if repo.EmailTaken(form.Email) {
+		return fmt.Errorf("a user with the email %q already exists", form.Email)
+	}
+
+	user, err := repo.RegisterUser(form)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "created user %s (%s)\n", user.Email, user.ID)
+	if generated {
+		fmt.Fprintf(env.Stdout, "generated password: %s\n", form.Password)
+	}
+	return nil
+}
+
+func userDisable(env *Env, args []string) error {
+	return withUser(env, "user disable", nil, args, func(_ *config.Config, repo *models.UserRepository, user *models.User) error {
+		if user.Disabled() {
+			fmt.Fprintf(env.Stdout, "user %s is already disabled\n", user.Email)
+			return nil
+		}
+		if err := repo.SetDisabled(user, true); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "disabled user %s\n", user.Email)
+		return nil
+	})
+}
+
+func userEnable(env *Env, args []string) error {
+	return withUser(env, "user enable", nil, args, func(_ *config.Config, repo *models.UserRepository, user *models.User) error {
+		if err := repo.SetDisabled(user, false); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "enabled user %s\n", user.Email)
+		return nil
+	})
+}
+
+func userResetPassword(env *Env, args []string) error {
+	var password string
+	setup := func(fs *flag.FlagSet) {
+		fs.StringVar(&password, "password", "", "the new password, a random one is generated and printed if empty")
+	}
+
+	return withUser(env, "user reset-password", setup, args, func(_ *config.Config, repo *models.UserRepository, user *models.User) error {
+		password, generated, err := passwordOrGenerated(password)
+		if err != nil {
+			return err
+		}
+		if err := validate(&auth.Credentials{Email: user.Email, Password: password}); err != nil {
+			return err
+		}
+		if err := repo.SetPassword(user, password); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "reset the password of user %s\n", user.Email)
+		if generated {
+			fmt.Fprintf(env.Stdout, "generated password: %s\n", password)
+		}
+		return nil
+	})
+}
+
+func userPlan(env *Env, args []string) error {
+	var plan string
+	setup := func(fs *flag.FlagSet) {
+		fs.StringVar(&plan, "plan", "", "the quota plan, one of the quota.plans of the config")
+	}
+
+	return withUser(env, "user plan", setup, args, func(cfg *config.Config, repo *models.UserRepository, user *models.User) error {
+		if _, ok := cfg.Quota.Plans[plan]; plan != "" && !ok {
+			return usageErrorf("user plan: unknown plan %q", plan)
+		}
+		if err := repo.SetPlan(user, plan); err != nil {
+			return err
+		}
+
+		if plan == "" {
+			fmt.Fprintf(env.Stdout, "put user %s on the default quota\n", user.Email)
+		} else {
+			fmt.Fprintf(env.Stdout, "put user %s on the %s plan\n", user.Email, plan)
+		}
+		return nil
+	})
+}
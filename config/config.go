@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the app configuration. Every field can be set from the config file using its yaml/toml key, from the
+// environment variable in its env tag and from the command line flag in its flag tag.
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	CORS       CORS       `yaml:"cors" toml:"cors"`
+	Pagination Pagination `yaml:"pagination" toml:"pagination"`
+	Mail       Mail       `yaml:"mail" toml:"mail"`
+	WebAuthn   WebAuthn   `yaml:"webauthn" toml:"webauthn"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Metrics    Metrics    `yaml:"metrics" toml:"metrics"`
+	Tracing    Tracing    `yaml:"tracing" toml:"tracing"`
+	GraphQL    GraphQL    `yaml:"graphql" toml:"graphql"`
+	GRPC       GRPC       `yaml:"grpc" toml:"grpc"`
+	Storage    Storage    `yaml:"storage" toml:"storage"`
+	Quota      Quota      `yaml:"quota" toml:"quota"`
+	Reminders  Reminders  `yaml:"reminders" toml:"reminders"`
+	Imports    Imports    `yaml:"imports" toml:"imports"`
+}
+
+// Server holds the http server settings.
+type Server struct {
+	Host      string `yaml:"host" toml:"host" env:"HOST" flag:"host" usage:"the host the server listens on"`
+	Port      int    `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"the port the server listens on"`
+	PublicURL string `yaml:"publicUrl" toml:"publicUrl" env:"PUBLIC_URL" flag:"public-url" usage:"the public url of the api used in emailed links"`
+
+	ReadTimeout       time.Duration `yaml:"readTimeout" toml:"readTimeout" env:"READ_TIMEOUT" flag:"read-timeout" usage:"the maximum duration for reading a request including the body"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT" flag:"read-header-timeout" usage:"the maximum duration for reading the request headers"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"WRITE_TIMEOUT" flag:"write-timeout" usage:"the maximum duration before timing out writing the response"`
+	TransferTimeout   time.Duration `yaml:"transferTimeout" toml:"transferTimeout" env:"TRANSFER_TIMEOUT" flag:"transfer-timeout" usage:"the maximum duration of the file uploads and downloads, they outlive the read and write timeouts"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" toml:"idleTimeout" env:"IDLE_TIMEOUT" flag:"idle-timeout" usage:"how long idle keep-alive connections are kept open"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes" toml:"maxHeaderBytes" env:"MAX_HEADER_BYTES" flag:"max-header-bytes" usage:"the maximum size of the request headers in bytes"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"how long to wait for in-flight requests and workers on shutdown"`
+	DrainDelay        time.Duration `yaml:"drainDelay" toml:"drainDelay" env:"DRAIN_DELAY" flag:"drain-delay" usage:"how long to keep serving with a failing readiness probe before shutting down"`
+}
+
+// Database holds the database settings.
+type Database struct {
+	URL               string `yaml:"url" toml:"url" env:"DATABASE_URL" flag:"database-url" usage:"the database connection url, postgres://... or sqlite://<path>" secret:"url"`
+	RequireMigrations bool   `yaml:"requireMigrations" toml:"requireMigrations" env:"REQUIRE_MIGRATIONS" flag:"require-migrations" usage:"refuse to start the server when there are pending migrations"`
+}
+
+// Auth holds the authentication settings.
+type Auth struct {
+	JWTSecret          string        `yaml:"jwtSecret" toml:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenAge     time.Duration `yaml:"accessTokenAge" toml:"accessTokenAge" env:"ACCESS_TOKEN_AGE" flag:"access-token-age" usage:"how long access tokens are valid"`
+	RefreshTokenAge    time.Duration `yaml:"refreshTokenAge" toml:"refreshTokenAge" env:"REFRESH_TOKEN_AGE" flag:"refresh-token-age" usage:"how long refresh tokens are valid"`
+	AccessTokenCookie  string        `yaml:"accessTokenCookie" toml:"accessTokenCookie" env:"ACCESS_TOKEN_COOKIE" flag:"access-token-cookie" usage:"the name of the access token cookie"`
+	RefreshTokenCookie string        `yaml:"refreshTokenCookie" toml:"refreshTokenCookie" env:"REFRESH_TOKEN_COOKIE" flag:"refresh-token-cookie" usage:"the name of the refresh token cookie"`
+	LoginLinkAge       time.Duration `yaml:"loginLinkAge" toml:"loginLinkAge" env:"LOGIN_LINK_AGE" flag:"login-link-age" usage:"how long passwordless login links are valid"`
+	MaxLoginLinks      int           `yaml:"maxLoginLinks" toml:"maxLoginLinks" env:"MAX_LOGIN_LINKS" flag:"max-login-links" usage:"login links a user can request within the link age"`
+	LoginLinkIPRate    int           `yaml:"loginLinkIpRate" toml:"loginLinkIpRate" env:"LOGIN_LINK_IP_RATE" flag:"login-link-ip-rate" usage:"login link requests per client ip per minute"`
+}
+
+// CORS holds the Cross-Origin Resource Sharing settings.
+type CORS struct {
+	AllowOrigins []string `yaml:"allowOrigins" toml:"allowOrigins" env:"ALLOW_ORIGINS" flag:"allow-origins" usage:"comma separated allowed origins, all origins are allowed if empty or \"*\""`
+}
+
+// Pagination holds the pagination settings.
+type Pagination struct {
+	PageSize    int `yaml:"pageSize" toml:"pageSize" env:"PAGE_SIZE" flag:"page-size" usage:"the default page size"`
+	MaxPageSize int `yaml:"maxPageSize" toml:"maxPageSize" env:"MAX_PAGE_SIZE" flag:"max-page-size" usage:"the maximum page size a client can request"`
+}
+
+// Mail holds the smtp settings, emails are logged when SMTPAddr is empty.
+type Mail struct {
+	SMTPAddr string `yaml:"smtpAddr" toml:"smtpAddr" env:"SMTP_ADDR" flag:"smtp-addr" usage:"the smtp server address (host:port)"`
+	From     string `yaml:"from" toml:"from" env:"SMTP_FROM" flag:"smtp-from" usage:"the sender email address"`
+	Username string `yaml:"username" toml:"username" env:"SMTP_USERNAME" flag:"smtp-username" usage:"the smtp username"`
+	Password string `yaml:"password" toml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// WebAuthn holds the passkeys relying party settings.
+type WebAuthn struct {
+	RPID    string   `yaml:"rpId" toml:"rpId" env:"WEBAUTHN_RP_ID" flag:"webauthn-rp-id" usage:"the passkeys relying party id (the api domain)"`
+	Origins []string `yaml:"origins" toml:"origins" env:"WEBAUTHN_ORIGINS" flag:"webauthn-origins" usage:"comma separated origins allowed to use passkeys"`
+}
+
+// Log holds the logging settings.
+type Log struct {
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"the log output format (console or json)"`
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"the minimum log level (debug, info, warn or error)"`
+}
+
+// Metrics holds the prometheus metrics settings, they're served on the loopback admin address by default so that they
+// aren't public.
+type Metrics struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED" flag:"metrics" usage:"record and serve the prometheus metrics"`
+	Path    string `yaml:"path" toml:"path" env:"METRICS_PATH" flag:"metrics-path" usage:"the path the metrics are served at"`
+	Addr    string `yaml:"addr" toml:"addr" env:"METRICS_ADDR" flag:"metrics-addr" usage:"the admin address (host:port) the metrics are served on, empty serves them on the public api"`
+}
+
+// Tracing holds the OpenTelemetry tracing settings.
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"the spans exporter (none, stdout or otlp)"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint" usage:"the otlp http endpoint url, the OTEL_EXPORTER_OTLP_* variables are used if empty"`
+}
+
+// GraphQL holds the graphql endpoint limits.
+type GraphQL struct {
+	MaxDepth      int `yaml:"maxDepth" toml:"maxDepth" env:"GRAPHQL_MAX_DEPTH" flag:"graphql-max-depth" usage:"the maximum selection depth of a graphql query"`
+	MaxComplexity int `yaml:"maxComplexity" toml:"maxComplexity" env:"GRAPHQL_MAX_COMPLEXITY" flag:"graphql-max-complexity" usage:"the maximum complexity of a graphql query, each field costs 1 and list fields multiply by their page size"`
+}
+
+// GRPC holds the grpc server settings.
+type GRPC struct {
+	Addr string `yaml:"addr" toml:"addr" env:"GRPC_ADDR" flag:"grpc-addr" usage:"serve the grpc api on this address (host:port), it's disabled if empty"`
+}
+
+// Storage holds the attachments storage settings.
+type Storage struct {
+	Backend           string `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND" flag:"storage-backend" usage:"where the attachments are stored (local or s3)"`
+	Dir               string `yaml:"dir" toml:"dir" env:"STORAGE_DIR" flag:"storage-dir" usage:"the directory the local backend stores the attachments in"`
+	MaxAttachmentSize int    `yaml:"maxAttachmentSize" toml:"maxAttachmentSize" env:"MAX_ATTACHMENT_SIZE" flag:"max-attachment-size" usage:"the maximum size of an attachment in bytes"`
+
+	UploadDir    string        `yaml:"uploadDir" toml:"uploadDir" env:"UPLOAD_DIR" flag:"upload-dir" usage:"the directory the partial resumable uploads are kept in"`
+	UploadExpiry time.Duration `yaml:"uploadExpiry" toml:"uploadExpiry" env:"UPLOAD_EXPIRY" flag:"upload-expiry" usage:"how long an unfinished resumable upload is kept after it was last resumed"`
+
+	S3Endpoint  string `yaml:"s3Endpoint" toml:"s3Endpoint" env:"S3_ENDPOINT" flag:"s3-endpoint" usage:"the s3 endpoint url, the AWS endpoint of the region is used if empty"`
+	S3Region    string `yaml:"s3Region" toml:"s3Region" env:"S3_REGION" flag:"s3-region" usage:"the s3 region"`
+	S3Bucket    string `yaml:"s3Bucket" toml:"s3Bucket" env:"S3_BUCKET" flag:"s3-bucket" usage:"the s3 bucket the attachments are stored in"`
+	S3AccessKey string `yaml:"s3AccessKey" toml:"s3AccessKey" env:"S3_ACCESS_KEY" flag:"s3-access-key" usage:"the s3 access key id"`
+	S3SecretKey string `yaml:"s3SecretKey" toml:"s3SecretKey" env:"S3_SECRET_KEY" secret:"true"`
+	S3PathStyle bool   `yaml:"s3PathStyle" toml:"s3PathStyle" env:"S3_PATH_STYLE" flag:"s3-path-style" usage:"address the bucket in the url path instead of the host name (needed by most self hosted servers)"`
+}
+
+// Quota holds the limits of what each user can store, 0 is unlimited. The users on one of the plans get its limits
+// instead, the plans are only set in the config file.
+type Quota struct {
+	MaxNotes           int `yaml:"maxNotes" toml:"maxNotes" env:"QUOTA_MAX_NOTES" flag:"quota-max-notes" usage:"the maximum number of notes of a user, 0 is unlimited"`
+	MaxContentBytes    int `yaml:"maxContentBytes" toml:"maxContentBytes" env:"QUOTA_MAX_CONTENT_BYTES" flag:"quota-max-content-bytes" usage:"the maximum total size of the titles and contents of the notes of a user in bytes, 0 is unlimited"`
+	MaxAttachmentBytes int `yaml:"maxAttachmentBytes" toml:"maxAttachmentBytes" env:"QUOTA_MAX_ATTACHMENT_BYTES" flag:"quota-max-attachment-bytes" usage:"the maximum total size of the attachments of a user in bytes, 0 is unlimited"`
+	MaxNoteSize        int `yaml:"maxNoteSize" toml:"maxNoteSize" env:"QUOTA_MAX_NOTE_SIZE" flag:"quota-max-note-size" usage:"the maximum size of the title and content of a note in bytes, 0 is unlimited"`
+
+	Plans map[string]QuotaPlan `yaml:"plans" toml:"plans"`
+}
+
+// QuotaPlan holds the limits of a named plan, 0 is unlimited.
+type QuotaPlan struct {
+	MaxNotes           int `yaml:"maxNotes" toml:"maxNotes"`
+	MaxContentBytes    int `yaml:"maxContentBytes" toml:"maxContentBytes"`
+	MaxAttachmentBytes int `yaml:"maxAttachmentBytes" toml:"maxAttachmentBytes"`
+	MaxNoteSize        int `yaml:"maxNoteSize" toml:"maxNoteSize"`
+}
+
+// Reminders holds the reminders scheduler and delivery settings.
+type Reminders struct {
+	Scheduler           bool          `yaml:"scheduler" toml:"scheduler" env:"REMINDER_SCHEDULER" flag:"reminder-scheduler" usage:"deliver the due reminders from this instance, any number of instances can"`
+	Interval            time.Duration `yaml:"interval" toml:"interval" env:"REMINDER_INTERVAL" flag:"reminder-interval" usage:"how often the scheduler looks for due reminders"`
+	WebhookTimeout      time.Duration `yaml:"webhookTimeout" toml:"webhookTimeout" env:"REMINDER_WEBHOOK_TIMEOUT" flag:"reminder-webhook-timeout" usage:"the timeout of the reminder webhook requests"`
+	WebhookSecret       string        `yaml:"webhookSecret" toml:"webhookSecret" env:"REMINDER_WEBHOOK_SECRET" secret:"true"`
+	WebhookAllowPrivate bool          `yaml:"webhookAllowPrivate" toml:"webhookAllowPrivate" env:"REMINDER_WEBHOOK_ALLOW_PRIVATE" flag:"reminder-webhook-allow-private" usage:"allow the reminder webhooks to private and loopback addresses"`
+}
+
+// Imports holds the note imports settings.
+type Imports struct {
+	Worker   bool          `yaml:"worker" toml:"worker" env:"IMPORT_WORKER" flag:"import-worker" usage:"run the pending imports from this instance, any number of instances can"`
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"IMPORT_INTERVAL" flag:"import-interval" usage:"how often the worker looks for pending imports"`
+	MaxSize  int           `yaml:"maxSize" toml:"maxSize" env:"MAX_IMPORT_SIZE" flag:"max-import-size" usage:"the maximum size of an uploaded export in bytes"`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              8080,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			TransferTimeout:   10 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20, // 1 MB
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenAge:     5 * time.Minute,
+			RefreshTokenAge:    730 * time.Hour, // = 1 month
+			AccessTokenCookie:  "seele",
+			RefreshTokenCookie: "herz",
+			LoginLinkAge:       15 * time.Minute,
+			MaxLoginLinks:      3,
+			LoginLinkIPRate:    10,
+		},
+		Pagination: Pagination{
+			PageSize:    20,  // default pagination size
+			MaxPageSize: 100, // 100 seems like a reasonable number, its not too high and not too low.
+		},
+		WebAuthn: WebAuthn{
+			RPID:    "localhost",
+			Origins: []string{"http://localhost:3000"},
+		},
+		Log:     Log{Format: "console", Level: "info"},
+		Metrics: Metrics{Enabled: true, Path: "/metrics", Addr: "127.0.0.1:9090"},
+		Tracing: Tracing{Exporter: "none"},
+		GraphQL: GraphQL{MaxDepth: 8, MaxComplexity: 2000},
+		Storage: Storage{
+			Backend:           "local",
+			Dir:               "data/attachments",
+			MaxAttachmentSize: 25 << 20, // 25 MB
+			UploadDir:         "data/uploads",
+			UploadExpiry:      24 * time.Hour,
+			S3Region:          "us-east-1",
+		},
+		Quota: Quota{
+			MaxNotes:           10000,
+			MaxContentBytes:    100 << 20, // 100 MB
+			MaxAttachmentBytes: 1 << 30,   // 1 GB
+			MaxNoteSize:        1 << 20,   // 1 MB
+		},
+		Reminders: Reminders{
+			Scheduler:      true,
+			Interval:       30 * time.Second,
+			WebhookTimeout: 10 * time.Second,
+		},
+		Imports: Imports{
+			Worker:   true,
+			Interval: 5 * time.Second,
+			MaxSize:  512 << 20, // 512 MB
+		},
+	}
+}
+
+// ValidationError lists all the problems found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration and returns a *ValidationError describing every invalid setting.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, a...))
+		}
+	}
+
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "server.port must be between 1 and 65535 (PORT, --port), got %d", cfg.Server.Port)
+	if cfg.Server.PublicURL != "" {
+		u, err := url.Parse(cfg.Server.PublicURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "server.publicUrl must be an absolute url (PUBLIC_URL, --public-url)")
+	}
+
+	check(cfg.Server.ReadTimeout > 0, "server.readTimeout must be positive (READ_TIMEOUT, --read-timeout)")
+	check(cfg.Server.ReadHeaderTimeout > 0, "server.readHeaderTimeout must be positive (READ_HEADER_TIMEOUT, --read-header-timeout)")
+	check(cfg.Server.WriteTimeout > 0, "server.writeTimeout must be positive (WRITE_TIMEOUT, --write-timeout)")
+	check(cfg.Server.TransferTimeout > 0, "server.transferTimeout must be positive (TRANSFER_TIMEOUT, --transfer-timeout)")
+	check(cfg.Server.IdleTimeout > 0, "server.idleTimeout must be positive (IDLE_TIMEOUT, --idle-timeout)")
+	check(cfg.Server.MaxHeaderBytes >= 4096, "server.maxHeaderBytes must be at least 4096 (MAX_HEADER_BYTES, --max-header-bytes)")
+	check(cfg.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive (SHUTDOWN_TIMEOUT, --shutdown-timeout)")
+	check(cfg.Server.DrainDelay >= 0, "server.drainDelay must not be negative (DRAIN_DELAY, --drain-delay)")
+
+	check(cfg.Database.URL != "", "database.url is required (DATABASE_URL, --database-url)")
+	if cfg.Database.URL != "" {
+		scheme, _, _ := strings.Cut(cfg.Database.URL, ":")
+		switch strings.ToLower(scheme) {
+		case "postgres", "postgresql", "sqlite":
+		default:
+			check(false, "database.url must be a postgres:// or sqlite:// url (DATABASE_URL, --database-url)")
+		}
+	}
+
+	check(cfg.Auth.JWTSecret != "", "auth.jwtSecret is required (JWT_SECRET)")
+	check(cfg.Auth.AccessTokenAge > 0, "auth.accessTokenAge must be positive (ACCESS_TOKEN_AGE, --access-token-age)")
+	check(cfg.Auth.RefreshTokenAge > cfg.Auth.AccessTokenAge, "auth.refreshTokenAge must be longer than auth.accessTokenAge (REFRESH_TOKEN_AGE, --refresh-token-age)")
+	check(cfg.Auth.AccessTokenCookie != "", "auth.accessTokenCookie is required (ACCESS_TOKEN_COOKIE, --access-token-cookie)")
+	check(cfg.Auth.RefreshTokenCookie != "", "auth.refreshTokenCookie is required (REFRESH_TOKEN_COOKIE, --refresh-token-cookie)")
+	check(cfg.Auth.AccessTokenCookie != cfg.Auth.RefreshTokenCookie, "auth.accessTokenCookie and auth.refreshTokenCookie must be different")
+	check(cfg.Auth.LoginLinkAge > 0, "auth.loginLinkAge must be positive (LOGIN_LINK_AGE, --login-link-age)")
+	check(cfg.Auth.MaxLoginLinks > 0, "auth.maxLoginLinks must be positive (MAX_LOGIN_LINKS, --max-login-links)")
+	check(cfg.Auth.LoginLinkIPRate > 0, "auth.loginLinkIpRate must be positive (LOGIN_LINK_IP_RATE, --login-link-ip-rate)")
+
+	check(cfg.Pagination.PageSize > 0, "pagination.pageSize must be positive (PAGE_SIZE, --page-size)")
+	check(cfg.Pagination.MaxPageSize >= cfg.Pagination.PageSize, "pagination.maxPageSize must not be less than pagination.pageSize (MAX_PAGE_SIZE, --max-page-size)")
+
+	if cfg.Mail.SMTPAddr != "" {
+		check(cfg.Mail.From != "", "mail.from is required when mail.smtpAddr is set (SMTP_FROM, --smtp-from)")
+	}
+
+	check(cfg.WebAuthn.RPID != "", "webauthn.rpId is required (WEBAUTHN_RP_ID, --webauthn-rp-id)")
+	check(len(cfg.WebAuthn.Origins) > 0, "webauthn.origins is required (WEBAUTHN_ORIGINS, --webauthn-origins)")
+
+	check(cfg.Log.Format == "console" || cfg.Log.Format == "json", "log.format must be \"console\" or \"json\" (LOG_FORMAT, --log-format), got %q", cfg.Log.Format)
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be one of debug, info, warn or error (LOG_LEVEL, --log-level), got %q", cfg.Log.Level)
+	}
+
+	check(strings.HasPrefix(cfg.Metrics.Path, "/"), "metrics.path must start with a / (METRICS_PATH, --metrics-path)")
+	if cfg.Metrics.Addr != "" {
+		_, _, err := net.SplitHostPort(cfg.Metrics.Addr)
+		check(err == nil, "metrics.addr must be a host:port address (METRICS_ADDR, --metrics-addr)")
+		check(cfg.Metrics.Addr != cfg.Server.Addr(), "metrics.addr must be different from the server address")
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter must be one of none, stdout or otlp (TRACING_EXPORTER, --tracing-exporter), got %q", cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.Endpoint != "" {
+		u, err := url.Parse(cfg.Tracing.Endpoint)
+		check(err == nil && u.Scheme != "" && u.Host != "", "tracing.endpoint must be an absolute url (TRACING_ENDPOINT, --tracing-endpoint)")
+	}
+
+	check(cfg.GraphQL.MaxDepth > 0, "graphql.maxDepth must be positive (GRAPHQL_MAX_DEPTH, --graphql-max-depth)")
+	check(cfg.GraphQL.MaxComplexity > 0, "graphql.maxComplexity must be positive (GRAPHQL_MAX_COMPLEXITY, --graphql-max-complexity)")
+
+	if cfg.GRPC.Addr != "" {
+		_, _, err := net.SplitHostPort(cfg.GRPC.Addr)
+		check(err == nil, "grpc.addr must be a host:port address (GRPC_ADDR, --grpc-addr)")
+		check(cfg.GRPC.Addr != cfg.Server.Addr(), "grpc.addr must be different from the server address")
+		check(cfg.GRPC.Addr != cfg.Metrics.Addr, "grpc.addr must be different from metrics.addr")
+	}
+
+	switch cfg.Storage.Backend {
+	case "local":
+		check(cfg.Storage.Dir != "", "storage.dir is required by the local backend (STORAGE_DIR, --storage-dir)")
+	case "s3":
+		check(cfg.Storage.S3Region != "", "storage.s3Region is required by the s3 backend (S3_REGION, --s3-region)")
+		check(cfg.Storage.S3Bucket != "", "storage.s3Bucket is required by the s3 backend (S3_BUCKET, --s3-bucket)")
+		check(cfg.Storage.S3AccessKey != "" && cfg.Storage.S3SecretKey != "", "storage.s3AccessKey and storage.s3SecretKey are required by the s3 backend (S3_ACCESS_KEY, S3_SECRET_KEY)")
+		if cfg.Storage.S3Endpoint != "" {
+			u, err := url.Parse(cfg.Storage.S3Endpoint)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "storage.s3Endpoint must be an http(s) url (S3_ENDPOINT, --s3-endpoint)")
+		}
+	default:
+		check(false, "storage.backend must be local or s3 (STORAGE_BACKEND, --storage-backend), got %q", cfg.Storage.Backend)
+	}
+	check(cfg.Storage.MaxAttachmentSize > 0, "storage.maxAttachmentSize must be positive (MAX_ATTACHMENT_SIZE, --max-attachment-size)")
+	check(cfg.Storage.UploadDir != "", "storage.uploadDir is required (UPLOAD_DIR, --upload-dir)")
+	check(cfg.Storage.UploadExpiry > 0, "storage.uploadExpiry must be positive (UPLOAD_EXPIRY, --upload-expiry)")
+
+	check(cfg.Quota.MaxNotes >= 0, "quota.maxNotes must not be negative (QUOTA_MAX_NOTES, --quota-max-notes)")
+	check(cfg.Quota.MaxContentBytes >= 0, "quota.maxContentBytes must not be negative (QUOTA_MAX_CONTENT_BYTES, --quota-max-content-bytes)")
+	check(cfg.Quota.MaxAttachmentBytes >= 0, "quota.maxAttachmentBytes must not be negative (QUOTA_MAX_ATTACHMENT_BYTES, --quota-max-attachment-bytes)")
+	check(cfg.Quota.MaxNoteSize >= 0, "quota.maxNoteSize must not be negative (QUOTA_MAX_NOTE_SIZE, --quota-max-note-size)")
+	for _, name := range slices.Sorted(maps.Keys(cfg.Quota.Plans)) {
+		plan := cfg.Quota.Plans[name]
+		check(name != "", "quota.plans must not have an empty name")
+		check(plan.MaxNotes >= 0 && plan.MaxContentBytes >= 0 && plan.MaxAttachmentBytes >= 0 && plan.MaxNoteSize >= 0,
+			"quota.plans.%s limits must not be negative", name)
+	}
+
+	check(cfg.Reminders.Interval > 0, "reminders.interval must be positive (REMINDER_INTERVAL, --reminder-interval)")
+	check(cfg.Reminders.WebhookTimeout > 0 && cfg.Reminders.WebhookTimeout <= time.Minute,
+		"reminders.webhookTimeout must be positive and at most a minute (REMINDER_WEBHOOK_TIMEOUT, --reminder-webhook-timeout)")
+
+	check(cfg.Imports.Interval > 0, "imports.interval must be positive (IMPORT_INTERVAL, --import-interval)")
+	check(cfg.Imports.MaxSize > 0, "imports.maxSize must be positive (MAX_IMPORT_SIZE, --max-import-size)")
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (s Server) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// AllowAllOrigins reports whether any origin is allowed.
+func (c CORS) AllowAllOrigins() bool {
+	for _, o := range c.AllowOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return len(c.AllowOrigins) == 0
+}
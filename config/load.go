@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field is a configurable leaf field of the Config struct.
+type field struct {
+	path   string // e.g. "server.port"
+	value  reflect.Value
+	env    string
+	flag   string
+	usage  string
+	secret string
+}
+
+func fields(cfg *Config) []*field {
+	var fs []*field
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			path := prefix + strings.SplitN(sf.Tag.Get("yaml"), ",", 2)[0]
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			fs = append(fs, &field{
+				path:   path,
+				value:  v.Field(i),
+				env:    sf.Tag.Get("env"),
+				flag:   sf.Tag.Get("flag"),
+				usage:  sf.Tag.Get("usage"),
+				secret: sf.Tag.Get("secret"),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+
+	return fs
+}
+
+func (f *field) set(s string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", f.path, s)
+		}
+		f.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s must be a boolean, got %q", f.path, s)
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s must be a duration (e.g. \"15m\"), got %q", f.path, s)
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s has an unsupported type %s", f.path, f.value.Type())
+	}
+	return nil
+}
+
+// flagValue records the raw value of a flag so it can be applied after the file and the environment.
+type flagValue struct {
+	field *field
+	raw   *string
+}
+
+func (v flagValue) String() string {
+	if v.raw == nil || *v.raw == "" {
+		return ""
+	}
+	return *v.raw
+}
+
+func (v flagValue) Set(s string) error {
+	*v.raw = s
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	return v.field != nil && v.field.value.Kind() == reflect.Bool
+}
+
+// Load registers the config flags in fs, parses the args and loads the configuration from the defaults, the config
+// file (--config or CONFIG_FILE), the environment variables and the flags, each overriding the previous one. The
+// remaining positional args are available through fs.Args(). The returned config is not validated.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	cfgFields := fields(cfg)
+
+	configFile := fs.String("config", "", "path to a yaml or toml config file (CONFIG_FILE)")
+	raws := map[string]*string{}
+	for _, f := range cfgFields {
+		if f.flag == "" {
+			continue
+		}
+		raw := new(string)
+		raws[f.flag] = raw
+		fs.Var(flagValue{field: f, raw: raw}, f.flag, f.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range cfgFields {
+		if f.env == "" {
+			continue
+		}
+		if s, ok := os.LookupEnv(f.env); ok && s != "" {
+			if err := f.set(s); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		raw, ok := raws[fl.Name]
+		if !ok || err != nil {
+			return
+		}
+		for _, f := range cfgFields {
+			if f.flag == fl.Name {
+				if e := f.set(*raw); e != nil {
+					err = fmt.Errorf("--%s: %w", fl.Name, e)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config file %s: unknown key %q", path, undecoded[0].String())
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, use a .yaml, .yml or .toml file", path)
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the config with the secrets hidden, secret urls keep everything but the password.
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	for _, f := range fields(&redacted) {
+		s, ok := f.value.Interface().(string)
+		if !ok || s == "" {
+			continue
+		}
+
+		switch f.secret {
+		case "true":
+			f.value.SetString("REDACTED")
+		case "url":
+			u, err := url.Parse(s)
+			if err != nil {
+				f.value.SetString("REDACTED")
+				continue
+			}
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			}
+			f.value.SetString(u.String())
+		}
+	}
+
+	return &redacted
+}
+
+// YAML encodes the config as yaml.
+func (cfg *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
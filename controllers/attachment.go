@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+)
+
+// multipartOverhead is the room left for the multipart boundaries and headers when limiting the upload body size.
+const multipartOverhead = 64 << 10
+
+// AttachmentController is the group of the actions related to the note attachments with their dependencies.
+type AttachmentController struct {
+	Store models.AttachmentStore
+	Notes models.NoteStore
+	Users models.UserStore
+	Usage models.UsageStore
+	Blobs blob.Store
+	// MaxSize is the maximum size of an attachment in bytes.
+	MaxSize int64
+	// Quotas are checked before the files are stored, the store enforces them again when the attachment is created.
+	Quotas models.Quotas
+}
+
+// NewAttachmentController creates a new attachment controller.
+func NewAttachmentController(stores *models.Stores, blobs blob.Store, maxSize int64, quotas models.Quotas) *AttachmentController {
+	return &AttachmentController{
+		Store: stores.Attachments, Notes: stores.Notes, Users: stores.Users, Usage: stores.Usage, Blobs: blobs,
+		MaxSize: maxSize, Quotas: quotas,
+	}
+}
+
+// Upload attaches the file of the multipart "file" field to the note. The mime type is sniffed from the content, the
+// one sent by the client isn't trusted.
+func (ctrl *AttachmentController) Upload(c *gin.Context) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ctrl.MaxSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The file is too large"))
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("The file field is required"))
+		return
+	}
+	if header.Size > ctrl.MaxSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The file is too large"))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		abortWithError(c, err, "Could not read the file")
+		return
+	}
+	defer file.Close()
+
+	att, ok := ctrl.attach(c, note, header.Filename, file, header.Size)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, att)
+}
+
+// attach stores the size bytes of the file and creates its attachment, the mime type is sniffed from the start of the
+// file. It responds with an error and returns false if it fails.
+func (ctrl *AttachmentController) attach(c *gin.Context, note *models.Note, filename string, file io.ReadSeeker, size int64) (*models.Attachment, bool) {
+	if !ctrl.checkQuota(c, note.UserID, size) {
+		return nil, false
+	}
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		abortWithError(c, err, "Could not read the file")
+		return nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		abortWithError(c, err, "Could not read the file")
+		return nil, false
+	}
+
+	att := &models.Attachment{
+		NoteID:   note.ID,
+		UserID:   note.UserID,
+		Filename: utils.SanitizeFilename(filename),
+		MimeType: http.DetectContentType(sniff[:n]),
+		Size:     size,
+	}
+	att.ID = uuid.NewString()
+	att.StorageKey = att.UserID + "/" + att.NoteID + "/" + att.ID
+
+	ctx := c.Request.Context()
+	hash := sha256.New()
+	if err := ctrl.Blobs.Put(ctx, att.StorageKey, io.TeeReader(file, hash), att.Size); err != nil {
+		abortWithError(c, err, "Could not store the file")
+		return nil, false
+	}
+	att.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if err := ctrl.Store.WithContext(ctx).Create(att); err != nil {
+		ctrl.deleteBlob(c, att.StorageKey)
+		if abortWithQuotaError(c, err) {
+			return nil, false
+		}
+		abortWithError(c, err, "Could not create the attachment")
+		return nil, false
+	}
+
+	return att, true
+}
+
+// checkQuota responds with an error and returns false if a file of size bytes doesn't fit in the user quota, so that
+// it's rejected before it's stored.
+func (ctrl *AttachmentController) checkQuota(c *gin.Context, userID string, size int64) bool {
+	_, quota, err := userQuota(c, ctrl.Users, ctrl.Quotas, userID)
+	if err != nil {
+		abortWithError(c, err, "Could not handle your request")
+		return false
+	}
+	usage, err := ctrl.Usage.WithContext(c.Request.Context()).Get(userID)
+	if err != nil {
+		abortWithError(c, err, "Could not handle your request")
+		return false
+	}
+	if err := quota.Check(*usage, models.Usage{AttachmentBytes: size}); err != nil {
+		abortWithQuotaError(c, err)
+		return false
+	}
+	return true
+}
+
+// List lists the note attachments, the oldest first.
+func (ctrl *AttachmentController) List(c *gin.Context) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	atts, err := ctrl.Store.WithContext(c.Request.Context()).ListForNote(note.ID, note.UserID)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve attachments")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": atts})
+}
+
+// Download serves the attachment content with its sniffed mime type, range and conditional requests are supported.
+func (ctrl *AttachmentController) Download(c *gin.Context) {
+	att, ok := ctrl.findAttachment(c)
+	if !ok {
+		return
+	}
+
+	r, err := ctrl.Blobs.Open(c.Request.Context(), att.StorageKey)
+	if err != nil {
+		abortWithError(c, err, "Could not read the attachment")
+		return
+	}
+	defer r.Close()
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", att.MimeType)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "private")
+	h.Set("ETag", `"`+att.Checksum+`"`)
+	http.ServeContent(c.Writer, c.Request, "", att.CreatedAt, r)
+}
+
+// Delete permanently deletes the attachment and its content.
+func (ctrl *AttachmentController) Delete(c *gin.Context) {
+	att, ok := ctrl.findAttachment(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).Delete(att); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Attachment not found"))
+			return
+		}
+		abortWithError(c, err, "Could not delete the attachment")
+		return
+	}
+	ctrl.deleteBlob(c, att.StorageKey)
+
+	c.JSON(http.StatusOK, utils.Msg("Attachment removed"))
+}
+
+func (ctrl *AttachmentController) findNote(c *gin.Context) (*models.Note, bool) {
+	note, err := ctrl.Notes.WithContext(c.Request.Context()).FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return note, true
+}
+
+func (ctrl *AttachmentController) findAttachment(c *gin.Context) (*models.Attachment, bool) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return nil, false
+	}
+
+	att, err := ctrl.Store.WithContext(c.Request.Context()).FindForNote(c.Param("attachmentId"), note.ID, note.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Attachment not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return att, true
+}
+
+// deleteBlob deletes the blob stored under key, failing to do so leaves an orphaned blob so it's only logged.
+func (ctrl *AttachmentController) deleteBlob(c *gin.Context, key string) {
+	if err := ctrl.Blobs.Delete(c.Request.Context(), key); err != nil {
+		middleware.Log(c).Warn().Err(err).Str("key", key).Msg("Could not delete the attachment blob")
+	}
+}
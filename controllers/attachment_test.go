@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// pngHeader is the start of a png file, enough for the content to be sniffed as one.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// uploadAttachment uploads content as the file field of a multipart body, the part is sent with a misleading
+// content type.
+func uploadAttachment(noteID, filename string, content []byte, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	h.Set("Content-Type", "application/pdf")
+	part, _ := mw.CreatePart(h)
+	part.Write(content)
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", API+APINote+"/"+noteID+APIAttachments, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAttachments(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	note := &models.Note{Title: mockTitle, UserID: user.ID}
+	stores.Notes.Create(note)
+	attachmentsURL := API + APINote + "/" + note.ID + APIAttachments
+
+	content := []byte("hello, attachments\n")
+	var att models.Attachment
+
+	t.Run("a_user_can_attach_a_file_to_their_note", func(t *testing.T) {
+		w := uploadAttachment(note.ID, "../../notes.txt", content, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &att)
+
+		sum := sha256.Sum256(content)
+		assert.NotEmpty(t, att.ID)
+		assert.Equal(t, note.ID, att.NoteID)
+		assert.Equal(t, "notes.txt", att.Filename)
+		assert.Equal(t, "text/plain; charset=utf-8", att.MimeType)
+		assert.EqualValues(t, len(content), att.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), att.Checksum)
+		assert.NotContains(t, w.Body.String(), "storageKey")
+	})
+
+	t.Run("the_mime_type_is_sniffed", func(t *testing.T) {
+		w := uploadAttachment(note.ID, "image.txt", pngHeader, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"mimeType":"image/png"`)
+	})
+
+	t.Run("a_user_can_list_the_note_attachments", func(t *testing.T) {
+		w := serveHTTP("GET", attachmentsURL, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct{ Result []models.Attachment }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if assert.Len(t, resp.Result, 2) {
+			assert.Equal(t, att.ID, resp.Result[0].ID)
+			assert.Equal(t, "image.txt", resp.Result[1].Filename)
+		}
+	})
+
+	t.Run("a_user_can_download_an_attachment", func(t *testing.T) {
+		w := serveHTTP("GET", attachmentsURL+"/"+att.ID, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=notes.txt`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	})
+
+	t.Run("downloads_support_ranges", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", attachmentsURL+"/"+att.ID, nil)
+		req.Header.Set("Range", "bytes=7-17")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "attachments", w.Body.String())
+		assert.Equal(t, "bytes 7-17/19", w.Header().Get("Content-Range"))
+	})
+
+	t.Run("downloads_support_etags", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", attachmentsURL+"/"+att.ID, nil)
+		req.Header.Set("If-None-Match", `"`+att.Checksum+`"`)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+
+	t.Run("the_file_names_are_encoded", func(t *testing.T) {
+		w := uploadAttachment(note.ID, "résumé.txt", content, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var unicode models.Attachment
+		json.Unmarshal(w.Body.Bytes(), &unicode)
+
+		w = serveHTTP("GET", attachmentsURL+"/"+unicode.ID, nil, cookies)
+		assert.Equal(t, `attachment; filename*=utf-8''r%C3%A9sum%C3%A9.txt`, w.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("files_larger_than_the_limit_are_rejected", func(t *testing.T) {
+		w := uploadAttachment(note.ID, "large.bin", make([]byte, cfg.Storage.MaxAttachmentSize+1), cookies)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		w = uploadAttachment(note.ID, "huge.bin", make([]byte, 2*cfg.Storage.MaxAttachmentSize), cookies)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("the_file_is_required", func(t *testing.T) {
+		w := serveHTTP("POST", attachmentsURL, strings.NewReader("not multipart"), cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("other_users_can_not_access_the_attachments", func(t *testing.T) {
+		otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+		createMockUser(&otherCreds)
+		otherCookies := login(otherCreds).Result().Cookies()
+
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", attachmentsURL, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", attachmentsURL+"/"+att.ID, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", attachmentsURL+"/"+att.ID, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, uploadAttachment(note.ID, "x.txt", content, otherCookies).Code)
+	})
+
+	t.Run("a_user_can_delete_an_attachment", func(t *testing.T) {
+		w := serveHTTP("DELETE", attachmentsURL+"/"+att.ID, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", attachmentsURL+"/"+att.ID, nil, cookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", attachmentsURL+"/"+att.ID, nil, cookies).Code)
+
+		_, err := blob.NewLocal(cfg.Storage.Dir).Open(context.Background(), user.ID+"/"+note.ID+"/"+att.ID)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	})
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"notes.txt":                       "notes.txt",
+		"../../etc/passwd":                "passwd",
+		`C:\Users\me\notes.txt`:           "notes.txt",
+		"bad\x00\nname.txt":               "badname.txt",
+		"":                                "attachment",
+		"..":                              "attachment",
+		"/":                               "attachment",
+		strings.Repeat("a", 300) + ".txt": strings.Repeat("a", 251) + ".txt",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, utils.SanitizeFilename(name), name)
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// MaxBatchOperations is the maximum number of operations of a batch.
+const MaxBatchOperations = 500
+
+// The result modes of the batches.
+const (
+	// BatchAtomic applies all the operations or none of them.
+	BatchAtomic = "atomic"
+	// BatchPartial applies the operations that succeed and reports the failed ones.
+	BatchPartial = "partial"
+)
+
+// The batch operations.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpMove    = "move"
+)
+
+// errOperationFailed rolls back the failed operations of a batch.
+var errOperationFailed = errors.New("the batch operation failed")
+
+// BatchForm is the body of the batch requests.
+type BatchForm struct {
+	// Mode is BatchAtomic, the default, or BatchPartial.
+	Mode       string           `json:"mode" binding:"omitempty,oneof=atomic partial"`
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=500"`
+}
+
+// BatchOperation is an operation of a batch, the create and update operations have a note and the others have the id
+// of the note, the created notes get new ids. The move operations have the folder the note is moved to, the empty folder is the top level.
+type BatchOperation struct {
+	Op     string     `json:"op" binding:"required,oneof=create update delete restore move"`
+	ID     string     `json:"id" binding:"required_unless=Op create"`
+	Note   *BatchNote `json:"note"`
+	Folder *string    `json:"folder" binding:"omitempty,max=255"`
+}
+
+// BatchNote is the note of a create or update operation, an empty content leaves the content of the updated notes as
+// it is.
+type BatchNote struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content"`
+}
+
+// BatchResult is the result of an operation, the errors are in the format of the validation errors. The operations of
+// a failed atomic batch other than the failed one have the 424 status.
+type BatchResult struct {
+	Status int                `json:"status"`
+	Note   *models.Note       `json:"note,omitempty"`
+	Errors []validation.Error `json:"errors,omitempty"`
+}
+
+// BatchResponse is the response of the batch requests.
+type BatchResponse struct {
+	// Committed reports whether the changes were saved, a failed atomic batch saves none of them.
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchController is the group of the actions changing many notes at once with their dependencies.
+type BatchController struct {
+	Stores  *models.Stores
+	Quotas  models.Quotas
+	Metrics *metrics.Metrics
+}
+
+// NewBatchController creates a new batch controller.
+func NewBatchController(stores *models.Stores, quotas models.Quotas, m *metrics.Metrics) *BatchController {
+	return &BatchController{Stores: stores, Quotas: quotas, Metrics: m}
+}
+
+// Apply applies the operations of the batch to the notes of the user in order in a transaction. An atomic batch stops
+// at the first failed operation and saves nothing, its status is the status of the failed operation. A partial batch
+// saves the operations that succeed and responds with 200.
+func (ctrl *BatchController) Apply(c *gin.Context) {
+	form := BatchForm{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+	atomic := form.Mode != BatchPartial
+
+	userID := c.GetString(auth.UserIDKey)
+	ctx := c.Request.Context()
+	results := make([]BatchResult, len(form.Operations))
+	failed := -1
+	created := 0
+	err := ctrl.Stores.Transaction(ctx, func(tx *models.Stores) error {
+		for i, op := range form.Operations {
+			// every operation is a nested transaction so that a failed one is rolled back by itself.
+			err := tx.Transaction(ctx, func(tx *models.Stores) error {
+				results[i] = ctrl.apply(c, tx.WithQuota(ctrl.Quotas).Notes, userID, op)
+				if results[i].Status != http.StatusOK {
+					return errOperationFailed
+				}
+				return nil
+			})
+			switch {
+			case err == nil:
+				if op.Op == OpCreate {
+					created++
+				}
+			case !errors.Is(err, errOperationFailed):
+				return err
+			case atomic:
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && failed < 0 {
+		abortWithError(c, err, "Could not apply the batch")
+		return
+	}
+
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i] = BatchResult{Status: http.StatusFailedDependency}
+			}
+		}
+		c.JSON(results[failed].Status, BatchResponse{Results: results})
+		return
+	}
+
+	ctrl.Metrics.NotesCreated.Add(float64(created))
+	c.JSON(http.StatusOK, BatchResponse{Committed: true, Results: results})
+}
+
+// apply applies an operation using the notes store of a transaction.
+func (ctrl *BatchController) apply(c *gin.Context, notes models.NoteStore, userID string, op BatchOperation) BatchResult {
+	if errs := validateOperation(op); len(errs) > 0 {
+		return BatchResult{Status: http.StatusNotAcceptable, Errors: errs}
+	}
+
+	var err error
+	note := &models.Note{UserID: userID}
+	switch op.Op {
+	case OpCreate:
+		// the created notes get new ids, the id of the operation is ignored.
+		note.Title, note.Content = op.Note.Title, op.Note.Content
+		err = notes.Create(note)
+	case OpUpdate:
+		note, err = notes.FindForUser(op.ID, userID)
+		if err == nil {
+			note.Title = op.Note.Title
+			if op.Note.Content != "" {
+				note.Content = op.Note.Content
+			}
+			err = notes.Update(note)
+		}
+	case OpDelete:
+		note.ID = op.ID
+		err = notes.Delete(note)
+		note = nil
+	case OpRestore:
+		note.ID = op.ID
+		err = notes.Restore(note)
+	case OpMove:
+		note, err = notes.FindForUser(op.ID, userID)
+		if err == nil {
+			note.Folder = *op.Folder
+			err = notes.Move(note)
+		}
+	}
+
+	if err == nil {
+		return BatchResult{Status: http.StatusOK, Note: note}
+	}
+	status, errs := operationError(c, err, op.Op)
+	return BatchResult{Status: status, Errors: errs}
+}
+
+// operationError converts the error of a note operation to its status and errors in the format of the validation
+// errors, the unexpected errors are logged.
+func operationError(c *gin.Context, err error, op string) (int, []validation.Error) {
+	var qe *models.QuotaError
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound, []validation.Error{{Field: "id", Reason: "not_found"}}
+	case errors.As(err, &qe):
+		status := http.StatusForbidden
+		if qe.Resource == models.QuotaNoteSize {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return status, []validation.Error{{Field: "note", Reason: "quota=" + qe.Resource}}
+	}
+	c.Error(err)
+	middleware.Log(c).Error().Err(err).Str("op", op).Msg("Could not apply a note operation")
+	return http.StatusInternalServerError, []validation.Error{{Field: "op", Reason: "internal"}}
+}
+
+// validateOperation validates the operation with the binding tags, the note is required by the create and update
+// operations and a valid folder by the move operations.
+func validateOperation(op BatchOperation) []validation.Error {
+	if err := binding.Validator.ValidateStruct(op); err != nil {
+		var verr validator.ValidationErrors
+		if errors.As(err, &verr) {
+			return validation.DescriptiveErrors(verr)
+		}
+		return []validation.Error{{Field: "op", Reason: "invalid"}}
+	}
+	if (op.Op == OpCreate || op.Op == OpUpdate) && op.Note == nil {
+		return []validation.Error{{Field: "note", Reason: "required"}}
+	}
+	if op.Op == OpMove {
+		switch {
+		case op.Folder == nil:
+			return []validation.Error{{Field: "folder", Reason: "required"}}
+		case !models.ValidFolder(*op.Folder):
+			return []validation.Error{{Field: "folder", Reason: "invalid"}}
+		}
+	}
+	return nil
+}
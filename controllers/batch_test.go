@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func applyBatch(body string, cookies []*http.Cookie) (int, BatchResponse) {
+	w := serveHTTP("POST", API+APINote+APIBatch, strings.NewReader(body), cookies)
+	var resp BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func statuses(resp BatchResponse) []int {
+	out := []int{}
+	for _, r := range resp.Results {
+		out = append(out, r.Status)
+	}
+	return out
+}
+
+func TestBatch(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+	other, _ := createMockUser(&otherCreds)
+
+	keep := &models.Note{Title: "keep", Content: "content", UserID: user.ID}
+	trash := &models.Note{Title: "trash", UserID: user.ID}
+	deleted := &models.Note{Title: "deleted", UserID: user.ID}
+	othersNote := &models.Note{Title: "other", UserID: other.ID}
+	for _, note := range []*models.Note{keep, trash, deleted, othersNote} {
+		stores.Notes.Create(note)
+	}
+	stores.Notes.Delete(deleted)
+
+	titles := func() []string {
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		out := []string{}
+		for _, note := range notes {
+			out = append(out, note.Title)
+		}
+		return out
+	}
+
+	t.Run("atomic_batches_save_nothing_when_an_operation_fails", func(t *testing.T) {
+		code, resp := applyBatch(`{"operations":[
+			{"op":"create","note":{"title":"new"}},
+			{"op":"delete","id":"`+trash.ID+`"},
+			{"op":"update","id":"`+othersNote.ID+`","note":{"title":"stolen"}},
+			{"op":"restore","id":"`+deleted.ID+`"}
+		]}`, cookies)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.False(t, resp.Committed)
+		assert.Equal(t, []int{424, 424, 404, 424}, statuses(resp))
+		assert.Equal(t, `[{"field":"id","reason":"not_found"}]`, mustJSON(resp.Results[2].Errors))
+		assert.ElementsMatch(t, []string{"keep", "trash"}, titles())
+
+		found, _ := stores.Notes.Find(othersNote.ID)
+		assert.Equal(t, "other", found.Title)
+		usage, _ := stores.Usage.Get(user.ID)
+		assert.EqualValues(t, 2, usage.Notes, "the usage is rolled back")
+	})
+
+	t.Run("atomic_batches_apply_every_operation", func(t *testing.T) {
+		code, resp := applyBatch(`{"operations":[
+			{"op":"create","note":{"title":"new","content":"new content"}},
+			{"op":"update","id":"`+keep.ID+`","note":{"title":"kept"}},
+			{"op":"delete","id":"`+trash.ID+`"},
+			{"op":"restore","id":"`+deleted.ID+`"}
+		]}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, resp.Committed)
+		assert.Equal(t, []int{200, 200, 200, 200}, statuses(resp))
+		if assert.NotNil(t, resp.Results[0].Note) {
+			assert.Equal(t, "new content", resp.Results[0].Note.Content)
+		}
+		if assert.NotNil(t, resp.Results[1].Note) {
+			assert.Equal(t, "content", resp.Results[1].Note.Content, "an empty content is left as it is")
+		}
+		assert.Nil(t, resp.Results[2].Note)
+		assert.ElementsMatch(t, []string{"new", "kept", "deleted"}, titles())
+	})
+
+	t.Run("the_created_notes_get_new_ids", func(t *testing.T) {
+		code, resp := applyBatch(`{"operations":[
+			{"op":"create","id":"not-a-uuid","note":{"title":"invalid id"}},
+			{"op":"create","id":"`+keep.ID+`","note":{"title":"taken id"}}
+		]}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []int{200, 200}, statuses(resp))
+		for _, result := range resp.Results {
+			if assert.NotNil(t, result.Note) {
+				assert.NotEqual(t, keep.ID, result.Note.ID)
+				found, err := stores.Notes.FindForUser(result.Note.ID, user.ID)
+				if assert.Nil(t, err) {
+					assert.Equal(t, result.Note.Title, found.Title)
+				}
+				assert.Nil(t, stores.Notes.Delete(found))
+			}
+		}
+		found, _ := stores.Notes.Find(keep.ID)
+		assert.Equal(t, "kept", found.Title, "the notes can't be overwritten with a create")
+	})
+
+	t.Run("move_operations_move_the_notes_to_their_folders", func(t *testing.T) {
+		code, resp := applyBatch(`{"mode":"partial","operations":[
+			{"op":"move","id":"`+keep.ID+`","folder":"work/projects"},
+			{"op":"move","id":"`+keep.ID+`"},
+			{"op":"move","id":"`+keep.ID+`","folder":"work/../.."},
+			{"op":"move","id":"`+othersNote.ID+`","folder":"work"}
+		]}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []int{200, 406, 406, 404}, statuses(resp))
+		if assert.NotNil(t, resp.Results[0].Note) {
+			assert.Equal(t, "kept", resp.Results[0].Note.Title)
+			assert.Equal(t, "work/projects", resp.Results[0].Note.Folder)
+		}
+		assert.Equal(t, `[{"field":"folder","reason":"required"}]`, mustJSON(resp.Results[1].Errors))
+		assert.Equal(t, `[{"field":"folder","reason":"invalid"}]`, mustJSON(resp.Results[2].Errors))
+
+		found, _ := stores.Notes.Find(keep.ID)
+		assert.Equal(t, "work/projects", found.Folder)
+		found, _ = stores.Notes.Find(othersNote.ID)
+		assert.Equal(t, "", found.Folder, "the notes of other users can't be moved")
+	})
+
+	t.Run("partial_batches_report_each_operation", func(t *testing.T) {
+		code, resp := applyBatch(`{"mode":"partial","operations":[
+			{"op":"create","note":{"title":"partial"}},
+			{"op":"create","note":{"content":"no title"}},
+			{"op":"create"},
+			{"op":"delete"},
+			{"op":"archive","id":"`+keep.ID+`"},
+			{"op":"restore","id":"`+keep.ID+`"},
+			{"op":"delete","id":"`+othersNote.ID+`"},
+			{"op":"delete","id":"`+keep.ID+`"}
+		]}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, resp.Committed)
+		assert.Equal(t, []int{200, 406, 406, 406, 406, 404, 404, 200}, statuses(resp))
+		assert.Equal(t, `[{"field":"title","reason":"required"}]`, mustJSON(resp.Results[1].Errors))
+		assert.Equal(t, `[{"field":"note","reason":"required"}]`, mustJSON(resp.Results[2].Errors))
+		assert.Equal(t, `[{"field":"id","reason":"required_unless=Op create"}]`, mustJSON(resp.Results[3].Errors))
+		assert.Equal(t, `[{"field":"op","reason":"oneof=create update delete restore move"}]`, mustJSON(resp.Results[4].Errors))
+		assert.ElementsMatch(t, []string{"new", "deleted", "partial"}, titles())
+
+		_, err := stores.Notes.Find(othersNote.ID)
+		assert.Nil(t, err, "the notes of other users can't be deleted")
+	})
+
+	t.Run("invalid_batches_are_rejected", func(t *testing.T) {
+		w := serveHTTP("POST", API+APINote+APIBatch, strings.NewReader(`{"operations":[]}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"operations","reason":"min=1"}`)
+		w = serveHTTP("POST", API+APINote+APIBatch, strings.NewReader(`{"mode":"some","operations":[{"op":"delete","id":"`+keep.ID+`"}]}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"mode","reason":"oneof=atomic partial"}`)
+	})
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
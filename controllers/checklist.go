@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// ChecklistItemForm is the body of the requests adding checklist items.
+type ChecklistItemForm struct {
+	Text string `json:"text" binding:"required,max=1000"`
+	Done bool   `json:"done"`
+	// Position is where the item is inserted, it's appended when it's missing or past the end.
+	Position *int `json:"position" binding:"omitempty,min=0"`
+}
+
+// ChecklistItemPatch is the body of the requests changing checklist items, the missing fields are left as they are.
+type ChecklistItemPatch struct {
+	Text *string `json:"text" binding:"omitempty,min=1,max=1000"`
+	Done *bool   `json:"done"`
+}
+
+// ChecklistOrderForm is the body of the requests reordering checklists.
+type ChecklistOrderForm struct {
+	// IDs are the ids of all the checklist items in their new order.
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// ChecklistController is the group of the actions related to the note checklists with their dependencies.
+type ChecklistController struct {
+	Store models.ChecklistStore
+	Notes models.NoteStore
+}
+
+// NewChecklistController creates a new checklist controller.
+func NewChecklistController(stores *models.Stores) *ChecklistController {
+	return &ChecklistController{Store: stores.Checklists, Notes: stores.Notes}
+}
+
+// List lists the checklist items of the note in order.
+func (ctrl *ChecklistController) List(c *gin.Context) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	items, err := ctrl.Store.WithContext(c.Request.Context()).ListForNote(note.ID, note.UserID)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve the checklist")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": items})
+}
+
+// Add adds an item to the checklist of the note.
+func (ctrl *ChecklistController) Add(c *gin.Context) {
+	form := ChecklistItemForm{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+
+	position := -1
+	if form.Position != nil {
+		position = *form.Position
+	}
+	item := &models.ChecklistItem{
+		NoteID: c.Param("id"),
+		UserID: c.GetString(auth.UserIDKey),
+		Text:   form.Text,
+		Done:   form.Done,
+	}
+	if err := ctrl.Store.WithContext(c.Request.Context()).Add(item, position); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+		case errors.Is(err, models.ErrChecklistFull):
+			c.AbortWithStatusJSON(http.StatusConflict,
+				utils.Err("The checklist has reached the limit of "+strconv.Itoa(models.MaxChecklistItems)+" items"))
+		default:
+			abortWithError(c, err, "Could not add the item")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Update changes the text of an item or checks or unchecks it.
+func (ctrl *ChecklistController) Update(c *gin.Context) {
+	form := ChecklistItemPatch{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+
+	store := ctrl.Store.WithContext(c.Request.Context())
+	item, ok := ctrl.findItem(c, store)
+	if !ok {
+		return
+	}
+
+	if form.Text != nil {
+		item.Text = *form.Text
+	}
+	if form.Done != nil {
+		item.Done = *form.Done
+	}
+	if err := store.Update(item); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Item not found"))
+			return
+		}
+		abortWithError(c, err, "Could not update the item")
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Reorder orders the checklist of the note as the listed ids.
+func (ctrl *ChecklistController) Reorder(c *gin.Context) {
+	form := ChecklistOrderForm{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+
+	items, err := ctrl.Store.WithContext(c.Request.Context()).Reorder(c.Param("id"), c.GetString(auth.UserIDKey), form.IDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+		case errors.Is(err, models.ErrChecklistOrder):
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"errors": []validation.Error{{Field: "ids", Reason: "permutation"}}})
+		default:
+			abortWithError(c, err, "Could not reorder the checklist")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": items})
+}
+
+// Delete removes an item from the checklist of the note.
+func (ctrl *ChecklistController) Delete(c *gin.Context) {
+	item := &models.ChecklistItem{NoteID: c.Param("id"), UserID: c.GetString(auth.UserIDKey)}
+	item.ID = c.Param("itemId")
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).Delete(item); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Item not found"))
+			return
+		}
+		abortWithError(c, err, "Could not remove the item")
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Msg("Item removed"))
+}
+
+func (ctrl *ChecklistController) findNote(c *gin.Context) (*models.Note, bool) {
+	note, err := ctrl.Notes.WithContext(c.Request.Context()).FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return note, true
+}
+
+// findItem finds the item of the note, the items of the deleted notes aren't found.
+func (ctrl *ChecklistController) findItem(c *gin.Context, store models.ChecklistStore) (*models.ChecklistItem, bool) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return nil, false
+	}
+
+	item, err := store.FindForNote(c.Param("itemId"), note.ID, note.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Item not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return item, true
+}
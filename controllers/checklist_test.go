@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func addChecklistItem(noteID, body string, cookies []*http.Cookie) (int, models.ChecklistItem) {
+	w := serveHTTP("POST", API+APINote+"/"+noteID+APIChecklist, strings.NewReader(body), cookies)
+	var item models.ChecklistItem
+	json.Unmarshal(w.Body.Bytes(), &item)
+	return w.Code, item
+}
+
+func TestChecklists(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	note := &models.Note{Title: mockTitle, UserID: user.ID}
+	stores.Notes.Create(note)
+
+	checklistPath := API + APINote + "/" + note.ID + APIChecklist
+	list := func() []models.ChecklistItem {
+		w := serveHTTP("GET", checklistPath, nil, cookies)
+		var resp struct{ Result []models.ChecklistItem }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Result
+	}
+	texts := func(items []models.ChecklistItem) []string {
+		out := []string{}
+		for _, item := range items {
+			out = append(out, item.Text)
+		}
+		return out
+	}
+
+	var milk, eggs, bread models.ChecklistItem
+	t.Run("a_user_can_add_items", func(t *testing.T) {
+		var code int
+		code, milk = addChecklistItem(note.ID, `{"text":"milk"}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		_, eggs = addChecklistItem(note.ID, `{"text":"eggs","done":true}`, cookies)
+		code, bread = addChecklistItem(note.ID, `{"text":"bread","position":0}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 0, bread.Position)
+
+		assert.Equal(t, []string{"bread", "milk", "eggs"}, texts(list()))
+	})
+
+	t.Run("invalid_items_are_rejected", func(t *testing.T) {
+		w := serveHTTP("POST", checklistPath, strings.NewReader(`{"text":""}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"text","reason":"required"}`)
+		w = serveHTTP("POST", checklistPath, strings.NewReader(`{"text":"milk","position":-1}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"position","reason":"min=0"}`)
+	})
+
+	t.Run("a_user_can_check_and_uncheck_items", func(t *testing.T) {
+		itemPath := checklistPath + "/" + milk.ID
+		w := serveHTTP("PATCH", itemPath, strings.NewReader(`{"done":true}`), cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"text":"milk","done":true`)
+
+		w = serveHTTP("PATCH", checklistPath+"/"+eggs.ID, strings.NewReader(`{"done":false,"text":"a dozen eggs"}`), cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"text":"a dozen eggs","done":false`)
+
+		w = serveHTTP("PATCH", itemPath, strings.NewReader(`{"text":""}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("PATCH", checklistPath+"/not-an-id", strings.NewReader(`{}`), cookies).Code)
+	})
+
+	t.Run("a_user_can_reorder_the_items", func(t *testing.T) {
+		body := `{"ids":["` + eggs.ID + `","` + milk.ID + `","` + bread.ID + `"]}`
+		w := serveHTTP("PUT", checklistPath+APIOrder, strings.NewReader(body), cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"a dozen eggs", "milk", "bread"}, texts(list()))
+
+		w = serveHTTP("PUT", checklistPath+APIOrder, strings.NewReader(`{"ids":["`+eggs.ID+`"]}`), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"ids","reason":"permutation"}`)
+	})
+
+	t.Run("the_note_list_counts_the_checked_items", func(t *testing.T) {
+		w := serveHTTP("GET", API+APINote, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"checklist":{"done":1,"total":3}`)
+	})
+
+	t.Run("other_users_can_not_access_the_checklist", func(t *testing.T) {
+		otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+		createMockUser(&otherCreds)
+		otherCookies := login(otherCreds).Result().Cookies()
+
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", checklistPath, nil, otherCookies).Code)
+		code, _ := addChecklistItem(note.ID, `{"text":"milk"}`, otherCookies)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("PATCH", checklistPath+"/"+milk.ID, strings.NewReader(`{"done":false}`), otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("PUT", checklistPath+APIOrder, strings.NewReader(`{"ids":[]}`), otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", checklistPath+"/"+milk.ID, nil, otherCookies).Code)
+	})
+
+	t.Run("a_user_can_remove_items", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serveHTTP("DELETE", checklistPath+"/"+milk.ID, nil, cookies).Code)
+		items := list()
+		assert.Equal(t, []string{"a dozen eggs", "bread"}, texts(items))
+		assert.Equal(t, 1, items[1].Position)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", checklistPath+"/"+milk.ID, nil, cookies).Code)
+	})
+}
@@ -2,18 +2,25 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/health"
+	"github.com/msal4/toastnotes/mail"
+	"github.com/msal4/toastnotes/migrations"
 	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/memory"
 	"github.com/msal4/toastnotes/testutils"
-	"gorm.io/gorm"
+	"github.com/msal4/toastnotes/validation"
 	"gorm.io/gorm/logger"
 )
 
@@ -23,8 +30,13 @@ const (
 	mockPassword = "mockpassword"
 )
 
-var db *gorm.DB
+// stores is backed by the database when TEST_DATABASE_URL is set and by memory otherwise, cleanup resets either.
+var stores *models.Stores
+var cleanupStores func()
 var router *gin.Engine
+var mailer = &mail.MemoryMailer{}
+var cfg = newTestConfig()
+var checker = health.New()
 
 var mockUserCreds = auth.Credentials{
 	Email:    mockEmail,
@@ -33,22 +45,78 @@ var mockUserCreds = auth.Credentials{
 
 func TestMain(m *testing.M) {
 	testutils.LoadEnv()
+	cfg.Database.URL = os.Getenv("TEST_DATABASE_URL")
+
+	if cfg.Database.URL != "" {
+		setupDatabase()
+	} else {
+		memDB := memory.New()
+		stores = memDB.Stores()
+		cleanupStores = memDB.Reset
+	}
 
-	var err error
-	db, err = models.OpenConnection(os.Getenv("TEST_DATABASE_URL"), logger.Discard)
+	storageDir, err := os.MkdirTemp("", "toastnotes-attachments")
 	if err != nil {
 		panic(err)
 	}
+	cfg.Storage.Dir = storageDir
+	cfg.Storage.UploadDir = filepath.Join(storageDir, "uploads")
 
-	router = SetupRouter(db)
+	mail.DefaultMailer = mailer
+	validation.UseJSONFieldNames()
+	router = SetupRouter(stores, cfg, Deps{Checker: checker})
 	m.Run()
 
 	cleanup()
+	os.RemoveAll(storageDir)
+}
+
+func newTestConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "mysecretkeygoeshere"
+	cfg.Storage.MaxAttachmentSize = 1 << 20
+	// the metrics are served by the router in the tests.
+	cfg.Metrics.Addr = ""
+	cfg.Quota = config.Quota{MaxNotes: 20, MaxContentBytes: 4096, MaxAttachmentBytes: 1<<20 + 1024, MaxNoteSize: 1024,
+		Plans: map[string]config.QuotaPlan{"pro": {MaxNotes: 40, MaxNoteSize: 2048}}}
+	return cfg
+}
+
+// setupDatabase migrates the test database and uses it for the stores and readiness checks.
+func setupDatabase() {
+	db, err := models.OpenConnection(cfg.Database.URL, logger.Discard)
+	if err != nil {
+		panic(err)
+	}
+	sqlDB, _ := db.DB()
+	migrator, err := migrations.New(sqlDB, models.Dialect(db))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		panic(err)
+	}
+
+	checker.Add("database", health.Ping(sqlDB))
+	checker.Add("migrations", health.Migrations(migrator))
+	stores = models.NewStores(db)
+	cleanupStores = func() {
+		db.Exec("DELETE FROM reminders")
+		db.Exec("DELETE FROM checklist_items")
+		db.Exec("DELETE FROM import_failures")
+		db.Exec("DELETE FROM import_jobs")
+		db.Exec("DELETE FROM attachments")
+		db.Exec("DELETE FROM credentials")
+		db.Exec("DELETE FROM login_links")
+		db.Exec("DELETE FROM notes")
+		db.Exec("DELETE FROM usages")
+		db.Exec("DELETE FROM users")
+	}
 }
 
 func cleanup() {
-	db.Exec("truncate users cascade;")
-	db.Exec("truncate notes cascade;")
+	cleanupStores()
+	mailer.Reset()
 }
 
 func createMockUser(creds *auth.Credentials) (*models.User, error) {
@@ -67,7 +135,7 @@ func createMockUser(creds *auth.Credentials) (*models.User, error) {
 		Password: hash,
 	}
 
-	if err := db.Create(user).Error; err != nil {
+	if err := stores.Users.Create(user); err != nil {
 		return nil, err
 	}
 
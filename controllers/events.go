@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/events"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// EventsHeartbeat is how often an idle events stream is pinged so that the proxies keep it open.
+	EventsHeartbeat = 30 * time.Second
+	// eventWriteTimeout is how long writing an event to a websocket may take before the client is dropped.
+	eventWriteTimeout = 10 * time.Second
+	// maxClientMessage is the size of the largest message read from the websocket clients, they're ignored.
+	maxClientMessage = 1 << 10
+)
+
+// EventsController is the group of the actions streaming the note changes of the authenticated user.
+type EventsController struct {
+	Broker events.Broker
+	CORS   config.CORS
+}
+
+// NewEventsController creates a new events controller, the websocket origins are checked against the cors origins.
+func NewEventsController(broker events.Broker, cors config.CORS) *EventsController {
+	return &EventsController{Broker: broker, CORS: cors}
+}
+
+// Stream streams the events of the user as server-sent events named after their types. The stream ends when the
+// client falls behind or the server shuts down, the clients connect again and pull the changes they missed.
+func (ctrl *EventsController) Stream(c *gin.Context) {
+	sub := ctrl.Broker.Subscribe(c.GetString(auth.UserIDKey))
+	defer sub.Close()
+
+	// the stream outlives the write timeout of the server.
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(EventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			c.SSEvent(e.Type, e)
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// WebSocket streams the events of the user as json text messages over a websocket, the messages of the client are
+// ignored. The browsers send the cookies with the cross origin websockets so only the configured origins can connect.
+func (ctrl *EventsController) WebSocket(c *gin.Context) {
+	// the user is subscribed before the handshake so that no event is missed once it's done.
+	sub := ctrl.Broker.Subscribe(c.GetString(auth.UserIDKey))
+	defer sub.Close()
+
+	server := websocket.Server{
+		Handshake: ctrl.checkOrigin,
+		Handler:   func(ws *websocket.Conn) { ctrl.serveWebSocket(ws, sub) },
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (ctrl *EventsController) serveWebSocket(ws *websocket.Conn, sub *events.Subscription) {
+	// the connection was hijacked with the deadlines of the server.
+	ws.SetDeadline(time.Time{})
+	ws.MaxPayloadBytes = maxClientMessage
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(EventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			err = websocket.JSON.Send(ws, e)
+		case <-heartbeat.C:
+			ws.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			ws.PayloadType = websocket.PingFrame
+			_, err = ws.Write(nil)
+			ws.PayloadType = websocket.TextFrame
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// checkOrigin accepts the clients without an origin, the same origin and the configured cors origins. Allowing all
+// the cors origins doesn't allow them here since they'd connect with the cookies of the user.
+func (ctrl *EventsController) checkOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host == r.Host || (!ctrl.CORS.AllowAllOrigins() && slices.Contains(ctrl.CORS.AllowOrigins, origin)) {
+		return nil
+	}
+	return websocket.ErrBadWebSocketOrigin
+}
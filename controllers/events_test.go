@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/events"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// readEvent reads the next server-sent event of the stream, skipping the comments.
+func readEvent(r *bufio.Reader) (name string, e events.Event, err error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return name, e, err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" && name != "":
+			return name, e, nil
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &e)
+			if err != nil {
+				return name, e, err
+			}
+		}
+	}
+}
+
+// dialEvents connects to the events websocket from the origin.
+func dialEvents(server *httptest.Server, origin string, cookies []*http.Cookie) (*websocket.Conn, error) {
+	wsConfig, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+API+APIEvents+APIWebSocket, origin)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cookies {
+		wsConfig.Header.Add("Cookie", c.Name+"="+c.Value)
+	}
+	return websocket.DialConfig(wsConfig)
+}
+
+func TestEvents(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+	other, _ := createMockUser(&otherCreds)
+	otherCookies := login(otherCreds).Result().Cookies()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("the_note_changes_are_streamed_as_server_sent_events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+API+APIEvents, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		serveHTTP("POST", API+APINote, strings.NewReader(`{"title":"Not mine"}`), otherCookies)
+		w := serveHTTP("POST", API+APINote, strings.NewReader(`{"title":"Groceries"}`), cookies)
+		var note models.Note
+		json.Unmarshal(w.Body.Bytes(), &note)
+		serveHTTP("PUT", API+APINote+"/"+note.ID, strings.NewReader(`{"title":"Groceries list"}`), cookies)
+		serveHTTP("DELETE", API+APINote+"/"+note.ID, nil, cookies)
+
+		r := bufio.NewReader(resp.Body)
+		versions := []int64{}
+		for _, typ := range []string{events.NoteCreated, events.NoteUpdated, events.NoteDeleted} {
+			name, e, err := readEvent(r)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, typ, name)
+			assert.Equal(t, events.Event{Type: typ, UserID: user.ID, NoteID: note.ID, Version: e.Version, Time: e.Time}, e)
+			versions = append(versions, e.Version)
+		}
+		assert.Equal(t, []int64{1, 2, 3}, versions, "the other users changes aren't streamed")
+	})
+
+	t.Run("the_note_changes_are_streamed_over_a_websocket", func(t *testing.T) {
+		ws, err := dialEvents(server, server.URL, otherCookies)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer ws.Close()
+
+		w := serveHTTP("POST", API+APINote, strings.NewReader(`{"title":"Ideas"}`), otherCookies)
+		var note models.Note
+		json.Unmarshal(w.Body.Bytes(), &note)
+
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var e events.Event
+		if assert.Nil(t, websocket.JSON.Receive(ws, &e)) {
+			assert.Equal(t, events.NoteCreated, e.Type)
+			assert.Equal(t, other.ID, e.UserID)
+			assert.Equal(t, note.ID, e.NoteID)
+		}
+	})
+
+	t.Run("the_changes_made_through_the_other_apis_are_streamed", func(t *testing.T) {
+		ws, err := dialEvents(server, server.URL, otherCookies)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer ws.Close()
+
+		id := uuid.NewString()
+		push(`{"changes":[{"op":"create","id":"`+id+`","note":{"title":"Offline"}}]}`, otherCookies)
+		applyBatch(`{"operations":[{"op":"delete","id":"`+id+`"},{"op":"restore","id":"`+id+`"}]}`, otherCookies)
+
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for _, typ := range []string{events.NoteCreated, events.NoteDeleted, events.NoteRestored} {
+			var e events.Event
+			if !assert.Nil(t, websocket.JSON.Receive(ws, &e)) {
+				return
+			}
+			assert.Equal(t, typ, e.Type)
+			assert.Equal(t, id, e.NoteID)
+		}
+	})
+
+	t.Run("the_websockets_of_the_other_origins_are_rejected", func(t *testing.T) {
+		_, err := dialEvents(server, "https://evil.example", cookies)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("the_streams_are_authenticated", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serveHTTP("GET", API+APIEvents, nil, nil).Code)
+		_, err := dialEvents(server, server.URL, nil)
+		assert.NotNil(t, err)
+	})
+}
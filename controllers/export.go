@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/vault"
+)
+
+// ExportController is the group of the actions exporting the notes with their dependencies.
+type ExportController struct {
+	Notes       models.NoteStore
+	Checklists  models.ChecklistStore
+	Attachments models.AttachmentStore
+	Blobs       blob.Store
+}
+
+// NewExportController creates a new export controller.
+func NewExportController(stores *models.Stores, blobs blob.Store) *ExportController {
+	return &ExportController{Notes: stores.Notes, Checklists: stores.Checklists, Attachments: stores.Attachments, Blobs: blobs}
+}
+
+// Export streams the notes of the user as a zip archive of a Markdown vault with the notes in their folders, it can be
+// imported back with the markdown import format. The links between the notes become wiki links to their files, the
+// names of the files are unique across the folders so the links don't need their paths.
+func (ctrl *ExportController) Export(c *gin.Context) {
+	userID := c.GetString(auth.UserIDKey)
+	ctx := c.Request.Context()
+	notes, err := ctrl.Notes.WithContext(ctx).ListForUser(userID)
+	if err != nil {
+		abortWithError(c, err, "Could not export the notes")
+		return
+	}
+
+	names := vault.NewNames()
+	files := make(map[string]string, len(notes))
+	for _, note := range notes {
+		files[note.ID] = names.Name(note.Title)
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "application/zip")
+	filename := "toastnotes-" + time.Now().UTC().Format("2006-01-02") + ".zip"
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	h.Set("Cache-Control", "private")
+	c.Status(http.StatusOK)
+
+	// the status is sent with the first write so the errors can only cut the archive short.
+	zw := vault.NewWriter(c.Writer)
+	for _, note := range notes {
+		if err := ctrl.writeNote(c, zw, &note, files); err != nil {
+			middleware.Log(c).Error().Err(err).Str("note", note.ID).Msg("Could not export a note")
+			c.Abort()
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		middleware.Log(c).Error().Err(err).Msg("Could not finish the export")
+		c.Abort()
+	}
+}
+
+// writeNote writes the note file along with its attachments, files has the names of the note files by note id.
+func (ctrl *ExportController) writeNote(c *gin.Context, zw *vault.Writer, note *models.Note, files map[string]string) error {
+	ctx := c.Request.Context()
+	items, err := ctrl.Checklists.WithContext(ctx).ListForNote(note.ID, note.UserID)
+	if err != nil {
+		return err
+	}
+	atts, err := ctrl.Attachments.WithContext(ctx).ListForNote(note.ID, note.UserID)
+	if err != nil {
+		return err
+	}
+
+	name := files[note.ID]
+	fm := vault.FrontMatter{
+		ID:      note.ID,
+		Title:   note.Title,
+		Folder:  note.Folder,
+		Created: note.CreatedAt.UTC(),
+		Updated: note.UpdatedAt.UTC(),
+		Tags:    vault.Hashtags(note.Content),
+	}
+	for _, item := range items {
+		fm.Checklist = append(fm.Checklist, vault.ChecklistItem{Text: item.Text, Done: item.Done})
+	}
+	paths := make([]string, len(atts))
+	for i, att := range atts {
+		paths[i] = zw.AttachmentPath(name, att.Filename)
+		fm.Attachments = append(fm.Attachments, paths[i])
+	}
+
+	body := vault.ToWikiLinks(note.Content, func(id string) (string, bool) {
+		file, ok := files[id]
+		return file, ok
+	})
+	if err := zw.WriteNote(name, fm, body); err != nil {
+		return err
+	}
+	for i, att := range atts {
+		r, err := ctrl.Blobs.Open(ctx, att.StorageKey)
+		if err != nil {
+			return err
+		}
+		err = zw.WriteFile(paths[i], att.CreatedAt, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
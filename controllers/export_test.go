@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	groceries := &models.Note{Title: "Groceries", Content: "milk and eggs #shopping", UserID: user.ID}
+	groceries.CreatedAt, groceries.UpdatedAt = created, created
+	stores.Notes.Create(groceries)
+	trip := &models.Note{Title: "Trip: day 1", Content: "see [the list](note:" + groceries.ID + ")", UserID: user.ID, Folder: "Travel/2026"}
+	stores.Notes.Create(trip)
+	addChecklistItem(groceries.ID, `{"text":"Milk"}`, cookies)
+	uploadAttachment(groceries.ID, "list.txt", []byte("milk, eggs"), cookies)
+
+	var archive []byte
+	t.Run("a_user_can_export_their_notes_as_a_vault", func(t *testing.T) {
+		w := serveHTTP("GET", API+APINote+APIExport, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		archive = w.Body.Bytes()
+
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if !assert.Nil(t, err) {
+			return
+		}
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(data)
+		}
+		assert.Equal(t, "milk, eggs", files["attachments/Groceries/list.txt"])
+		fm, body, err := vault.Parse([]byte(files["Groceries.md"]))
+		assert.Nil(t, err)
+		assert.Equal(t, vault.FrontMatter{
+			ID: groceries.ID, Title: "Groceries", Created: created, Updated: created, Tags: []string{"shopping"},
+			Checklist:   []vault.ChecklistItem{{Text: "Milk"}},
+			Attachments: []string{"attachments/Groceries/list.txt"},
+		}, fm)
+		assert.Equal(t, groceries.Content, body)
+		fm, body, _ = vault.Parse([]byte(files["Travel/2026/Trip- day 1.md"]))
+		assert.Equal(t, "Travel/2026", fm.Folder, "the notes are in their folders")
+		assert.Equal(t, "see [[Groceries|the list]]", body, "the links become wiki links")
+	})
+
+	t.Run("the_vault_can_be_imported_back", func(t *testing.T) {
+		w := uploadExport("vault.zip", "", archive, cookies)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		var job models.ImportJob
+		json.Unmarshal(w.Body.Bytes(), &job)
+		assert.Equal(t, importer.FormatMarkdown, job.Format)
+		worker := importer.NewWorker(stores, blob.NewLocal(cfg.Storage.Dir), models.NewQuotas(cfg.Quota), int64(cfg.Storage.MaxAttachmentSize))
+		assert.Equal(t, 1, worker.Run(context.Background()))
+
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		imported := map[string]models.Note{}
+		for _, note := range notes {
+			if note.ID != groceries.ID && note.ID != trip.ID {
+				imported[note.Title] = note
+			}
+		}
+		copied, ok := imported["Groceries"]
+		if !assert.True(t, ok) || !assert.Len(t, imported, 2) {
+			return
+		}
+		assert.Equal(t, groceries.Content, copied.Content)
+		assert.True(t, created.Equal(copied.CreatedAt), "the timestamps are kept")
+		assert.Equal(t, "see [the list](note:"+copied.ID+")", imported["Trip: day 1"].Content,
+			"the links point to the imported notes")
+		assert.Equal(t, "Travel/2026", imported["Trip: day 1"].Folder, "the folders are kept")
+		assert.Equal(t, "", copied.Folder)
+		items, _ := stores.Checklists.ListForNote(copied.ID, user.ID)
+		if assert.Len(t, items, 1) {
+			assert.Equal(t, "Milk", items[0].Text)
+		}
+		atts, _ := stores.Attachments.ListForNote(copied.ID, user.ID)
+		if assert.Len(t, atts, 1) {
+			assert.Equal(t, "list.txt", atts[0].Filename)
+		}
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, serveHTTP("GET", API+APINote+APIExport, nil, nil).Code)
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/graph"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+)
+
+// GraphQLController serves the GraphQL api of the authenticated user.
+type GraphQLController struct {
+	Server *graph.Server
+}
+
+// NewGraphQLController creates a new graphql controller, it panics if the schema is invalid.
+func NewGraphQLController(stores *models.Stores, cfg *config.Config, m *metrics.Metrics) *GraphQLController {
+	srv, err := graph.New(stores, cfg.GraphQL, cfg.Pagination, m)
+	if err != nil {
+		panic(err)
+	}
+
+	return &GraphQLController{Server: srv}
+}
+
+// Handle executes a graphql request, requests that can't be executed are rejected with 400.
+func (ctrl *GraphQLController) Handle(c *gin.Context) {
+	var req graph.Request
+	if errs := shouldBindJSON(c, &req); errs != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, *errs)
+		return
+	}
+
+	result, invalid := ctrl.Server.Execute(c.Request.Context(), c.GetString(auth.UserIDKey), req)
+	if invalid {
+		c.AbortWithStatusJSON(http.StatusBadRequest, result)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
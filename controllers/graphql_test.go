@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/graph"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func graphqlRequest(query string, variables map[string]interface{}, cookies []*http.Cookie) (int, map[string]interface{}) {
+	body, _ := json.Marshal(graph.Request{Query: query, Variables: variables})
+	w := serveHTTP("POST", GraphQL, bytes.NewReader(body), cookies)
+
+	result := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w.Code, result
+}
+
+func TestGraphQL(t *testing.T) {
+	t.Cleanup(cleanup)
+
+	user, _ := createMockUser(nil)
+	other, _ := createMockUser(&auth.Credentials{Email: "other@email.com", Password: mockPassword})
+	stores.Notes.Create(&models.Note{Title: "groceries", Content: "milk", UserID: user.ID})
+	stores.Notes.Create(&models.Note{Title: "ideas", Content: "a note app", UserID: user.ID})
+	othersNote := models.Note{Title: "secret", UserID: other.ID}
+	stores.Notes.Create(&othersNote)
+
+	cookies := login(mockUserCreds).Result().Cookies()
+
+	t.Run("requires_authentication", func(t *testing.T) {
+		code, _ := graphqlRequest(`{ me { id } }`, nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("fetches_the_profile_and_notes_in_one_request", func(t *testing.T) {
+		code, result := graphqlRequest(`{
+			me { id name email }
+			notes(pageSize: 1) { total pageSize nodes { title } }
+			search: notes(filter: {search: "APP"}) { total nodes { title content } }
+		}`, nil, cookies)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, result["errors"])
+		data := result["data"].(map[string]interface{})
+		assert.Equal(t, user.ID, data["me"].(map[string]interface{})["id"])
+
+		notes := data["notes"].(map[string]interface{})
+		assert.Equal(t, 2.0, notes["total"])
+		assert.Len(t, notes["nodes"], 1)
+
+		search := data["search"].(map[string]interface{})
+		assert.Equal(t, 1.0, search["total"])
+		assert.Equal(t, "ideas", search["nodes"].([]interface{})[0].(map[string]interface{})["title"])
+	})
+
+	t.Run("hides_other_users_notes", func(t *testing.T) {
+		code, result := graphqlRequest(`query($id: ID!) { note(id: $id) { title } }`, map[string]interface{}{"id": othersNote.ID}, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, result["data"].(map[string]interface{})["note"])
+
+		_, result = graphqlRequest(`mutation($id: ID!) { deleteNote(id: $id) }`, map[string]interface{}{"id": othersNote.ID}, cookies)
+		assert.Contains(t, result["errors"].([]interface{})[0].(map[string]interface{})["message"], "Note not found")
+	})
+
+	t.Run("creates_updates_and_deletes_notes", func(t *testing.T) {
+		_, result := graphqlRequest(`mutation { createNote(input: {title: "todo", content: "write tests"}) { id title } }`, nil, cookies)
+		created := result["data"].(map[string]interface{})["createNote"].(map[string]interface{})
+		assert.Equal(t, "todo", created["title"])
+		id := created["id"].(string)
+
+		_, result = graphqlRequest(`mutation($id: ID!) { updateNote(id: $id, input: {title: "done"}) { title content } }`,
+			map[string]interface{}{"id": id}, cookies)
+		updated := result["data"].(map[string]interface{})["updateNote"].(map[string]interface{})
+		assert.Equal(t, "done", updated["title"])
+		assert.Equal(t, "write tests", updated["content"])
+
+		_, result = graphqlRequest(`mutation($id: ID!) { deleteNote(id: $id) }`, map[string]interface{}{"id": id}, cookies)
+		assert.Equal(t, true, result["data"].(map[string]interface{})["deleteNote"])
+
+		_, err := stores.Notes.Find(id)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("rejects_queries_exceeding_the_limits", func(t *testing.T) {
+		code, result := graphqlRequest(`{ a: notes(pageSize: 100) { nodes { id title content createdAt updatedAt } }
+			b: notes(pageSize: 100) { nodes { id title content createdAt updatedAt } }
+			c: notes(pageSize: 100) { nodes { id title content createdAt updatedAt } }
+			d: notes(pageSize: 100) { nodes { id title content createdAt updatedAt } } }`, nil, cookies)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, result["errors"].([]interface{})[0].(map[string]interface{})["message"], "complexity")
+	})
+}
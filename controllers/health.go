@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/health"
+)
+
+// HealthController holds the liveness and readiness probes.
+type HealthController struct {
+	Checker *health.Checker
+}
+
+// NewHealthController creates a new health controller.
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{Checker: checker}
+}
+
+// Live reports that the process is alive and able to handle requests.
+func (ctrl *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Ready reports the status and latency of each dependency, it fails when any of them is unavailable or when the
+// server is shutting down.
+func (ctrl *HealthController) Ready(c *gin.Context) {
+	report := ctrl.Checker.Check(c.Request.Context())
+	if !report.Ready() {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
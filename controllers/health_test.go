@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msal4/toastnotes/health"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	t.Run("healthz", func(t *testing.T) {
+		w := serveHTTP("GET", Healthz, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, w.Header().Get(middleware.RequestIDHeader))
+	})
+
+	t.Run("readyz_reports_the_dependencies", func(t *testing.T) {
+		w := serveHTTP("GET", Readyz, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		report := health.Report{}
+		json.Unmarshal(w.Body.Bytes(), &report)
+		assert.Equal(t, health.StatusOK, report.Status)
+		// the database checks are only registered when the tests run against it.
+		if cfg.Database.URL != "" {
+			assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+			assert.Equal(t, health.StatusOK, report.Checks["migrations"].Status)
+		}
+	})
+
+	t.Run("readyz_fails_when_a_check_fails", func(t *testing.T) {
+		checker := health.New()
+		checker.Add("store", func(ctx context.Context) error { return errors.New("connection refused") })
+		router := SetupRouter(stores, cfg, Deps{Checker: checker})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", Readyz, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), "connection refused")
+	})
+
+	t.Run("readyz_fails_while_draining", func(t *testing.T) {
+		checker := health.New()
+		router := SetupRouter(stores, cfg, Deps{Checker: checker})
+		checker.Drain()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", Readyz, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), health.StatusDraining)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", Healthz, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
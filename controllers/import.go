@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// ImportController is the group of the actions related to the note imports with their dependencies.
+type ImportController struct {
+	Store models.ImportStore
+	Blobs blob.Store
+	// MaxSize is the maximum size of an uploaded export in bytes.
+	MaxSize int64
+}
+
+// NewImportController creates a new import controller.
+func NewImportController(stores *models.Stores, blobs blob.Store, maxSize int64) *ImportController {
+	return &ImportController{Store: stores.Imports, Blobs: blobs, MaxSize: maxSize}
+}
+
+// Create stores the export of the multipart "file" field and creates a pending job importing its notes, the job is
+// run in the background by the import workers. The format is detected from the file unless the "format" field sets
+// it.
+func (ctrl *ImportController) Create(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ctrl.MaxSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The file is too large"))
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("The file field is required"))
+		return
+	}
+	if header.Size > ctrl.MaxSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The file is too large"))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		abortWithError(c, err, "Could not read the file")
+		return
+	}
+	defer file.Close()
+
+	format := c.PostForm("format")
+	if format == "" {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			abortWithError(c, err, "Could not read the file")
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			abortWithError(c, err, "Could not read the file")
+			return
+		}
+		if format, err = importer.Detect(header.Filename, head[:n]); err != nil {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"errors": []validation.Error{{Field: "format", Reason: "required"}}})
+			return
+		}
+	}
+	if !importer.Valid(format) {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable,
+			gin.H{"errors": []validation.Error{{Field: "format", Reason: "oneof=" + strings.Join(importer.Formats, " ")}}})
+		return
+	}
+
+	job := &models.ImportJob{
+		UserID:   c.GetString(auth.UserIDKey),
+		Format:   format,
+		Filename: utils.SanitizeFilename(header.Filename),
+		Status:   models.ImportPending,
+	}
+	job.ID = uuid.NewString()
+	job.StorageKey = importer.StorageKey(job.UserID, job.ID)
+
+	ctx := c.Request.Context()
+	if err := ctrl.Blobs.Put(ctx, job.StorageKey, file, header.Size); err != nil {
+		abortWithError(c, err, "Could not store the file")
+		return
+	}
+	if err := ctrl.Store.WithContext(ctx).Create(job); err != nil {
+		if err := ctrl.Blobs.Delete(ctx, job.StorageKey); err != nil {
+			middleware.Log(c).Warn().Err(err).Str("key", job.StorageKey).Msg("Could not delete the export blob")
+		}
+		abortWithError(c, err, "Could not create the import")
+		return
+	}
+
+	job.Failures = []models.ImportFailure{}
+	c.Header("Location", API+APIImports+"/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// Retrieve responds with the status and progress of the import along with the notes that couldn't be imported.
+func (ctrl *ImportController) Retrieve(c *gin.Context) {
+	job, err := ctrl.Store.WithContext(c.Request.Context()).FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Import not found"))
+			return
+		}
+		abortWithError(c, err, "Could not retrieve the import")
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadExport uploads content as the file field of a multipart body along with the format if it's set.
+func uploadExport(filename, format string, content []byte, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	if format != "" {
+		mw.WriteField("format", format)
+	}
+	part, _ := mw.CreateFormFile("file", filename)
+	part.Write(content)
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", API+APIImports, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImports(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+
+	export := []byte(`{"activeNotes":[
+		{"content":"Groceries\nmilk and eggs","creationDate":"2026-01-02T03:04:05.000Z","tags":["shopping"]},
+		{"content":"Too large\n` + string(bytes.Repeat([]byte("a"), 2000)) + `"}
+	]}`)
+	var job models.ImportJob
+
+	t.Run("a_user_can_upload_an_export", func(t *testing.T) {
+		w := uploadExport("notes.json", "", export, cookies)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &job)
+		assert.Equal(t, importer.FormatSimplenote, job.Format, "the format is detected")
+		assert.Equal(t, models.ImportPending, job.Status)
+		assert.Equal(t, API+APIImports+"/"+job.ID, w.Header().Get("Location"))
+	})
+
+	t.Run("the_worker_imports_the_notes_and_reports_the_failed_ones", func(t *testing.T) {
+		worker := importer.NewWorker(stores, blob.NewLocal(cfg.Storage.Dir), models.NewQuotas(cfg.Quota), int64(cfg.Storage.MaxAttachmentSize))
+		assert.Equal(t, 1, worker.Run(context.Background()))
+
+		w := serveHTTP("GET", API+APIImports+"/"+job.ID, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var found models.ImportJob
+		json.Unmarshal(w.Body.Bytes(), &found)
+		assert.Equal(t, models.ImportDone, found.Status)
+		assert.Equal(t, []int{2, 2, 1, 1}, []int{found.Total, found.Processed, found.Imported, found.Failed})
+		if assert.Len(t, found.Failures, 1) {
+			assert.Equal(t, "Too large", found.Failures[0].Title)
+		}
+
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		if assert.Len(t, notes, 1) {
+			assert.Equal(t, "Groceries", notes[0].Title)
+			assert.Equal(t, "milk and eggs\n\n#shopping", notes[0].Content)
+			created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			assert.True(t, created.Equal(notes[0].CreatedAt), "the timestamps are kept")
+			assert.True(t, created.Equal(notes[0].UpdatedAt))
+		}
+	})
+
+	t.Run("invalid_exports_are_rejected", func(t *testing.T) {
+		w := uploadExport("notes.txt", "", []byte("plain text"), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"format","reason":"required"}`)
+		w = uploadExport("notes.txt", "onenote", []byte("plain text"), cookies)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"format","reason":"oneof=enex keep simplenote markdown"}`)
+		assert.Equal(t, http.StatusBadRequest, serveHTTP("POST", API+APIImports, nil, cookies).Code)
+	})
+
+	t.Run("other_users_can_not_see_the_import", func(t *testing.T) {
+		otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+		createMockUser(&otherCreds)
+		otherCookies := login(otherCreds).Result().Cookies()
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", API+APIImports+"/"+job.ID, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", API+APIImports+"/not-an-id", nil, cookies).Code)
+	})
+}
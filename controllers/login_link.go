@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/mail"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+)
+
+// LoginLinkController handles the passwordless login using single use links sent by email.
+type LoginLinkController struct {
+	Store  models.LoginLinkStore
+	Users  models.UserStore
+	Tokens *auth.Tokens
+	Mailer mail.Mailer
+	// PublicURL is used to build the links, the request host is used if it's empty.
+	PublicURL string
+	Metrics   *metrics.Metrics
+}
+
+// NewLoginLinkController creates a new login link controller.
+func NewLoginLinkController(stores *models.Stores, tokens *auth.Tokens, publicURL string, m *metrics.Metrics) *LoginLinkController {
+	return &LoginLinkController{
+		Store:     stores.LoginLinks,
+		Users:     stores.Users,
+		Tokens:    tokens,
+		Mailer:    mail.DefaultMailer,
+		PublicURL: publicURL,
+		Metrics:   m,
+	}
+}
+
+// Request sends a login link to the user's email and binds it to the requesting browser using a nonce cookie.
+// It responds the same way whether the user exists or not so it can't be used to find out registered emails, the
+// links over the limit and the emails that fail to send are only logged.
+func (ctrl *LoginLinkController) Request(c *gin.Context) {
+	var form auth.LoginLinkForm
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, *errs)
+		return
+	}
+
+	// the browser keeps its nonce so that all the links it requested work in it.
+	nonce, err := c.Cookie(auth.LoginNonceKey)
+	if err != nil || nonce == "" {
+		if nonce, err = auth.GenerateSecureToken(); err != nil {
+			abortWithError(c, err, "Could not handle your request")
+			return
+		}
+	}
+
+	user, err := ctrl.Users.WithContext(c.Request.Context()).FindByEmail(form.Email)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+	case err != nil:
+		abortWithError(c, err, "Could not handle your request")
+		return
+	case !user.Disabled():
+		ctrl.send(c, user, nonce)
+	}
+
+	// the cookie is set for every email so that it doesn't tell them apart either.
+	http.SetCookie(c.Writer, &http.Cookie{
+		Path:     API + APILoginLink,
+		Name:     auth.LoginNonceKey,
+		Value:    nonce,
+		MaxAge:   int(ctrl.Tokens.LoginLinkAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		// Lax so that the cookie is sent when the link is opened from the email.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.JSON(http.StatusOK, utils.Msg("If an account with this email exists, a login link has been sent to it"))
+}
+
+// send creates a login link for the user bound to the nonce and emails it unless the user requested too many links.
+func (ctrl *LoginLinkController) send(c *gin.Context, user *models.User, nonce string) {
+	logger := middleware.Log(c)
+	store := ctrl.Store.WithContext(c.Request.Context())
+	count, err := store.CountSince(user.ID, time.Now().Add(-ctrl.Tokens.LoginLinkAge))
+	if err != nil {
+		logger.Error().Err(err).Msg("Could not count the login links")
+		return
+	}
+	if count >= int64(ctrl.Tokens.MaxLoginLinks) {
+		logger.Warn().Str("user", user.ID).Msg("Too many login links requested")
+		return
+	}
+
+	token, err := auth.GenerateSecureToken()
+	if err != nil {
+		logger.Error().Err(err).Msg("Could not create login link")
+		return
+	}
+	link := models.LoginLink{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		NonceHash: auth.HashToken(nonce),
+		ExpiresAt: time.Now().Add(ctrl.Tokens.LoginLinkAge),
+	}
+	if err := store.Create(&link); err != nil {
+		logger.Error().Err(err).Msg("Could not create login link")
+		return
+	}
+
+	err = ctrl.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your Toast Notes login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the following link to log in, it expires in %s and can only be used once:\n\n%s\n",
+			user.Name, ctrl.Tokens.LoginLinkAge, ctrl.loginLinkURL(c, token)),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Could not send the login link")
+	}
+}
+
+// Verify consumes the login link token and logs the user in if the request comes from the same browser that
+// requested the link. The link opened in another browser, or prefetched by a mail scanner, can still be used.
+func (ctrl *LoginLinkController) Verify(c *gin.Context) {
+	const invalid = "Invalid or expired login link, open it in the browser you requested it from"
+	token := c.Query("token")
+	nonce, err := c.Cookie(auth.LoginNonceKey)
+	if token == "" || err != nil {
+		ctrl.Metrics.Login(metrics.LoginLink, false)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err(invalid))
+		return
+	}
+
+	link, err := ctrl.Store.WithContext(c.Request.Context()).Consume(auth.HashToken(token), auth.HashToken(nonce))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			ctrl.Metrics.Login(metrics.LoginLink, false)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err(invalid))
+			return
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return
+	}
+
+	user, err := ctrl.Users.WithContext(c.Request.Context()).RetrieveUser(link.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
+			return
+		}
+		abortWithError(c, err, "Failed to find the user")
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{Path: API + APILoginLink, Name: auth.LoginNonceKey, MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+
+	ok := generateTokens(c, ctrl.Tokens, user, utils.Msg("Login successful"))
+	ctrl.Metrics.Login(metrics.LoginLink, ok)
+}
+
+// loginLinkURL builds the url of the login link using the public url or the request host if it's not set.
+func (ctrl *LoginLinkController) loginLinkURL(c *gin.Context, token string) string {
+	base := ctrl.PublicURL
+	if base == "" {
+		scheme := "https"
+		if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+			scheme = "http"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+
+	return base + API + APILoginLink + "?token=" + url.QueryEscape(token)
+}
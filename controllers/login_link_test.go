@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var loginLinkTokenRegex = regexp.MustCompile(`token=([\w-]+)`)
+
+func requestLoginLink(email string) (*http.Cookie, string) {
+	body, _ := json.Marshal(auth.LoginLinkForm{Email: email})
+	w := serveHTTP("POST", API+APILoginLink, bytes.NewReader(body), nil)
+
+	var nonce *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.LoginNonceKey {
+			nonce = c
+		}
+	}
+
+	token := ""
+	if msgs := mailer.Messages(); len(msgs) > 0 {
+		if m := loginLinkTokenRegex.FindStringSubmatch(msgs[len(msgs)-1].Body); m != nil {
+			token = m[1]
+		}
+	}
+
+	return nonce, token
+}
+
+func TestLoginLink(t *testing.T) {
+	t.Cleanup(cleanup)
+	createMockUser(nil)
+
+	t.Run("a_user_can_login_using_the_link", func(t *testing.T) {
+		nonce, token := requestLoginLink(mockEmail)
+		assert.NotNil(t, nonce)
+		assert.NotEmpty(t, token)
+
+		w := serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{nonce})
+		assert.Equal(t, http.StatusOK, w.Code)
+		names := []string{}
+		for _, c := range w.Result().Cookies() {
+			names = append(names, c.Name)
+		}
+		assert.Contains(t, names, cfg.Auth.AccessTokenCookie)
+		assert.Contains(t, names, cfg.Auth.RefreshTokenCookie)
+	})
+
+	t.Run("a_link_can_only_be_used_once", func(t *testing.T) {
+		nonce, token := requestLoginLink(mockEmail)
+
+		w := serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{nonce})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{nonce})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("a_link_only_works_in_the_requesting_browser", func(t *testing.T) {
+		nonce, token := requestLoginLink(mockEmail)
+
+		w := serveHTTP("GET", API+APILoginLink+"?token="+token, nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+		w = serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{{Name: auth.LoginNonceKey, Value: "wrong"}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{nonce})
+		assert.Equal(t, http.StatusOK, w.Code, "opening the link in another browser doesn't use it up")
+	})
+
+	t.Run("does_not_send_links_to_non_existing_users", func(t *testing.T) {
+		mailer.Reset()
+
+		body, _ := json.Marshal(auth.LoginLinkForm{Email: "mynonexistinguseremail@gmail.com"})
+		w := serveHTTP("POST", API+APILoginLink, bytes.NewReader(body), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, mailer.Messages())
+		assert.Contains(t, w.Header().Get("Set-Cookie"), auth.LoginNonceKey, "the response is the same as the existing users'")
+	})
+
+	t.Run("limits_the_number_of_links_per_user", func(t *testing.T) {
+		cleanup()
+		createMockUser(nil)
+
+		for i := 0; i < cfg.Auth.MaxLoginLinks; i++ {
+			requestLoginLink(mockEmail)
+		}
+
+		mailer.Reset()
+		body, _ := json.Marshal(auth.LoginLinkForm{Email: mockEmail})
+		w := serveHTTP("POST", API+APILoginLink, bytes.NewReader(body), nil)
+		assert.Equal(t, http.StatusOK, w.Code, "the response doesn't tell that the user exists")
+		assert.Empty(t, mailer.Messages())
+	})
+
+	t.Run("the_links_requested_from_the_same_browser_all_work_in_it", func(t *testing.T) {
+		cleanup()
+		createMockUser(nil)
+
+		nonce, first := requestLoginLink(mockEmail)
+		body, _ := json.Marshal(auth.LoginLinkForm{Email: mockEmail})
+		serveHTTP("POST", API+APILoginLink, bytes.NewReader(body), []*http.Cookie{nonce})
+		msgs := mailer.Messages()
+		second := loginLinkTokenRegex.FindStringSubmatch(msgs[len(msgs)-1].Body)[1]
+
+		for _, token := range []string{first, second} {
+			w := serveHTTP("GET", API+APILoginLink+"?token="+token, nil, []*http.Cookie{nonce})
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+}
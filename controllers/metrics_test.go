@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Cleanup(cleanup)
+	createMockUser(nil)
+	login(mockUserCreds)
+
+	w := serveHTTP("GET", cfg.Metrics.Path, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `toastnotes_http_requests_total{method="POST",route="/api/v1/login",status="200"}`)
+	assert.Contains(t, w.Body.String(), `toastnotes_logins_total{method="password",result="success"}`)
+}
+
+func TestMetricsAdminAddr(t *testing.T) {
+	adminCfg := *cfg
+	adminCfg.Metrics = config.Default().Metrics
+	r := SetupRouter(stores, &adminCfg, Deps{Checker: checker})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", adminCfg.Metrics.Path, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "the metrics are served on the admin address instead of the api")
+}
@@ -1,23 +1,36 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
 	"github.com/msal4/toastnotes/models"
 	"github.com/msal4/toastnotes/utils"
-	"gorm.io/gorm"
+	"github.com/msal4/toastnotes/validation"
 )
 
 // NoteController is the group of the set of actions related to user notes with their dependencies.
 type NoteController struct {
-	Repository *models.NoteRepository
+	Store      models.NoteStore
+	Checklists models.ChecklistStore
+	Pagination config.Pagination
+	Metrics    *metrics.Metrics
+}
+
+// NoteSummary is a note listed without its content, along with the counts of its checklist.
+type NoteSummary struct {
+	models.Note
+	Checklist models.ChecklistCount `json:"checklist"`
 }
 
 // NewNoteController creates a new note controller.
-func NewNoteController(db *gorm.DB) *NoteController {
-	return &NoteController{Repository: models.NewNoteRepository(db)}
+func NewNoteController(stores *models.Stores, pagination config.Pagination, m *metrics.Metrics) *NoteController {
+	return &NoteController{Store: stores.Notes, Checklists: stores.Checklists, Pagination: pagination, Metrics: m}
 }
 
 // Retrieve gets the first note matching the provided id.
@@ -25,14 +38,14 @@ func (ctrl *NoteController) Retrieve(c *gin.Context) {
 	noteID := c.Param("id")
 	userID := c.GetString(auth.UserIDKey)
 
-	note := models.Note{}
-	if err := ctrl.Repository.FindByID(&note, noteID); err != nil {
-		if err == gorm.ErrRecordNotFound {
+	note, err := ctrl.Store.WithContext(c.Request.Context()).Find(noteID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
 			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
 			return
 		}
 
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Could not handle your request"))
+		abortWithError(c, err, "Could not handle your request")
 		return
 	}
 
@@ -48,18 +61,33 @@ func (ctrl *NoteController) Retrieve(c *gin.Context) {
 func (ctrl *NoteController) List(c *gin.Context) {
 	userID := c.GetString(auth.UserIDKey)
 
-	notes := []models.Note{}
-	err := ctrl.Repository.DB.Scopes(models.Paginate(c)).Select("ID", "Title", "CreatedAt", "UpdatedAt").
-		Find(&notes, "user_id = ?", userID).Order("updated_at DESC").Error
+	ctx := c.Request.Context()
+	offset, limit := paginate(c, ctrl.Pagination)
+	notes, total, err := ctrl.Store.WithContext(ctx).Search(userID, models.NoteFilter{}, offset, limit)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve notes")
+		return
+	}
+
+	ids := make([]string, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+	}
+	counts, err := ctrl.Checklists.WithContext(ctx).Counts(userID, ids)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Failed to retrieve notes"))
+		abortWithError(c, err, "Failed to retrieve notes")
 		return
 	}
 
-	var total int64
-	ctrl.Repository.DB.Find(&models.Note{}, "user_id = ?", userID).Count(&total)
+	// the list only has the titles.
+	result := make([]NoteSummary, len(notes))
+	for i, note := range notes {
+		note.Content = ""
+		note.UserID = ""
+		result[i] = NoteSummary{Note: note, Checklist: counts[note.ID]}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"result": notes, "total": total})
+	c.JSON(http.StatusOK, gin.H{"result": result, "total": total})
 }
 
 // Create handles creating notes.
@@ -70,29 +98,54 @@ func (ctrl *NoteController) Create(c *gin.Context) {
 		return
 	}
 
+	if !models.ValidFolder(note.Folder) {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"errors": []validation.Error{{Field: "folder", Reason: "invalid"}}})
+		return
+	}
+	// the ids and timestamps are set by the store, not by the client.
+	note.Model = models.Model{}
 	note.UserID = c.GetString(auth.UserIDKey)
 
-	if err := ctrl.Repository.DB.Create(&note).Error; err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Could not create note :("))
+	if err := ctrl.Store.WithContext(c.Request.Context()).Create(&note); err != nil {
+		if abortWithQuotaError(c, err) {
+			return
+		}
+		abortWithError(c, err, "Could not create note :(")
 		return
 	}
+	ctrl.Metrics.NotesCreated.Inc()
 
 	c.JSON(http.StatusOK, note)
 }
 
-// Update handles updating notes.
+// Update handles updating notes, an empty content leaves the content as is.
 func (ctrl *NoteController) Update(c *gin.Context) {
-	note := models.Note{}
-	if errs := shouldBindJSON(c, &note); errs != nil {
+	form := models.Note{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
 		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
 		return
 	}
 
-	note.ID = c.Param("id")
-	note.UserID = c.GetString(auth.UserIDKey)
+	store := ctrl.Store.WithContext(c.Request.Context())
+	note, err := store.FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return
+	}
 
-	if err := ctrl.Repository.DB.Model(&note).Updates(note).Error; err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Could not update note :("))
+	note.Title = form.Title
+	if form.Content != "" {
+		note.Content = form.Content
+	}
+	if err := store.Update(note); err != nil {
+		if abortWithQuotaError(c, err) {
+			return
+		}
+		abortWithError(c, err, "Could not update note :(")
 		return
 	}
 
@@ -105,10 +158,32 @@ func (ctrl *NoteController) Delete(c *gin.Context) {
 	note.ID = c.Param("id")
 	note.UserID = c.GetString(auth.UserIDKey)
 
-	if err := ctrl.Repository.DB.Delete(&note).Error; err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Could not delete the note :("))
+	if err := ctrl.Store.WithContext(c.Request.Context()).Delete(&note); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return
+		}
+		abortWithError(c, err, "Could not delete the note :(")
 		return
 	}
 
 	c.JSON(http.StatusOK, utils.Msg("Note removed"))
 }
+
+// paginate returns the offset and limit of the page requested using the page and page_size query params.
+func paginate(c *gin.Context, cfg config.Pagination) (offset, limit int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	switch {
+	case pageSize > cfg.MaxPageSize:
+		pageSize = cfg.MaxPageSize
+	case pageSize <= 0:
+		pageSize = cfg.PageSize
+	}
+
+	return (page - 1) * pageSize, pageSize
+}
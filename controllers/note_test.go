@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/msal4/toastnotes/auth"
 	"github.com/msal4/toastnotes/models"
@@ -25,8 +27,8 @@ func TestListNotes(t *testing.T) {
 	firstTitle := "first title"
 	secondTitle := "second title"
 
-	db.Create(&models.Note{Title: firstTitle, Content: mockContent, UserID: user.ID})
-	db.Create(&models.Note{Title: secondTitle, Content: mockContent, UserID: user.ID})
+	stores.Notes.Create(&models.Note{Title: firstTitle, Content: mockContent, UserID: user.ID})
+	stores.Notes.Create(&models.Note{Title: secondTitle, Content: mockContent, UserID: user.ID})
 
 	wLogin := login(mockUserCreds)
 	w := serveHTTP("GET", API+APINote, nil, wLogin.Result().Cookies())
@@ -82,6 +84,21 @@ func TestCreateNote(t *testing.T) {
 	user, _ := createMockUser(nil)
 	wLogin := login(mockUserCreds)
 
+	t.Run("the_id_and_timestamps_of_the_created_notes_are_set_by_the_server", func(t *testing.T) {
+		body := `{"id":"foo","createdAt":"2000-01-02T03:04:05Z","title":"` + mockTitle + `"}`
+		w := serveHTTP("POST", API+APINote, strings.NewReader(body), wLogin.Result().Cookies())
+		assert.Equal(t, http.StatusOK, w.Code)
+		var note models.Note
+		json.Unmarshal(w.Body.Bytes(), &note)
+		assert.NotEqual(t, "foo", note.ID)
+		assert.True(t, note.CreatedAt.After(time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)))
+
+		w = serveHTTP("GET", API+APINote+"/"+note.ID, nil, wLogin.Result().Cookies())
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = serveHTTP("DELETE", API+APINote+"/"+note.ID, nil, wLogin.Result().Cookies())
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
 	t.Run("a_user_can_create_a_note", func(t *testing.T) {
 		defer cleanup()
 
@@ -92,24 +109,29 @@ func TestCreateNote(t *testing.T) {
 		w := serveHTTP("POST", API+APINote, bytes.NewReader(body), wLogin.Result().Cookies())
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		note := models.Note{}
-		assert.Nil(t, db.First(&note).Error)
-		assert.NotEmpty(t, note.ID)
-		assert.Equal(t, mockTitle, note.Title)
-		assert.Equal(t, mockContent, note.Content)
-		assert.Equal(t, user.ID, note.UserID)
+		notes, err := stores.Notes.ListForUser(user.ID)
+		assert.Nil(t, err)
+		if assert.Len(t, notes, 1) {
+			assert.NotEmpty(t, notes[0].ID)
+			assert.Equal(t, mockTitle, notes[0].Title)
+			assert.Equal(t, mockContent, notes[0].Content)
+			assert.Equal(t, user.ID, notes[0].UserID)
+		}
 	})
 
 	t.Run("a_user_can_not_create_a_note_using_invalid_data", func(t *testing.T) {
 		body, _ := json.Marshal(models.Note{Content: mockContent})
 		w := serveHTTP("POST", API+APINote, bytes.NewReader(body), wLogin.Result().Cookies())
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
 
+		body, _ = json.Marshal(models.Note{Title: mockTitle, Folder: "../work"})
+		w = serveHTTP("POST", API+APINote, bytes.NewReader(body), wLogin.Result().Cookies())
 		assert.Equal(t, http.StatusNotAcceptable, w.Code)
-		note := models.Note{}
-		assert.NotNil(t, db.First(&note).Error)
-		assert.Empty(t, note.ID)
-		assert.Empty(t, note.Title)
-		assert.Empty(t, note.Content)
+		assert.Contains(t, w.Body.String(), `{"field":"folder","reason":"invalid"}`)
+
+		notes, err := stores.Notes.ListForUser(user.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, notes)
 	})
 }
 
@@ -131,11 +153,11 @@ func TestUpdateNote(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	n := models.Note{}
-	assert.Nil(t, db.First(&n).Error)
-	assert.NotEmpty(t, n.ID)
-	assert.Equal(t, newTitle, n.Title)
-	assert.Equal(t, newContent, n.Content)
+	n, err := stores.Notes.Find(note.ID)
+	if assert.Nil(t, err) {
+		assert.Equal(t, newTitle, n.Title)
+		assert.Equal(t, newContent, n.Content)
+	}
 }
 
 func TestDeleteNote(t *testing.T) {
@@ -148,11 +170,8 @@ func TestDeleteNote(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	n := models.Note{}
-	assert.NotNil(t, db.First(&n).Error)
-	assert.Empty(t, n.ID)
-	assert.Empty(t, n.Title)
-	assert.Empty(t, n.Content)
+	_, err := stores.Notes.Find(note.ID)
+	assert.ErrorIs(t, err, models.ErrNotFound)
 }
 
 func createMockNote(userID string) *models.Note {
@@ -164,6 +183,6 @@ func createMockNote(userID string) *models.Note {
 		Content: mockContent,
 		UserID:  userID,
 	}
-	db.Create(&note)
+	stores.Notes.Create(&note)
 	return &note
 }
@@ -0,0 +1,633 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/events"
+	"github.com/msal4/toastnotes/graph"
+	"github.com/msal4/toastnotes/health"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/openapi"
+	"github.com/msal4/toastnotes/tus"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// The security scheme names of the auth cookies.
+const (
+	accessTokenScheme  = "accessToken"
+	refreshTokenScheme = "refreshToken"
+)
+
+// NewOpenAPI describes the routes set up by SetupRouter with the given config.
+func NewOpenAPI(cfg *config.Config) *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Toast Notes API",
+		Version: "1.0.0",
+		Description: "Authentication uses http only cookies set by the login, register and refresh endpoints. " +
+			"Invalid request bodies are rejected with 406 and the validation errors.",
+	})
+	doc.Tags = []openapi.Tag{
+		{Name: "auth", Description: "Registration, login and session management."},
+		{Name: "user", Description: "The authenticated user."},
+		{Name: "passkeys", Description: "The authenticated user passkeys."},
+		{Name: "notes", Description: "The authenticated user notes."},
+		{Name: "attachments", Description: "The files attached to the notes."},
+		{Name: "checklists", Description: "The ordered checklist items of the notes."},
+		{Name: "reminders", Description: "The note reminders, delivered by email or webhook."},
+		{Name: "uploads", Description: "The tus 1.0 resumable uploads of the attachments."},
+		{Name: "sync", Description: "The delta sync of the offline first clients."},
+		{Name: "events", Description: "The real-time note changes of the authenticated user."},
+		{Name: "imports", Description: "The background imports of the notes exported from Evernote, Google Keep, Simplenote and Markdown vaults."},
+		{Name: "graphql", Description: "The GraphQL api."},
+		{Name: "ops", Description: "Health checks, metrics and docs."},
+	}
+	doc.Components.SecuritySchemes[accessTokenScheme] = &openapi.SecurityScheme{
+		Type: "apiKey", In: "cookie", Name: cfg.Auth.AccessTokenCookie,
+		Description: "The access token cookie.",
+	}
+	doc.Components.SecuritySchemes[refreshTokenScheme] = &openapi.SecurityScheme{
+		Type: "apiKey", In: "cookie", Name: cfg.Auth.RefreshTokenCookie,
+		Description: "The refresh token cookie.",
+	}
+
+	// schemas
+	message := doc.Define("Message", struct {
+		Message string `json:"message"`
+	}{})
+	errResp := doc.Define("Error", struct {
+		Error string `json:"error"`
+	}{})
+	doc.Define("ValidationError", validation.Error{})
+	validationErrs := doc.Define("ValidationErrors", struct {
+		Errors []validation.Error `json:"errors"`
+	}{})
+	credentials := doc.Define("Credentials", auth.Credentials{})
+	registerForm := doc.Define("RegisterForm", auth.RegisterForm{})
+	changePasswordForm := doc.Define("ChangePasswordForm", auth.ChangePasswordForm{})
+	loginLinkForm := doc.Define("LoginLinkForm", auth.LoginLinkForm{})
+	passkeyNameForm := doc.Define("PasskeyNameForm", auth.PasskeyNameForm{})
+	user := doc.Define("User", models.User{})
+	note := doc.Define("Note", models.Note{})
+	noteList := doc.Define("NoteList", struct {
+		Result []NoteSummary `json:"result"`
+		Total  int64         `json:"total"`
+	}{})
+	batchForm := doc.Define("BatchForm", BatchForm{})
+	doc.Define("BatchResult", BatchResult{})
+	batchResponse := doc.Define("BatchResponse", BatchResponse{})
+	doc.Define("Tombstone", Tombstone{})
+	syncResponse := doc.Define("SyncResponse", SyncResponse{})
+	syncPushForm := doc.Define("SyncPushForm", SyncPushForm{})
+	doc.Define("SyncResult", SyncResult{})
+	syncPushResponse := doc.Define("SyncPushResponse", SyncPushResponse{})
+	event := doc.Define("Event", events.Event{})
+	usageReport := doc.Define("UsageReport", UsageReport{})
+	quotaErr := doc.Define("QuotaError", QuotaErrorResponse{})
+	attachment := doc.Define("Attachment", models.Attachment{})
+	attachmentList := doc.Define("AttachmentList", struct {
+		Result []models.Attachment `json:"result"`
+	}{})
+	checklistItemForm := doc.Define("ChecklistItemForm", ChecklistItemForm{})
+	checklistItemPatch := doc.Define("ChecklistItemPatch", ChecklistItemPatch{})
+	checklistOrderForm := doc.Define("ChecklistOrderForm", ChecklistOrderForm{})
+	checklistItem := doc.Define("ChecklistItem", models.ChecklistItem{})
+	checklist := doc.Define("Checklist", struct {
+		Result []models.ChecklistItem `json:"result"`
+	}{})
+	reminderForm := doc.Define("ReminderForm", ReminderForm{})
+	reminder := doc.Define("Reminder", models.Reminder{})
+	upcomingList := doc.Define("UpcomingReminderList", struct {
+		Result []UpcomingReminder `json:"result"`
+	}{})
+	doc.Define("ImportFailure", models.ImportFailure{})
+	importJob := doc.Define("ImportJob", models.ImportJob{})
+	passkey := doc.Define("Passkey", models.Credential{})
+	passkeyList := doc.Define("PasskeyList", struct {
+		Result []models.Credential `json:"result"`
+	}{})
+	doc.Define("HealthCheck", health.Result{})
+	healthReport := doc.Define("HealthReport", health.Report{})
+	graphqlRequest := doc.Define("GraphQLRequest", graph.Request{})
+	graphqlResult := doc.Define("GraphQLResult", struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors,omitempty"`
+	}{})
+	webauthnOptions := &openapi.Schema{Type: "object", Description: "The WebAuthn credential creation or request options."}
+	webauthnResponse := &openapi.Schema{Type: "object", Description: "The WebAuthn authenticator response (PublicKeyCredential)."}
+
+	// helpers
+	body := func(schema *openapi.Schema) *openapi.RequestBody {
+		return &openapi.RequestBody{Required: true, Content: openapi.JSON(schema)}
+	}
+	resp := func(description string, schema *openapi.Schema) *openapi.Response {
+		return &openapi.Response{Description: description, Content: openapi.JSON(schema)}
+	}
+	responses := func(status int, r *openapi.Response, errs ...int) map[string]*openapi.Response {
+		out := map[string]*openapi.Response{strconv.Itoa(status): r}
+		for _, status := range errs {
+			switch status {
+			case http.StatusNotAcceptable:
+				out[strconv.Itoa(status)] = resp("Invalid body, the validation errors or an error message.", validationErrs)
+			default:
+				out[strconv.Itoa(status)] = resp(http.StatusText(status), errResp)
+			}
+		}
+		return out
+	}
+	// withQuota adds the responses of the changes rejected by the user quota.
+	withQuota := func(r map[string]*openapi.Response, statuses ...int) map[string]*openapi.Response {
+		for _, status := range statuses {
+			switch status {
+			case http.StatusForbidden:
+				r[strconv.Itoa(status)] = resp("The change would exceed the user quota.", quotaErr)
+			case http.StatusRequestEntityTooLarge:
+				r[strconv.Itoa(status)] = resp("The note is larger than the maximum note size.", quotaErr)
+			}
+		}
+		return r
+	}
+	authenticated := []map[string][]string{{accessTokenScheme: {}}}
+	const tokensSet = "The access and refresh token cookies are set."
+
+	// health
+	doc.Add(http.MethodGet, Healthz, &openapi.Operation{
+		Tags: []string{"ops"}, Summary: "Liveness probe", OperationID: "healthz",
+		Responses: responses(http.StatusOK, resp("The process is alive.", &openapi.Schema{
+			Type: "object", Properties: map[string]*openapi.Schema{"status": {Type: "string"}},
+		})),
+	})
+	doc.Add(http.MethodGet, Readyz, &openapi.Operation{
+		Tags: []string{"ops"}, Summary: "Readiness probe", OperationID: "readyz",
+		Responses: map[string]*openapi.Response{
+			"200": resp("All the checks passed.", healthReport),
+			"503": resp("A check failed or the server is shutting down.", healthReport),
+		},
+	})
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr == "" {
+		doc.Add(http.MethodGet, cfg.Metrics.Path, &openapi.Operation{
+			Tags: []string{"ops"}, Summary: "Prometheus metrics", OperationID: "metrics",
+			Responses: map[string]*openapi.Response{"200": {
+				Description: "The metrics in the prometheus exposition format.",
+				Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+			}},
+		})
+	}
+	doc.Add(http.MethodGet, API+APIOpenAPI, &openapi.Operation{
+		Tags: []string{"ops"}, Summary: "This document", OperationID: "openapi",
+		Responses: responses(http.StatusOK, resp("The OpenAPI document.", &openapi.Schema{Type: "object"})),
+	})
+	doc.Add(http.MethodGet, API+APIDocs, &openapi.Operation{
+		Tags: []string{"ops"}, Summary: "The api docs", OperationID: "docs",
+		Responses: map[string]*openapi.Response{"200": {
+			Description: "The docs page.",
+			Content:     map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+		}},
+	})
+
+	doc.Add(http.MethodPost, GraphQL, &openapi.Operation{
+		Tags: []string{"graphql"}, Summary: "Execute a GraphQL request", OperationID: "graphql", Security: authenticated,
+		Description: "Queries the authenticated user and notes and mutates the notes, the schema can be introspected. " +
+			"Queries exceeding the depth or complexity limits are rejected.",
+		RequestBody: body(graphqlRequest),
+		Responses: map[string]*openapi.Response{
+			"200": resp("The result of the request, field errors are listed in errors.", graphqlResult),
+			"400": resp("The request is invalid or exceeds the limits.", graphqlResult),
+			"401": resp(http.StatusText(http.StatusUnauthorized), errResp),
+		},
+	})
+
+	// auth
+	doc.Add(http.MethodPost, API+APIRegister, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Register a new user", OperationID: "register",
+		RequestBody: body(registerForm),
+		Responses:   responses(http.StatusOK, resp("The registered user. "+tokensSet, user), http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APILogin, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Log in with email and password", OperationID: "login",
+		RequestBody: body(credentials),
+		Responses: responses(http.StatusOK, resp(tokensSet, message),
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APILoginLink, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Email a passwordless login link", OperationID: "requestLoginLink",
+		Description: "Responds the same way whether the user exists or not, the link must be opened in the same browser.",
+		RequestBody: body(loginLinkForm),
+		Responses: responses(http.StatusOK, resp("The link was sent if the user exists.", message),
+			http.StatusNotAcceptable, http.StatusTooManyRequests, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodGet, API+APILoginLink, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Log in using a login link", OperationID: "verifyLoginLink",
+		Parameters: []openapi.Parameter{
+			{Name: "token", In: "query", Required: true, Description: "The emailed login link token.", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: responses(http.StatusOK, resp(tokensSet, message),
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APILoginPasskey+APIBegin, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Start a passkey login", OperationID: "beginPasskeyLogin",
+		Responses: responses(http.StatusOK, resp("The credential request options.", webauthnOptions), http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APILoginPasskey+APIFinish, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Finish a passkey login", OperationID: "finishPasskeyLogin",
+		RequestBody: body(webauthnResponse),
+		Responses: responses(http.StatusOK, resp(tokensSet, message),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APIRefresh, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Refresh the tokens", OperationID: "refresh",
+		Security:  []map[string][]string{{refreshTokenScheme: {}}},
+		Responses: responses(http.StatusOK, resp(tokensSet, message), http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound),
+	})
+	doc.Add(http.MethodDelete, API+APILogout, &openapi.Operation{
+		Tags: []string{"auth"}, Summary: "Log out", OperationID: "logout",
+		Responses: responses(http.StatusOK, resp("The token cookies are cleared.", message)),
+	})
+
+	// user
+	doc.Add(http.MethodGet, API+APIMe, &openapi.Operation{
+		Tags: []string{"user"}, Summary: "Get the authenticated user", OperationID: "me", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The authenticated user.", user), http.StatusUnauthorized, http.StatusNotFound),
+	})
+	doc.Add(http.MethodGet, API+APIMe+APIUsage, &openapi.Operation{
+		Tags: []string{"user"}, Summary: "Get the usage and limits", OperationID: "usage", Security: authenticated,
+		Description: "The notes, their content size and the attachments size of the authenticated user against the quota of their plan, " +
+			"the unlimited limits are null.",
+		Responses: responses(http.StatusOK, resp("The usage of the authenticated user.", usageReport),
+			http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APIChangePassword, &openapi.Operation{
+		Tags: []string{"user"}, Summary: "Change the password", OperationID: "changePassword", Security: authenticated,
+		Description: "Changing the password logs out the other sessions.",
+		RequestBody: body(changePasswordForm),
+		Responses: responses(http.StatusOK, resp("The password was updated.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+
+	// passkeys
+	doc.Add(http.MethodGet, API+APIPasskey, &openapi.Operation{
+		Tags: []string{"passkeys"}, Summary: "List the passkeys", OperationID: "listPasskeys", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The user passkeys.", passkeyList), http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APIPasskey+APIBegin, &openapi.Operation{
+		Tags: []string{"passkeys"}, Summary: "Start a passkey registration", OperationID: "beginPasskeyRegistration", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The credential creation options.", webauthnOptions),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APIPasskey+APIFinish, &openapi.Operation{
+		Tags: []string{"passkeys"}, Summary: "Finish a passkey registration", OperationID: "finishPasskeyRegistration", Security: authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "name", In: "query", Description: "The passkey name, defaults to \"Passkey\".", Schema: &openapi.Schema{Type: "string", MaxLength: intPtr(64)}},
+		},
+		RequestBody: body(webauthnResponse),
+		Responses: responses(http.StatusOK, resp("The registered passkey.", passkey),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPut, API+APIPasskey+"/:id", &openapi.Operation{
+		Tags: []string{"passkeys"}, Summary: "Rename a passkey", OperationID: "renamePasskey", Security: authenticated,
+		RequestBody: body(passkeyNameForm),
+		Responses: responses(http.StatusOK, resp("The renamed passkey.", passkey),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodDelete, API+APIPasskey+"/:id", &openapi.Operation{
+		Tags: []string{"passkeys"}, Summary: "Remove a passkey", OperationID: "deletePasskey", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The passkey was removed.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+
+	// notes
+	doc.Add(http.MethodGet, API+APINote, &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "List the notes", OperationID: "listNotes", Security: authenticated,
+		Description: "The listed notes don't include their content, they include the number of the checked items of " +
+			"their checklist and its size.",
+		Parameters: []openapi.Parameter{
+			{Name: "page", In: "query", Description: "The page number starting from 1.", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "page_size", In: "query", Schema: &openapi.Schema{Type: "integer", Maximum: floatPtr(cfg.Pagination.MaxPageSize)},
+				Description: "The page size, defaults to " + strconv.Itoa(cfg.Pagination.PageSize) + "."},
+		},
+		Responses: responses(http.StatusOK, resp("A page of notes and the total number of notes.", noteList),
+			http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APINote, &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Create a note", OperationID: "createNote", Security: authenticated,
+		RequestBody: body(note),
+		Responses: withQuota(responses(http.StatusOK, resp("The created note.", note),
+			http.StatusUnauthorized, http.StatusNotAcceptable, http.StatusInternalServerError),
+			http.StatusForbidden, http.StatusRequestEntityTooLarge),
+	})
+	doc.Add(http.MethodPost, API+APINote+APIBatch, &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Apply many note operations", OperationID: "batchNotes", Security: authenticated,
+		Description: "Applies up to " + strconv.Itoa(MaxBatchOperations) + " create, update, delete, restore and move operations " +
+			"in order in a transaction. A move operation moves the note to its folder, the empty folder is the top level. Each operation has a status and the errors in the format of the validation errors. " +
+			"An atomic batch, the default, stops at the first failed operation and saves nothing, it responds with the " +
+			"status of the failed operation and the others have the 424 status. A partial batch saves the operations that " +
+			"succeed.",
+		RequestBody: body(batchForm),
+		Responses: responses(http.StatusOK, resp("The results of the operations.", batchResponse),
+			http.StatusUnauthorized, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodGet, API+APINote+APIExport, &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Export the notes as a Markdown vault", OperationID: "exportNotes", Security: authenticated,
+		Description: "A zip archive of a Markdown file per note in its folder that opens as an Obsidian vault. The YAML front " +
+			"matter has the id, title, folder, timestamps, hashtags, checklist and attachment paths of the note and the " +
+			"attachments are in a folder per note under attachments. The links to the other notes become wiki links, the archive can be imported back " +
+			"with the markdown import format.",
+		Responses: responses(http.StatusOK, &openapi.Response{
+			Description: "The vault archive, it's served as a download.",
+			Content:     map[string]openapi.MediaType{"application/zip": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+		}, http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodGet, API+APINote+"/:id", &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Get a note", OperationID: "getNote", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The note.", note), http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPut, API+APINote+"/:id", &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Update a note", OperationID: "updateNote", Security: authenticated,
+		RequestBody: body(note),
+		Responses: withQuota(responses(http.StatusOK, resp("The updated note.", note),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+			http.StatusForbidden, http.StatusRequestEntityTooLarge),
+	})
+	doc.Add(http.MethodDelete, API+APINote+"/:id", &openapi.Operation{
+		Tags: []string{"notes"}, Summary: "Delete a note", OperationID: "deleteNote", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The note was removed.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+
+	// attachments
+	attachmentPath := API + APINote + "/:id" + APIAttachments
+	doc.Add(http.MethodGet, attachmentPath, &openapi.Operation{
+		Tags: []string{"attachments"}, Summary: "List the note attachments", OperationID: "listAttachments", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The note attachments, the oldest first.", attachmentList),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, attachmentPath, &openapi.Operation{
+		Tags: []string{"attachments"}, Summary: "Attach a file to a note", OperationID: "uploadAttachment", Security: authenticated,
+		Description: "The mime type is detected from the content of the file, files larger than " +
+			strconv.Itoa(cfg.Storage.MaxAttachmentSize) + " bytes are rejected with 413.",
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"file": {Type: "string", Format: "binary"}},
+			Required:   []string{"file"},
+		}}}},
+		Responses: withQuota(responses(http.StatusOK, resp("The created attachment.", attachment),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusInternalServerError),
+			http.StatusForbidden),
+	})
+	download := responses(http.StatusOK, &openapi.Response{
+		Description: "The attachment content with its mime type, it's served as a download.",
+		Content:     map[string]openapi.MediaType{"application/octet-stream": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+	}, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError)
+	download["206"] = &openapi.Response{Description: "The requested range of the content."}
+	download["416"] = &openapi.Response{Description: "The requested range can't be satisfied."}
+	doc.Add(http.MethodGet, attachmentPath+"/:attachmentId", &openapi.Operation{
+		Tags: []string{"attachments"}, Summary: "Download an attachment", OperationID: "downloadAttachment", Security: authenticated,
+		Description: "Supports the Range, If-Range and If-None-Match headers, the ETag is the sha256 checksum.",
+		Parameters: []openapi.Parameter{
+			{Name: "Range", In: "header", Description: "The byte ranges to download.", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: download,
+	})
+	doc.Add(http.MethodDelete, attachmentPath+"/:attachmentId", &openapi.Operation{
+		Tags: []string{"attachments"}, Summary: "Remove an attachment", OperationID: "deleteAttachment", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The attachment was removed.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+
+	// checklists
+	checklistPath := API + APINote + "/:id" + APIChecklist
+	doc.Add(http.MethodGet, checklistPath, &openapi.Operation{
+		Tags: []string{"checklists"}, Summary: "List the note checklist", OperationID: "listChecklist", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The checklist items in order.", checklist),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, checklistPath, &openapi.Operation{
+		Tags: []string{"checklists"}, Summary: "Add a checklist item", OperationID: "addChecklistItem", Security: authenticated,
+		Description: "The item is inserted at the position, the following items are moved down. A checklist has " +
+			strconv.Itoa(models.MaxChecklistItems) + " items at most, adding more is rejected with 409.",
+		RequestBody: body(checklistItemForm),
+		Responses: responses(http.StatusOK, resp("The added item.", checklistItem),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusConflict, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPut, checklistPath+APIOrder, &openapi.Operation{
+		Tags: []string{"checklists"}, Summary: "Reorder the note checklist", OperationID: "reorderChecklist", Security: authenticated,
+		Description: "The ids must list each item of the checklist once.",
+		RequestBody: body(checklistOrderForm),
+		Responses: responses(http.StatusOK, resp("The checklist items in their new order.", checklist),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPatch, checklistPath+"/:itemId", &openapi.Operation{
+		Tags: []string{"checklists"}, Summary: "Change a checklist item", OperationID: "updateChecklistItem", Security: authenticated,
+		Description: "Checks or unchecks the item or changes its text, the missing fields are left as they are.",
+		RequestBody: body(checklistItemPatch),
+		Responses: responses(http.StatusOK, resp("The changed item.", checklistItem),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodDelete, checklistPath+"/:itemId", &openapi.Operation{
+		Tags: []string{"checklists"}, Summary: "Remove a checklist item", OperationID: "deleteChecklistItem", Security: authenticated,
+		Description: "The following items are moved up.",
+		Responses: responses(http.StatusOK, resp("The item was removed.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+
+	// reminders
+	reminderPath := API + APINote + "/:id" + APIReminder
+	doc.Add(http.MethodGet, reminderPath, &openapi.Operation{
+		Tags: []string{"reminders"}, Summary: "Get the note reminder", OperationID: "getReminder", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The note reminder.", reminder),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPut, reminderPath, &openapi.Operation{
+		Tags: []string{"reminders"}, Summary: "Set the note reminder", OperationID: "setReminder", Security: authenticated,
+		Description: "Replaces the existing reminder of the note. The recurring reminders repeat the wall clock time of at in " +
+			"the timezone. Webhook reminders are posted as JSON, signed in the X-Toastnotes-Signature header when the server " +
+			"has a webhook secret. A failed delivery is retried " + strconv.Itoa(models.MaxReminderAttempts-1) + " times with " +
+			"a backoff before the occurrence is skipped.",
+		RequestBody: body(reminderForm),
+		Responses: responses(http.StatusOK, resp("The reminder with its next time.", reminder),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodDelete, reminderPath, &openapi.Operation{
+		Tags: []string{"reminders"}, Summary: "Remove the note reminder", OperationID: "deleteReminder", Security: authenticated,
+		Responses: responses(http.StatusOK, resp("The reminder was removed.", message),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodGet, API+APIReminders+APIUpcoming, &openapi.Operation{
+		Tags: []string{"reminders"}, Summary: "List the upcoming reminders", OperationID: "upcomingReminders", Security: authenticated,
+		Description: "The reminders of the deleted notes and the finished reminders aren't listed.",
+		Parameters: []openapi.Parameter{
+			{Name: "before", In: "query", Description: "List the reminders firing before this RFC 3339 time, a week from now by default.",
+				Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "page_size", In: "query", Schema: &openapi.Schema{Type: "integer", Maximum: floatPtr(cfg.Pagination.MaxPageSize)},
+				Description: "The maximum number of reminders, defaults to " + strconv.Itoa(cfg.Pagination.PageSize) + "."},
+		},
+		Responses: responses(http.StatusOK, resp("The upcoming reminders, the soonest first.", upcomingList),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+
+	// sync
+	doc.Add(http.MethodGet, API+APISync, &openapi.Operation{
+		Tags: []string{"sync"}, Summary: "Pull the note changes", OperationID: "syncPull", Security: authenticated,
+		Description: "The notes created, updated and deleted since the cursor, each one once in its current state with its " +
+			"version, and the cursor of the next pull. The cursor is opaque and only moves forward, the changes made while " +
+			"pulling are never skipped. Pull again right away while hasMore is true.",
+		Parameters: []openapi.Parameter{
+			{Name: "cursor", In: "query", Description: "The cursor of the previous pull, all the notes are listed without it.",
+				Schema: &openapi.Schema{Type: "string"}},
+			{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer", Maximum: floatPtr(MaxSyncChanges)},
+				Description: "The maximum number of changes, defaults to " + strconv.Itoa(MaxSyncChanges) + "."},
+		},
+		Responses: responses(http.StatusOK, resp("The changes since the cursor.", syncResponse),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodPost, API+APISync, &openapi.Operation{
+		Tags: []string{"sync"}, Summary: "Push the changes of a client", OperationID: "syncPush", Security: authenticated,
+		Description: "Applies up to " + strconv.Itoa(MaxSyncChanges) + " create, update and delete changes in order. The " +
+			"updates and deletes have the version of the note they were made to as their baseVersion, a change to a note " +
+			"that was changed since then isn't applied and has the 409 status with the current note or its tombstone. The " +
+			"creates may set the id of the note so that they can be pushed again.",
+		RequestBody: body(syncPushForm),
+		Responses: responses(http.StatusOK, resp("The results of the changes.", syncPushResponse),
+			http.StatusUnauthorized, http.StatusNotAcceptable, http.StatusInternalServerError),
+	})
+
+	// events
+	doc.Add(http.MethodGet, API+APIEvents, &openapi.Operation{
+		Tags: []string{"events"}, Summary: "Stream the note changes", OperationID: "streamEvents", Security: authenticated,
+		Description: "Server-sent events named after their types (note.created, note.updated, note.deleted and " +
+			"note.restored) with the event as their json data, the changes made on any instance and through any api are " +
+			"streamed. The events don't have the notes, " +
+			"fetch them or pull the changes. The stream ends when the client falls behind or the server shuts down, pull the " +
+			"changes since the last sync after connecting again. Idle streams get a comment every " + EventsHeartbeat.String() + ".",
+		Responses: responses(http.StatusOK, &openapi.Response{
+			Description: "The event stream.",
+			Content:     map[string]openapi.MediaType{"text/event-stream": {Schema: event}},
+		}, http.StatusUnauthorized),
+	})
+	doc.Add(http.MethodGet, API+APIEvents+APIWebSocket, &openapi.Operation{
+		Tags: []string{"events"}, Summary: "Stream the note changes over a websocket", OperationID: "streamEventsWebSocket",
+		Security: authenticated,
+		Description: "The events of the event stream as json text messages, the messages of the client are ignored. The " +
+			"browsers can connect from the same origin and from the configured CORS origins, allowing all the CORS origins " +
+			"doesn't allow them here.",
+		Responses: map[string]*openapi.Response{
+			strconv.Itoa(http.StatusSwitchingProtocols): {
+				Description: "The websocket, its messages are events.",
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: event}},
+			},
+			strconv.Itoa(http.StatusBadRequest):   {Description: "Not a websocket handshake."},
+			strconv.Itoa(http.StatusForbidden):    {Description: "The origin isn't allowed."},
+			strconv.Itoa(http.StatusUnauthorized): resp(http.StatusText(http.StatusUnauthorized), errResp),
+		},
+	})
+
+	// imports
+	doc.Add(http.MethodPost, API+APIImports, &openapi.Operation{
+		Tags: []string{"imports"}, Summary: "Import the notes of an export", OperationID: "createImport", Security: authenticated,
+		Description: "Evernote .enex files, Google Takeout archives of Keep or the JSON files in them, Simplenote " +
+			"notes.json files or the archives they're in and zip archives of Markdown vaults or single Markdown files are " +
+			"imported in the background, the status of the import is at the URL in the Location header. The tags are added to " +
+			"the end of the notes as hashtags and the to-dos and Keep lists become checklists. The folders of the vaults become " +
+			"tags and their wiki links become links to the imported notes. Files larger than " + strconv.Itoa(cfg.Imports.MaxSize) + " bytes are rejected with 413.",
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"file":   {Type: "string", Format: "binary"},
+				"format": {Type: "string", Enum: importer.Formats, Description: "The format of the export, it's detected from the file by default."},
+			},
+			Required: []string{"file"},
+		}}}},
+		Responses: responses(http.StatusAccepted, resp("The pending import.", importJob),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotAcceptable, http.StatusRequestEntityTooLarge,
+			http.StatusInternalServerError),
+	})
+	doc.Add(http.MethodGet, API+APIImports+"/:id", &openapi.Operation{
+		Tags: []string{"imports"}, Summary: "Get the status of an import", OperationID: "getImport", Security: authenticated,
+		Description: "The notes that couldn't be imported are listed in the failures with the reason, the first " +
+			strconv.Itoa(models.MaxImportFailures) + " of them.",
+		Responses: responses(http.StatusOK, resp("The import with its progress.", importJob),
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError),
+	})
+
+	// tus uploads
+	uploadPath := API + APIUploads
+	str := &openapi.Schema{Type: "string"}
+	tusResumable := openapi.Parameter{Name: "Tus-Resumable", In: "header", Description: "The protocol version, " + tus.Version + ".",
+		Required: true, Schema: str}
+	uploadOffset := openapi.Parameter{Name: "Upload-Offset", In: "header", Description: "The offset of the data in bytes.",
+		Required: true, Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(0)}}
+	noContent := func(description string) *openapi.Response { return &openapi.Response{Description: description} }
+	uploadErrs := func(r map[string]*openapi.Response) map[string]*openapi.Response {
+		r["412"] = noContent("The Tus-Resumable version isn't supported, the supported one is in the Tus-Version header.")
+		return r
+	}
+	doc.Add(http.MethodOptions, uploadPath, &openapi.Operation{
+		Tags: []string{"uploads"}, Summary: "Describe the tus server", OperationID: "uploadOptions",
+		Description: "The Tus-Version, Tus-Extension and Tus-Max-Size headers describe the supported uploads.",
+		Responses:   map[string]*openapi.Response{"204": noContent("The server capabilities.")},
+	})
+	doc.Add(http.MethodPost, uploadPath, &openapi.Operation{
+		Tags: []string{"uploads"}, Summary: "Create an upload", OperationID: "createUpload", Security: authenticated,
+		Description: "The Upload-Metadata must have the base64 encoded noteId of the note to attach the file to and " +
+			"should have its filename. The upload URL is in the Location header, abandoned uploads expire after " +
+			cfg.Storage.UploadExpiry.String() + ". Empty files are attached right away.",
+		Parameters: []openapi.Parameter{
+			tusResumable,
+			{Name: "Upload-Length", In: "header", Description: "The size of the file in bytes.", Required: true,
+				Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(0), Maximum: floatPtr(cfg.Storage.MaxAttachmentSize)}},
+			{Name: "Upload-Metadata", In: "header", Description: "Comma separated keys and base64 encoded values.", Required: true, Schema: str},
+		},
+		Responses: uploadErrs(withQuota(responses(http.StatusCreated, noContent("The upload was created."),
+			http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusInternalServerError),
+			http.StatusForbidden)),
+	})
+	doc.Add(http.MethodHead, uploadPath+"/:id", &openapi.Operation{
+		Tags: []string{"uploads"}, Summary: "Get the upload offset", OperationID: "getUploadOffset", Security: authenticated,
+		Description: "The Upload-Offset header is the offset to resume the upload from.",
+		Parameters:  []openapi.Parameter{tusResumable},
+		Responses: uploadErrs(map[string]*openapi.Response{
+			"200": noContent("The upload offset, length, expiry and metadata."),
+			"401": noContent(http.StatusText(http.StatusUnauthorized)),
+			"404": noContent(http.StatusText(http.StatusNotFound)),
+			"410": noContent("The upload has expired."),
+		}),
+	})
+	patch := uploadErrs(withQuota(responses(http.StatusNoContent, noContent("The data was appended, the new offset is in the Upload-Offset header. "+
+		"The id of the attachment is in the X-Attachment-Id header once the upload is complete."),
+		http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusInternalServerError),
+		http.StatusForbidden))
+	patch["409"] = resp("The Upload-Offset doesn't match the upload offset.", errResp)
+	patch["410"] = resp("The upload has expired.", errResp)
+	patch["415"] = resp("The content type isn't "+offsetOctetStream+".", errResp)
+	patch["423"] = resp("The upload is being appended to by another request.", errResp)
+	doc.Add(http.MethodPatch, uploadPath+"/:id", &openapi.Operation{
+		Tags: []string{"uploads"}, Summary: "Append to an upload", OperationID: "appendUpload", Security: authenticated,
+		Parameters: []openapi.Parameter{tusResumable, uploadOffset},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			offsetOctetStream: {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}},
+		Responses: patch,
+	})
+	terminate := uploadErrs(responses(http.StatusNoContent, noContent("The upload and its data were deleted."),
+		http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError))
+	terminate["423"] = resp("The upload is being appended to by another request.", errResp)
+	doc.Add(http.MethodDelete, uploadPath+"/:id", &openapi.Operation{
+		Tags: []string{"uploads"}, Summary: "Terminate an upload", OperationID: "terminateUpload", Security: authenticated,
+		Parameters: []openapi.Parameter{tusResumable},
+		Responses:  terminate,
+	})
+
+	return doc
+}
+
+func intPtr(n int) *int { return &n }
+
+func floatPtr(n int) *float64 {
+	f := float64(n)
+	return &f
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	spec := NewOpenAPI(cfg)
+
+	t.Run("describes_every_route", func(t *testing.T) {
+		routes := map[string]bool{}
+		for _, r := range router.Routes() {
+			routes[r.Method+" "+openapi.Path(r.Path)] = true
+			assert.NotNil(t, spec.Operation(r.Method, r.Path), "%s %s is missing from the openapi spec", r.Method, r.Path)
+		}
+
+		// and doesn't describe routes that don't exist.
+		for path, item := range spec.Paths {
+			for method := range item {
+				assert.True(t, routes[strings.ToUpper(method)+" "+path], "%s %s is not a route", method, path)
+			}
+		}
+	})
+
+	t.Run("references_defined_schemas", func(t *testing.T) {
+		body, _ := json.Marshal(spec)
+		var refs []string
+		var walk func(v interface{})
+		walk = func(v interface{}) {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				for k, v := range v {
+					if s, ok := v.(string); ok && k == "$ref" {
+						refs = append(refs, s)
+					}
+					walk(v)
+				}
+			case []interface{}:
+				for _, v := range v {
+					walk(v)
+				}
+			}
+		}
+		var doc interface{}
+		json.Unmarshal(body, &doc)
+		walk(doc)
+
+		assert.NotEmpty(t, refs)
+		for _, ref := range refs {
+			name := ref[len("#/components/schemas/"):]
+			assert.Contains(t, spec.Components.Schemas, name)
+		}
+	})
+
+	t.Run("serves_the_spec", func(t *testing.T) {
+		w := serveHTTP("GET", API+APIOpenAPI, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		doc := openapi.Document{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, openapi.Version, doc.OpenAPI)
+		assert.Contains(t, doc.Paths, API+APINote+"/{id}")
+	})
+
+	t.Run("serves_the_docs", func(t *testing.T) {
+		w := serveHTTP("GET", API+APIDocs, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), API+APIOpenAPI)
+	})
+}
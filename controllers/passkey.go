@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+)
+
+// PasskeyController handles the webauthn registration and login ceremonies and the management of the user
+// passkeys.
+type PasskeyController struct {
+	Store    models.CredentialStore
+	Tokens   *auth.Tokens
+	WebAuthn *webauthn.WebAuthn
+	Metrics  *metrics.Metrics
+}
+
+// NewPasskeyController creates a new passkey controller, it panics if the webauthn config is invalid.
+func NewPasskeyController(store models.CredentialStore, tokens *auth.Tokens, cfg config.WebAuthn, m *metrics.Metrics) *PasskeyController {
+	wa, err := auth.NewWebAuthn(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return &PasskeyController{
+		Store:    store,
+		Tokens:   tokens,
+		WebAuthn: wa,
+		Metrics:  m,
+	}
+}
+
+// BeginRegistration starts the registration ceremony of a new passkey for the authenticated user.
+func (ctrl *PasskeyController) BeginRegistration(c *gin.Context) {
+	user, ok := ctrl.retrieveUser(c, c.GetString(auth.UserIDKey))
+	if !ok {
+		return
+	}
+
+	exclusions := webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()
+	options, session, err := ctrl.WebAuthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		abortWithError(c, err, "Could not start passkey registration")
+		return
+	}
+
+	if !setPasskeySession(c, ctrl.Tokens, session) {
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishRegistration verifies the authenticator response and saves the new passkey, the passkey name can be
+// provided using the `name` query param.
+func (ctrl *PasskeyController) FinishRegistration(c *gin.Context) {
+	session, ok := passkeySession(c, ctrl.Tokens)
+	if !ok {
+		return
+	}
+
+	user, ok := ctrl.retrieveUser(c, c.GetString(auth.UserIDKey))
+	if !ok {
+		return
+	}
+
+	name := c.DefaultQuery("name", "Passkey")
+	if len(name) > 64 {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, utils.Err("Passkey name is too long"))
+		return
+	}
+
+	wc, err := ctrl.WebAuthn.FinishRegistration(user, *session, c.Request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("Passkey verification failed"))
+		return
+	}
+
+	cred := models.NewCredential(user.ID, name, wc)
+	if err := ctrl.Store.WithContext(c.Request.Context()).Create(cred); err != nil {
+		abortWithError(c, err, "Could not save the passkey")
+		return
+	}
+
+	clearPasskeySession(c)
+	c.JSON(http.StatusOK, cred)
+}
+
+// BeginLogin starts a passwordless login ceremony, the authenticator picks the account.
+func (ctrl *PasskeyController) BeginLogin(c *gin.Context) {
+	options, session, err := ctrl.WebAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		abortWithError(c, err, "Could not start passkey login")
+		return
+	}
+
+	if !setPasskeySession(c, ctrl.Tokens, session) {
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishLogin verifies the authenticator assertion and logs the user in.
+func (ctrl *PasskeyController) FinishLogin(c *gin.Context) {
+	session, ok := passkeySession(c, ctrl.Tokens)
+	if !ok {
+		return
+	}
+
+	var user *models.User
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err := ctrl.Store.WithContext(c.Request.Context()).RetrieveUserWithCredentials(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		user = u
+		return u, nil
+	}
+
+	wc, err := ctrl.WebAuthn.FinishDiscoverableLogin(handler, *session, c.Request)
+	if err != nil || user == nil {
+		ctrl.Metrics.Login(metrics.LoginPasskey, false)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err("Passkey verification failed"))
+		return
+	}
+
+	if wc.Authenticator.CloneWarning {
+		ctrl.Metrics.Login(metrics.LoginPasskey, false)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err("This passkey may have been cloned, please use another login method"))
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).RecordLogin(user, wc); err != nil {
+		abortWithError(c, err, "Could not handle your request")
+		return
+	}
+
+	clearPasskeySession(c)
+	ok = generateTokens(c, ctrl.Tokens, user, utils.Msg("Login successful"))
+	ctrl.Metrics.Login(metrics.LoginPasskey, ok)
+}
+
+// List lists the authenticated user passkeys.
+func (ctrl *PasskeyController) List(c *gin.Context) {
+	creds, err := ctrl.Store.WithContext(c.Request.Context()).ListForUser(c.GetString(auth.UserIDKey))
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve passkeys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": creds})
+}
+
+// Rename renames one of the authenticated user passkeys.
+func (ctrl *PasskeyController) Rename(c *gin.Context) {
+	var form auth.PasskeyNameForm
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, *errs)
+		return
+	}
+
+	cred, ok := ctrl.findCredential(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).Rename(cred, form.Name); err != nil {
+		abortWithError(c, err, "Could not rename the passkey")
+		return
+	}
+
+	c.JSON(http.StatusOK, cred)
+}
+
+// Delete removes one of the authenticated user passkeys.
+func (ctrl *PasskeyController) Delete(c *gin.Context) {
+	cred, ok := ctrl.findCredential(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).Delete(cred); err != nil {
+		abortWithError(c, err, "Could not delete the passkey")
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Msg("Passkey removed"))
+}
+
+func (ctrl *PasskeyController) retrieveUser(c *gin.Context, userID string) (*models.User, bool) {
+	user, err := ctrl.Store.WithContext(c.Request.Context()).RetrieveUserWithCredentials(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Failed to find the user")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (ctrl *PasskeyController) findCredential(c *gin.Context) (*models.Credential, bool) {
+	cred, err := ctrl.Store.WithContext(c.Request.Context()).FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Passkey not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return cred, true
+}
+
+func setPasskeySession(c *gin.Context, tokens *auth.Tokens, session *webauthn.SessionData) bool {
+	token, err := tokens.GeneratePasskeySessionToken(session)
+	if err != nil {
+		abortWithError(c, err, "Could not handle your request")
+		return false
+	}
+
+	c.SetCookie(auth.PasskeySessionKey, token, auth.PasskeySessionAge, API, "", true, true)
+	return true
+}
+
+func clearPasskeySession(c *gin.Context) {
+	c.SetCookie(auth.PasskeySessionKey, "", -1, API, "", true, true)
+}
+
+func passkeySession(c *gin.Context, tokens *auth.Tokens) (*webauthn.SessionData, bool) {
+	tokenStr, err := c.Cookie(auth.PasskeySessionKey)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("No passkey ceremony in progress"))
+		return nil, false
+	}
+
+	claims := auth.PasskeySessionClaims{}
+	token, err := tokens.ParseToken(tokenStr, &claims)
+	if err != nil || !token.Valid {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("No passkey ceremony in progress"))
+		return nil, false
+	}
+
+	return &claims.Session, true
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func registerPasskey(t *testing.T, authenticator *testutils.Authenticator, cookies []*http.Cookie) *models.Credential {
+	w := serveHTTP("POST", API+APIPasskey+APIBegin, nil, cookies)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body, err := authenticator.Register(w.Body.Bytes())
+	assert.Nil(t, err)
+
+	w = serveHTTP("POST", API+APIPasskey+APIFinish+"?name=laptop", bytes.NewReader(body), append(cookies, w.Result().Cookies()...))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cred := models.Credential{}
+	json.Unmarshal(w.Body.Bytes(), &cred)
+	return &cred
+}
+
+func TestPasskeys(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	authenticator := testutils.NewAuthenticator(cfg.WebAuthn.Origins[0])
+
+	t.Run("a_user_can_register_a_passkey", func(t *testing.T) {
+		cred := registerPasskey(t, authenticator, cookies)
+		assert.NotEmpty(t, cred.ID)
+		assert.Equal(t, "laptop", cred.Name)
+
+		stored, err := stores.Credentials.FindForUser(cred.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.NotEmpty(t, stored.PublicKey)
+		}
+	})
+
+	t.Run("a_user_can_login_using_a_passkey", func(t *testing.T) {
+		w := serveHTTP("POST", API+APILoginPasskey+APIBegin, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		body, err := authenticator.Login(w.Body.Bytes())
+		assert.Nil(t, err)
+
+		w = serveHTTP("POST", API+APILoginPasskey+APIFinish, bytes.NewReader(body), w.Result().Cookies())
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = serveHTTP("GET", API+APIMe, nil, w.Result().Cookies())
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), mockEmail)
+	})
+
+	t.Run("does_not_login_with_an_unknown_passkey", func(t *testing.T) {
+		w := serveHTTP("POST", API+APILoginPasskey+APIBegin, nil, nil)
+		stranger := testutils.NewAuthenticator(cfg.WebAuthn.Origins[0])
+		stranger.Register([]byte(`{"publicKey":{"challenge":"AA","rp":{"id":"localhost"},"user":{"id":"AA"}}}`))
+
+		body, _ := stranger.Login(w.Body.Bytes())
+		w = serveHTTP("POST", API+APILoginPasskey+APIFinish, bytes.NewReader(body), w.Result().Cookies())
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("a_user_can_list_rename_and_delete_their_passkeys", func(t *testing.T) {
+		w := serveHTTP("GET", API+APIPasskey, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct{ Result []models.Credential }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Len(t, resp.Result, 1)
+		id := resp.Result[0].ID
+
+		body, _ := json.Marshal(auth.PasskeyNameForm{Name: "phone"})
+		w = serveHTTP("PUT", API+APIPasskey+"/"+id, bytes.NewReader(body), cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "phone")
+
+		w = serveHTTP("DELETE", API+APIPasskey+"/"+id, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, err := stores.Credentials.FindForUser(id, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("a_user_can_not_manage_passkeys_of_others", func(t *testing.T) {
+		cred := registerPasskey(t, authenticator, cookies)
+
+		anotherUserCreds := auth.Credentials{Email: "a" + mockEmail, Password: mockPassword}
+		createMockUser(&anotherUserCreds)
+		anotherCookies := login(anotherUserCreds).Result().Cookies()
+
+		w := serveHTTP("DELETE", API+APIPasskey+"/"+cred.ID, nil, anotherCookies)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		_, err := stores.Credentials.FindForUser(cred.ID, user.ID)
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/rrule"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// defaultUpcomingWindow is how far ahead the upcoming reminders are listed by default.
+const defaultUpcomingWindow = 7 * 24 * time.Hour
+
+// ReminderForm is the body of the requests setting the reminder of a note.
+type ReminderForm struct {
+	// At is the time of the first occurrence.
+	At time.Time `json:"at" binding:"required"`
+	// Timezone is the IANA time zone the recurrences keep the wall clock time of at in.
+	Timezone string `json:"timezone" binding:"required,timezone"`
+	// Recurrence is an RFC 5545 recurrence rule, the FREQ, INTERVAL, COUNT, UNTIL and BYDAY parts are supported.
+	Recurrence string `json:"recurrence"`
+	Channel    string `json:"channel" binding:"required,oneof=email webhook"`
+	// WebhookURL is the http(s) url the webhook reminders are posted to.
+	WebhookURL string `json:"webhookUrl" binding:"required_if=Channel webhook,omitempty,url,max=2048"`
+}
+
+// UpcomingReminder is a reminder along with the title of its note.
+type UpcomingReminder struct {
+	models.Reminder
+	NoteTitle string `json:"noteTitle"`
+}
+
+// ReminderController is the group of the actions related to the note reminders with their dependencies.
+type ReminderController struct {
+	Store      models.ReminderStore
+	Notes      models.NoteStore
+	Pagination config.Pagination
+}
+
+// NewReminderController creates a new reminder controller.
+func NewReminderController(stores *models.Stores, pagination config.Pagination) *ReminderController {
+	return &ReminderController{Store: stores.Reminders, Notes: stores.Notes, Pagination: pagination}
+}
+
+// Retrieve gets the reminder of the note.
+func (ctrl *ReminderController) Retrieve(c *gin.Context) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	rem, err := ctrl.Store.WithContext(c.Request.Context()).FindForNote(note.ID, note.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("The note has no reminder"))
+			return
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return
+	}
+
+	c.JSON(http.StatusOK, rem)
+}
+
+// Set sets the reminder of the note, replacing the existing one.
+func (ctrl *ReminderController) Set(c *gin.Context) {
+	form := ReminderForm{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+	if errs := validateReminder(&form); len(errs) > 0 {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"errors": errs})
+		return
+	}
+
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	rem := &models.Reminder{
+		NoteID:     note.ID,
+		UserID:     note.UserID,
+		At:         form.At.UTC(),
+		Timezone:   form.Timezone,
+		Recurrence: form.Recurrence,
+		Channel:    form.Channel,
+	}
+	if form.Channel == models.ChannelWebhook {
+		rem.WebhookURL = form.WebhookURL
+	}
+	if err := rem.Schedule(time.Now()); err != nil {
+		if errors.Is(err, models.ErrNoOccurrence) {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"errors": []validation.Error{{Field: "at", Reason: "future"}}})
+			return
+		}
+		abortWithError(c, err, "Could not set the reminder")
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).Set(rem); err != nil {
+		abortWithError(c, err, "Could not set the reminder")
+		return
+	}
+
+	c.JSON(http.StatusOK, rem)
+}
+
+// validateReminder checks the parts of the form the binding tags can't, the recurrence rule and the webhook scheme.
+func validateReminder(form *ReminderForm) []validation.Error {
+	var errs []validation.Error
+	if form.Recurrence != "" {
+		rule, err := rrule.Parse(form.Recurrence)
+		if err != nil {
+			errs = append(errs, validation.Error{Field: "recurrence", Reason: "rrule"})
+		} else {
+			form.Recurrence = rule.String()
+		}
+	}
+	if form.Channel == models.ChannelWebhook {
+		if u, err := url.Parse(form.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, validation.Error{Field: "webhookUrl", Reason: "http_url"})
+		}
+	}
+	return errs
+}
+
+// Delete removes the reminder of the note.
+func (ctrl *ReminderController) Delete(c *gin.Context) {
+	note, ok := ctrl.findNote(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.Store.WithContext(c.Request.Context()).DeleteForNote(note.ID, note.UserID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("The note has no reminder"))
+			return
+		}
+		abortWithError(c, err, "Could not remove the reminder")
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Msg("Reminder removed"))
+}
+
+// Upcoming lists the reminders of the user firing before the before query parameter, a week from now by default,
+// the soonest first. The page_size parameter limits how many are listed.
+func (ctrl *ReminderController) Upcoming(c *gin.Context) {
+	before := time.Now().Add(defaultUpcomingWindow)
+	if s := c.Query("before"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("before must be an RFC 3339 time"))
+			return
+		}
+		before = t
+	}
+	_, limit := paginate(c, ctrl.Pagination)
+
+	userID := c.GetString(auth.UserIDKey)
+	ctx := c.Request.Context()
+	rems, err := ctrl.Store.WithContext(ctx).Upcoming(userID, before, limit)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve the reminders")
+		return
+	}
+
+	ids := make([]string, len(rems))
+	for i, rem := range rems {
+		ids[i] = rem.NoteID
+	}
+	notes, err := ctrl.Notes.WithContext(ctx).FindManyForUser(userID, ids)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve the reminders")
+		return
+	}
+	titles := make(map[string]string, len(notes))
+	for _, note := range notes {
+		titles[note.ID] = note.Title
+	}
+
+	result := make([]UpcomingReminder, len(rems))
+	for i, rem := range rems {
+		result[i] = UpcomingReminder{Reminder: rem, NoteTitle: titles[rem.NoteID]}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+func (ctrl *ReminderController) findNote(c *gin.Context) (*models.Note, bool) {
+	note, err := ctrl.Notes.WithContext(c.Request.Context()).FindForUser(c.Param("id"), c.GetString(auth.UserIDKey))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return note, true
+}
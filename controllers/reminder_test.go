@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func setReminder(noteID, body string, cookies []*http.Cookie) (int, models.Reminder) {
+	w := serveHTTP("PUT", API+APINote+"/"+noteID+APIReminder, strings.NewReader(body), cookies)
+	var rem models.Reminder
+	json.Unmarshal(w.Body.Bytes(), &rem)
+	return w.Code, rem
+}
+
+func TestReminders(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	note := &models.Note{Title: mockTitle, UserID: user.ID}
+	later := &models.Note{Title: "later", UserID: user.ID}
+	stores.Notes.Create(note)
+	stores.Notes.Create(later)
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	reminderPath := API + APINote + "/" + note.ID + APIReminder
+
+	t.Run("a_user_can_set_a_reminder", func(t *testing.T) {
+		code, rem := setReminder(note.ID, `{"at":"`+at.Format(time.RFC3339)+`","timezone":"Europe/Berlin","channel":"email"}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, note.ID, rem.NoteID)
+		if assert.NotNil(t, rem.NextAt) {
+			assert.True(t, at.Equal(*rem.NextAt))
+		}
+
+		w := serveHTTP("GET", reminderPath, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"timezone":"Europe/Berlin"`)
+	})
+
+	t.Run("setting_a_reminder_replaces_the_existing_one", func(t *testing.T) {
+		code, rem := setReminder(note.ID, `{"at":"`+at.Add(-2*time.Hour).Format(time.RFC3339)+
+			`","timezone":"UTC","recurrence":"freq=daily;count=3","channel":"webhook","webhookUrl":"https://example.com/hook"}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "FREQ=DAILY;COUNT=3", rem.Recurrence)
+		assert.Equal(t, "https://example.com/hook", rem.WebhookURL)
+		if assert.NotNil(t, rem.NextAt) {
+			assert.True(t, at.Add(22*time.Hour).Equal(*rem.NextAt), "the next occurrence follows the recurrence")
+		}
+
+		found, _ := stores.Reminders.FindForNote(note.ID, user.ID)
+		assert.Equal(t, rem.ID, found.ID)
+	})
+
+	t.Run("invalid_reminders_are_rejected", func(t *testing.T) {
+		tests := []struct {
+			body   string
+			field  string
+			reason string
+		}{
+			{`{"timezone":"UTC","channel":"email"}`, "at", "required"},
+			{`{"at":"` + at.Format(time.RFC3339) + `","timezone":"Mars/Olympus","channel":"email"}`, "timezone", "timezone"},
+			{`{"at":"` + at.Format(time.RFC3339) + `","timezone":"UTC","channel":"pigeon"}`, "channel", "oneof=email webhook"},
+			{`{"at":"` + at.Format(time.RFC3339) + `","timezone":"UTC","channel":"webhook"}`, "webhookUrl", "required_if=Channel webhook"},
+			{`{"at":"` + at.Format(time.RFC3339) + `","timezone":"UTC","channel":"webhook","webhookUrl":"ftp://example.com"}`, "webhookUrl", "http_url"},
+			{`{"at":"` + at.Format(time.RFC3339) + `","timezone":"UTC","channel":"email","recurrence":"FREQ=HOURLY"}`, "recurrence", "rrule"},
+			{`{"at":"` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `","timezone":"UTC","channel":"email"}`, "at", "future"},
+		}
+		for _, tt := range tests {
+			w := serveHTTP("PUT", reminderPath, strings.NewReader(tt.body), cookies)
+			assert.Equal(t, http.StatusNotAcceptable, w.Code, tt.body)
+			assert.Contains(t, w.Body.String(), `{"field":"`+tt.field+`","reason":"`+tt.reason+`"}`, tt.body)
+		}
+	})
+
+	t.Run("upcoming_lists_the_soonest_first", func(t *testing.T) {
+		code, _ := setReminder(later.ID, `{"at":"`+at.Add(30*time.Minute).Format(time.RFC3339)+`","timezone":"UTC","channel":"email"}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+
+		w := serveHTTP("GET", API+APIReminders+APIUpcoming, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct{ Result []UpcomingReminder }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if assert.Len(t, resp.Result, 2) {
+			assert.Equal(t, later.ID, resp.Result[0].NoteID)
+			assert.Equal(t, "later", resp.Result[0].NoteTitle)
+			assert.Equal(t, note.ID, resp.Result[1].NoteID)
+		}
+
+		before := url.QueryEscape(at.Add(time.Hour).Format(time.RFC3339))
+		w = serveHTTP("GET", API+APIReminders+APIUpcoming+"?before="+before, nil, cookies)
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Len(t, resp.Result, 1)
+
+		w = serveHTTP("GET", API+APIReminders+APIUpcoming+"?before=tomorrow", nil, cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("other_users_can_not_access_the_reminders", func(t *testing.T) {
+		otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+		createMockUser(&otherCreds)
+		otherCookies := login(otherCreds).Result().Cookies()
+
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", reminderPath, nil, otherCookies).Code)
+		code, _ := setReminder(note.ID, `{"at":"`+at.Format(time.RFC3339)+`","timezone":"UTC","channel":"email"}`, otherCookies)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", reminderPath, nil, otherCookies).Code)
+
+		w := serveHTTP("GET", API+APIReminders+APIUpcoming, nil, otherCookies)
+		assert.Equal(t, `{"result":[]}`, w.Body.String())
+	})
+
+	t.Run("a_user_can_remove_a_reminder", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serveHTTP("DELETE", reminderPath, nil, cookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("GET", reminderPath, nil, cookies).Code)
+		assert.Equal(t, http.StatusNotFound, serveHTTP("DELETE", reminderPath, nil, cookies).Code)
+	})
+}
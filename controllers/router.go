@@ -1,9 +1,24 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/events"
+	"github.com/msal4/toastnotes/health"
+	"github.com/msal4/toastnotes/metrics"
 	"github.com/msal4/toastnotes/middleware"
-	"gorm.io/gorm"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/openapi"
+	"github.com/msal4/toastnotes/tracing"
+	"github.com/msal4/toastnotes/tus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -13,6 +28,10 @@ const (
 	APIRegister = "/register"
 	// APILogin is the user signin endpoint.
 	APILogin = "/login"
+	// APILoginLink is the passwordless login link endpoint.
+	APILoginLink = "/login/link"
+	// APILoginPasskey is the passkey login ceremony endpoint group.
+	APILoginPasskey = "/login/passkey"
 	// APIRefresh is the user tokens refresh endpoint.
 	APIRefresh = "/refresh"
 	// APILogout is the logout endpoint.
@@ -22,41 +41,228 @@ const (
 	// APIMe is the user profile endpoint.
 	APIMe = "/me"
 
+	// APIPasskey is the authenticated user passkeys api group.
+	APIPasskey = "/passkeys"
+
+	// APIBegin and APIFinish are the steps of a passkey ceremony.
+	APIBegin  = "/begin"
+	APIFinish = "/finish"
+
 	// APINote is the user notes api group.
 	APINote = "/notes"
+	// APIBatch applies many note operations at once, it's nested under APINote.
+	APIBatch = "/batch"
+	// APIExport exports the notes as a Markdown vault, it's nested under APINote.
+	APIExport = "/export"
+	// APIAttachments is the note attachments api group, it's nested under a note.
+	APIAttachments = "/attachments"
+	// APIUploads is the tus resumable uploads endpoint.
+	APIUploads = "/uploads"
+	// APIReminder is the note reminder endpoint, it's nested under a note.
+	APIReminder = "/reminder"
+	// APIReminders is the reminders api group.
+	APIReminders = "/reminders"
+	// APIUpcoming lists the upcoming reminders, it's nested under APIReminders.
+	APIUpcoming = "/upcoming"
+	// APIChecklist is the note checklist api group, it's nested under a note.
+	APIChecklist = "/checklist"
+	// APIOrder reorders the checklist, it's nested under APIChecklist.
+	APIOrder = "/order"
+	// APISync is the delta sync endpoint of the offline first clients.
+	APISync = "/sync"
+	// APIEvents streams the note changes of the authenticated user as server-sent events.
+	APIEvents = "/events"
+	// APIWebSocket streams the events over a websocket, it's nested under APIEvents.
+	APIWebSocket = "/ws"
+	// APIImports is the note imports api group.
+	APIImports = "/imports"
+	// APIUsage is the usage of the authenticated user, it's nested under APIMe.
+	APIUsage = "/usage"
+
+	// APIOpenAPI is the OpenAPI document endpoint.
+	APIOpenAPI = "/openapi.json"
+	// APIDocs is the api docs page.
+	APIDocs = "/docs"
+
+	// GraphQL is the graphql endpoint.
+	GraphQL = "/graphql"
+
+	// Healthz is the liveness probe endpoint.
+	Healthz = "/healthz"
+	// Readyz is the readiness probe endpoint.
+	Readyz = "/readyz"
 )
 
-// SetupRouter sets up the app routes.
-func SetupRouter(db *gorm.DB) *gin.Engine {
+// Deps holds the dependencies shared between the router and the server, nil fields are created by SetupRouter.
+type Deps struct {
+	// Checker runs the readiness checks, the caller registers the checks of the stores backend.
+	Checker *health.Checker
+	// Metrics records the http and app metrics, they're served at the metrics path unless a separate metrics
+	// address is configured.
+	Metrics *metrics.Metrics
+	// Tracer traces the requests, the global otel provider is used if it's nil.
+	Tracer trace.TracerProvider
+	// Logger is the base of the request scoped loggers, the global logger is used if it's nil.
+	Logger *zerolog.Logger
+	// Blobs stores the attachments content, a local store in the configured directory is used if it's nil.
+	Blobs blob.Store
+	// Uploads keeps the partial resumable uploads, the caller cleans up the expired ones.
+	Uploads *tus.Store
+	// Events fans out the note changes made through the router to the event streams, an in process broker is used
+	// if it's nil.
+	Events events.Broker
+}
+
+// SetupRouter sets up the app routes using the given stores, config and dependencies.
+func SetupRouter(stores *models.Stores, cfg *config.Config, deps Deps) *gin.Engine {
+	if deps.Checker == nil {
+		deps.Checker = health.New()
+	}
+	if deps.Metrics == nil {
+		deps.Metrics = metrics.New()
+	}
+	if deps.Tracer == nil {
+		deps.Tracer = otel.GetTracerProvider()
+	}
+	if deps.Logger == nil {
+		deps.Logger = &log.Logger
+	}
+	if deps.Blobs == nil {
+		deps.Blobs = blob.NewLocal(cfg.Storage.Dir)
+	}
+	if deps.Uploads == nil {
+		deps.Uploads = tus.NewStore(cfg.Storage.UploadDir, cfg.Storage.UploadExpiry)
+	}
+	if deps.Events == nil {
+		deps.Events = events.NewLocal()
+	}
+	checker := deps.Checker
+	quotas := models.NewQuotas(cfg.Quota)
+	stores = events.Stores(stores, deps.Events).WithQuota(quotas)
+
 	// router
 	router := gin.New()
 
 	// middleware
-	router.Use(gin.Recovery(), middleware.CORS())
+	router.Use(tracing.Middleware(deps.Tracer), middleware.Logger(*deps.Logger))
+	if cfg.Metrics.Enabled {
+		router.Use(deps.Metrics.Middleware())
+	}
+	router.Use(gin.Recovery(), middleware.CORS(cfg.CORS))
+
+	tokens := auth.NewTokens(cfg.Auth)
+
+	// health
+	healthController := NewHealthController(checker)
+	router.GET(Healthz, healthController.Live)
+	router.GET(Readyz, healthController.Ready)
+
+	// metrics
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr == "" {
+		router.GET(cfg.Metrics.Path, gin.WrapH(deps.Metrics.Handler()))
+	}
 
 	// controllers
-	userController := NewUserController(db)
-	noteController := NewNoteController(db)
+	userController := NewUserController(stores.Users, tokens, deps.Metrics)
+	noteController := NewNoteController(stores, cfg.Pagination, deps.Metrics)
+	loginLinkController := NewLoginLinkController(stores, tokens, cfg.Server.PublicURL, deps.Metrics)
+	passkeyController := NewPasskeyController(stores.Credentials, tokens, cfg.WebAuthn, deps.Metrics)
+	graphqlController := NewGraphQLController(stores, cfg, deps.Metrics)
+	attachmentController := NewAttachmentController(stores, deps.Blobs, int64(cfg.Storage.MaxAttachmentSize), quotas)
+	uploadController := NewUploadController(deps.Uploads, attachmentController)
+	reminderController := NewReminderController(stores, cfg.Pagination)
+	checklistController := NewChecklistController(stores)
+	batchController := NewBatchController(stores, quotas, deps.Metrics)
+	importController := NewImportController(stores, deps.Blobs, int64(cfg.Imports.MaxSize))
+	exportController := NewExportController(stores, deps.Blobs)
+	syncController := NewSyncController(stores, quotas, deps.Metrics)
+	eventsController := NewEventsController(deps.Events, cfg.CORS)
+	usageController := NewUsageController(stores, quotas, int64(cfg.Storage.MaxAttachmentSize))
+
+	loginLinkLimiter := middleware.NewRateLimiter(cfg.Auth.LoginLinkIPRate, time.Minute)
+	transfer := middleware.Deadline(cfg.Server.TransferTimeout)
+
+	// graphql
+	router.POST(GraphQL, middleware.JWTAuth(tokens), graphqlController.Handle)
+
+	// docs
+	spec := NewOpenAPI(cfg)
 
 	v1 := router.Group(API)
 	{
+		v1.GET(APIOpenAPI, gin.WrapH(spec.Handler()))
+		v1.GET(APIDocs, gin.WrapH(openapi.DocsHandler(spec.Info.Title, API+APIOpenAPI)))
+
 		v1.POST(APIRegister, userController.Register)
 		v1.POST(APILogin, userController.Login)
+		v1.POST(APILoginLink, middleware.RateLimit(loginLinkLimiter), loginLinkController.Request)
+		v1.GET(APILoginLink, loginLinkController.Verify)
+		v1.POST(APILoginPasskey+APIBegin, passkeyController.BeginLogin)
+		v1.POST(APILoginPasskey+APIFinish, passkeyController.FinishLogin)
 		v1.POST(APIRefresh, userController.RefreshTokens)
 		v1.DELETE(APILogout, userController.Logout)
+		v1.OPTIONS(APIUploads, uploadController.Options)
 
-		authenticated := v1.Group("/", middleware.JWTAuth())
+		authenticated := v1.Group("/", middleware.JWTAuth(tokens))
 		{
 			// user
 			authenticated.GET(APIMe, userController.Me)
+			authenticated.GET(APIMe+APIUsage, usageController.Usage)
 			authenticated.POST(APIChangePassword, userController.ChangePassword)
 
+			// passkey
+			authenticated.GET(APIPasskey, passkeyController.List)
+			authenticated.POST(APIPasskey+APIBegin, passkeyController.BeginRegistration)
+			authenticated.POST(APIPasskey+APIFinish, passkeyController.FinishRegistration)
+			authenticated.PUT(APIPasskey+"/:id", passkeyController.Rename)
+			authenticated.DELETE(APIPasskey+"/:id", passkeyController.Delete)
+
 			// note
 			authenticated.GET(APINote, noteController.List)
 			authenticated.POST(APINote, noteController.Create)
+			authenticated.POST(APINote+APIBatch, batchController.Apply)
+			authenticated.GET(APINote+APIExport, exportController.Export)
 			authenticated.GET(APINote+"/:id", noteController.Retrieve)
 			authenticated.PUT(APINote+"/:id", noteController.Update)
 			authenticated.DELETE(APINote+"/:id", noteController.Delete)
+
+			// attachment
+			authenticated.GET(APINote+"/:id"+APIAttachments, attachmentController.List)
+			authenticated.POST(APINote+"/:id"+APIAttachments, transfer, attachmentController.Upload)
+			authenticated.GET(APINote+"/:id"+APIAttachments+"/:attachmentId", transfer, attachmentController.Download)
+			authenticated.DELETE(APINote+"/:id"+APIAttachments+"/:attachmentId", attachmentController.Delete)
+
+			// checklist
+			authenticated.GET(APINote+"/:id"+APIChecklist, checklistController.List)
+			authenticated.POST(APINote+"/:id"+APIChecklist, checklistController.Add)
+			authenticated.PUT(APINote+"/:id"+APIChecklist+APIOrder, checklistController.Reorder)
+			authenticated.PATCH(APINote+"/:id"+APIChecklist+"/:itemId", checklistController.Update)
+			authenticated.DELETE(APINote+"/:id"+APIChecklist+"/:itemId", checklistController.Delete)
+
+			// reminder
+			authenticated.GET(APINote+"/:id"+APIReminder, reminderController.Retrieve)
+			authenticated.PUT(APINote+"/:id"+APIReminder, reminderController.Set)
+			authenticated.DELETE(APINote+"/:id"+APIReminder, reminderController.Delete)
+			authenticated.GET(APIReminders+APIUpcoming, reminderController.Upcoming)
+
+			// sync
+			authenticated.GET(APISync, syncController.Pull)
+			authenticated.POST(APISync, syncController.Push)
+
+			// events
+			authenticated.GET(APIEvents, eventsController.Stream)
+			authenticated.GET(APIEvents+APIWebSocket, eventsController.WebSocket)
+
+			// import
+			authenticated.POST(APIImports, transfer, importController.Create)
+			authenticated.GET(APIImports+"/:id", importController.Retrieve)
+
+			// tus uploads
+			uploads := authenticated.Group(APIUploads, transfer, uploadController.Resumable)
+			uploads.POST("", uploadController.Create)
+			uploads.HEAD("/:id", uploadController.Head)
+			uploads.PATCH("/:id", uploadController.Patch)
+			uploads.DELETE("/:id", uploadController.Delete)
 		}
 	}
 
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/msal4/toastnotes/validation"
+)
+
+// MaxSyncChanges is the maximum number of changes of a sync response and of a push.
+const MaxSyncChanges = 500
+
+// cursorPrefix versions the format of the cursors.
+const cursorPrefix = "v1:"
+
+// SyncResponse is the response of the sync requests, every changed note is listed once in its current state.
+type SyncResponse struct {
+	Created []models.Note `json:"created"`
+	// Updated has the notes that were created before the cursor, the clients create the ones they don't have.
+	Updated []models.Note `json:"updated"`
+	Deleted []Tombstone   `json:"deleted"`
+	// Cursor is sent back as the cursor of the next sync, it's the same cursor if nothing changed.
+	Cursor string `json:"cursor"`
+	// HasMore reports whether there are more changes after the cursor.
+	HasMore bool `json:"hasMore"`
+}
+
+// Tombstone is a deleted note.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Version   int64     `json:"version"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// SyncPushForm is the body of the push requests.
+type SyncPushForm struct {
+	Changes []SyncChange `json:"changes" binding:"required,min=1,max=500"`
+}
+
+// SyncChange is a change made by a client, the updates and deletes are applied if the note is still at their base
+// version.
+type SyncChange struct {
+	Op string `json:"op" binding:"required,oneof=create update delete"`
+	// ID is the id of the note, the clients may choose the ids of the notes they create so that they can retry the
+	// push.
+	ID          string    `json:"id" binding:"required_unless=Op create,omitempty,uuid"`
+	BaseVersion int64     `json:"baseVersion" binding:"required_unless=Op create"`
+	Note        *SyncNote `json:"note"`
+}
+
+// SyncNote is the note of a create or update change, the content replaces the content of the updated notes.
+type SyncNote struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content"`
+}
+
+// SyncResult is the result of a change, the errors are in the format of the validation errors. A conflicting change
+// has the 409 status and the current note, or its tombstone if it was deleted.
+type SyncResult struct {
+	Status  int                `json:"status"`
+	Note    *models.Note       `json:"note,omitempty"`
+	Deleted *Tombstone         `json:"deleted,omitempty"`
+	Errors  []validation.Error `json:"errors,omitempty"`
+}
+
+// SyncPushResponse is the response of the push requests.
+type SyncPushResponse struct {
+	Results []SyncResult `json:"results"`
+}
+
+// SyncController is the group of the actions syncing the notes of the offline first clients with their dependencies.
+type SyncController struct {
+	Stores  *models.Stores
+	Quotas  models.Quotas
+	Metrics *metrics.Metrics
+}
+
+// NewSyncController creates a new sync controller.
+func NewSyncController(stores *models.Stores, quotas models.Quotas, m *metrics.Metrics) *SyncController {
+	return &SyncController{Stores: stores, Quotas: quotas, Metrics: m}
+}
+
+// Pull responds with the notes of the user created, updated or deleted since the cursor, all of them without a
+// cursor. The notes are listed in the order of their versions so the returned cursor never skips a change, even when
+// the notes are changed concurrently.
+func (ctrl *SyncController) Pull(c *gin.Context) {
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("Invalid cursor"))
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > MaxSyncChanges {
+		limit = MaxSyncChanges
+	}
+
+	userID := c.GetString(auth.UserIDKey)
+	notes, err := ctrl.Stores.Notes.WithContext(c.Request.Context()).Changes(userID, after, limit+1)
+	if err != nil {
+		abortWithError(c, err, "Could not retrieve the changes")
+		return
+	}
+
+	resp := SyncResponse{Created: []models.Note{}, Updated: []models.Note{}, Deleted: []Tombstone{}}
+	if len(notes) > limit {
+		notes, resp.HasMore = notes[:limit], true
+	}
+	for _, note := range notes {
+		switch {
+		case note.Deleted():
+			resp.Deleted = append(resp.Deleted, tombstone(&note))
+		case note.CreatedVersion > after:
+			resp.Created = append(resp.Created, note)
+		default:
+			resp.Updated = append(resp.Updated, note)
+		}
+		after = note.Version
+	}
+	resp.Cursor = encodeCursor(after)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Push applies the changes of a client in order in a transaction, every change is applied unless it fails or
+// conflicts with the changes the client hasn't pulled yet. The clients resolve the conflicts and push them again with
+// the versions of the conflicting notes as their base versions.
+func (ctrl *SyncController) Push(c *gin.Context) {
+	form := SyncPushForm{}
+	if errs := shouldBindJSON(c, &form); errs != nil {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errs)
+		return
+	}
+
+	userID := c.GetString(auth.UserIDKey)
+	ctx := c.Request.Context()
+	results := make([]SyncResult, len(form.Changes))
+	created := 0
+	err := ctrl.Stores.Transaction(ctx, func(tx *models.Stores) error {
+		for i, change := range form.Changes {
+			// every change is a nested transaction so that a failed one is rolled back by itself.
+			err := tx.Transaction(ctx, func(tx *models.Stores) error {
+				var isNew bool
+				results[i], isNew = ctrl.apply(c, tx.WithQuota(ctrl.Quotas).Notes, userID, change)
+				if results[i].Status != http.StatusOK {
+					return errOperationFailed
+				}
+				if isNew {
+					created++
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errOperationFailed) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		abortWithError(c, err, "Could not apply the changes")
+		return
+	}
+
+	ctrl.Metrics.NotesCreated.Add(float64(created))
+	c.JSON(http.StatusOK, SyncPushResponse{Results: results})
+}
+
+// apply applies a change using the notes store of a transaction, it reports whether a note was created.
+func (ctrl *SyncController) apply(c *gin.Context, notes models.NoteStore, userID string, change SyncChange) (SyncResult, bool) {
+	if errs := validateChange(change); len(errs) > 0 {
+		return SyncResult{Status: http.StatusNotAcceptable, Errors: errs}, false
+	}
+
+	note := &models.Note{UserID: userID}
+	note.ID = change.ID
+	var err error
+	switch change.Op {
+	case OpCreate:
+		if change.ID != "" {
+			existing, err := notes.FindForUserWithDeleted(change.ID, userID)
+			switch {
+			case err == nil && !existing.Deleted() && existing.Title == change.Note.Title && existing.Content == change.Note.Content:
+				// the create was pushed again after its response was lost.
+				return SyncResult{Status: http.StatusOK, Note: existing}, false
+			case err == nil:
+				return conflict(existing), false
+			case !errors.Is(err, models.ErrNotFound):
+				return ctrl.failed(c, err, change), false
+			}
+		}
+		note.Title, note.Content = change.Note.Title, change.Note.Content
+		if err := notes.Create(note); err != nil {
+			return ctrl.failed(c, err, change), false
+		}
+		return SyncResult{Status: http.StatusOK, Note: note}, true
+	case OpUpdate:
+		note.Title, note.Content = change.Note.Title, change.Note.Content
+		err = notes.UpdateIfVersion(note, change.BaseVersion)
+	case OpDelete:
+		err = notes.DeleteIfVersion(note, change.BaseVersion)
+	}
+	if err != nil && !errors.Is(err, models.ErrConflict) {
+		return ctrl.failed(c, err, change), false
+	}
+
+	current, findErr := notes.FindForUserWithDeleted(change.ID, userID)
+	if findErr != nil {
+		return ctrl.failed(c, findErr, change), false
+	}
+	if err != nil {
+		return conflict(current), false
+	}
+	if current.Deleted() {
+		deleted := tombstone(current)
+		return SyncResult{Status: http.StatusOK, Deleted: &deleted}, false
+	}
+	return SyncResult{Status: http.StatusOK, Note: current}, false
+}
+
+// failed converts the error of a change to its result.
+func (ctrl *SyncController) failed(c *gin.Context, err error, change SyncChange) SyncResult {
+	status, errs := operationError(c, err, change.Op)
+	return SyncResult{Status: status, Errors: errs}
+}
+
+// conflict is the result of a change conflicting with the current note.
+func conflict(current *models.Note) SyncResult {
+	result := SyncResult{Status: http.StatusConflict, Errors: []validation.Error{{Field: "baseVersion", Reason: "conflict"}}}
+	if current.Deleted() {
+		deleted := tombstone(current)
+		result.Deleted = &deleted
+	} else {
+		result.Note = current
+	}
+	return result
+}
+
+// validateChange validates the change with the binding tags, the note is required by the create and update changes.
+func validateChange(change SyncChange) []validation.Error {
+	if err := binding.Validator.ValidateStruct(change); err != nil {
+		var verr validator.ValidationErrors
+		if errors.As(err, &verr) {
+			return validation.DescriptiveErrors(verr)
+		}
+		return []validation.Error{{Field: "op", Reason: "invalid"}}
+	}
+	if (change.Op == OpCreate || change.Op == OpUpdate) && change.Note == nil {
+		return []validation.Error{{Field: "note", Reason: "required"}}
+	}
+	return nil
+}
+
+func tombstone(note *models.Note) Tombstone {
+	return Tombstone{ID: note.ID, Version: note.Version, DeletedAt: note.DeletedAt.Time}
+}
+
+// encodeCursor makes the cursor of the version, it's opaque to the clients.
+func encodeCursor(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(version, 10)))
+}
+
+// decodeCursor returns the version of the cursor, the empty cursor is before all the versions.
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	rest, ok := strings.CutPrefix(string(data), cursorPrefix)
+	if !ok {
+		return 0, errors.New("unknown cursor version")
+	}
+	version, err := strconv.ParseInt(rest, 10, 64)
+	if err == nil && version < 0 {
+		err = errors.New("negative cursor")
+	}
+	return version, err
+}
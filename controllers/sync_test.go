@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func pull(cursor string, limit string, cookies []*http.Cookie) (int, SyncResponse) {
+	w := serveHTTP("GET", API+APISync+"?"+url.Values{"cursor": {cursor}, "limit": {limit}}.Encode(), nil, cookies)
+	var resp SyncResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func push(body string, cookies []*http.Cookie) (int, SyncPushResponse) {
+	w := serveHTTP("POST", API+APISync, strings.NewReader(body), cookies)
+	var resp SyncPushResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func titlesOf(notes []models.Note) []string {
+	out := []string{}
+	for _, note := range notes {
+		out = append(out, note.Title)
+	}
+	return out
+}
+
+func TestSync(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+	other, _ := createMockUser(&otherCreds)
+
+	groceries := &models.Note{Title: "Groceries", UserID: user.ID}
+	ideas := &models.Note{Title: "Ideas", UserID: user.ID}
+	for _, note := range []*models.Note{groceries, ideas, {Title: "other", UserID: other.ID}} {
+		stores.Notes.Create(note)
+	}
+
+	var cursor string
+	t.Run("the_first_pull_lists_all_the_notes", func(t *testing.T) {
+		code, resp := pull("", "1", cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"Groceries"}, titlesOf(resp.Created))
+		assert.True(t, resp.HasMore)
+
+		code, resp = pull(resp.Cursor, "", cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"Ideas"}, titlesOf(resp.Created))
+		assert.False(t, resp.HasMore)
+		cursor = resp.Cursor
+
+		_, resp = pull(cursor, "", cookies)
+		assert.Empty(t, resp.Created)
+		assert.Equal(t, cursor, resp.Cursor, "the cursor stays the same when nothing changed")
+	})
+
+	t.Run("the_next_pulls_list_the_changes_since_the_cursor", func(t *testing.T) {
+		groceries.Title = "Groceries list"
+		stores.Notes.Update(groceries)
+		stores.Notes.Delete(ideas)
+		created := &models.Note{Title: "New", UserID: user.ID}
+		stores.Notes.Create(created)
+
+		_, resp := pull(cursor, "", cookies)
+		assert.Equal(t, []string{"New"}, titlesOf(resp.Created))
+		assert.Equal(t, []string{"Groceries list"}, titlesOf(resp.Updated))
+		if assert.Len(t, resp.Deleted, 1) {
+			assert.Equal(t, ideas.ID, resp.Deleted[0].ID)
+			assert.False(t, resp.Deleted[0].DeletedAt.IsZero())
+		}
+		cursor = resp.Cursor
+	})
+
+	t.Run("pushed_changes_are_applied_unless_they_conflict", func(t *testing.T) {
+		found, _ := stores.Notes.FindForUser(groceries.ID, user.ID)
+		id := uuid.NewString()
+		body := `{"changes":[
+			{"op":"create","id":"` + id + `","note":{"title":"Offline"}},
+			{"op":"update","id":"` + groceries.ID + `","baseVersion":` + strconv.FormatInt(found.Version, 10) + `,"note":{"title":"Synced"}},
+			{"op":"update","id":"` + groceries.ID + `","baseVersion":` + strconv.FormatInt(found.Version, 10) + `,"note":{"title":"Stale"}},
+			{"op":"update","id":"` + ideas.ID + `","baseVersion":1,"note":{"title":"Revived"}},
+			{"op":"delete","id":"` + ideas.ID + `","baseVersion":1},
+			{"op":"update","id":"` + uuid.NewString() + `","baseVersion":1,"note":{"title":"Missing"}},
+			{"op":"update","id":"` + groceries.ID + `","note":{"title":"No base"}}
+		]}`
+		code, resp := push(body, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		statuses := []int{}
+		for _, r := range resp.Results {
+			statuses = append(statuses, r.Status)
+		}
+		assert.Equal(t, []int{200, 200, 409, 409, 200, 404, 406}, statuses)
+		if len(resp.Results) != 7 {
+			return
+		}
+		assert.Equal(t, id, resp.Results[0].Note.ID, "the clients choose the ids")
+		assert.Equal(t, "Synced", resp.Results[2].Note.Title, "a conflict has the current note")
+		assert.Equal(t, ideas.ID, resp.Results[3].Deleted.ID, "or its tombstone")
+		assert.Equal(t, ideas.ID, resp.Results[4].Deleted.ID, "deleting a deleted note does nothing")
+
+		code, resp = push(`{"changes":[{"op":"create","id":"`+id+`","note":{"title":"Offline"}}]}`, cookies)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, http.StatusOK, resp.Results[0].Status, "the creates can be pushed again")
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		assert.ElementsMatch(t, []string{"Synced", "New", "Offline"}, titlesOf(notes))
+
+		_, pulled := pull(cursor, "", cookies)
+		assert.Equal(t, []string{"Offline"}, titlesOf(pulled.Created))
+		assert.Equal(t, []string{"Synced"}, titlesOf(pulled.Updated))
+	})
+
+	t.Run("invalid_requests_are_rejected", func(t *testing.T) {
+		code, _ := pull("not a cursor", "", cookies)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = push(`{"changes":[]}`, cookies)
+		assert.Equal(t, http.StatusNotAcceptable, code)
+		code, _ = pull("", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/tus"
+	"github.com/msal4/toastnotes/utils"
+)
+
+// offsetOctetStream is the content type of the tus PATCH requests.
+const offsetOctetStream = "application/offset+octet-stream"
+
+// errAttachFailed is returned from the upload finish func when attaching the file failed, the response has already
+// been written.
+var errAttachFailed = errors.New("attaching the upload failed")
+
+// UploadController implements the tus resumable uploads, a complete upload is attached to the note whose id is in
+// the noteId metadata.
+type UploadController struct {
+	Store       *tus.Store
+	Attachments *AttachmentController
+}
+
+// NewUploadController creates a new upload controller.
+func NewUploadController(store *tus.Store, attachments *AttachmentController) *UploadController {
+	return &UploadController{Store: store, Attachments: attachments}
+}
+
+// Resumable sets the Tus-Resumable header of the responses and rejects the requests using another protocol version.
+func (ctrl *UploadController) Resumable(c *gin.Context) {
+	c.Header("Tus-Resumable", tus.Version)
+	if c.GetHeader("Tus-Resumable") != tus.Version {
+		c.Header("Tus-Version", tus.Version)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, utils.Err("Unsupported tus version"))
+		return
+	}
+	c.Next()
+}
+
+// Options describes the supported protocol version, extensions and maximum upload size.
+func (ctrl *UploadController) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tus.Version)
+	c.Header("Tus-Version", tus.Version)
+	c.Header("Tus-Extension", tus.Extensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(ctrl.Attachments.MaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create creates an upload of Upload-Length bytes, the Upload-Metadata must have the noteId of one of the user notes
+// and should have the filename.
+func (ctrl *UploadController) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("Invalid Upload-Length"))
+		return
+	}
+	if length > ctrl.Attachments.MaxSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The file is too large"))
+		return
+	}
+	metadata, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("Invalid Upload-Metadata"))
+		return
+	}
+
+	if metadata["noteId"] == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("The noteId metadata is required"))
+		return
+	}
+	note, ok := ctrl.findNote(c, metadata["noteId"], c.GetString(auth.UserIDKey))
+	if !ok || !ctrl.Attachments.checkQuota(c, note.UserID, length) {
+		return
+	}
+
+	up := &tus.Upload{UserID: note.UserID, Length: length, Metadata: metadata}
+	if err := ctrl.Store.Create(up); err != nil {
+		abortWithError(c, err, "Could not create the upload")
+		return
+	}
+	c.Header("Location", API+APIUploads+"/"+up.ID)
+	c.Header("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	// an empty file has nothing to upload.
+	if up.Complete() && !ctrl.finish(c, up) {
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// Head responds with the offset the client must resume the upload from.
+func (ctrl *UploadController) Head(c *gin.Context) {
+	up, ok := ctrl.findUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(up.Length, 10))
+	c.Header("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+	if len(up.Metadata) > 0 {
+		c.Header("Upload-Metadata", tus.FormatMetadata(up.Metadata))
+	}
+	c.Status(http.StatusOK)
+}
+
+// Patch appends the request body to the upload at Upload-Offset, the upload is attached to its note once it's
+// complete.
+func (ctrl *UploadController) Patch(c *gin.Context) {
+	if c.ContentType() != offsetOctetStream {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, utils.Err("The content type must be "+offsetOctetStream))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("Invalid Upload-Offset"))
+		return
+	}
+
+	up, ok := ctrl.findUpload(c)
+	if !ok {
+		return
+	}
+	if c.Request.ContentLength > up.Length-offset {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, utils.Err("The body exceeds the Upload-Length"))
+		return
+	}
+
+	up, err = ctrl.Store.Append(up.ID, offset, c.Request.Body)
+	if err != nil {
+		switch {
+		case up != nil:
+			// the received data is kept, the client can resume from the new offset.
+			middleware.Log(c).Warn().Err(err).Str("upload", up.ID).Int64("offset", up.Offset).Msg("The upload was interrupted")
+			c.AbortWithStatusJSON(http.StatusBadRequest, utils.Err("The upload was interrupted"))
+		default:
+			ctrl.abortWithUploadError(c, err)
+		}
+		return
+	}
+	c.Header("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+
+	if up.Complete() && !ctrl.finish(c, up) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Delete terminates the upload and deletes its data.
+func (ctrl *UploadController) Delete(c *gin.Context) {
+	up, ok := ctrl.findUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.Store.Delete(up.ID); err != nil {
+		ctrl.abortWithUploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// finish attaches the complete upload to its note and sets the X-Attachment-Id header, it responds with an error and
+// returns false if it fails.
+func (ctrl *UploadController) finish(c *gin.Context, up *tus.Upload) bool {
+	note, ok := ctrl.findNote(c, up.Metadata["noteId"], up.UserID)
+	if !ok {
+		return false
+	}
+	filename := up.Metadata["filename"]
+	if filename == "" {
+		filename = up.Metadata["name"]
+	}
+
+	var att *models.Attachment
+	err := ctrl.Store.Finish(up.ID, func(up *tus.Upload, data *os.File) error {
+		if att, ok = ctrl.Attachments.attach(c, note, filename, data, up.Length); !ok {
+			return errAttachFailed
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errAttachFailed) {
+			ctrl.abortWithUploadError(c, err)
+		}
+		return false
+	}
+
+	c.Header("X-Attachment-Id", att.ID)
+	return true
+}
+
+func (ctrl *UploadController) findNote(c *gin.Context, noteID, userID string) (*models.Note, bool) {
+	note, err := ctrl.Attachments.Notes.WithContext(c.Request.Context()).FindForUser(noteID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Note not found"))
+			return nil, false
+		}
+		abortWithError(c, err, "Could not handle your request")
+		return nil, false
+	}
+
+	return note, true
+}
+
+func (ctrl *UploadController) findUpload(c *gin.Context) (*tus.Upload, bool) {
+	up, err := ctrl.Store.Get(c.Param("id"))
+	if err == nil && up.UserID != c.GetString(auth.UserIDKey) {
+		err = tus.ErrNotFound
+	}
+	if err != nil {
+		ctrl.abortWithUploadError(c, err)
+		return nil, false
+	}
+
+	return up, true
+}
+
+// abortWithUploadError responds with the status of the upload store errors.
+func (ctrl *UploadController) abortWithUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, tus.ErrNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("Upload not found"))
+	case errors.Is(err, tus.ErrExpired):
+		c.AbortWithStatusJSON(http.StatusGone, utils.Err("The upload has expired"))
+	case errors.Is(err, tus.ErrOffsetMismatch):
+		c.AbortWithStatusJSON(http.StatusConflict, utils.Err("The Upload-Offset doesn't match the upload offset"))
+	case errors.Is(err, tus.ErrLocked):
+		c.AbortWithStatusJSON(http.StatusLocked, utils.Err("The upload is in use by another request"))
+	default:
+		abortWithError(c, err, "Could not handle your request")
+	}
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/tus"
+	"github.com/stretchr/testify/assert"
+)
+
+// tusRequest sends a tus request with the given headers.
+func tusRequest(method, url string, body io.Reader, headers map[string]string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Set("Tus-Resumable", tus.Version)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func createUpload(noteID string, length int, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	return tusRequest("POST", API+APIUploads, nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": tus.FormatMetadata(map[string]string{"noteId": noteID, "filename": "notes.txt"}),
+	}, cookies)
+}
+
+func patchUpload(url string, offset int, data string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	return tusRequest("PATCH", url, strings.NewReader(data), map[string]string{
+		"Content-Type":  offsetOctetStream,
+		"Upload-Offset": strconv.Itoa(offset),
+	}, cookies)
+}
+
+func TestUploads(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+	note := &models.Note{Title: mockTitle, UserID: user.ID}
+	stores.Notes.Create(note)
+
+	content := "hello, resumable uploads\n"
+	var location string
+
+	t.Run("options_describes_the_server", func(t *testing.T) {
+		w := serveHTTP("OPTIONS", API+APIUploads, nil, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, tus.Version, w.Header().Get("Tus-Version"))
+		assert.Equal(t, tus.Extensions, w.Header().Get("Tus-Extension"))
+		assert.Equal(t, strconv.Itoa(cfg.Storage.MaxAttachmentSize), w.Header().Get("Tus-Max-Size"))
+	})
+
+	t.Run("other_protocol_versions_are_rejected", func(t *testing.T) {
+		w := tusRequest("POST", API+APIUploads, nil, map[string]string{"Tus-Resumable": "0.2.2"}, cookies)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, tus.Version, w.Header().Get("Tus-Version"))
+	})
+
+	t.Run("a_user_can_create_an_upload", func(t *testing.T) {
+		w := createUpload(note.ID, len(content), cookies)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, tus.Version, w.Header().Get("Tus-Resumable"))
+		assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+		location = w.Header().Get("Location")
+		assert.True(t, strings.HasPrefix(location, API+APIUploads+"/"), location)
+
+		w = tusRequest("HEAD", location, nil, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+		assert.Equal(t, strconv.Itoa(len(content)), w.Header().Get("Upload-Length"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("invalid_uploads_are_rejected", func(t *testing.T) {
+		w := tusRequest("POST", API+APIUploads, nil, map[string]string{"Upload-Length": "-1"}, cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = tusRequest("POST", API+APIUploads, nil, map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename !"}, cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = tusRequest("POST", API+APIUploads, nil, map[string]string{"Upload-Length": "1"}, cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "the noteId is required")
+
+		w = createUpload(note.ID, cfg.Storage.MaxAttachmentSize+1, cookies)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("the_data_must_be_an_offset_octet_stream", func(t *testing.T) {
+		w := tusRequest("PATCH", location, strings.NewReader("hello"), map[string]string{
+			"Content-Type": "text/plain", "Upload-Offset": "0",
+		}, cookies)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("a_user_can_upload_in_chunks", func(t *testing.T) {
+		w := patchUpload(location, 0, content[:10], cookies)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+		assert.Empty(t, w.Header().Get("X-Attachment-Id"))
+
+		w = tusRequest("HEAD", location, nil, nil, cookies)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+	})
+
+	t.Run("the_offset_must_match", func(t *testing.T) {
+		w := patchUpload(location, 0, content, cookies)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = patchUpload(location, 10, content, cookies)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "the data exceeds the length")
+	})
+
+	t.Run("other_users_can_not_access_the_upload", func(t *testing.T) {
+		otherCreds := auth.Credentials{Email: "other@email.com", Password: mockPassword}
+		createMockUser(&otherCreds)
+		otherCookies := login(otherCreds).Result().Cookies()
+
+		assert.Equal(t, http.StatusNotFound, tusRequest("HEAD", location, nil, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, patchUpload(location, 10, content[10:], otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, tusRequest("DELETE", location, nil, nil, otherCookies).Code)
+		assert.Equal(t, http.StatusNotFound, createUpload(note.ID, 1, otherCookies).Code)
+	})
+
+	t.Run("the_complete_upload_is_attached_to_the_note", func(t *testing.T) {
+		w := patchUpload(location, 10, content[10:], cookies)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, strconv.Itoa(len(content)), w.Header().Get("Upload-Offset"))
+		attID := w.Header().Get("X-Attachment-Id")
+		assert.NotEmpty(t, attID)
+
+		w = serveHTTP("GET", API+APINote+"/"+note.ID+APIAttachments+"/"+attID, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.String())
+		assert.Equal(t, "attachment; filename=notes.txt", w.Header().Get("Content-Disposition"))
+
+		assert.Equal(t, http.StatusNotFound, tusRequest("HEAD", location, nil, nil, cookies).Code, "the upload is removed")
+	})
+
+	t.Run("empty_files_are_attached_right_away", func(t *testing.T) {
+		w := createUpload(note.ID, 0, cookies)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		attID := w.Header().Get("X-Attachment-Id")
+		assert.NotEmpty(t, attID)
+
+		w = serveHTTP("GET", API+APINote+"/"+note.ID+APIAttachments, nil, cookies)
+		var resp struct{ Result []models.Attachment }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Len(t, resp.Result, 2)
+	})
+
+	t.Run("a_user_can_terminate_an_upload", func(t *testing.T) {
+		location := createUpload(note.ID, 10, cookies).Header().Get("Location")
+		w := tusRequest("DELETE", location, nil, nil, cookies)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		assert.Equal(t, http.StatusNotFound, tusRequest("HEAD", location, nil, nil, cookies).Code)
+		assert.Equal(t, http.StatusNotFound, patchUpload(location, 0, "hello", cookies).Code)
+	})
+
+	t.Run("the_patches_are_not_limited_to_the_server_timeouts", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(router)
+		server.Config.ReadTimeout, server.Config.WriteTimeout = 50*time.Millisecond, 50*time.Millisecond
+		server.Start()
+		defer server.Close()
+
+		location := createUpload(note.ID, 10, cookies).Header().Get("Location")
+		// the data arrives slower than the server timeouts allow.
+		body, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte("hel"))
+			time.Sleep(150 * time.Millisecond)
+			pw.Write([]byte("lo"))
+			pw.Close()
+		}()
+		req, _ := http.NewRequest("PATCH", server.URL+location, body)
+		req.ContentLength = 5
+		req.Header.Set("Tus-Resumable", tus.Version)
+		req.Header.Set("Content-Type", offsetOctetStream)
+		req.Header.Set("Upload-Offset", "0")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if assert.Nil(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+			assert.Equal(t, "5", resp.Header.Get("Upload-Offset"))
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+)
+
+// UsageLimit is the usage of a resource and its limit, a nil limit is unlimited.
+type UsageLimit struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit"`
+}
+
+// UsageReport is the usage of the user against the quota of their plan.
+type UsageReport struct {
+	// Plan is the quota plan of the user, empty for the default quota.
+	Plan            string     `json:"plan"`
+	Notes           UsageLimit `json:"notes"`
+	ContentBytes    UsageLimit `json:"contentBytes"`
+	AttachmentBytes UsageLimit `json:"attachmentBytes"`
+	// MaxNoteSize is the maximum size of the title and content of a note in bytes, nil if unlimited.
+	MaxNoteSize *int64 `json:"maxNoteSize"`
+	// MaxAttachmentSize is the maximum size of a single attachment in bytes.
+	MaxAttachmentSize int64 `json:"maxAttachmentSize"`
+}
+
+// QuotaErrorResponse is the body of the responses rejecting a change that exceeds the user quota.
+type QuotaErrorResponse struct {
+	Error string `json:"error"`
+	// Quota is the exceeded limit, notes, contentBytes, attachmentBytes or noteSize.
+	Quota string `json:"quota"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+}
+
+// UsageController reports the usage of the users against the quota of their plan.
+type UsageController struct {
+	Store             models.UsageStore
+	Users             models.UserStore
+	Quotas            models.Quotas
+	MaxAttachmentSize int64
+}
+
+// NewUsageController creates a new usage controller.
+func NewUsageController(stores *models.Stores, quotas models.Quotas, maxAttachmentSize int64) *UsageController {
+	return &UsageController{Store: stores.Usage, Users: stores.Users, Quotas: quotas, MaxAttachmentSize: maxAttachmentSize}
+}
+
+// Usage responds with the authenticated user usage and limits.
+func (ctrl *UsageController) Usage(c *gin.Context) {
+	userID := c.GetString(auth.UserIDKey)
+	plan, quota, err := userQuota(c, ctrl.Users, ctrl.Quotas, userID)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve your usage")
+		return
+	}
+	usage, err := ctrl.Store.WithContext(c.Request.Context()).Get(userID)
+	if err != nil {
+		abortWithError(c, err, "Failed to retrieve your usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageReport{
+		Plan:              plan,
+		Notes:             UsageLimit{Used: usage.Notes, Limit: limit(quota.MaxNotes)},
+		ContentBytes:      UsageLimit{Used: usage.ContentBytes, Limit: limit(quota.MaxContentBytes)},
+		AttachmentBytes:   UsageLimit{Used: usage.AttachmentBytes, Limit: limit(quota.MaxAttachmentBytes)},
+		MaxNoteSize:       limit(quota.MaxNoteSize),
+		MaxAttachmentSize: ctrl.MaxAttachmentSize,
+	})
+}
+
+// userQuota returns the plan of the user and its quota.
+func userQuota(c *gin.Context, users models.UserStore, quotas models.Quotas, userID string) (string, models.Quota, error) {
+	user, err := users.WithContext(c.Request.Context()).RetrieveUser(userID)
+	if err != nil {
+		return "", models.Quota{}, err
+	}
+	return user.Plan, quotas.For(user.Plan), nil
+}
+
+// limit returns nil for the unlimited zero limits.
+func limit(n int64) *int64 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// abortWithQuotaError responds with the exceeded limit if err is a quota error and reports whether it was one. A note
+// larger than the maximum size is rejected with 413 and going over the user totals with 403.
+func abortWithQuotaError(c *gin.Context, err error) bool {
+	var qe *models.QuotaError
+	if !errors.As(err, &qe) {
+		return false
+	}
+
+	status := http.StatusForbidden
+	if qe.Resource == models.QuotaNoteSize {
+		status = http.StatusRequestEntityTooLarge
+	}
+	c.AbortWithStatusJSON(status, QuotaErrorResponse{Error: qe.Message(), Quota: qe.Resource, Limit: qe.Limit, Used: qe.Used})
+	return true
+}
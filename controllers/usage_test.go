@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func createNote(title, content string, cookies []*http.Cookie) int {
+	body, _ := json.Marshal(models.Note{Title: title, Content: content})
+	return serveHTTP("POST", API+APINote, bytes.NewReader(body), cookies).Code
+}
+
+func getUsage(t *testing.T, cookies []*http.Cookie) UsageReport {
+	t.Helper()
+	w := serveHTTP("GET", API+APIMe+APIUsage, nil, cookies)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report UsageReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	return report
+}
+
+func TestUsage(t *testing.T) {
+	t.Cleanup(cleanup)
+	user, _ := createMockUser(nil)
+	cookies := login(mockUserCreds).Result().Cookies()
+
+	t.Run("reports_the_usage_against_the_limits", func(t *testing.T) {
+		report := getUsage(t, cookies)
+		assert.Zero(t, report.Notes.Used)
+		if assert.NotNil(t, report.Notes.Limit) {
+			assert.EqualValues(t, cfg.Quota.MaxNotes, *report.Notes.Limit)
+		}
+		assert.EqualValues(t, cfg.Quota.MaxNoteSize, *report.MaxNoteSize)
+		assert.EqualValues(t, cfg.Storage.MaxAttachmentSize, report.MaxAttachmentSize)
+
+		assert.Equal(t, http.StatusOK, createNote("title", "content", cookies))
+		report = getUsage(t, cookies)
+		assert.EqualValues(t, 1, report.Notes.Used)
+		assert.EqualValues(t, 12, report.ContentBytes.Used)
+	})
+
+	t.Run("reports_the_limits_of_the_plan_of_the_user", func(t *testing.T) {
+		found, _ := stores.Users.RetrieveUser(user.ID)
+		stores.Users.SetPlan(found, "pro")
+		defer stores.Users.SetPlan(found, "")
+
+		report := getUsage(t, cookies)
+		assert.Equal(t, "pro", report.Plan)
+		if assert.NotNil(t, report.Notes.Limit) {
+			assert.EqualValues(t, 40, *report.Notes.Limit)
+		}
+		assert.Nil(t, report.ContentBytes.Limit)
+		assert.EqualValues(t, 2048, *report.MaxNoteSize)
+	})
+
+	t.Run("notes_larger_than_the_maximum_size_are_rejected", func(t *testing.T) {
+		w := serveHTTP("POST", API+APINote, strings.NewReader(`{"title":"large","content":"`+strings.Repeat("a", cfg.Quota.MaxNoteSize)+`"}`), cookies)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		var resp QuotaErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, models.QuotaNoteSize, resp.Quota)
+		assert.EqualValues(t, cfg.Quota.MaxNoteSize, resp.Limit)
+		assert.NotEmpty(t, resp.Error)
+	})
+
+	t.Run("the_note_count_is_limited_under_concurrent_creates", func(t *testing.T) {
+		var wg sync.WaitGroup
+		codes := make([]int, cfg.Quota.MaxNotes+10)
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = createNote("note", "", cookies)
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, code := range codes {
+			if code == http.StatusOK {
+				created++
+			} else {
+				assert.Equal(t, http.StatusForbidden, code)
+			}
+		}
+		assert.Equal(t, cfg.Quota.MaxNotes-1, created)
+		assert.EqualValues(t, cfg.Quota.MaxNotes, getUsage(t, cookies).Notes.Used)
+
+		w := serveHTTP("POST", API+APINote, strings.NewReader(`{"title":"one more"}`), cookies)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"quota":"notes"`)
+	})
+
+	t.Run("deleting_notes_frees_the_quota", func(t *testing.T) {
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		w := serveHTTP("DELETE", API+APINote+"/"+notes[0].ID, nil, cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, cfg.Quota.MaxNotes-1, getUsage(t, cookies).Notes.Used)
+		assert.Equal(t, http.StatusOK, createNote("again", "", cookies))
+	})
+
+	t.Run("attachments_are_limited", func(t *testing.T) {
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		w := uploadAttachment(notes[0].ID, "large.bin", make([]byte, cfg.Storage.MaxAttachmentSize), cookies)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = uploadAttachment(notes[0].ID, "more.bin", make([]byte, 2048), cookies)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"quota":"attachmentBytes"`)
+
+		w = createUpload(notes[0].ID, 2048, cookies)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.EqualValues(t, cfg.Storage.MaxAttachmentSize, getUsage(t, cookies).AttachmentBytes.Used)
+	})
+}
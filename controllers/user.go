@@ -8,22 +8,27 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/middleware"
 	"github.com/msal4/toastnotes/models"
 	"github.com/msal4/toastnotes/utils"
 	"github.com/msal4/toastnotes/validation"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 // UserController holds all the user controller dependencies.
 type UserController struct {
-	Repository *models.UserRepository
+	Store   models.UserStore
+	Tokens  *auth.Tokens
+	Metrics *metrics.Metrics
 }
 
 // NewUserController creates a new user controller.
-func NewUserController(db *gorm.DB) *UserController {
+func NewUserController(store models.UserStore, tokens *auth.Tokens, m *metrics.Metrics) *UserController {
 	return &UserController{
-		Repository: models.NewUserRepository(db),
+		Store:   store,
+		Tokens:  tokens,
+		Metrics: m,
 	}
 }
 
@@ -37,19 +42,20 @@ func (ctrl *UserController) Register(c *gin.Context) {
 	}
 
 	// Check if the email is taken.
-	if ctrl.Repository.EmailTaken(form.Email) {
+	if ctrl.Store.WithContext(c.Request.Context()).EmailTaken(form.Email) {
 		c.AbortWithStatusJSON(http.StatusNotAcceptable, utils.Err("A user with this email already exists"))
 		return
 	}
 
 	// Create the user.
-	user, err := ctrl.Repository.RegisterUser(form)
+	user, err := ctrl.Store.WithContext(c.Request.Context()).RegisterUser(form)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, utils.Err("Failed to register user"))
+		abortWithError(c, err, "Failed to register user")
 		return
 	}
 
-	generateTokens(c, user.ID, user.TokenVersion, user)
+	ctrl.Metrics.Registrations.Inc()
+	generateTokens(c, ctrl.Tokens, user, user)
 }
 
 // Login a user.
@@ -60,22 +66,25 @@ func (ctrl *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := ctrl.Repository.DB.First(&user, "email = ?", credentials.Email).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+	user, err := ctrl.Store.WithContext(c.Request.Context()).FindByEmail(credentials.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			ctrl.Metrics.Login(metrics.LoginPassword, false)
 			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
 			return
 		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Failed to find the user"))
+		abortWithError(c, err, "Failed to find the user")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
+		ctrl.Metrics.Login(metrics.LoginPassword, false)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err("Wrong email or password"))
 		return
 	}
 
-	generateTokens(c, user.ID, user.TokenVersion, gin.H{"message": "Login successful"})
+	ok := generateTokens(c, ctrl.Tokens, user, gin.H{"message": "Login successful"})
+	ctrl.Metrics.Login(metrics.LoginPassword, ok)
 }
 
 // ChangePassword takes the current password for the authenticated user and allows them to set a new
@@ -87,13 +96,13 @@ func (ctrl *UserController) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	user, err := ctrl.Repository.RetrieveUser(c.GetString(auth.UserIDKey))
+	user, err := ctrl.Store.WithContext(c.Request.Context()).RetrieveUser(c.GetString(auth.UserIDKey))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, models.ErrNotFound) {
 			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
 			return
 		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Failed to find the user"))
+		abortWithError(c, err, "Failed to find the user")
 		return
 	}
 
@@ -107,18 +116,8 @@ func (ctrl *UserController) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	hash, err := auth.HashPassword(form.NewPassword)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Failed to update password"))
-		return
-	}
-
-	err = ctrl.Repository.DB.Model(&user).Updates(models.User{
-		Password:     hash,
-		TokenVersion: user.TokenVersion + 1,
-	}).Error
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err("Failed to update password"))
+	if err := ctrl.Store.WithContext(c.Request.Context()).SetPassword(user, form.NewPassword); err != nil {
+		abortWithError(c, err, "Failed to update password")
 		return
 	}
 
@@ -129,9 +128,9 @@ func (ctrl *UserController) ChangePassword(c *gin.Context) {
 func (ctrl *UserController) Me(c *gin.Context) {
 	userID := c.GetString(auth.UserIDKey)
 
-	user, err := ctrl.Repository.RetrieveUser(userID)
+	user, err := ctrl.Store.WithContext(c.Request.Context()).RetrieveUser(userID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, models.ErrNotFound) {
 			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
 			return
 		}
@@ -145,15 +144,15 @@ func (ctrl *UserController) Me(c *gin.Context) {
 
 // Logout deletes token cookies.
 func (ctrl *UserController) Logout(c *gin.Context) {
-	http.SetCookie(c.Writer, &http.Cookie{Path: "/", Name: auth.RefreshTokenKey, MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
-	http.SetCookie(c.Writer, &http.Cookie{Path: "/", Name: auth.AccessTokenKey, MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
+	http.SetCookie(c.Writer, &http.Cookie{Path: "/", Name: ctrl.Tokens.RefreshTokenCookie, MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
+	http.SetCookie(c.Writer, &http.Cookie{Path: "/", Name: ctrl.Tokens.AccessTokenCookie, MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
 
 	c.JSON(http.StatusOK, utils.Msg("Logged out"))
 }
 
 // RefreshTokens uses the refresh token to generate an access token and regenerates refresh_token.
 func (ctrl *UserController) RefreshTokens(c *gin.Context) {
-	tokenStr, err := c.Cookie(auth.RefreshTokenKey)
+	tokenStr, err := c.Cookie(ctrl.Tokens.RefreshTokenCookie)
 
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.Err("Unauthorized"))
@@ -161,9 +160,7 @@ func (ctrl *UserController) RefreshTokens(c *gin.Context) {
 	}
 
 	claims := auth.RefreshTokenClaims{}
-	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
-		return auth.JWTSecret, nil
-	})
+	token, err := ctrl.Tokens.ParseToken(tokenStr, &claims)
 
 	if err != nil {
 		if err == jwt.ErrSignatureInvalid {
@@ -179,9 +176,9 @@ func (ctrl *UserController) RefreshTokens(c *gin.Context) {
 		return
 	}
 
-	user, err := ctrl.Repository.RetrieveUser(claims.UserID)
+	user, err := ctrl.Store.WithContext(c.Request.Context()).RetrieveUser(claims.UserID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, models.ErrNotFound) {
 			c.AbortWithStatusJSON(http.StatusNotFound, utils.Err("User not found"))
 			return
 		}
@@ -195,7 +192,7 @@ func (ctrl *UserController) RefreshTokens(c *gin.Context) {
 		return
 	}
 
-	generateTokens(c, user.ID, user.TokenVersion, utils.Msg("Tokens refreshed"))
+	generateTokens(c, ctrl.Tokens, user, utils.Msg("Tokens refreshed"))
 }
 
 func shouldBindJSON(c *gin.Context, obj interface{}) *gin.H {
@@ -209,21 +206,36 @@ func shouldBindJSON(c *gin.Context, obj interface{}) *gin.H {
 	return nil
 }
 
-func generateTokens(c *gin.Context, userID string, tokenVersion int, resp interface{}) {
-	tokenStr, err := auth.GenerateAccessToken(userID)
+// abortWithError logs err using the request logger and responds with a 500 and msg.
+func abortWithError(c *gin.Context, err error, msg string) {
+	c.Error(err)
+	middleware.Log(c).Error().Err(err).Msg(msg)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, utils.Err(msg))
+}
+
+// generateTokens sets the access and refresh token cookies of the user and responds with resp, disabled users are
+// rejected. It reports whether the tokens were generated.
+func generateTokens(c *gin.Context, tokens *auth.Tokens, user *models.User, resp interface{}) bool {
+	if user.Disabled() {
+		c.AbortWithStatusJSON(http.StatusForbidden, utils.Err("This account has been disabled"))
+		return false
+	}
+
+	tokenStr, err := tokens.GenerateAccessToken(user.ID)
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		abortWithError(c, err, "Could not handle your request")
+		return false
 	}
 
-	refreshTokenStr, err := auth.GenerateRefreshToken(userID, tokenVersion)
+	refreshTokenStr, err := tokens.GenerateRefreshToken(user.ID, user.TokenVersion)
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		abortWithError(c, err, "Could not handle your request")
+		return false
 	}
 
-	c.SetCookie(auth.AccessTokenKey, tokenStr, auth.AccessTokenAge, "/", "", true, true)
-	c.SetCookie(auth.RefreshTokenKey, refreshTokenStr, auth.RefreshTokenAge, "/", "", true, true)
+	c.SetCookie(tokens.AccessTokenCookie, tokenStr, tokens.AccessTokenMaxAge(), "/", "", true, true)
+	c.SetCookie(tokens.RefreshTokenCookie, refreshTokenStr, tokens.RefreshTokenMaxAge(), "/", "", true, true)
 
 	c.JSON(http.StatusOK, resp)
+	return true
 }
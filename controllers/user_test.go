@@ -34,8 +34,8 @@ func TestRegister(t *testing.T) {
 		}
 		testRegister(t, form, http.StatusOK)
 
-		var user models.User
-		assert.Nil(t, db.First(&user, "email = ?", mockEmail).Error)
+		_, err := stores.Users.FindByEmail(mockEmail)
+		assert.Nil(t, err)
 	})
 
 	t.Run("does_not_register_with_invalid_data", func(t *testing.T) {
@@ -50,13 +50,14 @@ func TestRegister(t *testing.T) {
 		}
 		testRegister(t, form, http.StatusNotAcceptable)
 
-		assert.NotNil(t, db.First(&models.User{}, "email = ?", mockEmail).Error)
+		_, err := stores.Users.FindByEmail(mockEmail)
+		assert.ErrorIs(t, err, models.ErrNotFound)
 	})
 
 	t.Run("does_not_register_an_existing_user", func(t *testing.T) {
 		defer cleanup()
-		createMockUser(nil)
-		assert.Nil(t, db.First(&models.User{}, "email = ?", mockEmail).Error)
+		_, err := createMockUser(nil)
+		assert.Nil(t, err)
 
 		form := auth.RegisterForm{
 			Name:        mockName,
@@ -87,6 +88,19 @@ func TestLogin(t *testing.T) {
 		assert.Empty(t, w.Header().Get("Set-Cookie"))
 	})
 
+	t.Run("does_not_login_a_disabled_user", func(t *testing.T) {
+		user, err := stores.Users.FindByEmail(mockEmail)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Nil(t, stores.Users.SetDisabled(user, true))
+		defer stores.Users.SetDisabled(user, false)
+
+		w := login(mockUserCreds)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+	})
+
 	t.Run("does_not_login_non_existing_user", func(t *testing.T) {
 		form := auth.Credentials{
 			Email:    "mynonexistinguseremail@gmail.com",
@@ -0,0 +1,55 @@
+// Package events fans out the note changes to the clients of their users, in process or through Postgres
+// LISTEN/NOTIFY so that the clients connected to any instance get the changes made on the others.
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// The event types.
+const (
+	NoteCreated  = "note.created"
+	NoteUpdated  = "note.updated"
+	NoteDeleted  = "note.deleted"
+	NoteRestored = "note.restored"
+)
+
+// SubscriptionBuffer is the number of events a subscriber can fall behind before it's dropped.
+const SubscriptionBuffer = 64
+
+// Event is a change of a note. It doesn't have the note so that it stays small, the clients fetch the note or pull
+// the changes after their sync cursor.
+type Event struct {
+	Type    string    `json:"type"`
+	UserID  string    `json:"userId"`
+	NoteID  string    `json:"noteId"`
+	Version int64     `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// Broker publishes the events to the subscribers of their users.
+type Broker interface {
+	// Publish sends the event to the subscribers of its user, the subscribers that fell behind are dropped.
+	Publish(ctx context.Context, e Event) error
+	// Subscribe subscribes to the events of the user until the subscription is closed.
+	Subscribe(userID string) *Subscription
+	// Close closes all the subscriptions, the later ones are closed right away.
+	Close()
+}
+
+// Subscription receives the events of a user, its channel is closed when the subscription is closed or dropped. A
+// dropped subscriber may have missed some events so its client should pull the changes again.
+type Subscription struct {
+	// C receives the events in the order they were published.
+	C <-chan Event
+
+	c      chan Event
+	userID string
+	local  *Local
+}
+
+// Close closes the subscription, closing it again does nothing.
+func (s *Subscription) Close() {
+	s.local.remove(s)
+}
@@ -0,0 +1,130 @@
+package events_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/msal4/toastnotes/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next event of the subscription, ok is false if it was closed or nothing was received in time.
+func receive(sub *events.Subscription) (e events.Event, ok bool) {
+	select {
+	case e, ok = <-sub.C:
+		return e, ok
+	case <-time.After(5 * time.Second):
+		return e, false
+	}
+}
+
+// closed reports whether the subscription was closed without receiving any more events.
+func closed(sub *events.Subscription) bool {
+	_, ok := receive(sub)
+	return !ok
+}
+
+func testBroker(t *testing.T, broker events.Broker) {
+	ctx := context.Background()
+
+	t.Run("the_events_are_delivered_to_the_subscribers_of_their_users", func(t *testing.T) {
+		first, second, other := broker.Subscribe("user"), broker.Subscribe("user"), broker.Subscribe("other")
+		defer other.Close()
+
+		created := events.Event{Type: events.NoteCreated, UserID: "user", NoteID: "note", Version: 1}
+		assert.Nil(t, broker.Publish(ctx, created))
+		assert.Nil(t, broker.Publish(ctx, events.Event{Type: events.NoteDeleted, UserID: "user", NoteID: "note", Version: 2}))
+		for _, sub := range []*events.Subscription{first, second} {
+			e, _ := receive(sub)
+			assert.Equal(t, created, e)
+			e, _ = receive(sub)
+			assert.Equal(t, events.NoteDeleted, e.Type, "the events are received in order")
+		}
+
+		first.Close()
+		first.Close()
+		assert.True(t, closed(first))
+		assert.Nil(t, broker.Publish(ctx, events.Event{Type: events.NoteUpdated, UserID: "other", NoteID: "other note"}))
+		e, _ := receive(other)
+		assert.Equal(t, "other note", e.NoteID, "the other users get their own events only")
+		second.Close()
+	})
+
+	t.Run("closing_the_broker_closes_the_subscriptions", func(t *testing.T) {
+		sub := broker.Subscribe("user")
+		broker.Close()
+		assert.True(t, closed(sub))
+		assert.True(t, closed(broker.Subscribe("user")), "the later ones are closed right away")
+	})
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	local := events.NewLocal()
+
+	t.Run("the_subscribers_falling_behind_are_dropped", func(t *testing.T) {
+		slow := local.Subscribe("user")
+		for i := 0; i <= events.SubscriptionBuffer; i++ {
+			local.Publish(ctx, events.Event{Type: events.NoteUpdated, UserID: "user", Version: int64(i)})
+		}
+		received := 0
+		for {
+			if _, ok := receive(slow); !ok {
+				break
+			}
+			received++
+		}
+		assert.Equal(t, events.SubscriptionBuffer, received)
+	})
+
+	testBroker(t, local)
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" || strings.HasPrefix(dsn, "sqlite:") {
+		t.Skip("TEST_DATABASE_URL is not a postgres database")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// two instances, the events published by either are delivered by both.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher, broker := events.NewPostgres(db, dsn), events.NewPostgres(db, dsn)
+	go publisher.Listen(ctx)
+	go broker.Listen(ctx)
+
+	// the listeners are up once an event gets through.
+	probe := broker.Subscribe("probe")
+	for {
+		publisher.Publish(ctx, events.Event{Type: events.NoteCreated, UserID: "probe"})
+		select {
+		case <-probe.C:
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+		break
+	}
+	probe.Close()
+
+	t.Run("the_events_of_the_other_instances_are_delivered", func(t *testing.T) {
+		sub := broker.Subscribe("user")
+		defer sub.Close()
+		e := events.Event{Type: events.NoteUpdated, UserID: "user", NoteID: "note", Version: 3, Time: time.Now().UTC().Truncate(time.Second)}
+		assert.Nil(t, publisher.Publish(ctx, e))
+		received, _ := receive(sub)
+		assert.Equal(t, e, received)
+	})
+
+	publisher.Close()
+	testBroker(t, broker)
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is the in process broker of a single instance.
+type Local struct {
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewLocal creates an in process broker.
+func NewLocal() *Local {
+	return &Local{subs: map[string]map[*Subscription]struct{}{}}
+}
+
+// Publish delivers the event to the subscribers of its user.
+func (l *Local) Publish(ctx context.Context, e Event) error {
+	l.deliver(e)
+	return nil
+}
+
+// Subscribe subscribes to the events of the user.
+func (l *Local) Subscribe(userID string) *Subscription {
+	c := make(chan Event, SubscriptionBuffer)
+	s := &Subscription{C: c, c: c, userID: userID, local: l}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		close(c)
+		return s
+	}
+	if l.subs[userID] == nil {
+		l.subs[userID] = map[*Subscription]struct{}{}
+	}
+	l.subs[userID][s] = struct{}{}
+	return s
+}
+
+// Close closes all the subscriptions.
+func (l *Local) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.dropAll()
+}
+
+// deliver sends the event to the subscribers of its user without blocking, the ones whose buffer is full are dropped.
+func (l *Local) deliver(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s := range l.subs[e.UserID] {
+		select {
+		case s.c <- e:
+		default:
+			l.drop(s)
+		}
+	}
+}
+
+// disconnect drops all the subscribers after the events may have been missed, they subscribe again.
+func (l *Local) disconnect() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropAll()
+}
+
+func (l *Local) remove(s *Subscription) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.drop(s)
+}
+
+// drop closes the subscription if it's still subscribed, the lock is held by the caller.
+func (l *Local) drop(s *Subscription) {
+	subs := l.subs[s.userID]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(l.subs, s.userID)
+	}
+	close(s.c)
+}
+
+func (l *Local) dropAll() {
+	for _, subs := range l.subs {
+		for s := range subs {
+			close(s.c)
+		}
+	}
+	l.subs = map[string]map[*Subscription]struct{}{}
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Channel is the Postgres notification channel of the events.
+const Channel = "toastnotes_events"
+
+// maxRetryDelay is the longest wait before listening again after the connection failed.
+const maxRetryDelay = 30 * time.Second
+
+// Postgres publishes the events with NOTIFY and delivers the notifications it listens to, including its own, to the
+// subscribers of the instance.
+type Postgres struct {
+	DB  *sql.DB
+	URL string
+
+	local *Local
+}
+
+// NewPostgres creates a broker publishing the events with db and listening to them on a connection of its own to the
+// database url, Listen has to run for the subscribers to get any events.
+func NewPostgres(db *sql.DB, url string) *Postgres {
+	return &Postgres{DB: db, URL: url, local: NewLocal()}
+}
+
+// Publish notifies the listening instances of the event.
+func (p *Postgres) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.DB.ExecContext(ctx, "SELECT pg_notify($1, $2)", Channel, string(payload))
+	return err
+}
+
+// Subscribe subscribes to the events of the user received by this instance.
+func (p *Postgres) Subscribe(userID string) *Subscription {
+	return p.local.Subscribe(userID)
+}
+
+// Close closes all the subscriptions.
+func (p *Postgres) Close() {
+	p.local.Close()
+}
+
+// Listen listens to the notifications until ctx is done, it connects again when the connection fails. The events
+// sent while it's not listening are lost so the subscribers are dropped then.
+func (p *Postgres) Listen(ctx context.Context) {
+	delay := time.Second
+	for {
+		err := p.listen(ctx, func() { delay = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+		p.local.disconnect()
+		log.Error().Err(err).Dur("retry", delay).Msg("Stopped listening to the note events")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+// listen delivers the notifications until the connection fails or ctx is done, listening is called once it listens.
+func (p *Postgres) listen(ctx context.Context, listening func()) error {
+	conn, err := pgx.Connect(ctx, p.URL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	listening()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			log.Warn().Err(err).Msg("Ignored an invalid note event")
+			continue
+		}
+		p.local.deliver(e)
+	}
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/msal4/toastnotes/models"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Stores returns a copy of the stores publishing the changes of the notes to the broker, so that the changes are
+// published whichever api or worker makes them. The changes made in a transaction are published once it's committed.
+func Stores(stores *models.Stores, broker Broker) *models.Stores {
+	return publishing(stores, func(ctx context.Context, e Event) {
+		// the event is published even if the client that made the change is gone.
+		if err := broker.Publish(context.WithoutCancel(ctx), e); err != nil {
+			logger := zerolog.Ctx(ctx)
+			if logger.GetLevel() == zerolog.Disabled {
+				// the changes made outside the requests don't have a scoped logger.
+				logger = &log.Logger
+			}
+			logger.Warn().Err(err).Str("event", e.Type).Msg("Could not publish the note event")
+		}
+	})
+}
+
+// publishing returns a copy of the stores passing the changes of the notes to publish.
+func publishing(stores *models.Stores, publish func(ctx context.Context, e Event)) *models.Stores {
+	s := *stores
+	s.Transactor = transactor{Transactor: stores.Transactor, publish: publish}
+	s.Notes = noteStore{NoteStore: stores.Notes, ctx: context.Background(), publish: publish}
+	return &s
+}
+
+// transactor holds back the changes made in the transactions until they're committed, the changes of a nested
+// transaction are passed on to the outer one.
+type transactor struct {
+	models.Transactor
+	publish func(ctx context.Context, e Event)
+}
+
+func (t transactor) Transaction(ctx context.Context, fn func(stores *models.Stores) error) error {
+	var committed []Event
+	err := t.Transactor.Transaction(ctx, func(stores *models.Stores) error {
+		return fn(publishing(stores, func(_ context.Context, e Event) { committed = append(committed, e) }))
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range committed {
+		t.publish(ctx, e)
+	}
+	return nil
+}
+
+// noteStore publishes the changes of the notes made with its store.
+type noteStore struct {
+	models.NoteStore
+	ctx     context.Context
+	publish func(ctx context.Context, e Event)
+}
+
+func (s noteStore) WithContext(ctx context.Context) models.NoteStore {
+	return noteStore{NoteStore: s.NoteStore.WithContext(ctx), ctx: ctx, publish: s.publish}
+}
+
+func (s noteStore) WithQuota(quotas models.Quotas) models.NoteStore {
+	return noteStore{NoteStore: s.NoteStore.WithQuota(quotas), ctx: s.ctx, publish: s.publish}
+}
+
+func (s noteStore) Create(note *models.Note) error {
+	return s.changed(NoteCreated, note, s.NoteStore.Create(note))
+}
+
+func (s noteStore) Update(note *models.Note) error {
+	return s.changed(NoteUpdated, note, s.NoteStore.Update(note))
+}
+
+func (s noteStore) UpdateIfVersion(note *models.Note, version int64) error {
+	return s.changed(NoteUpdated, note, s.NoteStore.UpdateIfVersion(note, version))
+}
+
+func (s noteStore) Move(note *models.Note) error {
+	return s.changed(NoteUpdated, note, s.NoteStore.Move(note))
+}
+
+func (s noteStore) Delete(note *models.Note) error {
+	return s.changed(NoteDeleted, note, s.NoteStore.Delete(note))
+}
+
+func (s noteStore) DeleteIfVersion(note *models.Note, version int64) error {
+	before := note.Version
+	err := s.NoteStore.DeleteIfVersion(note, version)
+	if err == nil && note.Version == before {
+		// the note was already deleted.
+		return nil
+	}
+	return s.changed(NoteDeleted, note, err)
+}
+
+func (s noteStore) Restore(note *models.Note) error {
+	return s.changed(NoteRestored, note, s.NoteStore.Restore(note))
+}
+
+// changed publishes the change of the note unless it failed with err, it returns err.
+func (s noteStore) changed(typ string, note *models.Note, err error) error {
+	if err == nil {
+		s.publish(s.ctx, Event{Type: typ, UserID: note.UserID, NoteID: note.ID, Version: note.Version, Time: time.Now()})
+	}
+	return err
+}
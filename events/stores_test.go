@@ -0,0 +1,83 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/msal4/toastnotes/events"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// pending returns the types of the events received by the subscription so far.
+func pending(sub *events.Subscription) []string {
+	types := []string{}
+	for {
+		select {
+		case e := <-sub.C:
+			types = append(types, e.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	broker := events.NewLocal()
+	defer broker.Close()
+	stores := events.Stores(memory.NewStores(), broker)
+	user := &models.User{Name: "user", Email: "user@email.com"}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	sub := broker.Subscribe(user.ID)
+	notes := stores.Notes.WithContext(ctx)
+
+	t.Run("the_note_changes_are_published", func(t *testing.T) {
+		note := &models.Note{Title: "note", UserID: user.ID}
+		assert.Nil(t, notes.Create(note))
+		e := <-sub.C
+		assert.Equal(t, events.Event{Type: events.NoteCreated, UserID: user.ID, NoteID: note.ID, Version: note.Version, Time: e.Time}, e)
+
+		note.Title = "updated"
+		assert.Nil(t, notes.Update(note))
+		assert.Nil(t, notes.DeleteIfVersion(note, note.Version))
+		assert.Nil(t, notes.DeleteIfVersion(note, note.Version))
+		assert.Nil(t, notes.Restore(note))
+		assert.Equal(t, []string{events.NoteUpdated, events.NoteDeleted, events.NoteRestored}, pending(sub),
+			"deleting a deleted note isn't a change")
+
+		assert.NotNil(t, notes.UpdateIfVersion(note, note.Version-1))
+		assert.Empty(t, pending(sub), "the failed changes aren't published")
+	})
+
+	t.Run("the_changes_of_a_transaction_are_published_once_it_commits", func(t *testing.T) {
+		errRollback := errors.New("rollback")
+		err := stores.Transaction(ctx, func(tx *models.Stores) error {
+			if err := tx.Notes.Create(&models.Note{Title: "outer", UserID: user.ID}); err != nil {
+				return err
+			}
+			tx.Transaction(ctx, func(tx *models.Stores) error {
+				tx.Notes.Create(&models.Note{Title: "rolled back", UserID: user.ID})
+				return errRollback
+			})
+			tx.Transaction(ctx, func(tx *models.Stores) error {
+				return tx.Notes.WithQuota(models.Quotas{}).Create(&models.Note{Title: "inner", UserID: user.ID})
+			})
+			assert.Empty(t, pending(sub))
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{events.NoteCreated, events.NoteCreated}, pending(sub))
+
+		err = stores.Transaction(ctx, func(tx *models.Stores) error {
+			tx.Notes.Create(&models.Note{Title: "rolled back", UserID: user.ID})
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+		assert.Empty(t, pending(sub))
+	})
+}
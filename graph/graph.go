@@ -0,0 +1,159 @@
+// Package graph serves the notes and the authenticated user over GraphQL using the model repositories.
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	"github.com/rs/zerolog"
+)
+
+// errInternal is returned to the client instead of the underlying errors, which are logged.
+var errInternal = errors.New("Could not handle your request")
+
+// Request is a GraphQL request.
+type Request struct {
+	Query         string                 `json:"query" binding:"required"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Server executes the GraphQL requests of the authenticated users.
+type Server struct {
+	Schema     graphql.Schema
+	Stores     *models.Stores
+	Limits     config.GraphQL
+	Pagination config.Pagination
+	Metrics    *metrics.Metrics
+}
+
+// New creates a GraphQL server using the given stores.
+func New(stores *models.Stores, limits config.GraphQL, pagination config.Pagination, m *metrics.Metrics) (*Server, error) {
+	s := &Server{Stores: stores, Limits: limits, Pagination: pagination, Metrics: m}
+
+	schema, err := s.schema()
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = schema
+	return s, nil
+}
+
+// request holds the state of a single request.
+type request struct {
+	userID string
+	notes  models.NoteStore
+	users  models.UserStore
+
+	noteLoader *Loader[models.Note]
+	userLoader *Loader[models.User]
+}
+
+type requestKey struct{}
+
+func fromContext(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
+
+// Execute runs the request on behalf of the user, invalid queries and queries exceeding the depth or complexity
+// limits are rejected before they're executed. It reports whether the request was rejected.
+func (s *Server) Execute(ctx context.Context, userID string, req Request) (result *graphql.Result, invalid bool) {
+	doc, errs := s.check(req)
+	if len(errs) > 0 {
+		return &graphql.Result{Errors: errs}, true
+	}
+
+	r := &request{
+		userID: userID,
+		notes:  s.Stores.Notes.WithContext(ctx),
+		users:  s.Stores.Users.WithContext(ctx),
+	}
+	r.noteLoader = NewLoader(func(ids []string) (map[string]models.Note, error) {
+		notes, err := r.notes.FindManyForUser(userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]models.Note, len(notes))
+		for _, n := range notes {
+			found[n.ID] = n
+		}
+		return found, nil
+	})
+	r.userLoader = NewLoader(func(ids []string) (map[string]models.User, error) {
+		users, err := r.users.FindMany(ids)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]models.User, len(users))
+		for _, u := range users {
+			found[u.ID] = u
+		}
+		return found, nil
+	})
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.Schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, requestKey{}, r),
+	}), false
+}
+
+// check parses and validates the query and checks it against the depth and complexity limits.
+func (s *Server) check(req Request) (*ast.Document, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(err)}
+	}
+	if res := graphql.ValidateDocument(&s.Schema, doc, nil); !res.IsValid {
+		return nil, res.Errors
+	}
+
+	op, fragments, err := operation(doc, req.OperationName)
+	if err != nil {
+		return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(err)}
+	}
+	l := &limits{
+		fragments:       fragments,
+		variables:       req.Variables,
+		defaultPageSize: s.Pagination.PageSize,
+		maxPageSize:     s.Pagination.MaxPageSize,
+	}
+	if depth := l.depth(op.SelectionSet, map[string]bool{}); depth > s.Limits.MaxDepth {
+		err = fmt.Errorf("The query depth %d exceeds the maximum depth %d", depth, s.Limits.MaxDepth)
+	} else if c := l.complexity(op.SelectionSet, map[string]bool{}); c > s.Limits.MaxComplexity {
+		err = fmt.Errorf("The query complexity %d exceeds the maximum complexity %d", c, s.Limits.MaxComplexity)
+	}
+	if err != nil {
+		return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(err)}
+	}
+
+	return doc, nil
+}
+
+// internal logs err using the request logger and returns the error shown to the client, the quota errors are shown
+// as they are.
+func internal(ctx context.Context, err error, msg string) error {
+	var qe *models.QuotaError
+	if errors.As(err, &qe) {
+		return errors.New(qe.Message())
+	}
+	zerolog.Ctx(ctx).Error().Err(err).Msg(msg)
+	return errInternal
+}
+
+// validID reports whether id is a valid uuid, the database rejects the queries using invalid ones.
+func validID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const userID = "0b7e3b4c-4bd4-4f4e-9a53-0d6c8f0a4c11"
+
+// newTestServer creates a server using a dry run db, which runs the callbacks without connecting to the database,
+// and returns the queries it runs.
+func newTestServer(t *testing.T) (*Server, *[]string) {
+	db, err := gorm.Open(postgres.Open("postgres://localhost/toastnotes"), &gorm.Config{
+		DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []string
+	db.Callback().Query().After("gorm:query").Register("test:record", func(db *gorm.DB) {
+		queries = append(queries, db.Statement.SQL.String())
+	})
+
+	cfg := config.Default()
+	srv, err := New(models.NewStores(db), cfg.GraphQL, cfg.Pagination, metrics.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, &queries
+}
+
+func TestExecute(t *testing.T) {
+	t.Run("batches_the_note_lookups", func(t *testing.T) {
+		srv, queries := newTestServer(t)
+		result, invalid := srv.Execute(context.Background(), userID, Request{Query: `{
+			a: note(id: "5f0f1d2e-1111-4e5b-9c1a-000000000001") { id title }
+			b: note(id: "5f0f1d2e-1111-4e5b-9c1a-000000000002") { id title }
+			c: note(id: "5f0f1d2e-1111-4e5b-9c1a-000000000001") { id }
+			d: note(id: "not an id") { id }
+		}`})
+
+		assert.False(t, invalid)
+		assert.Empty(t, result.Errors)
+		assert.Equal(t, map[string]interface{}{"a": nil, "b": nil, "c": nil, "d": nil}, result.Data)
+		if assert.Len(t, *queries, 1) {
+			assert.Contains(t, (*queries)[0], `id IN ($2,$3)`)
+		}
+	})
+
+	t.Run("fetches_the_profile_and_notes_together", func(t *testing.T) {
+		srv, queries := newTestServer(t)
+		result, invalid := srv.Execute(context.Background(), userID, Request{
+			Query: `query Home($size: Int) {
+				notes(pageSize: $size, filter: {search: "50%"}) { total page pageSize nodes { id title } }
+				me { name }
+			}`,
+			Variables: map[string]interface{}{"size": float64(500)},
+		})
+
+		assert.False(t, invalid)
+		// the dry run db doesn't find the user.
+		if assert.Len(t, result.Errors, 1) {
+			assert.Equal(t, "User not found", result.Errors[0].Message)
+		}
+		assert.Len(t, *queries, 3)
+		joined := strings.Join(*queries, "\n")
+		assert.Contains(t, joined, "ILIKE")
+		assert.Contains(t, joined, "LIMIT 100")
+	})
+
+	t.Run("rejects_queries_exceeding_the_limits", func(t *testing.T) {
+		srv, queries := newTestServer(t)
+		srv.Limits.MaxComplexity = 50
+
+		result, invalid := srv.Execute(context.Background(), userID, Request{Query: `{ notes(pageSize: 20) { nodes { id title content } } }`})
+		assert.True(t, invalid)
+		if assert.Len(t, result.Errors, 1) {
+			assert.Contains(t, result.Errors[0].Message, "complexity 81")
+		}
+		assert.Empty(t, *queries)
+	})
+
+	t.Run("rejects_invalid_queries", func(t *testing.T) {
+		srv, _ := newTestServer(t)
+
+		for _, query := range []string{`{ notes {`, `{ nope }`, `query A { me { id } } query B { me { id } }`} {
+			result, invalid := srv.Execute(context.Background(), userID, Request{Query: query})
+			assert.True(t, invalid, query)
+			assert.NotEmpty(t, result.Errors, query)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listArgs maps the list fields to the argument holding their page size, their cost is multiplied by it.
+var listArgs = map[string]string{
+	"notes": "pageSize",
+}
+
+// limits measures the depth and complexity of an operation, introspection fields are free.
+type limits struct {
+	fragments       map[string]*ast.FragmentDefinition
+	variables       map[string]interface{}
+	defaultPageSize int
+	maxPageSize     int
+}
+
+// operation finds the operation to execute, the name can be empty if the document has a single operation.
+func operation(doc *ast.Document, name string) (*ast.OperationDefinition, map[string]*ast.FragmentDefinition, error) {
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	count := 0
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			count++
+			if name == "" || (def.Name != nil && def.Name.Value == name) {
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+
+	switch {
+	case name == "" && count > 1:
+		return nil, nil, fmt.Errorf("Must provide operation name if query contains multiple operations")
+	case op == nil && name != "":
+		return nil, nil, fmt.Errorf("Unknown operation named %q", name)
+	case op == nil:
+		return nil, nil, fmt.Errorf("Must provide an operation")
+	}
+	return op, fragments, nil
+}
+
+// depth returns the maximum number of nested fields of the selection set.
+func (l *limits) depth(set *ast.SelectionSet, visited map[string]bool) int {
+	if set == nil {
+		return 0
+	}
+
+	max := 0
+	for _, sel := range set.Selections {
+		d := 0
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			d = 1 + l.depth(sel.SelectionSet, visited)
+		case *ast.InlineFragment:
+			d = l.depth(sel.SelectionSet, visited)
+		case *ast.FragmentSpread:
+			d = l.spread(sel, visited, l.depth)
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// complexity returns the cost of the selection set, each field costs 1 and the selections of list fields are
+// multiplied by their page size.
+func (l *limits) complexity(set *ast.SelectionSet, visited map[string]bool) int {
+	if set == nil {
+		return 0
+	}
+
+	total := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			total += 1 + l.multiplier(sel)*l.complexity(sel.SelectionSet, visited)
+		case *ast.InlineFragment:
+			total += l.complexity(sel.SelectionSet, visited)
+		case *ast.FragmentSpread:
+			total += l.spread(sel, visited, l.complexity)
+		}
+	}
+	return total
+}
+
+// spread measures the selection set of a fragment, cycles are rejected by the validation but are skipped here
+// anyway.
+func (l *limits) spread(sel *ast.FragmentSpread, visited map[string]bool, measure func(*ast.SelectionSet, map[string]bool) int) int {
+	name := sel.Name.Value
+	frag, ok := l.fragments[name]
+	if !ok || visited[name] {
+		return 0
+	}
+
+	visited[name] = true
+	defer delete(visited, name)
+	return measure(frag.SelectionSet, visited)
+}
+
+func (l *limits) multiplier(field *ast.Field) int {
+	arg, ok := listArgs[field.Name.Value]
+	if !ok {
+		return 1
+	}
+
+	size := l.defaultPageSize
+	for _, a := range field.Arguments {
+		if a.Name.Value != arg {
+			continue
+		}
+		switch v := a.Value.(type) {
+		case *ast.IntValue:
+			size, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			switch n := l.variables[v.Name.Value].(type) {
+			case float64:
+				size = int(n)
+			case int:
+				size = n
+			}
+		}
+	}
+	return pageSize(size, l.defaultPageSize, l.maxPageSize)
+}
+
+// pageSize applies the default and maximum page sizes the same way the rest api does.
+func pageSize(size, defaultSize, maxSize int) int {
+	switch {
+	case size > maxSize:
+		return maxSize
+	case size <= 0:
+		return defaultSize
+	}
+	return size
+}
@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func measure(t *testing.T, query string, variables map[string]interface{}) (depth, complexity int) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, fragments, err := operation(doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &limits{fragments: fragments, variables: variables, defaultPageSize: 20, maxPageSize: 100}
+	return l.depth(op.SelectionSet, map[string]bool{}), l.complexity(op.SelectionSet, map[string]bool{})
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("counts_the_fields", func(t *testing.T) {
+		depth, complexity := measure(t, `{ me { id name } }`, nil)
+		assert.Equal(t, 2, depth)
+		assert.Equal(t, 3, complexity)
+	})
+
+	t.Run("multiplies_list_fields_by_their_page_size", func(t *testing.T) {
+		// notes + 20 * (nodes + id)
+		_, complexity := measure(t, `{ notes { nodes { id } } }`, nil)
+		assert.Equal(t, 41, complexity)
+
+		_, complexity = measure(t, `{ notes(pageSize: 5) { total nodes { id } } }`, nil)
+		assert.Equal(t, 16, complexity)
+
+		_, complexity = measure(t, `query($size: Int) { notes(pageSize: $size) { nodes { id } } }`, map[string]interface{}{"size": 1000.0})
+		assert.Equal(t, 201, complexity)
+	})
+
+	t.Run("follows_fragments", func(t *testing.T) {
+		depth, complexity := measure(t, `
+			{ me { ...profile } notes(pageSize: 2) { nodes { ... on Note { id title } } } }
+			fragment profile on User { id name }
+		`, nil)
+		assert.Equal(t, 3, depth)
+		assert.Equal(t, 3+1+2*3, complexity)
+	})
+
+	t.Run("ignores_introspection", func(t *testing.T) {
+		depth, complexity := measure(t, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } me { id } }`, nil)
+		assert.Equal(t, 2, depth)
+		assert.Equal(t, 2, complexity)
+	})
+}
+
+func TestOperation(t *testing.T) {
+	doc, _ := parser.Parse(parser.ParseParams{Source: `query A { me { id } } query B { me { name } }`})
+
+	op, _, err := operation(doc, "B")
+	assert.Nil(t, err)
+	assert.Equal(t, "B", op.Name.Value)
+
+	_, _, err = operation(doc, "")
+	assert.NotNil(t, err)
+	_, _, err = operation(doc, "C")
+	assert.NotNil(t, err)
+}
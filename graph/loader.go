@@ -0,0 +1,59 @@
+package graph
+
+import "sync"
+
+// Loader batches the loads of the keys requested while resolving a level of a query into a single fetch and caches
+// the results for the rest of the request. Load returns a thunk so that the executor resolves all the fields of a
+// level before any of them triggers the fetch.
+type Loader[V any] struct {
+	fetch func(keys []string) (map[string]V, error)
+
+	mu      sync.Mutex
+	pending *batch[V]
+	batches map[string]*batch[V]
+}
+
+type batch[V any] struct {
+	keys   []string
+	once   sync.Once
+	values map[string]V
+	err    error
+}
+
+// NewLoader creates a loader using fetch to load the values of a batch of keys, missing keys are left out of the
+// returned map.
+func NewLoader[V any](fetch func(keys []string) (map[string]V, error)) *Loader[V] {
+	return &Loader[V]{fetch: fetch, batches: map[string]*batch[V]{}}
+}
+
+// Load queues the key in the pending batch and returns a thunk returning its value, whether it was found and the
+// fetch error.
+func (l *Loader[V]) Load(key string) func() (V, bool, error) {
+	l.mu.Lock()
+	b, ok := l.batches[key]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &batch[V]{}
+		}
+		b = l.pending
+		b.keys = append(b.keys, key)
+		l.batches[key] = b
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		b.once.Do(func() {
+			// later loads go to a new batch.
+			l.mu.Lock()
+			if l.pending == b {
+				l.pending = nil
+			}
+			l.mu.Unlock()
+
+			b.values, b.err = l.fetch(b.keys)
+		})
+
+		v, ok := b.values[key]
+		return v, ok, b.err
+	}
+}
@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	var batches [][]string
+	l := NewLoader(func(keys []string) (map[string]int, error) {
+		batches = append(batches, keys)
+		values := map[string]int{}
+		for _, k := range keys {
+			if k != "missing" {
+				values[k] = len(k)
+			}
+		}
+		return values, nil
+	})
+
+	a, b, missing, again := l.Load("a"), l.Load("bb"), l.Load("missing"), l.Load("a")
+
+	v, ok, err := b()
+	assert.Equal(t, 2, v)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	v, _, _ = a()
+	assert.Equal(t, 1, v)
+	v, _, _ = again()
+	assert.Equal(t, 1, v)
+	_, ok, _ = missing()
+	assert.False(t, ok)
+
+	// the loaded keys are cached and the new ones go to a new batch.
+	cached, c := l.Load("bb"), l.Load("ccc")
+	v, _, _ = cached()
+	assert.Equal(t, 2, v)
+	v, _, _ = c()
+	assert.Equal(t, 3, v)
+
+	assert.Equal(t, [][]string{{"a", "bb", "missing"}, {"ccc"}}, batches)
+
+	t.Run("returns_the_fetch_error", func(t *testing.T) {
+		l := NewLoader(func(keys []string) (map[string]int, error) {
+			return nil, errors.New("connection refused")
+		})
+		_, ok, err := l.Load("a")()
+		assert.False(t, ok)
+		assert.EqualError(t, err, "connection refused")
+	})
+}
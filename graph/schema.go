@@ -0,0 +1,295 @@
+package graph
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/msal4/toastnotes/models"
+)
+
+var errNoteNotFound = errors.New("Note not found")
+
+func (s *Server) schema() (graphql.Schema, error) {
+	id := graphql.NewNonNull(graphql.ID)
+
+	// the fields of the embedded models.Model.
+	timestamps := func(fields graphql.Fields, model func(source interface{}) models.Model) graphql.Fields {
+		fields["id"] = &graphql.Field{Type: id, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return model(p.Source).ID, nil
+		}}
+		fields["createdAt"] = &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return model(p.Source).CreatedAt, nil
+		}}
+		fields["updatedAt"] = &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return model(p.Source).UpdatedAt, nil
+		}}
+		return fields
+	}
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A registered user.",
+		Fields: timestamps(graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"email": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		}, func(source interface{}) models.Model { return source.(*models.User).Model }),
+	})
+
+	noteType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Note",
+		Description: "A note of the authenticated user.",
+		Fields: timestamps(graphql.Fields{
+			"title":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"content": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"folder":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		}, func(source interface{}) models.Model { return source.(*models.Note).Model }),
+	})
+
+	noteConnection := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NoteConnection",
+		Description: "A page of notes.",
+		Fields: graphql.Fields{
+			"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(noteType)))},
+			"total":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "The number of notes matching the filter."},
+			"page":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"pageSize": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	noteFilter := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "NoteFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"search":        &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Matches the title or content, case insensitively."},
+			"updatedAfter":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"updatedBefore": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		},
+	})
+
+	createNoteInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateNoteInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"content": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	updateNoteInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "UpdateNoteInput",
+		Description: "The fields to update, the omitted fields are left as is.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"content": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "The authenticated user.",
+				Resolve:     s.me,
+			},
+			"notes": &graphql.Field{
+				Type:        graphql.NewNonNull(noteConnection),
+				Description: "The authenticated user notes, the most recently updated first.",
+				Args: graphql.FieldConfigArgument{
+					"page":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+					"pageSize": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: s.Pagination.PageSize},
+					"filter":   &graphql.ArgumentConfig{Type: noteFilter},
+				},
+				Resolve: s.notes,
+			},
+			"note": &graphql.Field{
+				Type:        noteType,
+				Description: "The note with the given id, null if it's not found.",
+				Args:        graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: id}},
+				Resolve:     s.note,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createNote": &graphql.Field{
+				Type:    graphql.NewNonNull(noteType),
+				Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createNoteInput)}},
+				Resolve: s.createNote,
+			},
+			"updateNote": &graphql.Field{
+				Type: graphql.NewNonNull(noteType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: id},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateNoteInput)},
+				},
+				Resolve: s.updateNote,
+			},
+			"deleteNote": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Boolean),
+				Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: id}},
+				Resolve: s.deleteNote,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+type noteConnection struct {
+	Nodes    []*models.Note `json:"nodes"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+func (s *Server) me(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+	load := r.userLoader.Load(r.userID)
+
+	return func() (interface{}, error) {
+		user, ok, err := load()
+		if err != nil {
+			return nil, internal(p.Context, err, "Failed to find the user")
+		}
+		if !ok {
+			return nil, errors.New("User not found")
+		}
+		return &user, nil
+	}, nil
+}
+
+func (s *Server) notes(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+
+	page, _ := p.Args["page"].(int)
+	if page <= 0 {
+		page = 1
+	}
+	size, _ := p.Args["pageSize"].(int)
+	size = pageSize(size, s.Pagination.PageSize, s.Pagination.MaxPageSize)
+
+	var filter models.NoteFilter
+	if f, ok := p.Args["filter"].(map[string]interface{}); ok {
+		filter.Search, _ = f["search"].(string)
+		if t, ok := f["updatedAfter"].(time.Time); ok {
+			filter.UpdatedAfter = &t
+		}
+		if t, ok := f["updatedBefore"].(time.Time); ok {
+			filter.UpdatedBefore = &t
+		}
+	}
+
+	notes, total, err := r.notes.Search(r.userID, filter, (page-1)*size, size)
+	if err != nil {
+		return nil, internal(p.Context, err, "Failed to retrieve notes")
+	}
+
+	conn := &noteConnection{Nodes: make([]*models.Note, len(notes)), Total: total, Page: page, PageSize: size}
+	for i := range notes {
+		conn.Nodes[i] = &notes[i]
+	}
+	return conn, nil
+}
+
+func (s *Server) note(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+	noteID, _ := p.Args["id"].(string)
+	if !validID(noteID) {
+		return nil, nil
+	}
+	load := r.noteLoader.Load(noteID)
+
+	return func() (interface{}, error) {
+		note, ok, err := load()
+		if err != nil {
+			return nil, internal(p.Context, err, "Failed to find the note")
+		}
+		if !ok {
+			return nil, nil
+		}
+		return &note, nil
+	}, nil
+}
+
+func (s *Server) createNote(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+	input := p.Args["input"].(map[string]interface{})
+
+	note := models.Note{UserID: r.userID}
+	note.Title, _ = input["title"].(string)
+	note.Content, _ = input["content"].(string)
+	if strings.TrimSpace(note.Title) == "" {
+		return nil, errors.New("The title is required")
+	}
+
+	if err := r.notes.Create(&note); err != nil {
+		return nil, internal(p.Context, err, "Could not create note")
+	}
+	s.Metrics.NotesCreated.Inc()
+
+	return &note, nil
+}
+
+func (s *Server) updateNote(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+	note, err := s.findNote(p)
+	if err != nil {
+		return nil, err
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	changed := false
+	if title, ok := input["title"].(string); ok {
+		if strings.TrimSpace(title) == "" {
+			return nil, errors.New("The title can't be empty")
+		}
+		note.Title = title
+		changed = true
+	}
+	if content, ok := input["content"].(string); ok {
+		note.Content = content
+		changed = true
+	}
+	if !changed {
+		return note, nil
+	}
+
+	if err := r.notes.Update(note); err != nil {
+		return nil, internal(p.Context, err, "Could not update note")
+	}
+	return note, nil
+}
+
+func (s *Server) deleteNote(p graphql.ResolveParams) (interface{}, error) {
+	r := fromContext(p.Context)
+	note, err := s.findNote(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.notes.Delete(note); err != nil {
+		return nil, internal(p.Context, err, "Could not delete the note")
+	}
+	return true, nil
+}
+
+// findNote finds the authenticated user note with the id argument.
+func (s *Server) findNote(p graphql.ResolveParams) (*models.Note, error) {
+	r := fromContext(p.Context)
+	noteID, _ := p.Args["id"].(string)
+	if !validID(noteID) {
+		return nil, errNoteNotFound
+	}
+
+	note, err := r.notes.FindForUser(noteID, r.userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errNoteNotFound
+		}
+		return nil, internal(p.Context, err, "Failed to find the note")
+	}
+	return note, nil
+}
@@ -0,0 +1,146 @@
+// Package health runs the readiness checks of the app dependencies.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/msal4/toastnotes/migrations"
+)
+
+// The check and report statuses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// CheckFunc checks a dependency and returns an error if it's not usable.
+type CheckFunc func(ctx context.Context) error
+
+// Checker runs the registered checks and reports whether the app is ready to receive traffic.
+type Checker struct {
+	// Timeout is the maximum duration of a single check.
+	Timeout time.Duration
+
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]CheckFunc
+	draining atomic.Bool
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness report of all the checks.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the app can receive traffic.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// New creates a checker without any checks.
+func New() *Checker {
+	return &Checker{Timeout: 2 * time.Second, checks: map[string]CheckFunc{}}
+}
+
+// Add registers a check, a check with the same name is replaced.
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Drain marks the app as shutting down, the following reports are not ready.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called.
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Check runs all the checks concurrently and reports their results.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	names := append([]string{}, c.names...)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	if c.Draining() {
+		report.Status = StatusDraining
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	res := Result{Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status, res.Error = StatusUnavailable, err.Error()
+	}
+
+	return res
+}
+
+// Ping checks that the database is reachable.
+func Ping(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// Migrations checks that there are no pending migrations.
+func Migrations(migrator *migrations.Migrator) CheckFunc {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations", len(pending))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	t.Run("is_ready_when_all_the_checks_pass", func(t *testing.T) {
+		c := New()
+		c.Add("database", ok)
+		c.Add("migrations", ok)
+
+		report := c.Check(context.Background())
+		assert.True(t, report.Ready())
+		assert.Len(t, report.Checks, 2)
+		assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	})
+
+	t.Run("reports_the_failing_checks", func(t *testing.T) {
+		c := New()
+		c.Add("database", failing)
+		c.Add("migrations", ok)
+
+		report := c.Check(context.Background())
+		assert.False(t, report.Ready())
+		assert.Equal(t, StatusUnavailable, report.Status)
+		assert.Equal(t, Result{Status: StatusUnavailable, LatencyMS: report.Checks["database"].LatencyMS, Error: "connection refused"}, report.Checks["database"])
+		assert.Equal(t, StatusOK, report.Checks["migrations"].Status)
+	})
+
+	t.Run("times_out_slow_checks", func(t *testing.T) {
+		c := New()
+		c.Timeout = 10 * time.Millisecond
+		c.Add("database", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		report := c.Check(context.Background())
+		assert.False(t, report.Ready())
+		assert.Contains(t, report.Checks["database"].Error, "deadline exceeded")
+	})
+
+	t.Run("is_not_ready_while_draining", func(t *testing.T) {
+		c := New()
+		c.Add("database", ok)
+		c.Drain()
+
+		report := c.Check(context.Background())
+		assert.False(t, report.Ready())
+		assert.Equal(t, StatusDraining, report.Status)
+	})
+}
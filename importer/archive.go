@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// archive reads the files of a zip archive, or the files of the other exports, within the limits.
+type archive struct {
+	limits Limits
+	// read is the total size of the files read so far.
+	read int64
+	// err is ErrTooLarge once the total limit is exceeded, the later reads fail with it.
+	err error
+}
+
+// readFile reads the file if it's not larger than the limit, the sizes in the headers of the archive can be forged so
+// the content read is limited too.
+func (a *archive) readFile(f *zip.File, limit int64) ([]byte, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, tooLarge(limit)
+	}
+	if a.read+int64(f.UncompressedSize64) > a.limits.Total {
+		a.err = ErrTooLarge
+		return nil, a.err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	a.read += int64(len(data))
+	switch {
+	case a.read > a.limits.Total:
+		a.err = ErrTooLarge
+		return nil, a.err
+	case err != nil:
+		return nil, err
+	case int64(len(data)) > limit:
+		return nil, tooLarge(limit)
+	}
+	return data, nil
+}
+
+// reserve counts a file of size bytes that isn't in the archive, like the attachments of the ENEX notes, in the total
+// if it's not larger than the limit, before it's read.
+func (a *archive) reserve(size, limit int64) error {
+	if a.err != nil {
+		return a.err
+	}
+	if size > limit {
+		return tooLarge(limit)
+	}
+	a.read += size
+	if a.read > a.limits.Total {
+		a.err = ErrTooLarge
+		return a.err
+	}
+	return nil
+}
+
+// readAll reads the export that isn't an archive if it's not larger than the limit of the files.
+func readAll(r io.ReaderAt, size int64, limits Limits) ([]byte, error) {
+	if size > limits.File {
+		return nil, tooLarge(limits.File)
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, size))
+}
+
+func tooLarge(limit int64) error {
+	return fmt.Errorf("the file is larger than the limit of %d bytes", limit)
+}
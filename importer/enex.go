@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// enexTime is the layout of the ENEX timestamps, they're in utc.
+const enexTime = "20060102T150405Z"
+
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data     string `xml:"data"`
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// eachENEX streams the note elements of the export so that the large exports aren't loaded at once, the notes are
+// read within the limits of the archive. The notes are only counted, without being read, unless read is set.
+func eachENEX(r io.Reader, a *archive, read bool, fn func(i int, note Note) error) error {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	i := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid enex file: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		var note Note
+		if !read {
+			err = d.Skip()
+		} else {
+			var en enexNote
+			if err = d.DecodeElement(&en, &start); err == nil {
+				note = en.note(a)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid enex file: %w", err)
+		}
+		if a.err != nil {
+			return a.err
+		}
+		if err := fn(i, note); err != nil {
+			return err
+		}
+		i++
+	}
+}
+
+// note converts the note element, the content and attachments over the limits of the archive fail the note and the
+// attachments are checked before they're decoded.
+func (en *enexNote) note(a *archive) Note {
+	note := Note{Title: en.Title, Tags: en.Tags}
+	note.CreatedAt, _ = time.Parse(enexTime, strings.TrimSpace(en.Created))
+	note.UpdatedAt, _ = time.Parse(enexTime, strings.TrimSpace(en.Updated))
+
+	var err error
+	if int64(len(en.Content)) > a.limits.File {
+		err = tooLarge(a.limits.File)
+	} else {
+		note.Content, note.Checklist, err = enmlText(en.Content)
+	}
+	if err != nil {
+		note.Err = fmt.Errorf("invalid note content: %w", err)
+	}
+	for i, res := range en.Resources {
+		if err := a.reserve(int64(base64.StdEncoding.DecodedLen(encodedLen(res.Data))), a.limits.Attachment); err != nil {
+			if a.err != nil {
+				return note
+			}
+			note.Err = fmt.Errorf("invalid attachment %d: %w", i+1, err)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(res.Data), ""))
+		if err != nil {
+			note.Err = fmt.Errorf("invalid attachment %d: %w", i+1, err)
+			continue
+		}
+		name := res.FileName
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d%s", i+1, mimeExtension(res.Mime))
+		}
+		note.Files = append(note.Files, File{Name: name, Data: data})
+	}
+	note.normalize()
+	return note
+}
+
+// encodedLen is the length of the base64 data without the whitespace it's wrapped with.
+func encodedLen(data string) int {
+	n := 0
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// enmlBlocks are the elements ending a line of text.
+var enmlBlocks = map[string]bool{
+	"div": true, "p": true, "br": true, "li": true, "tr": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "blockquote": true, "pre": true, "hr": true, "en-note": true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// enmlText converts the ENML content of a note to plain text. The to-dos are taken out of the text into the
+// checklist, the text following a to-do up to the end of its line is the item.
+func enmlText(enml string) (string, []Item, error) {
+	d := xml.NewDecoder(strings.NewReader(enml))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var text strings.Builder
+	var items []Item
+	var todo *Item
+	endLine := func() {
+		if todo != nil {
+			todo.Text = strings.TrimSpace(todo.Text)
+			if todo.Text != "" {
+				items = append(items, *todo)
+			}
+			todo = nil
+			return
+		}
+		text.WriteByte('\n')
+	}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch name := tok.Name.Local; {
+			case name == "en-todo":
+				if todo != nil {
+					endLine()
+				}
+				todo = &Item{}
+				for _, attr := range tok.Attr {
+					if attr.Name.Local == "checked" {
+						todo.Done = attr.Value == "true"
+					}
+				}
+			case name == "br" || name == "hr":
+				endLine()
+			case name == "li":
+				if todo == nil {
+					text.WriteString("- ")
+				}
+			}
+		case xml.EndElement:
+			if name := tok.Name.Local; enmlBlocks[name] && name != "br" && name != "hr" {
+				endLine()
+			}
+		case xml.CharData:
+			if todo != nil {
+				todo.Text += string(tok)
+			} else {
+				text.Write(tok)
+			}
+		}
+	}
+	if todo != nil {
+		endLine()
+	}
+
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\u00a0")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")), items, nil
+}
+
+// mimeExtension returns the extension of the common attachment types, the names of the files without one are
+// derived from it.
+func mimeExtension(mime string) string {
+	switch mime {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "application/pdf":
+		return ".pdf"
+	case "audio/wav", "audio/x-wav":
+		return ".wav"
+	case "audio/mpeg":
+		return ".mp3"
+	case "text/plain":
+		return ".txt"
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+// Package importer imports the notes of the exports of other note apps, Evernote ENEX files, Google Keep Takeout
+// archives, Simplenote JSON exports and Markdown vaults.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/msal4/toastnotes/vault"
+)
+
+// The supported export formats.
+const (
+	// FormatENEX is an Evernote .enex export.
+	FormatENEX = "enex"
+	// FormatKeep is a Google Takeout archive of Keep, or one of the JSON files in it.
+	FormatKeep = "keep"
+	// FormatSimplenote is the notes.json of a Simplenote export, or the zip archive it's in.
+	FormatSimplenote = "simplenote"
+	// FormatMarkdown is a zip archive of a Markdown vault like the ones of Obsidian, or a single Markdown file.
+	FormatMarkdown = "markdown"
+)
+
+// Formats are the supported export formats.
+var Formats = []string{FormatENEX, FormatKeep, FormatSimplenote, FormatMarkdown}
+
+// ErrUnknownFormat is returned when the format of an export can't be detected.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ErrTooLarge is returned when the files of an export archive decompress to more than the total limit.
+var ErrTooLarge = errors.New("the export is too large once decompressed")
+
+// The default limits of the files of the exports, they're decompressed in memory.
+const (
+	// MaxNoteFileSize is the maximum size of a file holding notes, the JSON and Markdown files of the archives and
+	// the exports that aren't archives.
+	MaxNoteFileSize = 64 << 20 // 64 MB
+	// MaxExtractedSize is the maximum total size of the files read from an archive.
+	MaxExtractedSize = 2 << 30 // 2 GB
+)
+
+// Limits are the limits of the sizes of the files read from the exports, the compressed files of the archives can be
+// a lot larger than the archives.
+type Limits struct {
+	// File is the maximum size of a file holding notes.
+	File int64
+	// Attachment is the maximum size of an attachment.
+	Attachment int64
+	// Total is the maximum total size of the files read from an archive, once exceeded the export fails with
+	// ErrTooLarge.
+	Total int64
+}
+
+// DefaultLimits returns the default limits of the files with the maximum size of the attachments.
+func DefaultLimits(maxAttachmentSize int64) Limits {
+	return Limits{File: MaxNoteFileSize, Attachment: maxAttachmentSize, Total: MaxExtractedSize}
+}
+
+// Note is a note read from an export.
+type Note struct {
+	Title   string
+	Content string
+	// Folder is the slash separated path of the folder of the note, the notes at the top level have the empty
+	// folder.
+	Folder    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Tags      []string
+	Checklist []Item
+	Files     []File
+	// Links are the links of the content to the other notes of the export, they're resolved with Resolve once the
+	// notes have ids.
+	Links []Link
+	// Err is set if the note couldn't be read, the other notes of the export can still be imported.
+	Err error
+}
+
+// Item is a checklist item of a note.
+type Item struct {
+	Text string
+	Done bool
+}
+
+// File is a file attached to a note.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Link is a link of the content of a note to another note of the export.
+type Link struct {
+	// Start and End are the offsets of the link in the content.
+	Start, End int
+	Label      string
+	// Index is the index of the linked note in the export.
+	Index int
+}
+
+// Detect detects the format of an export from its file name and the first bytes of its content.
+func Detect(filename string, head []byte) (string, error) {
+	head = bytes.TrimLeft(head, "\ufeff \t\r\n")
+	switch {
+	case strings.EqualFold(path.Ext(filename), vault.Ext):
+		return FormatMarkdown, nil
+	case strings.EqualFold(path.Ext(filename), ".enex") || bytes.HasPrefix(head, []byte("<?xml")) ||
+		bytes.HasPrefix(head, []byte("<!DOCTYPE en-export")) || bytes.HasPrefix(head, []byte("<en-export")):
+		return FormatENEX, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		// the name of the first file follows the header of the zip archives.
+		if bytes.Contains(head, []byte("source/")) || bytes.Contains(head, []byte("notes.json")) {
+			return FormatSimplenote, nil
+		}
+		if bytes.Contains(head, []byte(vault.Ext)) || bytes.Contains(head, []byte(".obsidian/")) {
+			return FormatMarkdown, nil
+		}
+		return FormatKeep, nil
+	case bytes.HasPrefix(head, []byte("{")):
+		if bytes.Contains(head, []byte(`"activeNotes"`)) || bytes.Contains(head, []byte(`"trashedNotes"`)) {
+			return FormatSimplenote, nil
+		}
+		return FormatKeep, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Valid reports whether the format is supported.
+func Valid(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Each reads the notes of the export of size bytes in order and calls fn with each of them along with its index,
+// it stops at the first error returned by fn. The notes that can't be read or whose files are over the limits have
+// their Err set, an error is only returned if the export itself can't be read or is over the limits.
+func Each(format string, r io.ReaderAt, size int64, limits Limits, fn func(i int, note Note) error) error {
+	return each(format, r, size, limits, true, fn)
+}
+
+// each reads the notes of the export like Each, the ENEX notes are only counted and passed to fn empty unless read is
+// set.
+func each(format string, r io.ReaderAt, size int64, limits Limits, read bool, fn func(i int, note Note) error) error {
+	switch format {
+	case FormatENEX:
+		return eachENEX(io.NewSectionReader(r, 0, size), &archive{limits: limits}, read, fn)
+	case FormatKeep:
+		return eachKeep(r, size, &archive{limits: limits}, fn)
+	case FormatSimplenote:
+		return eachSimplenote(r, size, &archive{limits: limits}, fn)
+	case FormatMarkdown:
+		return eachMarkdown(r, size, &archive{limits: limits}, fn)
+	}
+	return fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// Count counts the notes of the export, the notes of the ENEX files aren't read.
+func Count(format string, r io.ReaderAt, size int64, limits Limits) (int, error) {
+	n := 0
+	err := each(format, r, size, limits, false, func(int, Note) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// normalize fills the missing title of the note with its first line and the missing timestamps with each other.
+func (n *Note) normalize() {
+	n.Title = strings.TrimSpace(n.Title)
+	n.Content = strings.TrimSpace(n.Content)
+	if n.Title == "" {
+		first, rest, _ := strings.Cut(n.Content, "\n")
+		if first = strings.TrimSpace(first); first != "" && len(first) <= maxDerivedTitle {
+			n.Title, n.Content = first, strings.TrimSpace(rest)
+		}
+	}
+	if n.Title == "" {
+		n.Title = "Untitled"
+	}
+	if n.UpdatedAt.IsZero() {
+		n.UpdatedAt = n.CreatedAt
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = n.UpdatedAt
+	}
+}
+
+// maxDerivedTitle is the maximum length of the first line that is used as the title of an untitled note.
+const maxDerivedTitle = 200
+
+// Resolve replaces the links to the other notes of the export with links to their ids, id returns the id of the note
+// at an index.
+func (n *Note) Resolve(id func(i int) string) {
+	var b strings.Builder
+	end := 0
+	for _, link := range n.Links {
+		b.WriteString(n.Content[end:link.Start])
+		b.WriteString(vault.MarkdownLink(link.Label, id(link.Index)))
+		end = link.End
+	}
+	b.WriteString(n.Content[end:])
+	n.Content, n.Links = b.String(), nil
+}
+
+// Body returns the content of the note followed by its tags as hashtags, the notes have no tags of their own. The
+// tags already in the content aren't repeated.
+func (n *Note) Body() string {
+	present := map[string]bool{}
+	for _, tag := range vault.Hashtags(n.Content) {
+		present[strings.ToLower(tag)] = true
+	}
+	tags := make([]string, 0, len(n.Tags))
+	for _, tag := range n.Tags {
+		if tag = strings.Join(strings.Fields(tag), "-"); tag != "" && !present[strings.ToLower(tag)] {
+			present[strings.ToLower(tag)] = true
+			tags = append(tags, "#"+tag)
+		}
+	}
+	if len(tags) == 0 {
+		return n.Content
+	}
+	if n.Content == "" {
+		return strings.Join(tags, " ")
+	}
+	return n.Content + "\n\n" + strings.Join(tags, " ")
+}
@@ -0,0 +1,408 @@
+package importer_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/importer"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+var enex = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20261019T090000Z" application="Evernote" version="10">
+  <note>
+    <title>Groceries</title>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div>For the <b>weekend</b>&nbsp;trip</div><div><en-todo checked="true"/>Milk</div><div><en-todo/>Eggs</div><ul><li>bread</li></ul></en-note>]]></content>
+    <created>20260102T030405Z</created>
+    <updated>20260203T040506Z</updated>
+    <tag>shopping</tag>
+    <tag>weekend plans</tag>
+    <resource>
+      <data encoding="base64">` + base64.StdEncoding.EncodeToString([]byte("hello")) + `</data>
+      <mime>text/plain</mime>
+      <resource-attributes><file-name>hello.txt</file-name></resource-attributes>
+    </resource>
+  </note>
+  <note>
+    <title></title>
+    <content><![CDATA[<en-note><div>First line</div><div>the rest</div></en-note>]]></content>
+  </note>
+</en-export>`
+
+func collect(t *testing.T, format string, data []byte) []importer.Note {
+	t.Helper()
+	notes, err := collectWithin(t, format, data, importer.DefaultLimits(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notes
+}
+
+// collectWithin reads the notes of the export within the limits.
+func collectWithin(t *testing.T, format string, data []byte, limits importer.Limits) ([]importer.Note, error) {
+	t.Helper()
+	notes := []importer.Note{}
+	err := importer.Each(format, bytes.NewReader(data), int64(len(data)), limits, func(i int, note importer.Note) error {
+		assert.Equal(t, len(notes), i)
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+func zipFiles(t *testing.T, files map[string]string, order ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	keep := zipFiles(t, map[string]string{"Takeout/Keep/a.json": "{}"}, "Takeout/Keep/a.json")
+	simplenote := zipFiles(t, map[string]string{"source/notes.json": "{}"}, "source/notes.json")
+	markdown := zipFiles(t, map[string]string{"Vault/Groceries.md": "milk"}, "Vault/Groceries.md")
+	tests := []struct {
+		filename string
+		head     []byte
+		want     string
+	}{
+		{"notes.enex", []byte("anything"), importer.FormatENEX},
+		{"export", []byte(enex), importer.FormatENEX},
+		{"takeout.zip", keep, importer.FormatKeep},
+		{"notes.zip", simplenote, importer.FormatSimplenote},
+		{"notes.json", []byte(`{"activeNotes":[]}`), importer.FormatSimplenote},
+		{"note.json", []byte(`{"title":"a","textContent":"b"}`), importer.FormatKeep},
+		{"vault.zip", markdown, importer.FormatMarkdown},
+		{"Groceries.md", []byte("# Groceries"), importer.FormatMarkdown},
+	}
+	for _, tt := range tests {
+		got, err := importer.Detect(tt.filename, tt.head)
+		assert.Nil(t, err, tt.filename)
+		assert.Equal(t, tt.want, got, tt.filename)
+	}
+	_, err := importer.Detect("notes.txt", []byte("plain text"))
+	assert.ErrorIs(t, err, importer.ErrUnknownFormat)
+}
+
+func TestENEX(t *testing.T) {
+	notes := collect(t, importer.FormatENEX, []byte(enex))
+	if !assert.Len(t, notes, 2) {
+		return
+	}
+
+	note := notes[0]
+	assert.Nil(t, note.Err)
+	assert.Equal(t, "Groceries", note.Title)
+	assert.Equal(t, "For the weekend trip\n- bread", note.Content)
+	assert.Equal(t, []importer.Item{{Text: "Milk", Done: true}, {Text: "Eggs"}}, note.Checklist)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), note.CreatedAt)
+	assert.Equal(t, time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC), note.UpdatedAt)
+	assert.Equal(t, "For the weekend trip\n- bread\n\n#shopping #weekend-plans", note.Body())
+	assert.Equal(t, []importer.File{{Name: "hello.txt", Data: []byte("hello")}}, note.Files)
+
+	assert.Equal(t, "First line", notes[1].Title, "the untitled notes are titled with their first line")
+	assert.Equal(t, "the rest", notes[1].Content)
+
+	_, err := importer.Count(importer.FormatENEX, strings.NewReader("<en-export><note>"), 17, importer.DefaultLimits(1<<20))
+	assert.NotNil(t, err)
+}
+
+func TestKeep(t *testing.T) {
+	archive := zipFiles(t, map[string]string{
+		"Takeout/Keep/Groceries.json": `{"title":"Groceries","isTrashed":false,"createdTimestampUsec":1767323045000000,
+			"userEditedTimestampUsec":1770091506000000,"listContent":[{"text":"Milk","isChecked":true},{"text":"Eggs","isChecked":false}],
+			"labels":[{"name":"shopping"}],"attachments":[{"filePath":"photo.jpeg","mimetype":"image/jpeg"}]}`,
+		"Takeout/Keep/Groceries.html":  "<html></html>",
+		"Takeout/Keep/photo.jpg":       "jpeg data",
+		"Takeout/Keep/Trashed.json":    `{"title":"Trashed","isTrashed":true,"textContent":"gone"}`,
+		"Takeout/Keep/Broken.json":     `{"title":`,
+		"Takeout/archive_browser.html": "<html></html>",
+	}, "Takeout/archive_browser.html", "Takeout/Keep/Groceries.html", "Takeout/Keep/Groceries.json", "Takeout/Keep/photo.jpg",
+		"Takeout/Keep/Trashed.json", "Takeout/Keep/Broken.json")
+
+	notes := collect(t, importer.FormatKeep, archive)
+	if !assert.Len(t, notes, 2, "the trashed notes are skipped") {
+		return
+	}
+	note := notes[0]
+	assert.Nil(t, note.Err)
+	assert.Equal(t, "Groceries", note.Title)
+	assert.Equal(t, []importer.Item{{Text: "Milk", Done: true}, {Text: "Eggs"}}, note.Checklist)
+	assert.Equal(t, []string{"shopping"}, note.Tags)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), note.CreatedAt)
+	assert.Equal(t, []importer.File{{Name: "photo.jpg", Data: []byte("jpeg data")}}, note.Files,
+		"the attachments are matched by their name")
+
+	assert.Equal(t, "Broken", notes[1].Title)
+	assert.NotNil(t, notes[1].Err)
+
+	single := collect(t, importer.FormatKeep, []byte(`{"title":"","textContent":"Single note\nwith text"}`))
+	if assert.Len(t, single, 1) {
+		assert.Equal(t, "Single note", single[0].Title)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	note := `{"title":"Groceries","attachments":[{"filePath":"photo.jpg"}]}`
+	archive := zipFiles(t, map[string]string{
+		"Keep/Groceries.json": note,
+		"Keep/photo.jpg":      strings.Repeat("x", 200),
+		"Keep/Large.json":     `{"title":"Large","textContent":"` + strings.Repeat("x", 200) + `"}`,
+	}, "Keep/Groceries.json", "Keep/photo.jpg", "Keep/Large.json")
+	limits := importer.Limits{File: 100, Attachment: 100, Total: 1000}
+
+	notes, err := collectWithin(t, importer.FormatKeep, archive, limits)
+	assert.Nil(t, err)
+	if assert.Len(t, notes, 2) {
+		assert.ErrorContains(t, notes[0].Err, "larger than the limit", "the attachments over the limit fail their note")
+		assert.ErrorContains(t, notes[1].Err, "larger than the limit")
+	}
+
+	_, err = collectWithin(t, importer.FormatKeep, archive, importer.Limits{File: 300, Attachment: 300, Total: 300})
+	assert.ErrorIs(t, err, importer.ErrTooLarge, "the files can't add up to more than the total")
+
+	// the header of the file claims it's a byte.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	content := []byte(`{"title":"Forged","textContent":"` + strings.Repeat("x", 200) + `"}`)
+	w, _ := zw.CreateRaw(&zip.FileHeader{Name: "Forged.json", Method: zip.Store, CompressedSize64: uint64(len(content)), UncompressedSize64: 1})
+	w.Write(content)
+	zw.Close()
+	notes, err = collectWithin(t, importer.FormatKeep, buf.Bytes(), limits)
+	assert.Nil(t, err)
+	if assert.Len(t, notes, 1) {
+		assert.NotNil(t, notes[0].Err, "the forged sizes aren't trusted")
+	}
+
+	vaultArchive := zipFiles(t, map[string]string{
+		"Groceries.md":          "![[photo.jpg]]",
+		"Large.md":              strings.Repeat("x", 200),
+		"attachments/photo.jpg": strings.Repeat("x", 200),
+	}, "Groceries.md", "Large.md", "attachments/photo.jpg")
+	notes, err = collectWithin(t, importer.FormatMarkdown, vaultArchive, limits)
+	assert.Nil(t, err)
+	if assert.Len(t, notes, 2) {
+		assert.ErrorContains(t, notes[0].Err, "larger than the limit")
+		assert.ErrorContains(t, notes[1].Err, "larger than the limit")
+	}
+	_, err = collectWithin(t, importer.FormatMarkdown, vaultArchive, importer.Limits{File: 300, Attachment: 300, Total: 300})
+	assert.ErrorIs(t, err, importer.ErrTooLarge)
+
+	_, err = collectWithin(t, importer.FormatSimplenote, []byte(`{"activeNotes":[{"content":"`+strings.Repeat("x", 200)+`"}]}`), limits)
+	assert.ErrorContains(t, err, "larger than the limit")
+
+	resource := "<resource><data>\n" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 200))) + "\n</data></resource>"
+	enexExport := []byte("<en-export><note><title>Groceries</title>" + resource + "</note>" +
+		"<note><title>Large</title><content>" + strings.Repeat("x", 200) + "</content></note>" +
+		"<note><title>Photos</title>" + resource + resource + "</note></en-export>")
+	notes, err = collectWithin(t, importer.FormatENEX, enexExport, limits)
+	assert.Nil(t, err)
+	if assert.Len(t, notes, 3) {
+		assert.ErrorContains(t, notes[0].Err, "larger than the limit", "the attachments are checked before they're decoded")
+		assert.Empty(t, notes[0].Files)
+		assert.ErrorContains(t, notes[1].Err, "larger than the limit")
+	}
+	_, err = collectWithin(t, importer.FormatENEX, enexExport, importer.Limits{File: 300, Attachment: 300, Total: 300})
+	assert.ErrorIs(t, err, importer.ErrTooLarge)
+	count, err := importer.Count(importer.FormatENEX, bytes.NewReader(enexExport), int64(len(enexExport)), importer.Limits{})
+	assert.Nil(t, err, "the attachments aren't read while counting")
+	assert.Equal(t, 3, count)
+}
+
+func TestSimplenote(t *testing.T) {
+	export := `{"activeNotes":[{"id":"1","content":"Todo\r\nwrite tests","creationDate":"2026-01-02T03:04:05.000Z",
+		"lastModified":"2026-02-03T04:05:06.000Z","tags":["work"]},{"id":"2","content":""}],
+		"trashedNotes":[{"id":"3","content":"Trashed"}]}`
+	for _, data := range [][]byte{
+		[]byte(export),
+		zipFiles(t, map[string]string{"source/notes.json": export}, "source/notes.json"),
+	} {
+		notes := collect(t, importer.FormatSimplenote, data)
+		if !assert.Len(t, notes, 2) {
+			return
+		}
+		assert.Equal(t, "Todo", notes[0].Title)
+		assert.Equal(t, "write tests", notes[0].Content)
+		assert.Equal(t, []string{"work"}, notes[0].Tags)
+		assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), notes[0].CreatedAt)
+		assert.Equal(t, "Untitled", notes[1].Title)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	archive := zipFiles(t, map[string]string{
+		"Vault/Groceries.md": "---\nid: 0b5c4a3e-6a0f-4c1e-9a59-3d1c0f6d3a11\ntitle: Groceries list\nfolder: Old\ncreated: 2026-01-02T03:04:05Z\n" +
+			"updated: 2026-02-03\ntags: [shopping]\nchecklist:\n  - text: Milk\n    done: true\n  - text: Eggs\n" +
+			"attachments: [attachments/Groceries/list.txt]\n---\nFor [[Work/Trip|the trip]] #shopping\n![[photo.png]]\n",
+		"Vault/Work/Trip.md":                   "Pack for [[Groceries]], see [the list](note:0B5C4A3E-6A0F-4C1E-9A59-3D1C0F6D3A11) and [[Missing]].",
+		"Vault/Work/Broken.md":                 "---\ntitle: [\n---\n",
+		"Vault/attachments/Groceries/list.txt": "milk, eggs",
+		"Vault/photo.png":                      "png data",
+		"Vault/.obsidian/app.json":             "{}",
+		"Vault/.trash/Old.md":                  "trashed",
+	}, "Vault/Groceries.md", "Vault/Work/Trip.md", "Vault/Work/Broken.md", "Vault/attachments/Groceries/list.txt",
+		"Vault/photo.png", "Vault/.obsidian/app.json", "Vault/.trash/Old.md")
+
+	notes := collect(t, importer.FormatMarkdown, archive)
+	if !assert.Len(t, notes, 3, "the hidden files are skipped") {
+		return
+	}
+	note := notes[0]
+	assert.Nil(t, note.Err)
+	assert.Equal(t, "Groceries list", note.Title)
+	assert.Equal(t, "", note.Folder, "the folder of the file wins over the one of the front matter")
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), note.CreatedAt)
+	assert.Equal(t, time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), note.UpdatedAt)
+	assert.Equal(t, []importer.Item{{Text: "Milk", Done: true}, {Text: "Eggs"}}, note.Checklist)
+	assert.Equal(t, []importer.File{{Name: "list.txt", Data: []byte("milk, eggs")}, {Name: "photo.png", Data: []byte("png data")}},
+		note.Files, "the attachments of the front matter and the embeds are attached")
+	note.Resolve(func(i int) string { return fmt.Sprintf("00000000-0000-0000-0000-%012d", i) })
+	assert.Equal(t, "For [the trip](note:00000000-0000-0000-0000-000000000001) #shopping\n![[photo.png]]\n", note.Body(),
+		"the tags in the content aren't repeated")
+
+	trip := notes[1]
+	assert.Equal(t, "Trip", trip.Title, "the notes without a title are titled with their file name")
+	trip.Resolve(func(i int) string { return fmt.Sprintf("00000000-0000-0000-0000-%012d", i) })
+	assert.Equal(t, "Pack for [Groceries](note:00000000-0000-0000-0000-000000000000), see "+
+		"[the list](note:00000000-0000-0000-0000-000000000000) and [[Missing]].", trip.Body(),
+		"the links are resolved by name and exported id")
+	assert.Equal(t, "Work", trip.Folder)
+
+	assert.Equal(t, "Broken", notes[2].Title)
+	assert.NotNil(t, notes[2].Err)
+
+	exported := zipFiles(t, map[string]string{"Work/Trip.md": "---\nfolder: Work\n---\ntext"}, "Work/Trip.md")
+	if notes := collect(t, importer.FormatMarkdown, exported); assert.Len(t, notes, 1) {
+		assert.Equal(t, "Work", notes[0].Folder, "the folder of the exported notes isn't taken for the folder of the vault")
+	}
+
+	single := collect(t, importer.FormatMarkdown, []byte("# Heading\n\nsome text"))
+	if assert.Len(t, single, 1) {
+		assert.Equal(t, "Heading", single[0].Title, "the title is derived from the first heading")
+		assert.Equal(t, "some text", single[0].Content)
+	}
+	single = collect(t, importer.FormatMarkdown, []byte("---\nfolder: Work/Trips\n---\n# Trip"))
+	if assert.Len(t, single, 1) {
+		assert.Equal(t, "Work/Trips", single[0].Folder, "the single files are imported in the folder of their front matter")
+	}
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	stores := memory.NewStores()
+	user := &models.User{Name: "Mock User", Email: "user@email.com"}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	blobs := blob.NewLocal(t.TempDir())
+
+	export := []byte(strings.Replace(enex, "</en-export>", `<note><title>Too large</title><content><![CDATA[<en-note>`+
+		strings.Repeat("a", 2000)+`</en-note>]]></content></note></en-export>`, 1))
+	submit := func(processed int) *models.ImportJob {
+		t.Helper()
+		job := &models.ImportJob{UserID: user.ID, Format: importer.FormatENEX, Status: models.ImportPending, Processed: processed}
+		job.ID, job.CreatedAt = uuid.NewString(), now
+		job.StorageKey = importer.StorageKey(user.ID, job.ID)
+		if err := stores.Imports.Create(job); err != nil {
+			t.Fatal(err)
+		}
+		if err := blobs.Put(ctx, job.StorageKey, bytes.NewReader(export), int64(len(export))); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	newWorker := func() *importer.Worker {
+		w := importer.NewWorker(stores, blobs, models.Quotas{Default: models.Quota{MaxNoteSize: 1000}}, 1<<20)
+		w.Now = func() time.Time { return now }
+		return w
+	}
+
+	t.Run("imports_the_notes_and_reports_the_failed_ones", func(t *testing.T) {
+		job := submit(0)
+		assert.Equal(t, 1, newWorker().Run(ctx))
+
+		found, err := stores.Imports.FindForUser(job.ID, user.ID)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, models.ImportDone, found.Status)
+		assert.Equal(t, []int{3, 3, 2, 1}, []int{found.Total, found.Processed, found.Imported, found.Failed})
+		if assert.Len(t, found.Failures, 1) {
+			assert.Equal(t, 2, found.Failures[0].Index)
+			assert.Equal(t, "Too large", found.Failures[0].Title)
+			assert.Contains(t, found.Failures[0].Reason, "1000 bytes")
+		}
+		_, err = blobs.Open(ctx, job.StorageKey)
+		assert.ErrorIs(t, err, blob.ErrNotFound, "the export is deleted")
+
+		notes, _ := stores.Notes.ListForUser(user.ID)
+		if !assert.Len(t, notes, 2) {
+			return
+		}
+		var groceries models.Note
+		for _, note := range notes {
+			if note.Title == "Groceries" {
+				groceries = note
+			}
+		}
+		assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), groceries.CreatedAt.UTC())
+		assert.Equal(t, time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC), groceries.UpdatedAt.UTC())
+		items, _ := stores.Checklists.ListForNote(groceries.ID, user.ID)
+		assert.Len(t, items, 2)
+		atts, _ := stores.Attachments.ListForNote(groceries.ID, user.ID)
+		if assert.Len(t, atts, 1) {
+			assert.Equal(t, "hello.txt", atts[0].Filename)
+			r, err := blobs.Open(ctx, atts[0].StorageKey)
+			if assert.Nil(t, err) {
+				r.Close()
+			}
+		}
+	})
+
+	t.Run("resumes_the_jobs_after_the_imported_notes", func(t *testing.T) {
+		job := submit(2)
+		before, _ := stores.Notes.ListForUser(user.ID)
+		assert.Equal(t, 1, newWorker().Run(ctx))
+
+		found, _ := stores.Imports.FindForUser(job.ID, user.ID)
+		assert.Equal(t, models.ImportDone, found.Status)
+		assert.Equal(t, 3, found.Processed)
+		after, _ := stores.Notes.ListForUser(user.ID)
+		assert.Equal(t, len(before), len(after), "only the last note is left and it fails")
+	})
+
+	t.Run("fails_the_jobs_with_an_invalid_export", func(t *testing.T) {
+		job := &models.ImportJob{UserID: user.ID, Format: importer.FormatKeep, Status: models.ImportPending, StorageKey: "imports/invalid"}
+		stores.Imports.Create(job)
+		blobs.Put(ctx, job.StorageKey, strings.NewReader("not json"), 8)
+		assert.Equal(t, 1, newWorker().Run(ctx))
+
+		found, _ := stores.Imports.FindForUser(job.ID, user.ID)
+		assert.Equal(t, models.ImportFailed, found.Status)
+		assert.Contains(t, found.Error, "invalid keep note")
+		assert.NotNil(t, found.FinishedAt)
+	})
+}
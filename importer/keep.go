@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type keepNote struct {
+	Title                   string `json:"title"`
+	TextContent             string `json:"textContent"`
+	IsTrashed               bool   `json:"isTrashed"`
+	CreatedTimestampUsec    int64  `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64  `json:"userEditedTimestampUsec"`
+	ListContent             []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+	} `json:"attachments"`
+}
+
+// eachKeep reads the notes of a Takeout archive, every note is a JSON file next to its attachments, or the note of a
+// single JSON file. The trashed notes are skipped.
+func eachKeep(r io.ReaderAt, size int64, a *archive, fn func(i int, note Note) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err == zip.ErrFormat {
+		data, err := readAll(r, size, a.limits)
+		if err != nil {
+			return err
+		}
+		var kn keepNote
+		if err := json.Unmarshal(data, &kn); err != nil {
+			return fmt.Errorf("invalid keep note: %w", err)
+		}
+		if kn.IsTrashed {
+			return nil
+		}
+		return fn(0, kn.note(a, nil, ""))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid keep archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	i := 0
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".json") {
+			continue
+		}
+		var kn keepNote
+		data, err := a.readFile(f, a.limits.File)
+		if err == nil {
+			err = json.Unmarshal(data, &kn)
+		}
+		if a.err != nil {
+			return a.err
+		}
+		var note Note
+		switch {
+		case err != nil:
+			note = Note{Title: strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name)), Err: fmt.Errorf("invalid note: %w", err)}
+		case kn.IsTrashed || (kn.Title == "" && kn.TextContent == "" && len(kn.ListContent) == 0 && kn.CreatedTimestampUsec == 0):
+			// the trashed notes and the other json files of the archive are skipped.
+			continue
+		default:
+			note = kn.note(a, files, path.Dir(f.Name))
+			if a.err != nil {
+				return a.err
+			}
+		}
+		if err := fn(i, note); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+// note converts the Keep note, its attachments are looked up in the files of the archive in dir. The attachments
+// missing from the archive are skipped.
+func (kn *keepNote) note(a *archive, files map[string]*zip.File, dir string) Note {
+	note := Note{Title: kn.Title, Content: kn.TextContent}
+	if kn.CreatedTimestampUsec > 0 {
+		note.CreatedAt = time.UnixMicro(kn.CreatedTimestampUsec).UTC()
+	}
+	if kn.UserEditedTimestampUsec > 0 {
+		note.UpdatedAt = time.UnixMicro(kn.UserEditedTimestampUsec).UTC()
+	}
+	for _, item := range kn.ListContent {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			note.Checklist = append(note.Checklist, Item{Text: text, Done: item.IsChecked})
+		}
+	}
+	for _, label := range kn.Labels {
+		note.Tags = append(note.Tags, label.Name)
+	}
+	for _, att := range kn.Attachments {
+		f := keepAttachment(files, dir, att.FilePath)
+		if f == nil {
+			continue
+		}
+		data, err := a.readFile(f, a.limits.Attachment)
+		if err != nil {
+			note.Err = fmt.Errorf("invalid attachment %s: %w", att.FilePath, err)
+			continue
+		}
+		note.Files = append(note.Files, File{Name: path.Base(f.Name), Data: data})
+	}
+	note.normalize()
+	return note
+}
+
+// keepAttachment finds the attachment file in dir, Takeout sometimes stores the images with another extension than
+// the one in the note so they're matched by their name too.
+func keepAttachment(files map[string]*zip.File, dir, name string) *zip.File {
+	if name == "" || files == nil {
+		return nil
+	}
+	if f, ok := files[path.Join(dir, name)]; ok {
+		return f
+	}
+	base := strings.TrimSuffix(name, path.Ext(name))
+	for key, f := range files {
+		ext := strings.ToLower(path.Ext(key))
+		if path.Dir(key) == dir && strings.TrimSuffix(path.Base(key), path.Ext(key)) == base && ext != ".json" &&
+			ext != ".html" {
+			return f
+		}
+	}
+	return nil
+}
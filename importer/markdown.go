@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/msal4/toastnotes/vault"
+)
+
+// mdNote is a note file of a vault.
+type mdNote struct {
+	f *zip.File
+	// dir is the folder of the note relative to the root of the vault.
+	dir string
+	// fm and body are the parsed note, err is set if it couldn't be read.
+	fm   vault.FrontMatter
+	body string
+	err  error
+}
+
+// eachMarkdown reads the notes of a vault archive, every Markdown file is a note in its folder, or the note of a single
+// Markdown file in the folder of its front matter. The links to the other notes of the vault are resolved by their file names,
+// or by the ids of the front matter of the exported vaults.
+func eachMarkdown(r io.ReaderAt, size int64, a *archive, fn func(i int, note Note) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err == zip.ErrFormat {
+		data, err := readAll(r, size, a.limits)
+		if err != nil {
+			return err
+		}
+		fm, body, err := vault.Parse(data)
+		if err != nil {
+			return fn(0, Note{Title: "Untitled", Err: err})
+		}
+		return fn(0, markdownNote(a, fm, body, "", fm.Folder, nil))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid vault archive: %w", err)
+	}
+
+	root := vaultRoot(zr.File)
+	var notes []mdNote
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, root)
+		if f.FileInfo().IsDir() || hidden(name) {
+			continue
+		}
+		if strings.EqualFold(path.Ext(name), vault.Ext) {
+			dir := path.Dir(name)
+			if dir == "." {
+				dir = ""
+			}
+			notes = append(notes, mdNote{f: f, dir: dir})
+			continue
+		}
+		files[strings.ToLower(name)] = f
+		if base := strings.ToLower(path.Base(name)); files[base] == nil {
+			files[base] = f
+		}
+	}
+
+	// the links are resolved by the paths of the notes, their names if they're unique and their exported ids.
+	targets := map[string]int{}
+	names := map[string]int{}
+	for i, n := range notes {
+		name := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(n.f.Name, root), path.Ext(n.f.Name)))
+		targets[name] = i
+		if _, ok := names[path.Base(name)]; ok {
+			names[path.Base(name)] = -1
+		} else {
+			names[path.Base(name)] = i
+		}
+	}
+	for name, i := range names {
+		if _, ok := targets[name]; !ok && i >= 0 {
+			targets[name] = i
+		}
+	}
+	// the notes are read once and kept, the ids of all of them are needed to resolve the links of the first one.
+	for i := range notes {
+		n := &notes[i]
+		data, err := a.readFile(n.f, a.limits.File)
+		if a.err != nil {
+			return a.err
+		}
+		if err == nil {
+			n.fm, n.body, err = vault.Parse(data)
+		}
+		if n.err = err; err == nil && n.fm.ID != "" {
+			targets[strings.ToLower(n.fm.ID)] = i
+		}
+	}
+
+	for i, n := range notes {
+		title := strings.TrimSuffix(path.Base(n.f.Name), path.Ext(n.f.Name))
+		var note Note
+		if n.err != nil {
+			note = Note{Title: title, Err: fmt.Errorf("invalid note: %w", n.err)}
+		} else {
+			dir := n.dir
+			if root != "" && n.fm.Folder == path.Join(strings.TrimSuffix(root, "/"), dir) {
+				// the exported notes were all in a folder, which was taken for the folder of the vault.
+				dir = n.fm.Folder
+			}
+			note = markdownNote(a, n.fm, n.body, title, dir, func(name string) *zip.File { return vaultFile(files, root, name) })
+			if a.err != nil {
+				return a.err
+			}
+			note.resolve(targets)
+		}
+		// the parsed note is released once it's imported.
+		notes[i] = mdNote{}
+		if err := fn(i, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownNote converts the parsed note file named title in the folder dir, the attachments are looked up with file
+// and read from the archive.
+func markdownNote(a *archive, fm vault.FrontMatter, body, title, dir string, file func(name string) *zip.File) Note {
+	note := Note{Title: fm.Title, Content: body, CreatedAt: fm.Created, UpdatedAt: fm.Updated, Tags: fm.Tags}
+	if note.Title == "" {
+		note.Title = title
+	}
+	note.Folder = folder(dir)
+	for _, item := range fm.Checklist {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			note.Checklist = append(note.Checklist, Item{Text: text, Done: item.Done})
+		}
+	}
+
+	if file != nil {
+		attached := map[*zip.File]bool{}
+		for _, name := range append(fm.Attachments, vault.Embeds(body)...) {
+			f := file(name)
+			if f == nil || attached[f] {
+				// the missing attachments and the embedded notes are skipped.
+				continue
+			}
+			attached[f] = true
+			data, err := a.readFile(f, a.limits.Attachment)
+			if err != nil {
+				note.Err = fmt.Errorf("invalid attachment %s: %w", name, err)
+				continue
+			}
+			note.Files = append(note.Files, File{Name: path.Base(f.Name), Data: data})
+		}
+	}
+
+	note.normalize()
+	if fm.Title != "" || title != "" {
+		// the content isn't trimmed when the title isn't derived from it so that the vaults round trip.
+		note.Content = body
+	} else if heading := strings.TrimSpace(strings.TrimLeft(note.Title, "#")); heading != "" {
+		note.Title = heading
+	}
+	return note
+}
+
+// folder cleans the folder of a note of the vault, the empty names and the "." and ".." ones are dropped.
+func folder(dir string) string {
+	names := []string{}
+	for _, name := range strings.Split(dir, "/") {
+		if name != "" && name != "." && name != ".." {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// resolve finds the notes of the vault the links of the content point to, the links to the other files are left as
+// they are.
+func (n *Note) resolve(targets map[string]int) {
+	for _, link := range vault.Links(n.Content) {
+		if i, ok := targets[strings.ToLower(link.Target)]; ok {
+			n.Links = append(n.Links, Link{Start: link.Start, End: link.End, Label: link.Label, Index: i})
+		}
+	}
+}
+
+// vaultFile finds the attachment by its path in the vault, or by its name for the embeds that only have the name.
+func vaultFile(files map[string]*zip.File, root, name string) *zip.File {
+	name = strings.ToLower(strings.TrimPrefix(path.Clean("/"+name), "/"))
+	if f, ok := files[name]; ok {
+		return f
+	}
+	if f, ok := files[strings.TrimPrefix(name, strings.ToLower(root))]; ok {
+		return f
+	}
+	return files[path.Base(name)]
+}
+
+// vaultRoot returns the folder all the files of the archive are in, if they are, the archives of a vault folder have
+// the vault in it.
+func vaultRoot(files []*zip.File) string {
+	root := ""
+	for i, f := range files {
+		dir, _, ok := strings.Cut(f.Name, "/")
+		if !ok {
+			return ""
+		}
+		if i == 0 {
+			root = dir + "/"
+		} else if dir+"/" != root {
+			return ""
+		}
+	}
+	if hidden(root) {
+		return ""
+	}
+	return root
+}
+
+// hidden reports whether the file is hidden or in a hidden folder like the settings of Obsidian in .obsidian and its
+// trash in .trash.
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type simplenoteExport struct {
+	ActiveNotes []struct {
+		Content      string   `json:"content"`
+		CreationDate string   `json:"creationDate"`
+		LastModified string   `json:"lastModified"`
+		Tags         []string `json:"tags"`
+	} `json:"activeNotes"`
+}
+
+// eachSimplenote reads the active notes of the notes.json of an export, or of the zip archive it's in. The notes
+// have no title, their first line is used.
+func eachSimplenote(r io.ReaderAt, size int64, a *archive, fn func(i int, note Note) error) error {
+	var data []byte
+	zr, err := zip.NewReader(r, size)
+	switch {
+	case err == zip.ErrFormat:
+		data, err = readAll(r, size, a.limits)
+	case err != nil:
+		return fmt.Errorf("invalid simplenote archive: %w", err)
+	default:
+		data, err = readSimplenoteArchive(a, zr)
+	}
+	if err != nil {
+		return err
+	}
+
+	var export simplenoteExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("invalid simplenote export: %w", err)
+	}
+	for i, sn := range export.ActiveNotes {
+		note := Note{Content: sn.Content, Tags: sn.Tags}
+		note.CreatedAt, _ = time.Parse(time.RFC3339, sn.CreationDate)
+		note.UpdatedAt, _ = time.Parse(time.RFC3339, sn.LastModified)
+		note.normalize()
+		if err := fn(i, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSimplenoteArchive reads the notes.json of the archive, the text files next to it hold the same notes.
+func readSimplenoteArchive(a *archive, zr *zip.Reader) ([]byte, error) {
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Base(f.Name), "notes.json") {
+			return a.readFile(f, a.limits.File)
+		}
+	}
+	return nil, fmt.Errorf("invalid simplenote archive: notes.json not found")
+}
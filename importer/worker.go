@@ -0,0 +1,321 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/blob"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// Lease is how long a worker owns the job it's running, it's renewed with every imported note. A job whose worker
+// stopped is resumed by another one after its lease expires, from the first note that wasn't imported.
+const Lease = 5 * time.Minute
+
+// StorageKey returns the blob key of the export uploaded for the job.
+func StorageKey(userID, jobID string) string {
+	return "imports/" + userID + "/" + jobID
+}
+
+// NoteID returns the id of the note at the index of the export of the job. The ids are known before the notes are
+// imported so that the links between them can be resolved, and the resumed jobs give the notes the same ids.
+func NoteID(jobID string, i int) string {
+	return uuid.NewSHA1(noteNamespace, []byte(jobID+"/"+strconv.Itoa(i))).String()
+}
+
+// noteNamespace is the namespace of the ids of the imported notes.
+var noteNamespace = uuid.MustParse("5b0e7a2c-9f7e-4b6e-8c1a-2f4d9e3b6a10")
+
+// noteError is the reason a note of an export wasn't imported, it's reported to the user. The other errors stop the
+// job until it's resumed.
+type noteError struct {
+	reason string
+}
+
+func (e *noteError) Error() string {
+	return e.reason
+}
+
+// Worker runs the import jobs. Any number of workers can share the stores, every job is run by one of them at a time.
+type Worker struct {
+	Stores *models.Stores
+	Blobs  blob.Store
+	// Quotas are the quotas of the plans of the users, the notes that don't fit are reported as failed.
+	Quotas models.Quotas
+	// MaxAttachmentSize is the maximum size of an imported attachment in bytes.
+	MaxAttachmentSize int64
+	// Limits are the limits of the files read from the exports.
+	Limits Limits
+	Now    func() time.Time
+}
+
+// NewWorker creates a worker importing the notes into the stores.
+func NewWorker(stores *models.Stores, blobs blob.Store, quotas models.Quotas, maxAttachmentSize int64) *Worker {
+	return &Worker{
+		Stores: stores, Blobs: blobs, Quotas: quotas, MaxAttachmentSize: maxAttachmentSize,
+		Limits: DefaultLimits(maxAttachmentSize), Now: time.Now,
+	}
+}
+
+// Run runs the unfinished jobs one at a time until there are none left, it returns how many were finished.
+func (w *Worker) Run(ctx context.Context) int {
+	finished := 0
+	for ctx.Err() == nil {
+		job, err := w.Stores.Imports.WithContext(ctx).Claim(w.Now(), Lease)
+		if errors.Is(err, models.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("Failed to claim the pending imports")
+			}
+			break
+		}
+		if err := w.run(ctx, job); err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Str("import", job.ID).Msg("Failed to run an import")
+			}
+			// the job is left to be resumed once its lease expires.
+			continue
+		}
+		finished++
+	}
+	return finished
+}
+
+// run imports the notes of the claimed job that weren't imported yet and finishes it. An export that can't be read
+// or is over the limits fails the job, the other errors are returned and the job is resumed later.
+func (w *Worker) run(ctx context.Context, job *models.ImportJob) error {
+	export, size, cleanup, err := w.open(ctx, job.StorageKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return w.finish(ctx, job, errors.New("the uploaded export is missing"))
+	}
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if job.Processed == 0 {
+		if job.Total, err = Count(job.Format, export, size, w.Limits); err != nil {
+			return w.finish(ctx, job, err)
+		}
+		if err := w.save(ctx, w.Stores, job, nil); err != nil {
+			return err
+		}
+	}
+
+	err = Each(job.Format, export, size, w.Limits, func(i int, note Note) error {
+		if i < job.Processed {
+			return nil
+		}
+		return w.importNote(ctx, job, i, note)
+	})
+	if errors.Is(err, ErrTooLarge) {
+		return w.finish(ctx, job, err)
+	}
+	if err != nil {
+		return err
+	}
+	return w.finish(ctx, job, nil)
+}
+
+// importNote imports the note along with the progress of the job in a transaction, a note that fails is rolled back
+// by itself and reported.
+func (w *Worker) importNote(ctx context.Context, job *models.ImportJob, i int, note Note) error {
+	var keys, failedKeys []string
+	next := *job
+	err := w.Stores.Transaction(ctx, func(tx *models.Stores) error {
+		err := tx.Transaction(ctx, func(tx *models.Stores) error {
+			var err error
+			keys, err = w.create(ctx, tx.WithQuota(w.Quotas), job, i, note)
+			return err
+		})
+
+		var failures []models.ImportFailure
+		var ne *noteError
+		switch {
+		case err == nil:
+			next.Imported++
+		case errors.As(err, &ne):
+			failedKeys, keys = keys, nil
+			next.Failed++
+			if next.Failed <= models.MaxImportFailures {
+				failures = []models.ImportFailure{{Index: i, Title: note.Title, Reason: ne.reason}}
+			}
+		default:
+			return err
+		}
+		next.Processed = i + 1
+		return w.save(ctx, tx, &next, failures)
+	})
+	w.deleteBlobs(ctx, failedKeys)
+	if err != nil {
+		w.deleteBlobs(ctx, keys)
+		return err
+	}
+	*job = next
+	return nil
+}
+
+// create creates the note at the index of the export of the job with its checklist and attachments and returns the
+// keys of the stored blobs.
+func (w *Worker) create(ctx context.Context, stores *models.Stores, job *models.ImportJob, i int, note Note) ([]string, error) {
+	if note.Err != nil {
+		return nil, &noteError{reason: note.Err.Error()}
+	}
+
+	userID := job.UserID
+	note.Resolve(func(i int) string { return NoteID(job.ID, i) })
+	n := &models.Note{Title: note.Title, Content: note.Body(), UserID: userID, Folder: note.Folder}
+	if !models.ValidFolder(n.Folder) {
+		// the folders that can't be kept, like the too long ones, are left out.
+		n.Folder = ""
+	}
+	n.ID, n.CreatedAt, n.UpdatedAt = NoteID(job.ID, i), note.CreatedAt, note.UpdatedAt
+	if err := stores.Notes.WithContext(ctx).Create(n); err != nil {
+		return nil, reason(err)
+	}
+	for _, item := range note.Checklist {
+		if err := stores.Checklists.WithContext(ctx).Add(&models.ChecklistItem{NoteID: n.ID, UserID: userID, Text: item.Text, Done: item.Done}, -1); err != nil {
+			return nil, reason(err)
+		}
+	}
+
+	var keys []string
+	for _, file := range note.Files {
+		key, err := w.attach(ctx, stores.Attachments, n, file)
+		if key != "" {
+			keys = append(keys, key)
+		}
+		if err != nil {
+			return keys, reason(err)
+		}
+	}
+	return keys, nil
+}
+
+// attach stores the file and creates its attachment, it returns the key of the stored blob.
+func (w *Worker) attach(ctx context.Context, store models.AttachmentStore, note *models.Note, file File) (string, error) {
+	size := int64(len(file.Data))
+	if size > w.MaxAttachmentSize {
+		return "", &noteError{reason: fmt.Sprintf("the attachment %s is larger than the limit of %d bytes", file.Name, w.MaxAttachmentSize)}
+	}
+
+	sum := sha256.Sum256(file.Data)
+	att := &models.Attachment{
+		NoteID:   note.ID,
+		UserID:   note.UserID,
+		Filename: utils.SanitizeFilename(file.Name),
+		MimeType: http.DetectContentType(file.Data),
+		Size:     size,
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	att.ID = uuid.NewString()
+	att.StorageKey = att.UserID + "/" + att.NoteID + "/" + att.ID
+
+	if err := w.Blobs.Put(ctx, att.StorageKey, bytes.NewReader(file.Data), size); err != nil {
+		return "", err
+	}
+	return att.StorageKey, store.WithContext(ctx).Create(att)
+}
+
+// finish marks the job done, or failed with err, releases it and deletes the uploaded export.
+func (w *Worker) finish(ctx context.Context, job *models.ImportJob, err error) error {
+	next := *job
+	next.Status = models.ImportDone
+	if err != nil {
+		next.Status, next.Error = models.ImportFailed, err.Error()
+	}
+	now := w.Now().UTC()
+	next.FinishedAt = &now
+	claimedUntil := *job.ClaimedUntil
+	next.ClaimedUntil = nil
+	if err := w.Stores.Imports.WithContext(ctx).Update(&next, claimedUntil, nil); err != nil {
+		return err
+	}
+	*job = next
+
+	w.deleteBlobs(ctx, []string{job.StorageKey})
+	return nil
+}
+
+// save saves the progress of the job and renews its claim.
+func (w *Worker) save(ctx context.Context, stores *models.Stores, job *models.ImportJob, failures []models.ImportFailure) error {
+	claimedUntil := *job.ClaimedUntil
+	until := w.Now().UTC().Add(Lease).Truncate(time.Millisecond)
+	job.ClaimedUntil = &until
+	if err := stores.Imports.WithContext(ctx).Update(job, claimedUntil, failures); err != nil {
+		job.ClaimedUntil = &claimedUntil
+		return err
+	}
+	return nil
+}
+
+// open opens the export for random access, the blobs that can't be read at an offset are copied to a temporary
+// file. The returned func releases the export.
+func (w *Worker) open(ctx context.Context, key string) (io.ReaderAt, int64, func(), error) {
+	r, err := w.Blobs.Open(ctx, key)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		r.Close()
+		return nil, 0, nil, err
+	}
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra, size, func() { r.Close() }, nil
+	}
+	defer r.Close()
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, nil, err
+	}
+	f, err := os.CreateTemp("", "toastnotes-import-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return f, size, cleanup, nil
+}
+
+// deleteBlobs deletes the blobs stored for the notes that weren't imported, failing to do so leaves orphaned blobs
+// so it's only logged.
+func (w *Worker) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := w.Blobs.Delete(context.WithoutCancel(ctx), key); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Could not delete an imported blob")
+		}
+	}
+}
+
+// reason converts the errors caused by the note itself to a *noteError.
+func reason(err error) error {
+	var qe *models.QuotaError
+	switch {
+	case errors.As(err, &qe):
+		return &noteError{reason: qe.Message()}
+	case errors.Is(err, models.ErrChecklistFull):
+		return &noteError{reason: fmt.Sprintf("the checklist has more than %d items", models.MaxChecklistItems)}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Message is an email message.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// DefaultMailer is the mailer used by the controllers.
+var DefaultMailer Mailer = LogMailer{}
+
+// New creates an SMTP mailer if the smtp address is set and a LogMailer otherwise.
+func New(cfg config.Mail) Mailer {
+	if cfg.SMTPAddr == "" {
+		return LogMailer{}
+	}
+
+	return &SMTPMailer{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.From,
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+}
+
+// LogMailer writes messages to the log instead of sending them, useful for development.
+type LogMailer struct{}
+
+// Send logs the message.
+func (LogMailer) Send(msg Message) error {
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg(msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// Send sends the message using the SMTP server.
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := strings.SplitN(m.Addr, ":", 2)[0]
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.From, msg.To, msg.Subject, msg.Body)
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(body))
+}
+
+// MemoryMailer keeps the sent messages in memory, it's intended to be used in tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send stores the message.
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the sent messages.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message{}, m.messages...)
+}
+
+// Reset removes all the stored messages.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
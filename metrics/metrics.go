@@ -0,0 +1,191 @@
+// Package metrics records the prometheus metrics of the http server, the database and the app.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "toastnotes"
+
+// The login methods and results used as the logins counter labels.
+const (
+	LoginPassword  = "password"
+	LoginLink      = "login_link"
+	LoginPasskey   = "passkey"
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+)
+
+// Metrics holds the app collectors and the registry they're registered in.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	requestSize     *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+
+	Registrations prometheus.Counter
+	Logins        *prometheus.CounterVec
+	NotesCreated  prometheus.Counter
+}
+
+// New creates the app metrics in a new registry along with the go runtime and process metrics.
+func New() *Metrics {
+	sizeBuckets := prometheus.ExponentialBuckets(128, 4, 8) // 128B to 2MB
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "The number of handled http requests.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "The time taken to handle http requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_size_bytes",
+			Help:    "The size of the http request bodies.",
+			Buckets: sizeBuckets,
+		}, []string{"method", "route"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "response_size_bytes",
+			Help:    "The size of the http response bodies.",
+			Buckets: sizeBuckets,
+		}, []string{"method", "route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "db", Name: "query_duration_seconds",
+			Help:    "The time taken by the database queries.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"table", "operation"}),
+
+		Registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "registrations_total",
+			Help: "The number of registered users.",
+		}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "logins_total",
+			Help: "The number of login attempts by method and result.",
+		}, []string{"method", "result"}),
+		NotesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "notes_created_total",
+			Help: "The number of created notes.",
+		}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.requestSize, m.responseSize, m.queryDuration,
+		m.Registrations, m.Logins, m.NotesCreated,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Login records a login attempt using the given method.
+func (m *Metrics) Login(method string, ok bool) {
+	result := LoginSucceeded
+	if !ok {
+		result = LoginFailed
+	}
+	m.Logins.WithLabelValues(method, result).Inc()
+}
+
+// Middleware records the requests labelled by their route template (e.g. /api/v1/notes/:id) so that the number of
+// series doesn't grow with the ids, requests that don't match a route are labelled "unmatched".
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.requests.WithLabelValues(method, route, status).Inc()
+		m.requestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+		if c.Request.ContentLength > 0 {
+			m.requestSize.WithLabelValues(method, route).Observe(float64(c.Request.ContentLength))
+		}
+		if size := c.Writer.Size(); size > 0 {
+			m.responseSize.WithLabelValues(method, route).Observe(float64(size))
+		}
+	}
+}
+
+const startKey = "metrics:start"
+
+// InstrumentDB registers gorm callbacks recording the query durations by table and operation, and the connection
+// pool stats collector.
+func (m *Metrics) InstrumentDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := m.Registry.Register(collectors.NewDBStatsCollector(sqlDB, db.Dialector.Name())); err != nil {
+		return err
+	}
+
+	before := func(db *gorm.DB) {
+		db.InstanceSet(startKey, time.Now())
+	}
+	after := func(operation string) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			v, ok := db.InstanceGet(startKey)
+			if !ok {
+				return
+			}
+			table := db.Statement.Table
+			if table == "" {
+				table = "unknown"
+			}
+			m.queryDuration.WithLabelValues(table, operation).Observe(time.Since(v.(time.Time)).Seconds())
+		}
+	}
+
+	cb := db.Callback()
+	return firstErr(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	)
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/notes/:id", func(c *gin.Context) { c.String(http.StatusOK, "note") })
+
+	for _, path := range []string{"/notes/1", "/notes/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	t.Run("labels_requests_by_route_template", func(t *testing.T) {
+		assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/notes/:id", "200")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "unmatched", "404")))
+	})
+
+	t.Run("records_durations_and_sizes", func(t *testing.T) {
+		assert.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.responseSize))
+	})
+
+	t.Run("serves_the_metrics", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `toastnotes_http_requests_total{method="GET",route="/notes/:id",status="200"} 2`)
+		assert.Contains(t, w.Body.String(), "go_goroutines")
+	})
+}
+
+type note struct {
+	ID    string
+	Title string
+}
+
+func TestInstrumentDB(t *testing.T) {
+	// a dry run db runs the callbacks without connecting to the database.
+	db, err := gorm.Open(postgres.Open("postgres://localhost/toastnotes"), &gorm.Config{
+		DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := New()
+	assert.Nil(t, m.InstrumentDB(db))
+
+	db.Find(&[]note{})
+	db.Find(&[]note{})
+	db.Create(&note{Title: "title"})
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.queryDuration))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `toastnotes_db_query_duration_seconds_count{operation="query",table="notes"} 2`)
+	assert.Contains(t, w.Body.String(), `toastnotes_db_query_duration_seconds_count{operation="create",table="notes"} 1`)
+	assert.Contains(t, w.Body.String(), "go_sql_open_connections")
+}
+
+func TestLogin(t *testing.T) {
+	m := New()
+	m.Login(LoginPassword, true)
+	m.Login(LoginPassword, false)
+	m.Login(LoginPassword, false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Logins.WithLabelValues(LoginPassword, LoginSucceeded)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.Logins.WithLabelValues(LoginPassword, LoginFailed)))
+}
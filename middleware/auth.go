@@ -9,21 +9,21 @@ import (
 )
 
 // JWTAuth is the auth middleware that handles jwt authentication.
-func JWTAuth() gin.HandlerFunc {
+func JWTAuth(tokens *auth.Tokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		abortUnauthorized := func() {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		}
 
-		tokenStr, err := c.Cookie(auth.AccessTokenKey)
+		tokenStr, err := c.Cookie(tokens.AccessTokenCookie)
 		if err != nil {
 			abortUnauthorized()
 			return
 		}
 
 		claims := auth.AccessTokenClaims{}
-		token, err := auth.ParseToken(tokenStr, &claims)
+		token, err := tokens.ParseToken(tokenStr, &claims)
 		if err != nil {
 			if err == jwt.ErrSignatureInvalid {
 				abortUnauthorized()
@@ -1,28 +1,26 @@
 package middleware
 
 import (
-	"os"
-	"strings"
-
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/config"
 )
 
 // CORS (Cross-Origin Resource Sharing).
-func CORS() gin.HandlerFunc {
-	config := cors.DefaultConfig()
-	originsStr := os.Getenv("ALLOW_ORIGINS")
+func CORS(cfg config.CORS) gin.HandlerFunc {
+	corsConfig := cors.DefaultConfig()
 
-	if originsStr != "" && originsStr != "*" {
-		origins := []string{}
-		for _, o := range strings.Split(originsStr, ",") {
-			origins = append(origins, strings.Trim(o, " "))
-		}
-		config.AllowOrigins = origins
-		config.AllowCredentials = true
+	if !cfg.AllowAllOrigins() {
+		corsConfig.AllowOrigins = cfg.AllowOrigins
+		corsConfig.AllowCredentials = true
 	} else {
-		config.AllowAllOrigins = true
+		corsConfig.AllowAllOrigins = true
 	}
 
-	return cors.New(config)
+	// the tus resumable uploads headers.
+	corsConfig.AddAllowHeaders("Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata")
+	corsConfig.AddExposeHeaders("Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires", "X-Attachment-Id")
+
+	return cors.New(corsConfig)
 }
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deadline gives the request timeout from now to read its body and write its response. The server read and write
+// timeouts are meant for the small requests and would cut the file uploads and downloads short.
+func Deadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := time.Now().Add(timeout)
+		rc := http.NewResponseController(c.Writer)
+		// the writers without deadlines, like the test recorders, keep the server ones.
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+		c.Next()
+	}
+}
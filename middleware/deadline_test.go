@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	slow := func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	}
+	router := gin.New()
+	router.GET("/short", slow)
+	router.GET("/long", Deadline(5*time.Second), slow)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/short")
+	assert.NotNil(t, err, "the server write timeout applies by default")
+
+	resp, err := http.Get(server.URL + "/long")
+	if assert.Nil(t, err) {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "done", string(body))
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header the request id is read from and written to.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the context key of the request id.
+const RequestIDKey = "requestId"
+
+const loggerKey = "logger"
+
+// maxRequestIDLen is the maximum length of an incoming request id, longer or non printable ids are replaced.
+const maxRequestIDLen = 128
+
+// Logger sets up a request scoped logger with the request id and logs each request once it's handled. The request id
+// is taken from the X-Request-ID header or generated if it's missing, and is sent back in the response headers.
+func Logger(l zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		ctx := l.With().Str(RequestIDKey, id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+			ctx = ctx.Str("traceId", sc.TraceID().String())
+		}
+		rl := ctx.Logger()
+		c.Set(loggerKey, &rl)
+		c.Request = c.Request.WithContext(rl.WithContext(c.Request.Context()))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = rl.Error()
+		case status >= http.StatusBadRequest:
+			event = rl.Warn()
+		default:
+			event = rl.Info()
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		event = event.
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Str("route", route).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", c.Writer.Size()).
+			Str("ip", c.ClientIP()).
+			Str("userAgent", c.Request.UserAgent())
+		if userID := c.GetString(auth.UserIDKey); userID != "" {
+			event = event.Str(auth.UserIDKey, userID)
+		}
+		event.Msg("Handled request")
+	}
+}
+
+// Log returns the request scoped logger, the global logger is returned if the Logger middleware isn't used.
+func Log(c *gin.Context) *zerolog.Logger {
+	if v, ok := c.Get(loggerKey); ok {
+		return v.(*zerolog.Logger)
+	}
+	return &log.Logger
+}
+
+// ValidRequestID reports whether an incoming request id can be kept, it must be printable ascii and not too long.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
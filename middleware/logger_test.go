@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	router := gin.New()
+	router.Use(Logger(zerolog.New(&buf)))
+	router.GET("/notes/:id", func(c *gin.Context) {
+		c.Set(auth.UserIDKey, "user-id")
+		c.String(http.StatusOK, "note")
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		Log(c).Error().Err(errors.New("connection refused")).Msg("Could not handle your request")
+		c.Status(http.StatusInternalServerError)
+	})
+
+	// entries decodes the logged lines.
+	entries := func() []map[string]interface{} {
+		var out []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			entry := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, entry)
+		}
+		buf.Reset()
+		return out
+	}
+
+	t.Run("logs_the_request_and_generates_a_request_id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/notes/1", nil))
+
+		id := w.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 36)
+
+		logged := entries()
+		if assert.Len(t, logged, 1) {
+			assert.Equal(t, "info", logged[0]["level"])
+			assert.Equal(t, id, logged[0][RequestIDKey])
+			assert.Equal(t, "/notes/:id", logged[0]["route"])
+			assert.Equal(t, "/notes/1", logged[0]["path"])
+			assert.Equal(t, 200.0, logged[0]["status"])
+			assert.Equal(t, "user-id", logged[0][auth.UserIDKey])
+		}
+	})
+
+	t.Run("propagates_the_request_id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/notes/1", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+		assert.Equal(t, "abc-123", entries()[0][RequestIDKey])
+	})
+
+	t.Run("replaces_invalid_request_ids", func(t *testing.T) {
+		for _, id := range []string{"has space", strings.Repeat("a", 129)} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/notes/1", nil)
+			req.Header.Set(RequestIDHeader, id)
+			router.ServeHTTP(w, req)
+
+			assert.NotEqual(t, id, w.Header().Get(RequestIDHeader))
+			assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+		}
+		buf.Reset()
+	})
+
+	t.Run("handlers_log_with_the_request_id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/fail", nil))
+
+		id := w.Header().Get(RequestIDHeader)
+		logged := entries()
+		if assert.Len(t, logged, 2) {
+			assert.Equal(t, "connection refused", logged[0]["error"])
+			assert.Equal(t, id, logged[0][RequestIDKey])
+			assert.Equal(t, "error", logged[1]["level"])
+			assert.Equal(t, id, logged[1][RequestIDKey])
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter is an in-memory fixed window rate limiter.
+type RateLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter creates a rate limiter allowing limit hits per key in each window.
+func NewRateLimiter(limit int, w time.Duration) *RateLimiter {
+	return &RateLimiter{Limit: limit, Window: w, windows: map[string]*window{}}
+}
+
+// Allow records a hit for the key and reports whether it's within the limit.
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.Window {
+		// drop the expired windows every now and then so the map doesn't grow forever.
+		if len(l.windows) > 10000 {
+			for k, w := range l.windows {
+				if now.Sub(w.start) >= l.Window {
+					delete(l.windows, k)
+				}
+			}
+		}
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	w.count++
+	return w.count <= l.Limit
+}
+
+// RateLimit limits the requests per client ip using the given limiter.
+func RateLimit(l *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.Allow(c.ClientIP()) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,398 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dir and SQLiteDir are the postgres and sqlite migrations source directories relative to the project root, new
+// migrations are created in both so that their versions stay in line.
+const (
+	Dir       = "migrations/sql"
+	SQLiteDir = "migrations/sqlite"
+)
+
+// The dialects of the migrations, they match the gorm dialector names.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// lockID is the key of the postgres advisory lock held while migrating so that multiple instances don't race.
+const lockID = 7362811451
+
+//go:embed sql/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with its up and down sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration with the time it was applied at, AppliedAt is nil for pending migrations.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations, the applied versions are recorded in the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	// Dialect is the database dialect, Postgres when empty.
+	Dialect string
+}
+
+// New creates a migrator using the embedded migrations of the dialect.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	dir := "sql"
+	switch dialect {
+	case Postgres:
+	case SQLite:
+		dir = "sqlite"
+	default:
+		return nil, fmt.Errorf("unsupported migrations dialect %q", dialect)
+	}
+
+	sub, err := fs.Sub(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Parse(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Migrations: migrations, Dialect: dialect}, nil
+}
+
+// Parse reads the migrations in fsys named <version>_<name>.(up|down).sql sorted by version, every migration must
+// have both an up and a down file.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileRegex.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Create creates empty up and down files for a new migration in dir numbered after the latest one and returns
+// their paths.
+func Create(dir, name string) (string, string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q, use letters, digits and underscores", name)
+	}
+
+	migrations, err := Parse(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	var version int64 = 1
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte("-- "+strings.ReplaceAll(name, "_", " ")+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- revert "+strings.ReplaceAll(name, "_", " ")+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+
+	return up, down, nil
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, q querier) error {
+	appliedAt := "timestamptz NOT NULL DEFAULT now()"
+	if m.Dialect == SQLite {
+		appliedAt = "datetime NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	}
+	_, err := q.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at `+appliedAt+`
+	)`)
+	return err
+}
+
+// tableExists reports whether the migrations table has been created.
+func (m *Migrator) tableExists(ctx context.Context, q querier) (bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if m.Dialect == SQLite {
+		query = "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var exists bool
+	for rows.Next() {
+		if err := rows.Scan(&exists); err != nil {
+			return false, err
+		}
+	}
+	return exists, rows.Err()
+}
+
+// bind replaces the $n placeholders of query with the sqlite ones.
+func (m *Migrator) bind(query string) string {
+	if m.Dialect != SQLite {
+		return query
+	}
+	return placeholderRegex.ReplaceAllString(query, "?")
+}
+
+var placeholderRegex = regexp.MustCompile(`\$\d+`)
+
+func applied(ctx context.Context, q querier) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+
+	return versions, rows.Err()
+}
+
+// Status lists all the migrations with the time they were applied at. It only reads the database, the migrations
+// are all pending if the migrations table hasn't been created yet.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	exists, err := m.tableExists(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[int64]time.Time{}
+	if exists {
+		if versions, err = applied(ctx, m.DB); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, len(m.Migrations))
+	for i, mig := range m.Migrations {
+		statuses[i] = Status{Migration: mig}
+		if at, ok := versions[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// Pending lists the migrations that haven't been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies all the pending migrations in order, each in its own transaction, and returns the applied ones.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.Migrations {
+			if _, ok := versions[mig.Version]; ok {
+				continue
+			}
+
+			err := m.inTx(ctx, conn, func(tx querier) error {
+				if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, m.bind("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"), mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the latest applied migrations, up to steps of them, and returns the rolled back ones.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	done := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.Migrations[i]
+			if _, ok := versions[mig.Version]; !ok {
+				continue
+			}
+
+			err := m.inTx(ctx, conn, func(tx querier) error {
+				if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, m.bind("DELETE FROM schema_migrations WHERE version = $1"), mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %04d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// withLock runs fn on a single connection holding the migrations lock, the postgres advisory lock or the sqlite write
+// lock of a transaction spanning the whole run.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.Dialect == SQLite {
+		if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+			return fmt.Errorf("could not acquire the migrations lock: %w", err)
+		}
+		// the failed migrations are rolled back to their savepoint, the ones applied before them are kept.
+		defer conn.ExecContext(context.Background(), "COMMIT")
+	} else {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return fmt.Errorf("could not acquire the migrations lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// inTx runs fn in a transaction, a savepoint of the run transaction on sqlite.
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, fn func(tx querier) error) error {
+	if m.Dialect == SQLite {
+		if _, err := conn.ExecContext(ctx, "SAVEPOINT migration"); err != nil {
+			return err
+		}
+		if err := fn(conn); err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK TO migration")
+			conn.ExecContext(context.Background(), "RELEASE migration")
+			return err
+		}
+		_, err := conn.ExecContext(ctx, "RELEASE migration")
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,216 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("sorts_the_migrations_by_version", func(t *testing.T) {
+		migrations, err := Parse(fstest.MapFS{
+			"0002_second.up.sql":   {Data: []byte("up 2")},
+			"0002_second.down.sql": {Data: []byte("down 2")},
+			"0001_first.up.sql":    {Data: []byte("up 1")},
+			"0001_first.down.sql":  {Data: []byte("down 1")},
+			"README.md":            {Data: []byte("ignored")},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+			{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+		}, migrations)
+	})
+
+	t.Run("requires_both_up_and_down", func(t *testing.T) {
+		_, err := Parse(fstest.MapFS{"0001_first.up.sql": {Data: []byte("up 1")}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("rejects_conflicting_names", func(t *testing.T) {
+		_, err := Parse(fstest.MapFS{
+			"0001_first.up.sql":   {Data: []byte("up 1")},
+			"0001_other.down.sql": {Data: []byte("down 1")},
+		})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("parses_the_embedded_migrations", func(t *testing.T) {
+		m, err := New(nil, Postgres)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, m.Migrations)
+		assert.Equal(t, int64(1), m.Migrations[0].Version)
+
+		_, err = New(nil, "mysql")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("the_postgres_schema_doesnt_need_the_uuid_extension", func(t *testing.T) {
+		pg, _ := New(nil, Postgres)
+		for _, m := range pg.Migrations {
+			assert.NotContains(t, m.Up, `CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`, m.Name)
+			assert.NotContains(t, m.Up, "DEFAULT uuid_generate_v4()", m.Name)
+		}
+	})
+
+	t.Run("the_dialects_have_the_same_versions", func(t *testing.T) {
+		pg, _ := New(nil, Postgres)
+		lite, err := New(nil, SQLite)
+		assert.Nil(t, err)
+		if assert.Equal(t, len(pg.Migrations), len(lite.Migrations)) {
+			for i := range pg.Migrations {
+				assert.Equal(t, pg.Migrations[i].Version, lite.Migrations[i].Version)
+				assert.Equal(t, pg.Migrations[i].Name, lite.Migrations[i].Name)
+			}
+		}
+	})
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	up, down, err := Create(dir, "add_tags")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "0001_add_tags.up.sql"), up)
+	assert.Equal(t, filepath.Join(dir, "0001_add_tags.down.sql"), down)
+
+	up, _, err = Create(dir, "add_folders")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "0002_add_folders.up.sql"), up)
+
+	_, _, err = Create(dir, "bad name")
+	assert.NotNil(t, err)
+}
+
+// testDatabases runs fn against a new sqlite database and the TEST_DATABASE_URL one if it's a postgres database,
+// fn drops the schema_migrations table so it's never run against a shared sqlite database.
+func testDatabases(t *testing.T, fn func(t *testing.T, db *sql.DB, dialect string)) {
+	testutils.LoadEnv()
+	dsns := map[string]string{"sqlite": "sqlite://" + filepath.Join(t.TempDir(), "toastnotes.db")}
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" && !strings.HasPrefix(dsn, "sqlite:") {
+		dsns["database"] = dsn
+	}
+
+	for name, dsn := range dsns {
+		t.Run(name, func(t *testing.T) {
+			db, err := models.OpenConnection(dsn, logger.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sqlDB, _ := db.DB()
+			t.Cleanup(func() { sqlDB.Close() })
+			fn(t, sqlDB, models.Dialect(db))
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	testDatabases(t, testMigrator)
+}
+
+func testMigrator(t *testing.T, db *sql.DB, dialect string) {
+	ctx := context.Background()
+
+	migrator := &Migrator{DB: db, Dialect: dialect, Migrations: []Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE migration_test_a (id int)", Down: "DROP TABLE migration_test_a"},
+		{Version: 2, Name: "create_b", Up: "CREATE TABLE migration_test_b (id int)", Down: "DROP TABLE migration_test_b"},
+	}}
+	reset := func() {
+		db.Exec("DROP TABLE IF EXISTS migration_test_a")
+		db.Exec("DROP TABLE IF EXISTS migration_test_b")
+		db.Exec("DROP TABLE IF EXISTS schema_migrations")
+	}
+	reset()
+	t.Cleanup(reset)
+
+	pending, err := migrator.Pending(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+	exists, err := migrator.tableExists(ctx, db)
+	assert.Nil(t, err)
+	assert.False(t, exists, "listing the pending migrations doesn't create the migrations table")
+
+	// concurrent runs must apply every migration exactly once.
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 3)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := migrator.Up(ctx)
+			assert.Nil(t, err)
+			applied[i] = got
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for _, a := range applied {
+		total += len(a)
+	}
+	assert.Equal(t, 2, total)
+
+	statuses, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.NotNil(t, statuses[1].AppliedAt)
+
+	rolledBack, err := migrator.Down(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{migrator.Migrations[1]}, rolledBack)
+	_, err = db.Exec("SELECT * FROM migration_test_b")
+	assert.NotNil(t, err)
+
+	pending, err = migrator.Pending(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{migrator.Migrations[1]}, pending)
+
+	t.Run("a_failing_migration_is_not_recorded", func(t *testing.T) {
+		broken := &Migrator{DB: db, Dialect: dialect, Migrations: append(migrator.Migrations, Migration{Version: 3, Name: "broken", Up: "NOT SQL", Down: ""})}
+		_, err := broken.Up(ctx)
+		assert.NotNil(t, err)
+
+		pending, _ := broken.Pending(ctx)
+		assert.Equal(t, []Migration{broken.Migrations[2]}, pending)
+	})
+}
+
+// TestSQLiteMigrations checks that every sqlite migration can be rolled back and applied again, the postgres ones
+// aren't rolled back since the test database is shared.
+func TestSQLiteMigrations(t *testing.T) {
+	db, err := models.OpenConnection("sqlite://"+filepath.Join(t.TempDir(), "toastnotes.db"), logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	migrator, err := New(sqlDB, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	_, err = migrator.Down(ctx, len(migrator.Migrations))
+	assert.Nil(t, err)
+	done, err := migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, done, len(migrator.Migrations))
+
+	statuses, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS credentials;
+DROP TABLE IF EXISTS login_links;
+DROP TABLE IF EXISTS notes;
+DROP TABLE IF EXISTS users;
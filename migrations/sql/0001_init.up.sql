@@ -0,0 +1,65 @@
+-- The initial schema, it matches the tables previously created by gorm's AutoMigrate so existing databases can be
+-- migrated without changes. The ids are generated by the app so the tables don't need the uuid-ossp extension, the
+-- defaults of the existing tables are dropped by 0013_drop_uuid_defaults.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text,
+    email text UNIQUE,
+    password text,
+    token_version bigint DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS notes (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    title text,
+    content text,
+    user_id uuid,
+    CONSTRAINT fk_users_notes FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes (deleted_at);
+
+CREATE TABLE IF NOT EXISTS login_links (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id uuid,
+    token_hash text,
+    nonce_hash text,
+    expires_at timestamptz,
+    used_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_login_links_deleted_at ON login_links (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_login_links_user_id ON login_links (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_links_token_hash ON login_links (token_hash);
+
+CREATE TABLE IF NOT EXISTS credentials (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id uuid,
+    name text,
+    credential_id bytea,
+    public_key bytea,
+    attestation_type text,
+    attestation_format text,
+    transports text,
+    flags smallint,
+    aaguid bytea,
+    sign_count bigint,
+    clone_warning boolean,
+    last_used_at timestamptz,
+    CONSTRAINT fk_users_credentials FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_credentials_deleted_at ON credentials (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_credentials_user_id ON credentials (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credentials_credential_id ON credentials (credential_id);
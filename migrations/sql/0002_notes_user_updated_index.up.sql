@@ -0,0 +1,2 @@
+-- Used to list the user notes ordered by the last update.
+CREATE INDEX IF NOT EXISTS idx_notes_user_id_updated_at ON notes (user_id, updated_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_notes_content_trgm;
+DROP INDEX IF EXISTS idx_notes_title_trgm;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    note_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    filename text NOT NULL,
+    mime_type text NOT NULL,
+    size bigint NOT NULL,
+    checksum text NOT NULL,
+    storage_key text NOT NULL,
+    CONSTRAINT fk_notes_attachments FOREIGN KEY (note_id) REFERENCES notes (id),
+    CONSTRAINT fk_users_attachments FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_deleted_at ON attachments (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_attachments_note_created ON attachments (note_id, created_at);
@@ -0,0 +1,19 @@
+-- The usage counted against the user quotas, it's kept up to date by the note and attachment stores. The usage of the
+-- existing users is counted from their notes and attachments.
+CREATE TABLE IF NOT EXISTS usages (
+    user_id uuid PRIMARY KEY,
+    notes bigint NOT NULL DEFAULT 0,
+    content_bytes bigint NOT NULL DEFAULT 0,
+    attachment_bytes bigint NOT NULL DEFAULT 0,
+    updated_at timestamptz,
+    CONSTRAINT fk_users_usage FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+INSERT INTO usages (user_id, notes, content_bytes, attachment_bytes, updated_at)
+SELECT u.id,
+    (SELECT count(*) FROM notes n WHERE n.user_id = u.id AND n.deleted_at IS NULL),
+    (SELECT coalesce(sum(octet_length(coalesce(n.title, '')) + octet_length(coalesce(n.content, ''))), 0)
+        FROM notes n WHERE n.user_id = u.id AND n.deleted_at IS NULL),
+    (SELECT coalesce(sum(a.size), 0) FROM attachments a WHERE a.user_id = u.id AND a.deleted_at IS NULL),
+    now()
+FROM users u;
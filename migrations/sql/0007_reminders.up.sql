@@ -0,0 +1,25 @@
+-- The note reminders, a note has one at most. The partial index serves the schedulers looking for the due reminders.
+CREATE TABLE IF NOT EXISTS reminders (
+    id uuid PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    note_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    at timestamptz NOT NULL,
+    timezone text NOT NULL,
+    recurrence text NOT NULL DEFAULT '',
+    channel text NOT NULL,
+    webhook_url text NOT NULL DEFAULT '',
+    next_at timestamptz,
+    last_fired_at timestamptz,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    claimed_until timestamptz,
+    CONSTRAINT fk_notes_reminders FOREIGN KEY (note_id) REFERENCES notes (id),
+    CONSTRAINT fk_users_reminders FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reminders_note_id ON reminders (note_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_deleted_at ON reminders (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_next_at ON reminders (next_at) WHERE next_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reminders_user_next_at ON reminders (user_id, next_at);
@@ -0,0 +1,2 @@
+-- The quota plan of the users, the empty plan is the default quota.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan text NOT NULL DEFAULT '';
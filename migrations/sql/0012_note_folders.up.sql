@@ -0,0 +1,2 @@
+-- The folders of the notes, the notes at the top level have the empty folder.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS folder text NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- The defaults are restored where the uuid-ossp extension is installed.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'uuid-ossp') THEN
+        ALTER TABLE users ALTER COLUMN id SET DEFAULT uuid_generate_v4();
+        ALTER TABLE notes ALTER COLUMN id SET DEFAULT uuid_generate_v4();
+        ALTER TABLE login_links ALTER COLUMN id SET DEFAULT uuid_generate_v4();
+        ALTER TABLE credentials ALTER COLUMN id SET DEFAULT uuid_generate_v4();
+    END IF;
+END
+$$;
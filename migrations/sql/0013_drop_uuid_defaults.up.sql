@@ -0,0 +1,7 @@
+-- The ids are generated by the app, the uuid_generate_v4() defaults of the tables created before are dropped so that
+-- the schema doesn't depend on the uuid-ossp extension, which isn't available on every postgres. The extension is
+-- left installed.
+ALTER TABLE users ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE notes ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE login_links ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE credentials ALTER COLUMN id DROP DEFAULT;
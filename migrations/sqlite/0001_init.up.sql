@@ -0,0 +1,62 @@
+-- The initial schema, the ids are generated by the app.
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    email text UNIQUE,
+    password text,
+    token_version integer DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS notes (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    title text,
+    content text,
+    user_id text,
+    CONSTRAINT fk_users_notes FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes (deleted_at);
+
+CREATE TABLE IF NOT EXISTS login_links (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id text,
+    token_hash text,
+    nonce_hash text,
+    expires_at datetime,
+    used_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_login_links_deleted_at ON login_links (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_login_links_user_id ON login_links (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_links_token_hash ON login_links (token_hash);
+
+CREATE TABLE IF NOT EXISTS credentials (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id text,
+    name text,
+    credential_id blob,
+    public_key blob,
+    attestation_type text,
+    attestation_format text,
+    transports text,
+    flags integer,
+    aaguid blob,
+    sign_count integer,
+    clone_warning boolean,
+    last_used_at datetime,
+    CONSTRAINT fk_users_credentials FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_credentials_deleted_at ON credentials (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_credentials_user_id ON credentials (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credentials_credential_id ON credentials (credential_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_notes_user_id_updated_at;
@@ -0,0 +1,15 @@
+-- The full text index of the notes title and content, the trigram tokenizer matches any substring of at least three
+-- characters case insensitively. It's kept in sync by the triggers.
+CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(note_id UNINDEXED, title, content, tokenize = 'trigram');
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO notes_fts (note_id, title, content) VALUES (new.id, new.title, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE OF title, content ON notes BEGIN
+    UPDATE notes_fts SET title = new.title, content = new.content WHERE note_id = new.id;
+END;
+CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM notes_fts WHERE note_id = old.id;
+END;
+
+INSERT INTO notes_fts (note_id, title, content) SELECT id, title, content FROM notes;
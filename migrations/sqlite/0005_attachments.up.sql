@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    note_id text NOT NULL,
+    user_id text NOT NULL,
+    filename text NOT NULL,
+    mime_type text NOT NULL,
+    size integer NOT NULL,
+    checksum text NOT NULL,
+    storage_key text NOT NULL,
+    CONSTRAINT fk_notes_attachments FOREIGN KEY (note_id) REFERENCES notes (id),
+    CONSTRAINT fk_users_attachments FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_deleted_at ON attachments (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_attachments_note_created ON attachments (note_id, created_at);
@@ -0,0 +1,20 @@
+-- The usage counted against the user quotas, it's kept up to date by the note and attachment stores. The usage of the
+-- existing users is counted from their notes and attachments.
+CREATE TABLE IF NOT EXISTS usages (
+    user_id text PRIMARY KEY,
+    notes integer NOT NULL DEFAULT 0,
+    content_bytes integer NOT NULL DEFAULT 0,
+    attachment_bytes integer NOT NULL DEFAULT 0,
+    updated_at datetime,
+    CONSTRAINT fk_users_usage FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- the text is cast to a blob so that its length is in bytes.
+INSERT INTO usages (user_id, notes, content_bytes, attachment_bytes, updated_at)
+SELECT u.id,
+    (SELECT count(*) FROM notes n WHERE n.user_id = u.id AND n.deleted_at IS NULL),
+    (SELECT coalesce(sum(length(CAST(coalesce(n.title, '') AS BLOB)) + length(CAST(coalesce(n.content, '') AS BLOB))), 0)
+        FROM notes n WHERE n.user_id = u.id AND n.deleted_at IS NULL),
+    (SELECT coalesce(sum(a.size), 0) FROM attachments a WHERE a.user_id = u.id AND a.deleted_at IS NULL),
+    strftime('%Y-%m-%d %H:%M:%f', 'now')
+FROM users u;
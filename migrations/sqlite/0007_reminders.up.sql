@@ -0,0 +1,25 @@
+-- The note reminders, a note has one at most. The partial index serves the schedulers looking for the due reminders.
+CREATE TABLE IF NOT EXISTS reminders (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    note_id text NOT NULL,
+    user_id text NOT NULL,
+    at datetime NOT NULL,
+    timezone text NOT NULL,
+    recurrence text NOT NULL DEFAULT '',
+    channel text NOT NULL,
+    webhook_url text NOT NULL DEFAULT '',
+    next_at datetime,
+    last_fired_at datetime,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    claimed_until datetime,
+    CONSTRAINT fk_notes_reminders FOREIGN KEY (note_id) REFERENCES notes (id),
+    CONSTRAINT fk_users_reminders FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reminders_note_id ON reminders (note_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_deleted_at ON reminders (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_next_at ON reminders (next_at) WHERE next_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reminders_user_next_at ON reminders (user_id, next_at);
@@ -0,0 +1,16 @@
+-- The checklist items of the notes, ordered by their position within the note.
+CREATE TABLE IF NOT EXISTS checklist_items (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    note_id text NOT NULL,
+    user_id text NOT NULL,
+    text text NOT NULL,
+    done boolean NOT NULL DEFAULT 0,
+    position integer NOT NULL,
+    CONSTRAINT fk_notes_checklist_items FOREIGN KEY (note_id) REFERENCES notes (id),
+    CONSTRAINT fk_users_checklist_items FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_deleted_at ON checklist_items (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_note_position ON checklist_items (note_id, position);
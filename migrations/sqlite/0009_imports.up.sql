@@ -0,0 +1,33 @@
+-- The note imports and the notes of them that couldn't be imported. The partial index serves the workers looking for
+-- the unfinished jobs.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id text NOT NULL,
+    format text NOT NULL,
+    filename text NOT NULL DEFAULT '',
+    status text NOT NULL,
+    total integer NOT NULL DEFAULT 0,
+    processed integer NOT NULL DEFAULT 0,
+    imported integer NOT NULL DEFAULT 0,
+    failed integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    storage_key text NOT NULL,
+    claimed_until datetime,
+    finished_at datetime,
+    CONSTRAINT fk_users_import_jobs FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_deleted_at ON import_jobs (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_unfinished ON import_jobs (created_at) WHERE status IN ('pending', 'running');
+
+CREATE TABLE IF NOT EXISTS import_failures (
+    import_job_id text NOT NULL,
+    note_index integer NOT NULL,
+    title text NOT NULL DEFAULT '',
+    reason text NOT NULL,
+    PRIMARY KEY (import_job_id, note_index),
+    CONSTRAINT fk_import_jobs_import_failures FOREIGN KEY (import_job_id) REFERENCES import_jobs (id) ON DELETE CASCADE
+);
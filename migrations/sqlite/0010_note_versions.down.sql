@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_notes_user_id_version;
+ALTER TABLE notes DROP COLUMN created_version;
+ALTER TABLE notes DROP COLUMN version;
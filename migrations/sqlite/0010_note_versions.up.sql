@@ -0,0 +1,10 @@
+-- The versions of the notes for the delta sync, every change of a note gives it the next version of its user. The
+-- existing notes are numbered in the order of their last update.
+ALTER TABLE notes ADD COLUMN version integer NOT NULL DEFAULT 0;
+ALTER TABLE notes ADD COLUMN created_version integer NOT NULL DEFAULT 0;
+
+UPDATE notes SET version = numbered.version, created_version = numbered.version
+FROM (SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY updated_at, id) AS version FROM notes) AS numbered
+WHERE notes.id = numbered.id;
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_id_version ON notes (user_id, version);
@@ -0,0 +1 @@
+-- The sqlite tables never had id defaults.
@@ -0,0 +1 @@
+-- The sqlite tables never had id defaults, the ids are generated by the app.
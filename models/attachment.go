@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Attachment is a file attached to a note, its content is kept in the blob store under StorageKey.
+type Attachment struct {
+	Model
+	NoteID     string `json:"noteId" gorm:"type:uuid"`
+	UserID     string `json:"-" gorm:"type:uuid"`
+	Filename   string `json:"filename"`
+	MimeType   string `json:"mimeType"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"` // hex encoded sha256 of the content
+	StorageKey string `json:"-"`
+}
+
+// AttachmentRepository holds the attachments actions, the sizes are counted in the user usage and checked against
+// the quota of the plan of the user.
+type AttachmentRepository struct {
+	*Repository
+	Quotas Quotas
+}
+
+// NewAttachmentRepository creates a new attachment repo.
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *AttachmentRepository) WithContext(ctx context.Context) AttachmentStore {
+	return &AttachmentRepository{Repository: &Repository{DB: rep.DB.WithContext(ctx)}, Quotas: rep.Quotas}
+}
+
+// WithQuota returns a copy of the repository enforcing the quotas.
+func (rep *AttachmentRepository) WithQuota(quotas Quotas) AttachmentStore {
+	return &AttachmentRepository{Repository: rep.Repository, Quotas: quotas}
+}
+
+// Create creates the attachment if the user has room for it.
+func (rep *AttachmentRepository) Create(att *Attachment) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		quota, err := quotaOf(tx, rep.Quotas, att.UserID)
+		if err != nil {
+			return err
+		}
+		if err := chargeUsage(tx, att.UserID, quota, Usage{AttachmentBytes: att.Size}); err != nil {
+			return err
+		}
+		return tx.Create(att).Error
+	})
+}
+
+// ListForNote lists the attachments of the user note, the oldest first.
+func (rep *AttachmentRepository) ListForNote(noteID, userID string) ([]Attachment, error) {
+	atts := []Attachment{}
+	if !validID(noteID) {
+		return atts, nil
+	}
+	err := rep.DB.Order("created_at, id").Find(&atts, "note_id = ? AND user_id = ?", noteID, userID).Error
+	return atts, err
+}
+
+// FindForNote finds the attachment with the given id if it's attached to the user note.
+func (rep *AttachmentRepository) FindForNote(id, noteID, userID string) (*Attachment, error) {
+	if !validID(id) || !validID(noteID) {
+		return nil, ErrNotFound
+	}
+
+	var att Attachment
+	if err := rep.DB.First(&att, "id = ? AND note_id = ? AND user_id = ?", id, noteID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &att, nil
+}
+
+// Delete permanently deletes the attachment of its user, its blob must be deleted separately.
+func (rep *AttachmentRepository) Delete(att *Attachment) error {
+	if !validID(att.ID) {
+		return ErrNotFound
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUsage(tx, att.UserID); err != nil {
+			return err
+		}
+		var stored Attachment
+		if err := tx.Select("size").First(&stored, "id = ? AND user_id = ?", att.ID, att.UserID).Error; err != nil {
+			return err
+		}
+
+		res := tx.Unscoped().Where("user_id = ?", att.UserID).Delete(att)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return addUsage(tx, att.UserID, Usage{AttachmentBytes: -stored.Size})
+	})
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxChecklistItems is the maximum number of items in the checklist of a note.
+const MaxChecklistItems = 500
+
+var (
+	// ErrChecklistFull is returned when an item is added to a checklist of MaxChecklistItems items.
+	ErrChecklistFull = errors.New("the checklist is full")
+	// ErrChecklistOrder is returned when a new order of a checklist doesn't list each of its items once.
+	ErrChecklistOrder = errors.New("the order must list each checklist item once")
+)
+
+// ChecklistItem is an item of the checklist of a note, the items are ordered by their position starting from 0.
+type ChecklistItem struct {
+	Model
+	NoteID   string `json:"noteId" gorm:"type:uuid"`
+	UserID   string `json:"-" gorm:"type:uuid"`
+	Text     string `json:"text"`
+	Done     bool   `json:"done"`
+	Position int    `json:"position"`
+}
+
+// ChecklistCount is the number of the checked items of a checklist and its size.
+type ChecklistCount struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// ChecklistRepository holds the checklist items actions. The changes of a checklist lock its note so that the
+// positions of the concurrent changes don't collide.
+type ChecklistRepository struct {
+	*Repository
+}
+
+// NewChecklistRepository creates a new checklist repo.
+func NewChecklistRepository(db *gorm.DB) *ChecklistRepository {
+	return &ChecklistRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *ChecklistRepository) WithContext(ctx context.Context) ChecklistStore {
+	return NewChecklistRepository(rep.DB.WithContext(ctx))
+}
+
+// lockNote locks the user note until the transaction ends, it returns ErrNotFound if the note doesn't exist or is
+// deleted.
+func lockNote(tx *gorm.DB, noteID, userID string) error {
+	if !validID(noteID) {
+		return ErrNotFound
+	}
+	var note Note
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&note, "id = ? AND user_id = ?", noteID, userID).Error
+}
+
+// ListForNote lists the checklist items of the user note in order.
+func (rep *ChecklistRepository) ListForNote(noteID, userID string) ([]ChecklistItem, error) {
+	items := []ChecklistItem{}
+	if !validID(noteID) {
+		return items, nil
+	}
+	err := rep.DB.Order("position, id").Find(&items, "note_id = ? AND user_id = ?", noteID, userID).Error
+	return items, err
+}
+
+// FindForNote finds the checklist item with the given id if it's in the user note.
+func (rep *ChecklistRepository) FindForNote(id, noteID, userID string) (*ChecklistItem, error) {
+	if !validID(id) || !validID(noteID) {
+		return nil, ErrNotFound
+	}
+
+	var item ChecklistItem
+	if err := rep.DB.First(&item, "id = ? AND note_id = ? AND user_id = ?", id, noteID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Add inserts the item into the checklist of its note at the position, the following items are moved down. An
+// out of range position appends the item.
+func (rep *ChecklistRepository) Add(item *ChecklistItem, position int) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNote(tx, item.NoteID, item.UserID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&ChecklistItem{}).Where("note_id = ?", item.NoteID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxChecklistItems {
+			return ErrChecklistFull
+		}
+
+		if position < 0 || position > int(count) {
+			position = int(count)
+		}
+		err := tx.Model(&ChecklistItem{}).Where("note_id = ? AND position >= ?", item.NoteID, position).
+			Update("position", gorm.Expr("position + 1")).Error
+		if err != nil {
+			return err
+		}
+		item.Position = position
+		return tx.Create(item).Error
+	})
+}
+
+// Update saves the text and the state of the item.
+func (rep *ChecklistRepository) Update(item *ChecklistItem) error {
+	if !validID(item.ID) {
+		return ErrNotFound
+	}
+
+	res := rep.DB.Model(item).Where("note_id = ? AND user_id = ?", item.NoteID, item.UserID).
+		Select("text", "done", "updated_at").Updates(item)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reorder orders the checklist of the user note as the ids and returns it, the ids must list each item once or
+// ErrChecklistOrder is returned.
+func (rep *ChecklistRepository) Reorder(noteID, userID string, ids []string) ([]ChecklistItem, error) {
+	var items []ChecklistItem
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNote(tx, noteID, userID); err != nil {
+			return err
+		}
+		var stored []ChecklistItem
+		if err := tx.Find(&stored, "note_id = ?", noteID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		items, err = orderChecklist(stored, ids)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if items[i].Position == i {
+				continue
+			}
+			items[i].Position = i
+			if err := tx.Model(&items[i]).Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// orderChecklist returns the items in the order of the ids, they must list each item once.
+func orderChecklist(items []ChecklistItem, ids []string) ([]ChecklistItem, error) {
+	if len(ids) != len(items) {
+		return nil, ErrChecklistOrder
+	}
+	byID := make(map[string]ChecklistItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	ordered := make([]ChecklistItem, 0, len(ids))
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			return nil, ErrChecklistOrder
+		}
+		delete(byID, id)
+		ordered = append(ordered, item)
+	}
+	return ordered, nil
+}
+
+// Delete permanently deletes the item of its user note, the following items are moved up.
+func (rep *ChecklistRepository) Delete(item *ChecklistItem) error {
+	if !validID(item.ID) {
+		return ErrNotFound
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNote(tx, item.NoteID, item.UserID); err != nil {
+			return err
+		}
+		var stored ChecklistItem
+		if err := tx.Select("id", "position").First(&stored, "id = ? AND note_id = ?", item.ID, item.NoteID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&stored).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ChecklistItem{}).Where("note_id = ? AND position > ?", item.NoteID, stored.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// Counts counts the checked and all the checklist items of the user notes with the given ids, the notes without
+// items are left out.
+func (rep *ChecklistRepository) Counts(userID string, noteIDs []string) (map[string]ChecklistCount, error) {
+	counts := map[string]ChecklistCount{}
+	noteIDs = validIDs(noteIDs)
+	if len(noteIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		NoteID string
+		ChecklistCount
+	}
+	err := rep.DB.Model(&ChecklistItem{}).
+		Select("note_id, SUM(CASE WHEN done THEN 1 ELSE 0 END) AS done, COUNT(*) AS total").
+		Where("user_id = ? AND note_id IN ?", userID, noteIDs).Group("note_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.NoteID] = row.ChecklistCount
+	}
+	return counts, nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+// Credential is a webauthn credential (passkey) registered by a user.
+type Credential struct {
+	Model
+	UserID            string     `json:"-" gorm:"type:uuid;index"`
+	Name              string     `json:"name"`
+	CredentialID      []byte     `json:"-" gorm:"uniqueIndex"`
+	PublicKey         []byte     `json:"-"`
+	AttestationType   string     `json:"-"`
+	AttestationFormat string     `json:"-"`
+	Transports        string     `json:"transports"` // comma separated
+	Flags             uint8      `json:"-"`
+	AAGUID            []byte     `json:"-" gorm:"column:aaguid"`
+	SignCount         uint32     `json:"-"`
+	CloneWarning      bool       `json:"-"`
+	LastUsedAt        *time.Time `json:"lastUsedAt"`
+}
+
+// NewCredential creates a credential for the user from the one returned by the registration ceremony.
+func NewCredential(userID, name string, c *webauthn.Credential) *Credential {
+	cred := &Credential{UserID: userID, Name: name}
+	cred.Update(c)
+	return cred
+}
+
+// Update sets the credential fields from the webauthn credential.
+func (c *Credential) Update(wc *webauthn.Credential) {
+	transports := make([]string, len(wc.Transport))
+	for i, t := range wc.Transport {
+		transports[i] = string(t)
+	}
+
+	c.CredentialID = wc.ID
+	c.PublicKey = wc.PublicKey
+	c.AttestationType = wc.AttestationType
+	c.AttestationFormat = wc.AttestationFormat
+	c.Transports = strings.Join(transports, ",")
+	c.Flags = wc.Flags.MsgpByte()
+	c.AAGUID = wc.Authenticator.AAGUID
+	c.SignCount = wc.Authenticator.SignCount
+	c.CloneWarning = wc.Authenticator.CloneWarning
+}
+
+// WebAuthn converts the credential to the type used by the webauthn ceremonies.
+func (c *Credential) WebAuthn() webauthn.Credential {
+	transports := []protocol.AuthenticatorTransport{}
+	if c.Transports != "" {
+		for _, t := range strings.Split(c.Transports, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:                c.CredentialID,
+		PublicKey:         c.PublicKey,
+		AttestationType:   c.AttestationType,
+		AttestationFormat: c.AttestationFormat,
+		Transport:         transports,
+		Flags:             webauthn.CredentialFlagsFromMsgpByte(c.Flags),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       c.AAGUID,
+			SignCount:    c.SignCount,
+			CloneWarning: c.CloneWarning,
+		},
+	}
+}
+
+// WebAuthnID implements webauthn.User, the user id is used as the user handle.
+func (u *User) WebAuthnID() []byte {
+	return []byte(u.ID)
+}
+
+// WebAuthnName implements webauthn.User.
+func (u *User) WebAuthnName() string {
+	return u.Email
+}
+
+// WebAuthnDisplayName implements webauthn.User.
+func (u *User) WebAuthnDisplayName() string {
+	return u.Name
+}
+
+// WebAuthnCredentials implements webauthn.User, the credentials must be preloaded.
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.Credentials))
+	for i := range u.Credentials {
+		creds[i] = u.Credentials[i].WebAuthn()
+	}
+	return creds
+}
+
+// CredentialRepository holds the credentials actions.
+type CredentialRepository struct {
+	*Repository
+}
+
+// NewCredentialRepository creates a new credential repo.
+func NewCredentialRepository(db *gorm.DB) *CredentialRepository {
+	return &CredentialRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *CredentialRepository) WithContext(ctx context.Context) CredentialStore {
+	return NewCredentialRepository(rep.DB.WithContext(ctx))
+}
+
+// Create creates the credential.
+func (rep *CredentialRepository) Create(cred *Credential) error {
+	return rep.DB.Create(cred).Error
+}
+
+// RetrieveUserWithCredentials finds the user with the given id and preloads their credentials.
+func (rep *CredentialRepository) RetrieveUserWithCredentials(id string) (*User, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var user User
+	if err := rep.DB.Preload("Credentials", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC")
+	}).First(&user, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListForUser lists the user credentials, most recently created first.
+func (rep *CredentialRepository) ListForUser(userID string) ([]Credential, error) {
+	creds := []Credential{}
+	err := rep.DB.Order("created_at DESC").Find(&creds, "user_id = ?", userID).Error
+	return creds, err
+}
+
+// FindForUser finds the credential with the given id if it belongs to the user.
+func (rep *CredentialRepository) FindForUser(id, userID string) (*Credential, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var cred Credential
+	if err := rep.DB.First(&cred, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// RecordLogin updates the credential after it has been used to log in.
+func (rep *CredentialRepository) RecordLogin(user *User, wc *webauthn.Credential) error {
+	for i := range user.Credentials {
+		cred := &user.Credentials[i]
+		if string(cred.CredentialID) != string(wc.ID) {
+			continue
+		}
+
+		now := time.Now()
+		cred.Update(wc)
+		cred.LastUsedAt = &now
+		return rep.DB.Model(cred).Select("Flags", "SignCount", "CloneWarning", "LastUsedAt").Updates(cred).Error
+	}
+
+	return gorm.ErrRecordNotFound
+}
+
+// Rename renames the credential.
+func (rep *CredentialRepository) Rename(cred *Credential, name string) error {
+	if err := rep.DB.Model(cred).Update("name", name).Error; err != nil {
+		return err
+	}
+	cred.Name = name
+	return nil
+}
+
+// Delete permanently deletes the credential so that it can't be restored by mistake.
+func (rep *CredentialRepository) Delete(cred *Credential) error {
+	return rep.DB.Unscoped().Delete(cred).Error
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The statuses of the import jobs.
+const (
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// MaxImportFailures is the maximum number of failed notes listed in the report of an import, the rest are only
+// counted.
+const MaxImportFailures = 1000
+
+// ImportJob imports the notes of an export uploaded by a user, the export is kept in the blob store under
+// StorageKey until the job is finished. The workers import the notes one at a time and save the progress along with
+// each of them, so that a job resumed after a worker stopped doesn't import any note twice.
+type ImportJob struct {
+	Model
+	UserID   string `json:"-" gorm:"type:uuid"`
+	Format   string `json:"format"`
+	Filename string `json:"filename"`
+	Status   string `json:"status"`
+	// Total is the number of notes in the export, it's counted when a worker starts the job.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Imported  int `json:"imported"`
+	Failed    int `json:"failed"`
+	// Error describes why the whole import failed, the failures of the notes are in Failures.
+	Error      string          `json:"error,omitempty"`
+	Failures   []ImportFailure `json:"failures" gorm:"-"`
+	StorageKey string          `json:"-"`
+	// ClaimedUntil is set while a worker runs the job, the others skip it until then.
+	ClaimedUntil *time.Time `json:"-"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ImportFailure reports a note of an export that couldn't be imported.
+type ImportFailure struct {
+	ImportJobID string `json:"-" gorm:"type:uuid;primaryKey"`
+	// Index is the position of the note in the export, starting at 0.
+	Index  int    `json:"index" gorm:"column:note_index;primaryKey;autoIncrement:false"`
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+// Finished reports whether the job is done or failed.
+func (job *ImportJob) Finished() bool {
+	return job.Status == ImportDone || job.Status == ImportFailed
+}
+
+// ImportRepository holds the import jobs actions.
+type ImportRepository struct {
+	*Repository
+}
+
+// NewImportRepository creates a new import repo.
+func NewImportRepository(db *gorm.DB) *ImportRepository {
+	return &ImportRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *ImportRepository) WithContext(ctx context.Context) ImportStore {
+	return NewImportRepository(rep.DB.WithContext(ctx))
+}
+
+// Create creates the job.
+func (rep *ImportRepository) Create(job *ImportJob) error {
+	return rep.DB.Omit("Failures").Create(job).Error
+}
+
+// FindForUser finds the job with the given id if it belongs to the user along with its failures.
+func (rep *ImportRepository) FindForUser(id, userID string) (*ImportJob, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var job ImportJob
+	if err := rep.DB.First(&job, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	job.Failures = []ImportFailure{}
+	if err := rep.DB.Order("note_index").Find(&job.Failures, "import_job_id = ?", job.ID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// importProgressColumns are the columns saved by Update.
+var importProgressColumns = []string{
+	"updated_at", "status", "total", "processed", "imported", "failed", "error", "claimed_until", "finished_at",
+}
+
+// Claim claims the oldest unfinished job that isn't claimed at now until now+lease and sets it running, it returns
+// ErrNotFound if there's none. The rows are locked with SKIP LOCKED so that concurrent workers claim different jobs.
+func (rep *ImportRepository) Claim(now time.Time, lease time.Duration) (*ImportJob, error) {
+	now = now.UTC()
+	var job ImportJob
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND (claimed_until IS NULL OR claimed_until <= ?)", []string{ImportPending, ImportRunning}, now).
+			Order("created_at, id").Take(&job).Error
+		if err != nil {
+			return err
+		}
+
+		until := now.Add(lease).Truncate(time.Millisecond)
+		job.Status, job.ClaimedUntil = ImportRunning, &until
+		return tx.Model(&job).Select("status", "claimed_until").Updates(&job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Update saves the progress of the job claimed until claimedUntil along with the new failures, the claim is renewed
+// until job.ClaimedUntil or released if it's nil. It returns ErrNotFound if the claim was lost.
+func (rep *ImportRepository) Update(job *ImportJob, claimedUntil time.Time, failures []ImportFailure) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(job).Where("claimed_until = ?", claimedUntil).Select(importProgressColumns).Updates(job)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		for i := range failures {
+			failures[i].ImportJobID = job.ID
+		}
+		if len(failures) == 0 {
+			return nil
+		}
+		return tx.Create(&failures).Error
+	})
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginLink is a single use passwordless login link, only the hashes of the token and the nonce are stored.
+type LoginLink struct {
+	Model
+	UserID    string `gorm:"type:uuid;index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	NonceHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// LoginLinkRepository holds the login links actions.
+type LoginLinkRepository struct {
+	*Repository
+}
+
+// NewLoginLinkRepository creates a new login link repo.
+func NewLoginLinkRepository(db *gorm.DB) *LoginLinkRepository {
+	return &LoginLinkRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *LoginLinkRepository) WithContext(ctx context.Context) LoginLinkStore {
+	return NewLoginLinkRepository(rep.DB.WithContext(ctx))
+}
+
+// Create creates the link.
+func (rep *LoginLinkRepository) Create(link *LoginLink) error {
+	return rep.DB.Create(link).Error
+}
+
+// CountSince counts the links created for the user since the given time.
+func (rep *LoginLinkRepository) CountSince(userID string, since time.Time) (int64, error) {
+	var count int64
+	err := rep.DB.Model(&LoginLink{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error
+	return count, err
+}
+
+// Consume marks the unused and unexpired link matching the token and nonce hashes as used and returns it. It returns
+// gorm.ErrRecordNotFound if there is no such link, a link can only be consumed once and the wrong nonce doesn't use
+// it up.
+func (rep *LoginLinkRepository) Consume(tokenHash, nonceHash string) (*LoginLink, error) {
+	var link LoginLink
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&LoginLink{}).
+			Where("token_hash = ? AND nonce_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, nonceHash, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.First(&link, "token_hash = ?", tokenHash).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// DeleteExpired permanently deletes the links that expired before the given time and returns how many were deleted.
+func (rep *LoginLinkRepository) DeleteExpired(before time.Time) (int64, error) {
+	res := rep.DB.Unscoped().Where("expires_at < ?", before).Delete(&LoginLink{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,1235 @@
+// Package memory implements the model stores in memory, it's intended to be used in tests that don't need a
+// database.
+package memory
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"gorm.io/gorm"
+)
+
+// ErrDuplicate is returned when a record violates a unique constraint.
+var ErrDuplicate = errors.New("duplicate key value violates unique constraint")
+
+// DB holds the records of the stores, it's safe for concurrent use. The stores return copies of the records so
+// that changing them doesn't change the stored ones.
+type DB struct {
+	mu          sync.RWMutex
+	users       map[string]models.User
+	notes       map[string]models.Note
+	loginLinks  map[string]models.LoginLink
+	credentials map[string]models.Credential
+	attachments map[string]models.Attachment
+	usage       map[string]models.Usage
+	reminders   map[string]models.Reminder
+	checklists  map[string]models.ChecklistItem
+	imports     map[string]models.ImportJob
+	// failures holds the import failures by job id.
+	failures map[string][]models.ImportFailure
+}
+
+// New creates an empty database.
+func New() *DB {
+	db := &DB{}
+	db.Reset()
+	return db
+}
+
+// Reset deletes all the records.
+func (db *DB) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.users = map[string]models.User{}
+	db.notes = map[string]models.Note{}
+	db.loginLinks = map[string]models.LoginLink{}
+	db.credentials = map[string]models.Credential{}
+	db.attachments = map[string]models.Attachment{}
+	db.usage = map[string]models.Usage{}
+	db.reminders = map[string]models.Reminder{}
+	db.checklists = map[string]models.ChecklistItem{}
+	db.imports = map[string]models.ImportJob{}
+	db.failures = map[string][]models.ImportFailure{}
+}
+
+// Stores returns the stores using the database.
+func (db *DB) Stores() *models.Stores {
+	return &models.Stores{
+		Transactor:  db,
+		Users:       &UserStore{db: db},
+		Notes:       &NoteStore{db: db},
+		LoginLinks:  &LoginLinkStore{db: db},
+		Credentials: &CredentialStore{db: db},
+		Attachments: &AttachmentStore{db: db},
+		Usage:       &UsageStore{db: db},
+		Reminders:   &ReminderStore{db: db},
+		Checklists:  &ChecklistStore{db: db},
+		Imports:     &ImportStore{db: db},
+	}
+}
+
+// Transaction runs fn with the stores of the database and restores the records it had if fn fails. The concurrent
+// changes made while fn runs are lost with its changes.
+func (db *DB) Transaction(ctx context.Context, fn func(stores *models.Stores) error) error {
+	db.mu.RLock()
+	users, notes, loginLinks, credentials := maps.Clone(db.users), maps.Clone(db.notes), maps.Clone(db.loginLinks),
+		maps.Clone(db.credentials)
+	attachments, usage, reminders, checklists := maps.Clone(db.attachments), maps.Clone(db.usage),
+		maps.Clone(db.reminders), maps.Clone(db.checklists)
+	imports, failures := maps.Clone(db.imports), maps.Clone(db.failures)
+	db.mu.RUnlock()
+
+	err := fn(db.Stores())
+	if err != nil {
+		db.mu.Lock()
+		db.users, db.notes, db.loginLinks, db.credentials = users, notes, loginLinks, credentials
+		db.attachments, db.usage, db.reminders, db.checklists = attachments, usage, reminders, checklists
+		db.imports, db.failures = imports, failures
+		db.mu.Unlock()
+	}
+	return err
+}
+
+// NewStores creates the stores using a new empty database.
+func NewStores() *models.Stores {
+	return New().Stores()
+}
+
+// create sets the id and the unset timestamps of a new record the way the database does.
+func create(m *models.Model) {
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	now := time.Now()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = now
+	}
+}
+
+func deleted(m models.Model) bool {
+	return m.DeletedAt != nil && m.DeletedAt.Valid
+}
+
+// quota returns the quota of the plan of the user, the caller holds the lock.
+func (db *DB) quota(quotas models.Quotas, userID string) models.Quota {
+	return quotas.For(db.users[userID].Plan)
+}
+
+// charge adds delta to the usage of the user if it stays within the quota, the caller holds the write lock.
+func (db *DB) charge(userID string, quota models.Quota, delta models.Usage) error {
+	usage := db.usage[userID]
+	if err := quota.Check(usage, delta); err != nil {
+		return err
+	}
+	usage.UserID = userID
+	usage.Notes += delta.Notes
+	usage.ContentBytes += delta.ContentBytes
+	usage.AttachmentBytes += delta.AttachmentBytes
+	usage.UpdatedAt = time.Now()
+	db.usage[userID] = usage
+	return nil
+}
+
+// nextVersion returns the next version of the notes of the user, the caller holds the write lock.
+func (db *DB) nextVersion(userID string) int64 {
+	var version int64
+	for _, note := range db.notes {
+		if note.UserID == userID && note.Version > version {
+			version = note.Version
+		}
+	}
+	return version + 1
+}
+
+// NoteStore is the in-memory models.NoteStore.
+type NoteStore struct {
+	db     *DB
+	quotas models.Quotas
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *NoteStore) WithContext(ctx context.Context) models.NoteStore {
+	return s
+}
+
+// WithQuota returns a copy of the store enforcing the quotas.
+func (s *NoteStore) WithQuota(quotas models.Quotas) models.NoteStore {
+	return &NoteStore{db: s.db, quotas: quotas}
+}
+
+// Create creates the note if the user has room for it.
+func (s *NoteStore) Create(note *models.Note) error {
+	if !models.ValidFolder(note.Folder) {
+		return models.ErrInvalidFolder
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	quota := s.db.quota(s.quotas, note.UserID)
+	if err := quota.CheckNote(note); err != nil {
+		return err
+	}
+	if _, ok := s.db.notes[note.ID]; ok && note.ID != "" {
+		return ErrDuplicate
+	}
+	if err := s.db.charge(note.UserID, quota, models.Usage{Notes: 1, ContentBytes: models.NoteSize(note)}); err != nil {
+		return err
+	}
+	create(&note.Model)
+	note.Version = s.db.nextVersion(note.UserID)
+	note.CreatedVersion = note.Version
+	s.db.notes[note.ID] = *note
+	return nil
+}
+
+// Find finds the note with the given id.
+func (s *NoteStore) Find(id string) (*models.Note, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || deleted(note.Model) {
+		return nil, models.ErrNotFound
+	}
+	return &note, nil
+}
+
+// FindForUser finds the note with the given id if it belongs to the user.
+func (s *NoteStore) FindForUser(id, userID string) (*models.Note, error) {
+	note, err := s.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	if note.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	return note, nil
+}
+
+// FindManyForUser finds the notes of the user with the given ids.
+func (s *NoteStore) FindManyForUser(userID string, ids []string) ([]models.Note, error) {
+	notes := []models.Note{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if note, err := s.FindForUser(id, userID); err == nil {
+			notes = append(notes, *note)
+		}
+	}
+	return notes, nil
+}
+
+// FindForUserWithDeleted finds the note of the user with the given id, even if it's deleted.
+func (s *NoteStore) FindForUserWithDeleted(id, userID string) (*models.Note, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || note.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	return &note, nil
+}
+
+// Changes lists up to limit notes of the user changed after the version in the order of their versions.
+func (s *NoteStore) Changes(userID string, after int64, limit int) ([]models.Note, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	notes := []models.Note{}
+	for _, note := range s.db.notes {
+		if note.UserID == userID && note.Version > after {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Version < notes[j].Version })
+	return page(notes, 0, limit), nil
+}
+
+// ListForUser lists all the notes of the user, the most recently updated first.
+func (s *NoteStore) ListForUser(userID string) ([]models.Note, error) {
+	notes, _, err := s.Search(userID, models.NoteFilter{}, 0, -1)
+	return notes, err
+}
+
+// Search lists a page of the user notes matching the filter, a negative limit lists all of them.
+func (s *NoteStore) Search(userID string, filter models.NoteFilter, offset, limit int) ([]models.Note, int64, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+	notes := []models.Note{}
+	for _, note := range s.db.notes {
+		switch {
+		case note.UserID != userID || deleted(note.Model):
+			continue
+		case search != "" && !strings.Contains(strings.ToLower(note.Title), search) &&
+			!strings.Contains(strings.ToLower(note.Content), search):
+			continue
+		case filter.UpdatedAfter != nil && !note.UpdatedAt.After(*filter.UpdatedAfter):
+			continue
+		case filter.UpdatedBefore != nil && !note.UpdatedAt.Before(*filter.UpdatedBefore):
+			continue
+		}
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].UpdatedAt.After(notes[j].UpdatedAt) })
+
+	total := int64(len(notes))
+	return page(notes, offset, limit), total, nil
+}
+
+// Update saves the title and content of the note if it stays within the quota.
+func (s *NoteStore) Update(note *models.Note) error {
+	return s.update(note, nil)
+}
+
+// UpdateIfVersion updates the note if it's still at the version.
+func (s *NoteStore) UpdateIfVersion(note *models.Note, version int64) error {
+	return s.update(note, &version)
+}
+
+func (s *NoteStore) update(note *models.Note, version *int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	quota := s.db.quota(s.quotas, note.UserID)
+	if err := quota.CheckNote(note); err != nil {
+		return err
+	}
+
+	stored, ok := s.db.notes[note.ID]
+	switch {
+	case !ok || stored.UserID != note.UserID:
+		return models.ErrNotFound
+	case version != nil && (deleted(stored.Model) || stored.Version != *version):
+		return models.ErrConflict
+	case deleted(stored.Model):
+		return models.ErrNotFound
+	}
+	delta := models.Usage{ContentBytes: models.NoteSize(note) - models.NoteSize(&stored)}
+	if err := s.db.charge(note.UserID, quota, delta); err != nil {
+		return err
+	}
+	note.UpdatedAt, note.Version = time.Now(), s.db.nextVersion(note.UserID)
+	stored.Title, stored.Content, stored.UpdatedAt, stored.Version = note.Title, note.Content, note.UpdatedAt, note.Version
+	s.db.notes[note.ID] = stored
+	return nil
+}
+
+// Move moves the note of its user to its folder.
+func (s *NoteStore) Move(note *models.Note) error {
+	if !models.ValidFolder(note.Folder) {
+		return models.ErrInvalidFolder
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.notes[note.ID]
+	if !ok || stored.UserID != note.UserID || deleted(stored.Model) {
+		return models.ErrNotFound
+	}
+	note.UpdatedAt, note.Version = time.Now(), s.db.nextVersion(note.UserID)
+	stored.Folder, stored.UpdatedAt, stored.Version = note.Folder, note.UpdatedAt, note.Version
+	s.db.notes[note.ID] = stored
+	return nil
+}
+
+// Delete soft deletes the note if it belongs to its user.
+func (s *NoteStore) Delete(note *models.Note) error {
+	return s.delete(note, nil)
+}
+
+// DeleteIfVersion deletes the note if it's still at the version, deleting a deleted note does nothing.
+func (s *NoteStore) DeleteIfVersion(note *models.Note, version int64) error {
+	return s.delete(note, &version)
+}
+
+func (s *NoteStore) delete(note *models.Note, version *int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.notes[note.ID]
+	switch {
+	case !ok || stored.UserID != note.UserID:
+		return models.ErrNotFound
+	case version != nil && deleted(stored.Model):
+		return nil
+	case version != nil && stored.Version != *version:
+		return models.ErrConflict
+	case deleted(stored.Model):
+		return models.ErrNotFound
+	}
+	stored.DeletedAt = &gorm.DeletedAt{Time: time.Now(), Valid: true}
+	stored.Version = s.db.nextVersion(note.UserID)
+	s.db.notes[note.ID] = stored
+	note.Version = stored.Version
+	return s.db.charge(note.UserID, models.Quota{}, models.Usage{Notes: -1, ContentBytes: -models.NoteSize(&stored)})
+}
+
+// Restore restores the deleted note of its user if they have room for it again.
+func (s *NoteStore) Restore(note *models.Note) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.notes[note.ID]
+	if !ok || !deleted(stored.Model) || stored.UserID != note.UserID {
+		return models.ErrNotFound
+	}
+	quota := s.db.quota(s.quotas, note.UserID)
+	if err := quota.CheckNote(&stored); err != nil {
+		return err
+	}
+	if err := s.db.charge(note.UserID, quota, models.Usage{Notes: 1, ContentBytes: models.NoteSize(&stored)}); err != nil {
+		return err
+	}
+	stored.DeletedAt = nil
+	stored.UpdatedAt = time.Now()
+	stored.Version = s.db.nextVersion(note.UserID)
+	s.db.notes[note.ID] = stored
+	*note = stored
+	return nil
+}
+
+// UserStore is the in-memory models.UserStore.
+type UserStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *UserStore) WithContext(ctx context.Context) models.UserStore {
+	return s
+}
+
+// Create creates the user, the emails are unique.
+func (s *UserStore) Create(user *models.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[user.ID]; ok && user.ID != "" {
+		return ErrDuplicate
+	}
+	for _, u := range s.db.users {
+		if u.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	create(&user.Model)
+	s.db.users[user.ID] = stripUser(*user)
+	return nil
+}
+
+// RegisterUser creates a user using the register form.
+func (s *UserStore) RegisterUser(form auth.RegisterForm) (*models.User, error) {
+	password, err := auth.HashPassword(form.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{Name: form.Name, Email: form.Email, Password: password}
+	if err := s.Create(&user); err != nil {
+		return nil, errors.New("Failed to create user")
+	}
+	return &user, nil
+}
+
+// RetrieveUser finds the user with the given id.
+func (s *UserStore) RetrieveUser(id string) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &user, nil
+}
+
+// FindByEmail finds the user with the given email.
+func (s *UserStore) FindByEmail(email string) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, user := range s.db.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// FindMany finds the users with the given ids.
+func (s *UserStore) FindMany(ids []string) ([]models.User, error) {
+	users := []models.User{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if user, err := s.RetrieveUser(id); err == nil {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+// EmailTaken checks if a user has already registered with the given email.
+func (s *UserStore) EmailTaken(email string) bool {
+	_, err := s.FindByEmail(email)
+	return err == nil
+}
+
+// SetPassword hashes and sets the user password and bumps their token version.
+func (s *UserStore) SetPassword(user *models.User, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.update(user, func(u *models.User) {
+		u.Password = hash
+		u.TokenVersion = user.TokenVersion + 1
+	})
+}
+
+// SetDisabled disables or re-enables the user, disabling also bumps their token version.
+func (s *UserStore) SetDisabled(user *models.User, disabled bool) error {
+	return s.update(user, func(u *models.User) {
+		u.DisabledAt = nil
+		if disabled {
+			now := time.Now()
+			u.DisabledAt = &now
+			u.TokenVersion = user.TokenVersion + 1
+		}
+	})
+}
+
+// SetPlan puts the user on the quota plan.
+func (s *UserStore) SetPlan(user *models.User, plan string) error {
+	return s.update(user, func(u *models.User) { u.Plan = plan })
+}
+
+// update applies fn to the stored user and copies the result to user.
+func (s *UserStore) update(user *models.User, fn func(u *models.User)) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.users[user.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	fn(&stored)
+	stored.UpdatedAt = time.Now()
+	s.db.users[user.ID] = stored
+
+	user.Password, user.TokenVersion, user.DisabledAt, user.UpdatedAt = stored.Password, stored.TokenVersion, stored.DisabledAt, stored.UpdatedAt
+	user.Plan = stored.Plan
+	return nil
+}
+
+// stripUser drops the associations, they're stored separately.
+func stripUser(user models.User) models.User {
+	user.Notes = nil
+	user.Credentials = nil
+	return user
+}
+
+// LoginLinkStore is the in-memory models.LoginLinkStore.
+type LoginLinkStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *LoginLinkStore) WithContext(ctx context.Context) models.LoginLinkStore {
+	return s
+}
+
+// Create creates the link, the token hashes are unique.
+func (s *LoginLinkStore) Create(link *models.LoginLink) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, l := range s.db.loginLinks {
+		if l.TokenHash == link.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	create(&link.Model)
+	s.db.loginLinks[link.ID] = *link
+	return nil
+}
+
+// CountSince counts the links created for the user since the given time.
+func (s *LoginLinkStore) CountSince(userID string, since time.Time) (int64, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	var count int64
+	for _, link := range s.db.loginLinks {
+		if link.UserID == userID && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Consume marks the unused and unexpired link matching the token and nonce hashes as used and returns it.
+func (s *LoginLinkStore) Consume(tokenHash, nonceHash string) (*models.LoginLink, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	for id, link := range s.db.loginLinks {
+		if link.TokenHash != tokenHash || link.NonceHash != nonceHash || link.UsedAt != nil || !link.ExpiresAt.After(now) {
+			continue
+		}
+		link.UsedAt = &now
+		link.UpdatedAt = now
+		s.db.loginLinks[id] = link
+		return &link, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+// DeleteExpired deletes the links that expired before the given time.
+func (s *LoginLinkStore) DeleteExpired(before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var count int64
+	for id, link := range s.db.loginLinks {
+		if link.ExpiresAt.Before(before) {
+			delete(s.db.loginLinks, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CredentialStore is the in-memory models.CredentialStore.
+type CredentialStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *CredentialStore) WithContext(ctx context.Context) models.CredentialStore {
+	return s
+}
+
+// Create creates the credential, the credential ids are unique.
+func (s *CredentialStore) Create(cred *models.Credential) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, c := range s.db.credentials {
+		if string(c.CredentialID) == string(cred.CredentialID) {
+			return ErrDuplicate
+		}
+	}
+	create(&cred.Model)
+	s.db.credentials[cred.ID] = *cred
+	return nil
+}
+
+// RetrieveUserWithCredentials finds the user with the given id along with their credentials.
+func (s *CredentialStore) RetrieveUserWithCredentials(id string) (*models.User, error) {
+	user, err := (&UserStore{db: s.db}).RetrieveUser(id)
+	if err != nil {
+		return nil, err
+	}
+	user.Credentials, err = s.ListForUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListForUser lists the user credentials, the most recently created first.
+func (s *CredentialStore) ListForUser(userID string) ([]models.Credential, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	creds := []models.Credential{}
+	for _, cred := range s.db.credentials {
+		if cred.UserID == userID {
+			creds = append(creds, cred)
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].CreatedAt.After(creds[j].CreatedAt) })
+	return creds, nil
+}
+
+// FindForUser finds the credential with the given id if it belongs to the user.
+func (s *CredentialStore) FindForUser(id, userID string) (*models.Credential, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	cred, ok := s.db.credentials[id]
+	if !ok || cred.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	return &cred, nil
+}
+
+// RecordLogin updates the user credential after it has been used to log in.
+func (s *CredentialStore) RecordLogin(user *models.User, wc *webauthn.Credential) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for i := range user.Credentials {
+		cred := &user.Credentials[i]
+		if string(cred.CredentialID) != string(wc.ID) {
+			continue
+		}
+		stored, ok := s.db.credentials[cred.ID]
+		if !ok {
+			return models.ErrNotFound
+		}
+
+		now := time.Now()
+		cred.Update(wc)
+		cred.LastUsedAt = &now
+		cred.UpdatedAt = now
+		stored.Flags, stored.SignCount, stored.CloneWarning = cred.Flags, cred.SignCount, cred.CloneWarning
+		stored.LastUsedAt, stored.UpdatedAt = cred.LastUsedAt, cred.UpdatedAt
+		s.db.credentials[cred.ID] = stored
+		return nil
+	}
+	return models.ErrNotFound
+}
+
+// Rename renames the credential.
+func (s *CredentialStore) Rename(cred *models.Credential, name string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.credentials[cred.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	stored.Name = name
+	stored.UpdatedAt = time.Now()
+	s.db.credentials[cred.ID] = stored
+	cred.Name, cred.UpdatedAt = stored.Name, stored.UpdatedAt
+	return nil
+}
+
+// Delete permanently deletes the credential.
+func (s *CredentialStore) Delete(cred *models.Credential) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	delete(s.db.credentials, cred.ID)
+	return nil
+}
+
+// AttachmentStore is the in-memory models.AttachmentStore.
+type AttachmentStore struct {
+	db     *DB
+	quotas models.Quotas
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *AttachmentStore) WithContext(ctx context.Context) models.AttachmentStore {
+	return s
+}
+
+// WithQuota returns a copy of the store enforcing the quotas.
+func (s *AttachmentStore) WithQuota(quotas models.Quotas) models.AttachmentStore {
+	return &AttachmentStore{db: s.db, quotas: quotas}
+}
+
+// Create creates the attachment if the user has room for it.
+func (s *AttachmentStore) Create(att *models.Attachment) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.charge(att.UserID, s.db.quota(s.quotas, att.UserID), models.Usage{AttachmentBytes: att.Size}); err != nil {
+		return err
+	}
+	create(&att.Model)
+	s.db.attachments[att.ID] = *att
+	return nil
+}
+
+// ListForNote lists the attachments of the user note, the oldest first.
+func (s *AttachmentStore) ListForNote(noteID, userID string) ([]models.Attachment, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	atts := []models.Attachment{}
+	for _, att := range s.db.attachments {
+		if att.NoteID == noteID && att.UserID == userID {
+			atts = append(atts, att)
+		}
+	}
+	sort.Slice(atts, func(i, j int) bool {
+		if !atts[i].CreatedAt.Equal(atts[j].CreatedAt) {
+			return atts[i].CreatedAt.Before(atts[j].CreatedAt)
+		}
+		return atts[i].ID < atts[j].ID
+	})
+	return atts, nil
+}
+
+// FindForNote finds the attachment with the given id if it's attached to the user note.
+func (s *AttachmentStore) FindForNote(id, noteID, userID string) (*models.Attachment, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	att, ok := s.db.attachments[id]
+	if !ok || att.NoteID != noteID || att.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	return &att, nil
+}
+
+// Delete permanently deletes the attachment of its user.
+func (s *AttachmentStore) Delete(att *models.Attachment) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.attachments[att.ID]
+	if !ok || stored.UserID != att.UserID {
+		return models.ErrNotFound
+	}
+	delete(s.db.attachments, att.ID)
+	return s.db.charge(att.UserID, models.Quota{}, models.Usage{AttachmentBytes: -stored.Size})
+}
+
+// UsageStore is the in-memory models.UsageStore.
+type UsageStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *UsageStore) WithContext(ctx context.Context) models.UsageStore {
+	return s
+}
+
+// Get gets the usage of the user, it's zero if they haven't stored anything yet.
+func (s *UsageStore) Get(userID string) (*models.Usage, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	usage := s.db.usage[userID]
+	usage.UserID = userID
+	return &usage, nil
+}
+
+// ReminderStore is the in-memory models.ReminderStore.
+type ReminderStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *ReminderStore) WithContext(ctx context.Context) models.ReminderStore {
+	return s
+}
+
+// Set creates the reminder of its note or replaces the schedule of the existing one.
+func (s *ReminderStore) Set(rem *models.Reminder) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	rem.ClaimedUntil = nil
+	for _, existing := range s.db.reminders {
+		if existing.NoteID == rem.NoteID && existing.UserID == rem.UserID {
+			rem.ID, rem.CreatedAt, rem.LastFiredAt = existing.ID, existing.CreatedAt, existing.LastFiredAt
+			rem.UpdatedAt = time.Now()
+			s.db.reminders[rem.ID] = *rem
+			return nil
+		}
+	}
+	create(&rem.Model)
+	s.db.reminders[rem.ID] = *rem
+	return nil
+}
+
+// FindForNote finds the reminder of the user note.
+func (s *ReminderStore) FindForNote(noteID, userID string) (*models.Reminder, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, rem := range s.db.reminders {
+		if rem.NoteID == noteID && rem.UserID == userID {
+			return &rem, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// Upcoming lists the reminders of the user that fire before the given time, the soonest first.
+func (s *ReminderStore) Upcoming(userID string, before time.Time, limit int) ([]models.Reminder, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	rems := []models.Reminder{}
+	for _, rem := range s.db.reminders {
+		if rem.UserID == userID && rem.NextAt != nil && rem.NextAt.Before(before) && s.db.noteExists(rem.NoteID) {
+			rems = append(rems, rem)
+		}
+	}
+	sortReminders(rems)
+	return page(rems, 0, limit), nil
+}
+
+// DeleteForNote permanently deletes the reminder of the user note.
+func (s *ReminderStore) DeleteForNote(noteID, userID string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, rem := range s.db.reminders {
+		if rem.NoteID == noteID && rem.UserID == userID {
+			delete(s.db.reminders, id)
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+// Claim claims the reminder that has been due the longest at now for the lease duration.
+func (s *ReminderStore) Claim(now time.Time, lease time.Duration) (*models.Due, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	due := []models.Reminder{}
+	for _, rem := range s.db.reminders {
+		if rem.NextAt != nil && !rem.NextAt.After(now) && (rem.ClaimedUntil == nil || !rem.ClaimedUntil.After(now)) &&
+			s.db.noteExists(rem.NoteID) {
+			due = append(due, rem)
+		}
+	}
+	if len(due) == 0 {
+		return nil, models.ErrNotFound
+	}
+	sortReminders(due)
+
+	rem := due[0]
+	until := now.Add(lease).Truncate(time.Millisecond)
+	rem.ClaimedUntil = &until
+	s.db.reminders[rem.ID] = rem
+
+	note := s.db.notes[rem.NoteID]
+	user, ok := s.db.users[rem.UserID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &models.Due{Reminder: &rem, Note: &note, User: &user}, nil
+}
+
+// Complete saves the schedule of the claimed reminder and releases it.
+func (s *ReminderStore) Complete(rem *models.Reminder, claimedUntil time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.reminders[rem.ID]
+	if !ok || stored.ClaimedUntil == nil || !stored.ClaimedUntil.Equal(claimedUntil) {
+		return models.ErrNotFound
+	}
+	stored.NextAt, stored.LastFiredAt = rem.NextAt, rem.LastFiredAt
+	stored.Attempts, stored.LastError = rem.Attempts, rem.LastError
+	stored.ClaimedUntil = nil
+	stored.UpdatedAt = time.Now()
+	s.db.reminders[rem.ID] = stored
+	return nil
+}
+
+// ChecklistStore is the in-memory models.ChecklistStore.
+type ChecklistStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *ChecklistStore) WithContext(ctx context.Context) models.ChecklistStore {
+	return s
+}
+
+// ListForNote lists the checklist items of the user note in order.
+func (s *ChecklistStore) ListForNote(noteID, userID string) ([]models.ChecklistItem, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	items := []models.ChecklistItem{}
+	for _, item := range s.db.checklist(noteID) {
+		if item.UserID == userID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// FindForNote finds the checklist item with the given id if it's in the user note.
+func (s *ChecklistStore) FindForNote(id, noteID, userID string) (*models.ChecklistItem, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	item, ok := s.db.checklists[id]
+	if !ok || item.NoteID != noteID || item.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	return &item, nil
+}
+
+// Add inserts the item into the checklist of its note at the position.
+func (s *ChecklistStore) Add(item *models.ChecklistItem, position int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !s.db.ownsNote(item.NoteID, item.UserID) {
+		return models.ErrNotFound
+	}
+	items := s.db.checklist(item.NoteID)
+	if len(items) >= models.MaxChecklistItems {
+		return models.ErrChecklistFull
+	}
+
+	if position < 0 || position > len(items) {
+		position = len(items)
+	}
+	for _, other := range items[position:] {
+		other.Position++
+		s.db.checklists[other.ID] = other
+	}
+	item.Position = position
+	create(&item.Model)
+	s.db.checklists[item.ID] = *item
+	return nil
+}
+
+// Update saves the text and the state of the item.
+func (s *ChecklistStore) Update(item *models.ChecklistItem) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.checklists[item.ID]
+	if !ok || stored.NoteID != item.NoteID || stored.UserID != item.UserID {
+		return models.ErrNotFound
+	}
+	stored.Text, stored.Done = item.Text, item.Done
+	stored.UpdatedAt = time.Now()
+	item.UpdatedAt = stored.UpdatedAt
+	s.db.checklists[item.ID] = stored
+	return nil
+}
+
+// Reorder orders the checklist of the user note as the ids.
+func (s *ChecklistStore) Reorder(noteID, userID string, ids []string) ([]models.ChecklistItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !s.db.ownsNote(noteID, userID) {
+		return nil, models.ErrNotFound
+	}
+	items := s.db.checklist(noteID)
+	if len(ids) != len(items) {
+		return nil, models.ErrChecklistOrder
+	}
+	ordered := make([]models.ChecklistItem, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		item, ok := s.db.checklists[id]
+		if !ok || item.NoteID != noteID || seen[id] {
+			return nil, models.ErrChecklistOrder
+		}
+		seen[id] = true
+		item.Position = i
+		ordered = append(ordered, item)
+	}
+	for _, item := range ordered {
+		s.db.checklists[item.ID] = item
+	}
+	return ordered, nil
+}
+
+// Delete permanently deletes the item of its user note.
+func (s *ChecklistStore) Delete(item *models.ChecklistItem) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.checklists[item.ID]
+	if !ok || stored.NoteID != item.NoteID || !s.db.ownsNote(item.NoteID, item.UserID) {
+		return models.ErrNotFound
+	}
+	delete(s.db.checklists, item.ID)
+	for _, other := range s.db.checklist(item.NoteID)[stored.Position:] {
+		other.Position--
+		s.db.checklists[other.ID] = other
+	}
+	return nil
+}
+
+// Counts counts the checked and all the checklist items of the user notes with the given ids.
+func (s *ChecklistStore) Counts(userID string, noteIDs []string) (map[string]models.ChecklistCount, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	ids := make(map[string]bool, len(noteIDs))
+	for _, id := range noteIDs {
+		ids[id] = true
+	}
+	counts := map[string]models.ChecklistCount{}
+	for _, item := range s.db.checklists {
+		if item.UserID != userID || !ids[item.NoteID] {
+			continue
+		}
+		count := counts[item.NoteID]
+		count.Total++
+		if item.Done {
+			count.Done++
+		}
+		counts[item.NoteID] = count
+	}
+	return counts, nil
+}
+
+// checklist returns the checklist items of the note in order, the caller holds the lock.
+func (db *DB) checklist(noteID string) []models.ChecklistItem {
+	items := []models.ChecklistItem{}
+	for _, item := range db.checklists {
+		if item.NoteID == noteID {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+	return items
+}
+
+// ownsNote reports whether the note exists, belongs to the user and isn't deleted, the caller holds the lock.
+func (db *DB) ownsNote(id, userID string) bool {
+	note, ok := db.notes[id]
+	return ok && note.UserID == userID && !deleted(note.Model)
+}
+
+// noteExists reports whether the note exists and isn't deleted, the caller holds the lock.
+func (db *DB) noteExists(id string) bool {
+	note, ok := db.notes[id]
+	return ok && !deleted(note.Model)
+}
+
+func sortReminders(rems []models.Reminder) {
+	sort.Slice(rems, func(i, j int) bool {
+		if !rems[i].NextAt.Equal(*rems[j].NextAt) {
+			return rems[i].NextAt.Before(*rems[j].NextAt)
+		}
+		return rems[i].ID < rems[j].ID
+	})
+}
+
+// page returns the records in the [offset, offset+limit) range, a negative limit returns the rest of them.
+func page[T any](records []T, offset, limit int) []T {
+	if offset >= len(records) {
+		return []T{}
+	}
+	records = records[offset:]
+	if limit >= 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+// ImportStore is the in-memory models.ImportStore.
+type ImportStore struct {
+	db *DB
+}
+
+// WithContext returns the store, the operations don't block.
+func (s *ImportStore) WithContext(ctx context.Context) models.ImportStore {
+	return s
+}
+
+// Create creates the job.
+func (s *ImportStore) Create(job *models.ImportJob) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	create(&job.Model)
+	stored := *job
+	stored.Failures = nil
+	s.db.imports[job.ID] = stored
+	return nil
+}
+
+// FindForUser finds the job with the given id if it belongs to the user along with its failures.
+func (s *ImportStore) FindForUser(id, userID string) (*models.ImportJob, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	job, ok := s.db.imports[id]
+	if !ok || job.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	job.Failures = append([]models.ImportFailure{}, s.db.failures[id]...)
+	sort.Slice(job.Failures, func(i, j int) bool { return job.Failures[i].Index < job.Failures[j].Index })
+	return &job, nil
+}
+
+// Claim claims the oldest unfinished job that isn't claimed at now for the lease duration.
+func (s *ImportStore) Claim(now time.Time, lease time.Duration) (*models.ImportJob, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var claimed *models.ImportJob
+	for _, job := range s.db.imports {
+		if job.Finished() || (job.ClaimedUntil != nil && job.ClaimedUntil.After(now)) {
+			continue
+		}
+		if claimed == nil || job.CreatedAt.Before(claimed.CreatedAt) ||
+			(job.CreatedAt.Equal(claimed.CreatedAt) && job.ID < claimed.ID) {
+			job := job
+			claimed = &job
+		}
+	}
+	if claimed == nil {
+		return nil, models.ErrNotFound
+	}
+
+	until := now.Add(lease).Truncate(time.Millisecond)
+	claimed.Status, claimed.ClaimedUntil = models.ImportRunning, &until
+	s.db.imports[claimed.ID] = *claimed
+	return claimed, nil
+}
+
+// Update saves the progress of the claimed job and adds the failures to its report.
+func (s *ImportStore) Update(job *models.ImportJob, claimedUntil time.Time, failures []models.ImportFailure) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.imports[job.ID]
+	if !ok || stored.ClaimedUntil == nil || !stored.ClaimedUntil.Equal(claimedUntil) {
+		return models.ErrNotFound
+	}
+	stored.Status, stored.Total, stored.Processed = job.Status, job.Total, job.Processed
+	stored.Imported, stored.Failed, stored.Error = job.Imported, job.Failed, job.Error
+	stored.ClaimedUntil, stored.FinishedAt = job.ClaimedUntil, job.FinishedAt
+	stored.UpdatedAt = time.Now()
+	job.UpdatedAt = stored.UpdatedAt
+	s.db.imports[job.ID] = stored
+
+	for i := range failures {
+		failures[i].ImportJobID = job.ID
+	}
+	// the stored slice is clipped so that the snapshots of the transactions don't share the appended items.
+	s.db.failures[job.ID] = append(slices.Clip(s.db.failures[job.ID]), failures...)
+	return nil
+}
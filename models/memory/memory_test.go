@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *models.Stores {
+		return NewStores()
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	stores := NewStores()
+	user := &models.User{Name: "Mock User", Email: "user@email.com"}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			note := &models.Note{Title: fmt.Sprint("note ", i), UserID: user.ID}
+			assert.Nil(t, stores.Notes.Create(note))
+			note.Content = "updated"
+			assert.Nil(t, stores.Notes.Update(note))
+			stores.Notes.Search(user.ID, models.NoteFilter{Search: "note"}, 0, 5)
+		}(i)
+	}
+	wg.Wait()
+
+	_, total, err := stores.Notes.Search(user.ID, models.NoteFilter{}, 0, 0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 20, total)
+}
+
+func TestReset(t *testing.T) {
+	db := New()
+	stores := db.Stores()
+	stores.Users.Create(&models.User{Email: "user@email.com"})
+
+	db.Reset()
+	assert.False(t, stores.Users.EmailTaken("user@email.com"))
+}
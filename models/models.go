@@ -1,25 +1,43 @@
 package models
 
 import (
-	"errors"
-	"strconv"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/msal4/toastnotes/settings"
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+
+	// the pure go sqlite driver, registered as "sqlite" and built with fts5.
+	_ "modernc.org/sqlite"
+)
+
+// The supported database dialects, they match the gorm dialector names.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
 )
 
 // Model is the base model.
 type Model struct {
-	ID        string          `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID        string          `json:"id" gorm:"type:uuid;primaryKey"`
 	CreatedAt time.Time       `json:"createdAt"`
 	UpdatedAt time.Time       `json:"updatedAt"`
 	DeletedAt *gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// BeforeCreate generates the id of new records so that it doesn't depend on a database extension.
+func (m *Model) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	return nil
+}
+
 // Repository is the base repository.
 type Repository struct {
 	DB *gorm.DB
@@ -30,48 +48,71 @@ func (rep *Repository) FindByID(v interface{}, id string) error {
 	return rep.DB.First(v, "id = ?", id).Error
 }
 
-// OpenConnection opens a db connections using the provided uri.
+// Dialect returns the dialect of the database, Postgres or SQLite.
+func Dialect(db *gorm.DB) string {
+	return db.Dialector.Name()
+}
+
+// OpenConnection opens a db connections using the provided uri, the schema is managed by the migrations package.
+// The dialect is selected by the uri scheme, postgres:// (or postgresql://) and sqlite:// followed by the file path,
+// e.g. sqlite://toastnotes.db or sqlite:///var/lib/toastnotes/toastnotes.db.
 func OpenConnection(dsn string, lgr logger.Interface) (*gorm.DB, error) {
 	if lgr == nil {
 		lgr = logger.Default
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: lgr,
-	})
-	if err != nil {
-		return nil, err
-	}
+	cfg := &gorm.Config{Logger: lgr}
 
-	// Create the uuid extension to generate uuids for the id field in models.
-	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
-		return nil, errors.New("Could not create extension \"uuid-ossp\"")
+	var dialector gorm.Dialector
+	switch scheme := strings.ToLower(strings.SplitN(dsn, ":", 2)[0]); scheme {
+	case "postgres", "postgresql":
+		dialector = postgres.Open(dsn)
+	case "sqlite":
+		path, err := sqlitePath(dsn)
+		if err != nil {
+			return nil, err
+		}
+		dialector = sqlite.Dialector{DriverName: "sqlite", DSN: path}
+		// sqlite compares the timestamps as text so they're all stored in utc.
+		cfg.NowFunc = func() time.Time { return time.Now().UTC() }
+	default:
+		return nil, fmt.Errorf("unsupported database url scheme %q, use postgres:// or sqlite://", scheme)
 	}
 
-	if err := db.AutoMigrate(&User{}, &Note{}); err != nil {
+	db, err := gorm.Open(dialector, cfg)
+	if err != nil {
 		return nil, err
 	}
 
 	return db, nil
 }
 
-// Paginate paginates the given request context using scopes.
-func Paginate(c *gin.Context) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		page, _ := strconv.Atoi(c.Query("page"))
-		if page == 0 {
-			page = 1
-		}
-
-		pageSize, _ := strconv.Atoi(c.Query("page_size"))
-		switch {
-		case pageSize > settings.MaxPageSize:
-			pageSize = settings.MaxPageSize
-		case pageSize <= 0:
-			pageSize = settings.PageSize
-		}
+// sqlitePragmas are set on every sqlite connection unless the dsn sets them, the foreign keys are off by default
+// and the busy timeout lets the concurrent writers wait for each other instead of failing.
+var sqlitePragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"}
 
-		offset := (page - 1) * pageSize
+// sqlitePath converts a sqlite:// url to the driver dsn, the query parameters are passed to the driver.
+func sqlitePath(dsn string) (string, error) {
+	rest := strings.TrimPrefix(dsn[len("sqlite:"):], "//")
+	path, query, _ := strings.Cut(rest, "?")
+	if path == "" {
+		return "", fmt.Errorf("the sqlite database url must include the file path, e.g. sqlite://toastnotes.db")
+	}
 
-		return db.Offset(offset).Limit(pageSize)
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid sqlite database url: %w", err)
+	}
+	set := strings.Join(params["_pragma"], ",")
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		if !strings.Contains(set, name) {
+			params.Add("_pragma", pragma)
+		}
 	}
+	if params.Get("_txlock") == "" {
+		// the write lock is taken when the transactions start so that they don't fail to upgrade their read lock.
+		params.Set("_txlock", "immediate")
+	}
+
+	return "file:" + path + "?" + params.Encode(), nil
 }
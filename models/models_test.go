@@ -0,0 +1,133 @@
+package models_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msal4/toastnotes/migrations"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/storetest"
+	"github.com/msal4/toastnotes/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens and migrates the database of dsn.
+func openTestDB(t *testing.T, dsn string) *gorm.DB {
+	db, err := models.OpenConnection(dsn, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	migrator, err := migrations.New(sqlDB, models.Dialect(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func runStores(t *testing.T, db *gorm.DB) {
+	clear := func() {
+		db.Exec("DELETE FROM reminders")
+		db.Exec("DELETE FROM checklist_items")
+		db.Exec("DELETE FROM import_failures")
+		db.Exec("DELETE FROM import_jobs")
+		db.Exec("DELETE FROM attachments")
+		db.Exec("DELETE FROM credentials")
+		db.Exec("DELETE FROM login_links")
+		db.Exec("DELETE FROM notes")
+		db.Exec("DELETE FROM usages")
+		db.Exec("DELETE FROM users")
+	}
+	t.Cleanup(clear)
+
+	storetest.Run(t, func(t *testing.T) *models.Stores {
+		clear()
+		return models.NewStores(db)
+	})
+}
+
+func TestStores(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		runStores(t, openTestDB(t, "sqlite://"+filepath.Join(t.TempDir(), "toastnotes.db")))
+	})
+
+	t.Run("database", func(t *testing.T) {
+		testutils.LoadEnv()
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		runStores(t, openTestDB(t, dsn))
+	})
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	db := openTestDB(t, "sqlite://"+filepath.Join(t.TempDir(), "toastnotes.db"))
+	stores := models.NewStores(db)
+
+	user := &models.User{Name: "Search", Email: "search@email.com"}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	note := &models.Note{Title: "Grocery list", Content: `milk, "oat" 100% bread_rolls`, UserID: user.ID}
+	if err := stores.Notes.Create(note); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, note.ID, 36)
+
+	search := func(text string) int64 {
+		_, total, err := stores.Notes.Search(user.ID, models.NoteFilter{Search: text}, 0, 10)
+		assert.Nil(t, err)
+		return total
+	}
+
+	t.Run("matches_substrings_using_the_index", func(t *testing.T) {
+		assert.EqualValues(t, 1, search("ROCER"))
+		assert.EqualValues(t, 1, search(`"oat"`))
+		assert.EqualValues(t, 1, search("100%"))
+		assert.EqualValues(t, 0, search("100%%"))
+		assert.EqualValues(t, 0, search("bread rolls"))
+	})
+
+	t.Run("matches_short_searches", func(t *testing.T) {
+		assert.EqualValues(t, 1, search("gr"))
+		assert.EqualValues(t, 1, search("%"))
+		assert.EqualValues(t, 0, search("_x"))
+	})
+
+	t.Run("follows_the_updates_and_deletes", func(t *testing.T) {
+		note.Title = "Hardware store"
+		assert.Nil(t, stores.Notes.Update(note))
+		assert.EqualValues(t, 0, search("grocery"))
+		assert.EqualValues(t, 1, search("hardware"))
+
+		assert.Nil(t, db.Unscoped().Delete(note).Error)
+		assert.EqualValues(t, 0, search("hardware"))
+		var count int64
+		db.Table("notes_fts").Count(&count)
+		assert.Zero(t, count)
+	})
+}
+
+func TestOpenConnection(t *testing.T) {
+	_, err := models.OpenConnection("mysql://localhost/toastnotes", logger.Discard)
+	assert.NotNil(t, err)
+	_, err = models.OpenConnection("sqlite://", logger.Discard)
+	assert.NotNil(t, err)
+
+	db, err := models.OpenConnection("sqlite://"+filepath.Join(t.TempDir(), "toastnotes.db"), logger.Discard)
+	if assert.Nil(t, err) {
+		assert.Equal(t, models.SQLite, models.Dialect(db))
+		var foreignKeys int
+		db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+		assert.Equal(t, 1, foreignKeys)
+	}
+}
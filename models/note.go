@@ -1,6 +1,13 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
 
 // Note is the user notes model.
 type Note struct {
@@ -8,14 +15,421 @@ type Note struct {
 	Title   string `json:"title" binding:"required"`
 	Content string `json:"content,omitempty"`
 	UserID  string `json:"userId,omitempty"`
+	// Folder is the slash separated path of the folder of the note, e.g. "work/projects", the notes at the top level
+	// have the empty folder. See ValidFolder.
+	Folder string `json:"folder"`
+	// Version is the version of the notes of the user the note was last changed at, including its deletion. Every
+	// change of a note gives it the next version of its user, see NoteStore.Changes.
+	Version int64 `json:"version"`
+	// CreatedVersion is the version the note was created at.
+	CreatedVersion int64 `json:"-"`
+}
+
+// Deleted reports whether the note is soft deleted.
+func (note *Note) Deleted() bool {
+	return note.DeletedAt != nil && note.DeletedAt.Valid
 }
 
-// NoteRepository holds the notes actions.
+// MaxFolderLength is the maximum length of the folder path of the notes in bytes.
+const MaxFolderLength = 255
+
+// ValidFolder reports whether folder is a valid folder path, the empty path or slash separated names without the
+// leading or trailing slashes, "." and ".." names or backslashes.
+func ValidFolder(folder string) bool {
+	if folder == "" {
+		return true
+	}
+	if len(folder) > MaxFolderLength || !utf8.ValidString(folder) || strings.ContainsRune(folder, '\\') {
+		return false
+	}
+	for _, name := range strings.Split(folder, "/") {
+		if name == "" || name == "." || name == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// NoteRepository holds the notes actions, the changes are counted in the user usage and checked against the quota of
+// the plan of the user.
 type NoteRepository struct {
 	*Repository
+	Quotas Quotas
 }
 
 // NewNoteRepository creates a new note repo.
 func NewNoteRepository(db *gorm.DB) *NoteRepository {
 	return &NoteRepository{Repository: &Repository{DB: db}}
 }
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *NoteRepository) WithContext(ctx context.Context) NoteStore {
+	return &NoteRepository{Repository: &Repository{DB: rep.DB.WithContext(ctx)}, Quotas: rep.Quotas}
+}
+
+// WithQuota returns a copy of the repository enforcing the quotas.
+func (rep *NoteRepository) WithQuota(quotas Quotas) NoteStore {
+	return &NoteRepository{Repository: rep.Repository, Quotas: quotas}
+}
+
+// Create creates the note if the user has room for it.
+func (rep *NoteRepository) Create(note *Note) error {
+	if !ValidFolder(note.Folder) {
+		return ErrInvalidFolder
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		quota, err := quotaOf(tx, rep.Quotas, note.UserID)
+		if err != nil {
+			return err
+		}
+		if err := quota.CheckNote(note); err != nil {
+			return err
+		}
+		if err := chargeUsage(tx, note.UserID, quota, Usage{Notes: 1, ContentBytes: NoteSize(note)}); err != nil {
+			return err
+		}
+		version, err := nextVersion(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		note.Version, note.CreatedVersion = version, version
+		return tx.Create(note).Error
+	})
+}
+
+// Find finds the note with the given id.
+func (rep *NoteRepository) Find(id string) (*Note, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var note Note
+	if err := rep.FindByID(&note, id); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// FindForUser finds the note with the given id if it belongs to the user.
+func (rep *NoteRepository) FindForUser(id, userID string) (*Note, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var note Note
+	if err := rep.DB.First(&note, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Update saves the title and content of the note, the content is selected so that it can be cleared. A note growing
+// past the quota isn't saved.
+func (rep *NoteRepository) Update(note *Note) error {
+	return rep.update(note, nil)
+}
+
+// UpdateIfVersion updates the note like Update if it's still at the version, otherwise it returns ErrConflict.
+func (rep *NoteRepository) UpdateIfVersion(note *Note, version int64) error {
+	return rep.update(note, &version)
+}
+
+func (rep *NoteRepository) update(note *Note, version *int64) error {
+	if !validID(note.ID) {
+		return ErrNotFound
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		quota, err := quotaOf(tx, rep.Quotas, note.UserID)
+		if err != nil {
+			return err
+		}
+		if err := quota.CheckNote(note); err != nil {
+			return err
+		}
+		usage, err := lockUsage(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		stored, err := findLocked(tx, note)
+		if err != nil {
+			return err
+		}
+		switch {
+		case version != nil && (stored.Deleted() || stored.Version != *version):
+			return ErrConflict
+		case stored.Deleted():
+			return ErrNotFound
+		}
+		delta := Usage{ContentBytes: NoteSize(note) - NoteSize(stored)}
+		if err := quota.Check(*usage, delta); err != nil {
+			return err
+		}
+
+		if note.Version, err = nextVersion(tx, note.UserID); err != nil {
+			return err
+		}
+		// the updates don't skip the soft deleted notes by themselves.
+		res := tx.Model(note).Where("user_id = ? AND deleted_at IS NULL", note.UserID).
+			Select("title", "content", "updated_at", "version").Updates(note)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return addUsage(tx, note.UserID, delta)
+	})
+}
+
+// Move moves the note of its user to its folder and sets its update time and version.
+func (rep *NoteRepository) Move(note *Note) error {
+	if !validID(note.ID) {
+		return ErrNotFound
+	}
+	if !ValidFolder(note.Folder) {
+		return ErrInvalidFolder
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUsage(tx, note.UserID); err != nil {
+			return err
+		}
+		version, err := nextVersion(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		note.Version = version
+		res := tx.Model(note).Where("user_id = ? AND deleted_at IS NULL", note.UserID).
+			Select("folder", "updated_at", "version").Updates(note)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// Delete soft deletes the note if it belongs to its user and sets its version to the version of the deletion.
+func (rep *NoteRepository) Delete(note *Note) error {
+	return rep.delete(note, nil)
+}
+
+// DeleteIfVersion deletes the note like Delete if it's still at the version, otherwise it returns ErrConflict. Deleting
+// a deleted note does nothing.
+func (rep *NoteRepository) DeleteIfVersion(note *Note, version int64) error {
+	return rep.delete(note, &version)
+}
+
+func (rep *NoteRepository) delete(note *Note, version *int64) error {
+	if !validID(note.ID) {
+		return ErrNotFound
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUsage(tx, note.UserID); err != nil {
+			return err
+		}
+		stored, err := findLocked(tx, note)
+		if err != nil {
+			return err
+		}
+		switch {
+		case version != nil && stored.Deleted():
+			return nil
+		case version != nil && stored.Version != *version:
+			return ErrConflict
+		case stored.Deleted():
+			return ErrNotFound
+		}
+
+		next, err := nextVersion(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		// the deletion isn't an update of the note so the update time is kept.
+		res := tx.Model(&Note{}).Where("id = ? AND user_id = ? AND deleted_at IS NULL", note.ID, note.UserID).
+			UpdateColumns(map[string]interface{}{"deleted_at": tx.NowFunc(), "version": next})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		note.Version = next
+		return addUsage(tx, note.UserID, Usage{Notes: -1, ContentBytes: -NoteSize(stored)})
+	})
+}
+
+// findLocked finds the note of its user, the deleted ones included, while the user usage is locked.
+func findLocked(tx *gorm.DB, note *Note) (*Note, error) {
+	var stored Note
+	err := tx.Unscoped().Select("title", "content", "version", "deleted_at").
+		First(&stored, "id = ? AND user_id = ?", note.ID, note.UserID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// nextVersion returns the next version of the notes of the user. The caller holds the lock of the user usage so the
+// changes of the user are committed in the order of their versions, and a reader that sees a version sees all the
+// versions before it.
+func nextVersion(tx *gorm.DB, userID string) (int64, error) {
+	var version int64
+	err := tx.Unscoped().Model(&Note{}).Select("COALESCE(MAX(version), 0)").Where("user_id = ?", userID).Scan(&version).Error
+	return version + 1, err
+}
+
+// Restore restores the soft deleted note of its user if they have room for it again, the restored note is loaded
+// into note.
+func (rep *NoteRepository) Restore(note *Note) error {
+	if !validID(note.ID) {
+		return ErrNotFound
+	}
+
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		usage, err := lockUsage(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		var stored Note
+		err = tx.Unscoped().First(&stored, "id = ? AND user_id = ? AND deleted_at IS NOT NULL", note.ID, note.UserID).Error
+		if err != nil {
+			return err
+		}
+		quota, err := quotaOf(tx, rep.Quotas, note.UserID)
+		if err != nil {
+			return err
+		}
+		if err := quota.CheckNote(&stored); err != nil {
+			return err
+		}
+		delta := Usage{Notes: 1, ContentBytes: NoteSize(&stored)}
+		if err := quota.Check(*usage, delta); err != nil {
+			return err
+		}
+
+		version, err := nextVersion(tx, note.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&stored).Updates(map[string]interface{}{"deleted_at": nil, "version": version}).Error; err != nil {
+			return err
+		}
+		stored.DeletedAt, stored.Version = nil, version
+		*note = stored
+		return addUsage(tx, note.UserID, delta)
+	})
+}
+
+// ListForUser lists all the notes of the user with the given id, the most recently updated first.
+func (rep *NoteRepository) ListForUser(userID string) ([]Note, error) {
+	notes := []Note{}
+	if err := rep.DB.Order("updated_at DESC").Find(&notes, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// FindForUserWithDeleted finds the note with the given id if it belongs to the user, even if it's deleted.
+func (rep *NoteRepository) FindForUserWithDeleted(id, userID string) (*Note, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	var note Note
+	if err := rep.DB.Unscoped().First(&note, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Changes lists up to limit notes of the user changed after the version, the deleted ones included, in the order of
+// their versions.
+func (rep *NoteRepository) Changes(userID string, after int64, limit int) ([]Note, error) {
+	notes := []Note{}
+	err := rep.DB.Unscoped().Where("user_id = ? AND version > ?", userID, after).Order("version").Limit(limit).Find(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// NoteFilter narrows down the listed notes, the zero value matches all the notes.
+type NoteFilter struct {
+	// Search matches the notes containing it in their title or content, case insensitively.
+	Search        string
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+}
+
+// Search lists a page of the user notes matching the filter, the most recently updated first, along with the total
+// number of matching notes.
+func (rep *NoteRepository) Search(userID string, filter NoteFilter, offset, limit int) ([]Note, int64, error) {
+	var total int64
+	if err := rep.DB.Model(&Note{}).Scopes(filter.scope(userID)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	notes := []Note{}
+	err := rep.DB.Scopes(filter.scope(userID)).Order("updated_at DESC").Offset(offset).Limit(limit).Find(&notes).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return notes, total, nil
+}
+
+func (filter NoteFilter) scope(userID string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("user_id = ?", userID)
+		if filter.Search != "" {
+			db = searchScope(db, filter.Search)
+		}
+		// the times are converted to utc since sqlite compares them as text.
+		if filter.UpdatedAfter != nil {
+			db = db.Where("updated_at > ?", filter.UpdatedAfter.UTC())
+		}
+		if filter.UpdatedBefore != nil {
+			db = db.Where("updated_at < ?", filter.UpdatedBefore.UTC())
+		}
+		return db
+	}
+}
+
+// searchScope matches the notes containing search in their title or content case insensitively, sqlite uses the
+// notes_fts trigram index for the searches long enough to have a trigram.
+func searchScope(db *gorm.DB, search string) *gorm.DB {
+	pattern := "%" + escapeLike(search) + "%"
+	if Dialect(db) != SQLite {
+		return db.Where("(title ILIKE ? OR content ILIKE ?)", pattern, pattern)
+	}
+
+	if utf8.RuneCountInString(search) >= 3 {
+		phrase := `"` + strings.ReplaceAll(search, `"`, `""`) + `"`
+		return db.Where("id IN (SELECT note_id FROM notes_fts WHERE notes_fts MATCH ?)", phrase)
+	}
+	return db.Where(`(title LIKE ? ESCAPE '\' OR content LIKE ? ESCAPE '\')`, pattern, pattern)
+}
+
+// FindManyForUser finds the notes of the user with the given ids, missing and other users notes are skipped.
+func (rep *NoteRepository) FindManyForUser(userID string, ids []string) ([]Note, error) {
+	notes := []Note{}
+	ids = validIDs(ids)
+	if len(ids) == 0 {
+		return notes, nil
+	}
+	if err := rep.DB.Find(&notes, "user_id = ? AND id IN ?", userID, ids).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/msal4/toastnotes/rrule"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The channels the reminders are delivered through.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// MaxReminderAttempts is how many times the delivery of a reminder is attempted before the occurrence is skipped, the
+// retries wait ReminderRetryDelay doubled after every failure.
+const MaxReminderAttempts = 5
+
+// ReminderRetryDelay is how long the first retry of a failed delivery waits.
+var ReminderRetryDelay = time.Minute
+
+// ErrNoOccurrence is returned when a reminder would never fire.
+var ErrNoOccurrence = errors.New("the reminder has no upcoming occurrence")
+
+// Reminder reminds the user of a note at a time, a note has one reminder at most. The recurring reminders repeat At
+// following their recurrence rule in their timezone.
+type Reminder struct {
+	Model
+	NoteID string `json:"noteId" gorm:"type:uuid"`
+	UserID string `json:"-" gorm:"type:uuid"`
+	// At is the time of the first occurrence.
+	At time.Time `json:"at"`
+	// Timezone is the IANA time zone the recurrences keep the wall clock time of At in, e.g. Europe/Berlin.
+	Timezone string `json:"timezone"`
+	// Recurrence is an RFC 5545 recurrence rule like FREQ=WEEKLY;BYDAY=MO,FR, see the rrule package.
+	Recurrence string `json:"recurrence,omitempty"`
+	Channel    string `json:"channel"`
+	WebhookURL string `json:"webhookUrl,omitempty"`
+	// NextAt is when the reminder fires next, it's nil once the reminder is done.
+	NextAt      *time.Time `json:"nextAt"`
+	LastFiredAt *time.Time `json:"lastFiredAt,omitempty"`
+	// Attempts counts the failed deliveries of the next occurrence and LastError describes the last one.
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+	// ClaimedUntil is set while a scheduler delivers the reminder, the others skip it until then.
+	ClaimedUntil *time.Time `json:"-"`
+}
+
+// Location loads the reminder time zone.
+func (r *Reminder) Location() (*time.Location, error) {
+	return time.LoadLocation(r.Timezone)
+}
+
+// Next returns the first occurrence of the reminder after the given time, ok is false if there are no more.
+func (r *Reminder) Next(after time.Time) (next time.Time, ok bool, err error) {
+	loc, err := r.Location()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	start := r.At.In(loc)
+	if r.Recurrence == "" {
+		return start, start.After(after), nil
+	}
+
+	rule, err := rrule.Parse(r.Recurrence)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	next, ok = rule.Next(start, after)
+	return next, ok, nil
+}
+
+// Schedule sets the next time of the reminder to its first occurrence after now, it returns ErrNoOccurrence if
+// there's none.
+func (r *Reminder) Schedule(now time.Time) error {
+	next, ok, err := r.Next(now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		r.NextAt = nil
+		return ErrNoOccurrence
+	}
+	next = next.UTC()
+	r.NextAt = &next
+	return nil
+}
+
+// Advance schedules the reminder after it was delivered at now, or failed to be with err. A failed delivery is
+// retried after a backoff until MaxReminderAttempts is reached and then the occurrence is skipped.
+func (r *Reminder) Advance(now time.Time, err error) {
+	r.ClaimedUntil = nil
+	if err != nil {
+		r.Attempts++
+		r.LastError = err.Error()
+		if r.Attempts < MaxReminderAttempts {
+			retry := now.Add(ReminderRetryDelay << (r.Attempts - 1)).UTC()
+			r.NextAt = &retry
+			return
+		}
+	} else {
+		fired := now.UTC()
+		r.LastFiredAt = &fired
+		r.LastError = ""
+	}
+	r.Attempts = 0
+	if err := r.Schedule(now); err != nil {
+		r.NextAt = nil
+	}
+}
+
+// Due is a claimed due reminder along with its note and the user it's delivered to.
+type Due struct {
+	Reminder *Reminder
+	Note     *Note
+	User     *User
+}
+
+// ReminderRepository holds the reminders actions.
+type ReminderRepository struct {
+	*Repository
+}
+
+// NewReminderRepository creates a new reminder repo.
+func NewReminderRepository(db *gorm.DB) *ReminderRepository {
+	return &ReminderRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *ReminderRepository) WithContext(ctx context.Context) ReminderStore {
+	return NewReminderRepository(rep.DB.WithContext(ctx))
+}
+
+// reminderScheduleColumns are the columns replaced by Set, the last time the reminder fired is kept.
+var reminderScheduleColumns = []string{
+	"updated_at", "at", "timezone", "recurrence", "channel", "webhook_url", "next_at", "attempts", "last_error",
+	"claimed_until",
+}
+
+// Set creates the reminder of its note or replaces the existing one, which releases its claim.
+func (rep *ReminderRepository) Set(rem *Reminder) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Reminder
+		err := tx.Select("id", "created_at").First(&existing, "note_id = ? AND user_id = ?", rem.NoteID, rem.UserID).Error
+		switch {
+		case errors.Is(err, ErrNotFound):
+			rem.ClaimedUntil = nil
+			return tx.Create(rem).Error
+		case err != nil:
+			return err
+		}
+
+		rem.ID, rem.CreatedAt = existing.ID, existing.CreatedAt
+		rem.ClaimedUntil = nil
+		return tx.Model(rem).Select(reminderScheduleColumns).Updates(rem).Error
+	})
+}
+
+// FindForNote finds the reminder of the user note.
+func (rep *ReminderRepository) FindForNote(noteID, userID string) (*Reminder, error) {
+	if !validID(noteID) {
+		return nil, ErrNotFound
+	}
+
+	var rem Reminder
+	if err := rep.DB.First(&rem, "note_id = ? AND user_id = ?", noteID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &rem, nil
+}
+
+// Upcoming lists the reminders of the user that fire before the given time, the soonest first. The reminders of the
+// deleted notes are skipped.
+func (rep *ReminderRepository) Upcoming(userID string, before time.Time, limit int) ([]Reminder, error) {
+	rems := []Reminder{}
+	err := rep.DB.Where("user_id = ? AND next_at IS NOT NULL AND next_at < ?", userID, before.UTC()).
+		Where("note_id IN (SELECT id FROM notes WHERE user_id = ? AND deleted_at IS NULL)", userID).
+		Order("next_at, id").Limit(limit).Find(&rems).Error
+	return rems, err
+}
+
+// DeleteForNote permanently deletes the reminder of the user note.
+func (rep *ReminderRepository) DeleteForNote(noteID, userID string) error {
+	if !validID(noteID) {
+		return ErrNotFound
+	}
+
+	res := rep.DB.Unscoped().Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&Reminder{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Claim claims the reminder that was due the longest at now until now+lease and returns it with its note and user,
+// it returns ErrNotFound if there's none. The due rows are locked with SKIP LOCKED so that concurrent schedulers claim
+// different reminders without waiting for each other, sqlite serializes the write transactions instead.
+func (rep *ReminderRepository) Claim(now time.Time, lease time.Duration) (*Due, error) {
+	now = now.UTC()
+	var due *Due
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		var rem Reminder
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_at <= ? AND (claimed_until IS NULL OR claimed_until <= ?)", now, now).
+			Where("note_id IN (SELECT id FROM notes WHERE deleted_at IS NULL)").
+			Order("next_at, id").Take(&rem).Error
+		if err != nil {
+			return err
+		}
+
+		until := now.Add(lease).Truncate(time.Millisecond)
+		if err := tx.Model(&rem).Update("claimed_until", until).Error; err != nil {
+			return err
+		}
+		rem.ClaimedUntil = &until
+
+		var note Note
+		if err := tx.First(&note, "id = ?", rem.NoteID).Error; err != nil {
+			return err
+		}
+		var user User
+		if err := tx.First(&user, "id = ?", rem.UserID).Error; err != nil {
+			return err
+		}
+		due = &Due{Reminder: &rem, Note: &note, User: &user}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// Complete saves the schedule of a claimed reminder after its delivery and releases the claim, it returns
+// ErrNotFound if the claim was lost because the reminder was changed, deleted or claimed again after it expired.
+func (rep *ReminderRepository) Complete(rem *Reminder, claimedUntil time.Time) error {
+	res := rep.DB.Model(rem).Where("claimed_until = ?", claimedUntil).Updates(map[string]interface{}{
+		"next_at":       rem.NextAt,
+		"last_fired_at": rem.LastFiredAt,
+		"attempts":      rem.Attempts,
+		"last_error":    rem.LastError,
+		"claimed_until": nil,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by the stores when a record doesn't exist, it's gorm.ErrRecordNotFound so that either can
+// be checked.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrConflict is returned by the conditional changes of the notes when the note was changed since the expected version.
+var ErrConflict = errors.New("the note was changed")
+
+// ErrInvalidFolder is returned by the notes changes when the folder of the note isn't valid, see ValidFolder.
+var ErrInvalidFolder = errors.New("the folder isn't a valid path")
+
+// NoteStore holds the notes operations.
+type NoteStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) NoteStore
+	// WithQuota returns a copy of the store that rejects the changes exceeding the quota of the plan of the user with
+	// a *QuotaError.
+	WithQuota(quotas Quotas) NoteStore
+	// Create creates the note and sets its id and timestamps, it returns ErrInvalidFolder unless its folder is valid.
+	Create(note *Note) error
+	// Find finds the note with the given id whoever owns it.
+	Find(id string) (*Note, error)
+	// FindForUser finds the note with the given id if it belongs to the user.
+	FindForUser(id, userID string) (*Note, error)
+	// FindManyForUser finds the notes of the user with the given ids, missing and other users notes are skipped.
+	FindManyForUser(userID string, ids []string) ([]Note, error)
+	// ListForUser lists all the notes of the user, the most recently updated first.
+	ListForUser(userID string) ([]Note, error)
+	// Search lists a page of the user notes matching the filter, the most recently updated first, along with the
+	// total number of matching notes.
+	Search(userID string, filter NoteFilter, offset, limit int) ([]Note, int64, error)
+	// FindForUserWithDeleted finds the note with the given id if it belongs to the user, even if it's deleted.
+	FindForUserWithDeleted(id, userID string) (*Note, error)
+	// Changes lists up to limit notes of the user changed after the version, the deleted ones included, in the order
+	// of their versions. A reader that sees a version sees all the versions before it.
+	Changes(userID string, after int64, limit int) ([]Note, error)
+	// Update saves the title and content of the note of its user and sets its update time and version.
+	Update(note *Note) error
+	// UpdateIfVersion updates the note like Update if it's still at the version, otherwise it returns ErrConflict.
+	UpdateIfVersion(note *Note, version int64) error
+	// Move moves the note of its user to its folder and sets its update time and version, it returns ErrInvalidFolder
+	// unless the folder is valid.
+	Move(note *Note) error
+	// Delete deletes the note of its user and sets its version.
+	Delete(note *Note) error
+	// DeleteIfVersion deletes the note like Delete if it's still at the version, otherwise it returns ErrConflict.
+	// Deleting a deleted note does nothing.
+	DeleteIfVersion(note *Note, version int64) error
+	// Restore restores the deleted note of its user and loads it into note, it returns ErrNotFound unless the note is
+	// deleted.
+	Restore(note *Note) error
+}
+
+// UserStore holds the users operations.
+type UserStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) UserStore
+	// Create creates the user and sets their id and timestamps, the emails are unique.
+	Create(user *User) error
+	// RegisterUser creates a user using the register form, the password is hashed.
+	RegisterUser(form auth.RegisterForm) (*User, error)
+	// RetrieveUser finds the user with the given id.
+	RetrieveUser(id string) (*User, error)
+	// FindByEmail finds the user with the given email.
+	FindByEmail(email string) (*User, error)
+	// FindMany finds the users with the given ids, missing users are skipped.
+	FindMany(ids []string) ([]User, error)
+	// EmailTaken checks if a user has already registered with the given email.
+	EmailTaken(email string) bool
+	// SetPassword hashes and sets the user password and bumps their token version.
+	SetPassword(user *User, password string) error
+	// SetDisabled disables or re-enables the user, disabling also bumps their token version.
+	SetDisabled(user *User, disabled bool) error
+	// SetPlan puts the user on the quota plan, the empty plan is the default quota.
+	SetPlan(user *User, plan string) error
+}
+
+// LoginLinkStore holds the login links operations.
+type LoginLinkStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) LoginLinkStore
+	// Create creates the link and sets its id and timestamps, the token hashes are unique.
+	Create(link *LoginLink) error
+	// CountSince counts the links created for the user since the given time.
+	CountSince(userID string, since time.Time) (int64, error)
+	// Consume marks the unused and unexpired link matching the token and nonce hashes as used and returns it, a link
+	// can only be consumed once. A link opened with the wrong nonce is left unused.
+	Consume(tokenHash, nonceHash string) (*LoginLink, error)
+	// DeleteExpired permanently deletes the links that expired before the given time and returns how many were
+	// deleted.
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// CredentialStore holds the passkeys operations.
+type CredentialStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) CredentialStore
+	// Create creates the credential and sets its id and timestamps, the credential ids are unique.
+	Create(cred *Credential) error
+	// RetrieveUserWithCredentials finds the user with the given id along with their credentials.
+	RetrieveUserWithCredentials(id string) (*User, error)
+	// ListForUser lists the user credentials, the most recently created first.
+	ListForUser(userID string) ([]Credential, error)
+	// FindForUser finds the credential with the given id if it belongs to the user.
+	FindForUser(id, userID string) (*Credential, error)
+	// RecordLogin updates the user credential after it has been used to log in.
+	RecordLogin(user *User, wc *webauthn.Credential) error
+	// Rename renames the credential.
+	Rename(cred *Credential, name string) error
+	// Delete permanently deletes the credential.
+	Delete(cred *Credential) error
+}
+
+// AttachmentStore holds the note attachments operations.
+type AttachmentStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) AttachmentStore
+	// WithQuota returns a copy of the store that rejects the attachments exceeding the quota of the plan of the user
+	// with a *QuotaError.
+	WithQuota(quotas Quotas) AttachmentStore
+	// Create creates the attachment and sets its id and timestamps.
+	Create(att *Attachment) error
+	// ListForNote lists the attachments of the user note, the oldest first.
+	ListForNote(noteID, userID string) ([]Attachment, error)
+	// FindForNote finds the attachment with the given id if it's attached to the user note.
+	FindForNote(id, noteID, userID string) (*Attachment, error)
+	// Delete permanently deletes the attachment of its user, its blob isn't deleted.
+	Delete(att *Attachment) error
+}
+
+// UsageStore holds the usage operations, the usage is kept up to date by the note and attachment stores.
+type UsageStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) UsageStore
+	// Get gets the usage of the user, it's zero if they haven't stored anything yet.
+	Get(userID string) (*Usage, error)
+}
+
+// ReminderStore holds the note reminders operations.
+type ReminderStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) ReminderStore
+	// Set creates the reminder of its note and sets its id and timestamps, or replaces the schedule of the existing
+	// one. The next time must be set, see Reminder.Schedule.
+	Set(rem *Reminder) error
+	// FindForNote finds the reminder of the user note.
+	FindForNote(noteID, userID string) (*Reminder, error)
+	// Upcoming lists up to limit reminders of the user that fire before the given time, the soonest first, the
+	// reminders of the deleted notes are skipped.
+	Upcoming(userID string, before time.Time, limit int) ([]Reminder, error)
+	// DeleteForNote permanently deletes the reminder of the user note.
+	DeleteForNote(noteID, userID string) error
+	// Claim claims the reminder that has been due the longest at now for the lease duration and returns it along with
+	// its note and user, it returns ErrNotFound if none is due. A claimed reminder isn't claimed again until the lease
+	// expires, so that only one of the concurrent schedulers fires it.
+	Claim(now time.Time, lease time.Duration) (*Due, error)
+	// Complete saves the next time and delivery state of the reminder claimed until claimedUntil and releases it, it
+	// returns ErrNotFound if the reminder was changed or claimed again since.
+	Complete(rem *Reminder, claimedUntil time.Time) error
+}
+
+// ChecklistStore holds the note checklists operations.
+type ChecklistStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) ChecklistStore
+	// ListForNote lists the checklist items of the user note in order.
+	ListForNote(noteID, userID string) ([]ChecklistItem, error)
+	// FindForNote finds the checklist item with the given id if it's in the user note.
+	FindForNote(id, noteID, userID string) (*ChecklistItem, error)
+	// Add inserts the item into the checklist of its user note at the position and sets its id, position and
+	// timestamps, an out of range position appends it. It returns ErrNotFound if the note doesn't exist and
+	// ErrChecklistFull if the checklist has MaxChecklistItems items.
+	Add(item *ChecklistItem, position int) error
+	// Update saves the text and the state of the item of its user note.
+	Update(item *ChecklistItem) error
+	// Reorder orders the checklist of the user note as the ids and returns it, it returns ErrChecklistOrder unless
+	// the ids list each item once.
+	Reorder(noteID, userID string, ids []string) ([]ChecklistItem, error)
+	// Delete permanently deletes the item of its user note.
+	Delete(item *ChecklistItem) error
+	// Counts counts the checked and all the checklist items of the user notes with the given ids, the notes without
+	// items are left out.
+	Counts(userID string, noteIDs []string) (map[string]ChecklistCount, error)
+}
+
+// ImportStore holds the import jobs operations.
+type ImportStore interface {
+	// WithContext returns a copy of the store that runs its operations with ctx.
+	WithContext(ctx context.Context) ImportStore
+	// Create creates the job and sets its id and timestamps.
+	Create(job *ImportJob) error
+	// FindForUser finds the job with the given id if it belongs to the user along with its failures in order.
+	FindForUser(id, userID string) (*ImportJob, error)
+	// Claim claims the oldest unfinished job for the lease duration, sets it running and returns it, it returns
+	// ErrNotFound if there's none. A claimed job isn't claimed again until the lease expires, so that only one of the
+	// concurrent workers runs it.
+	Claim(now time.Time, lease time.Duration) (*ImportJob, error)
+	// Update saves the progress and the state of the job claimed until claimedUntil and adds the failures to its
+	// report, the claim is renewed until job.ClaimedUntil or released if it's nil. It returns ErrNotFound if the job
+	// was claimed again since.
+	Update(job *ImportJob, claimedUntil time.Time, failures []ImportFailure) error
+}
+
+// Transactor runs functions in the transactions of a stores backend.
+type Transactor interface {
+	// Transaction runs fn with the stores of a transaction, it's committed if fn returns nil and rolled back
+	// otherwise. The transactions can be nested, a nested transaction is rolled back by itself. The stores don't
+	// enforce a quota.
+	Transaction(ctx context.Context, fn func(stores *Stores) error) error
+}
+
+// Stores groups the stores of a backend, see NewStores for the database one.
+type Stores struct {
+	Transactor Transactor
+
+	Users       UserStore
+	Notes       NoteStore
+	LoginLinks  LoginLinkStore
+	Credentials CredentialStore
+	Attachments AttachmentStore
+	Usage       UsageStore
+	Reminders   ReminderStore
+	Checklists  ChecklistStore
+	Imports     ImportStore
+}
+
+// Transaction runs fn with the stores of a transaction, see Transactor.
+func (s *Stores) Transaction(ctx context.Context, fn func(stores *Stores) error) error {
+	return s.Transactor.Transaction(ctx, fn)
+}
+
+// WithQuota returns a copy of the stores enforcing the quotas of the plans of the users.
+func (s *Stores) WithQuota(quotas Quotas) *Stores {
+	stores := *s
+	stores.Notes = s.Notes.WithQuota(quotas)
+	stores.Attachments = s.Attachments.WithQuota(quotas)
+	return &stores
+}
+
+// NewStores creates the stores using the database repositories.
+func NewStores(db *gorm.DB) *Stores {
+	return &Stores{
+		Transactor:  transactor{db: db},
+		Users:       NewUserRepository(db),
+		Notes:       NewNoteRepository(db),
+		LoginLinks:  NewLoginLinkRepository(db),
+		Credentials: NewCredentialRepository(db),
+		Attachments: NewAttachmentRepository(db),
+		Usage:       NewUsageRepository(db),
+		Reminders:   NewReminderRepository(db),
+		Checklists:  NewChecklistRepository(db),
+		Imports:     NewImportRepository(db),
+	}
+}
+
+// transactor runs the transactions of the database, the nested ones use savepoints.
+type transactor struct {
+	db *gorm.DB
+}
+
+func (t transactor) Transaction(ctx context.Context, fn func(stores *Stores) error) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewStores(tx))
+	})
+}
+
+// validID reports whether id is a valid uuid, the database rejects the queries using invalid ones so they're treated
+// as missing records.
+func validID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// validIDs returns the valid ids.
+func validIDs(ids []string) []string {
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if validID(id) {
+			valid = append(valid, id)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,1251 @@
+// Package storetest is a conformance test suite of the model stores, every implementation must pass it so that the
+// tests using the in-memory stores hold for the database ones.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the suite, newStores must return stores without any records.
+func Run(t *testing.T, newStores func(t *testing.T) *models.Stores) {
+	t.Run("users", func(t *testing.T) { testUsers(t, newStores(t)) })
+	t.Run("notes", func(t *testing.T) { testNotes(t, newStores(t)) })
+	t.Run("note_versions", func(t *testing.T) { testNoteVersions(t, newStores(t)) })
+	t.Run("login_links", func(t *testing.T) { testLoginLinks(t, newStores(t)) })
+	t.Run("credentials", func(t *testing.T) { testCredentials(t, newStores(t)) })
+	t.Run("attachments", func(t *testing.T) { testAttachments(t, newStores(t)) })
+	t.Run("usage", func(t *testing.T) { testUsage(t, newStores(t)) })
+	t.Run("reminders", func(t *testing.T) { testReminders(t, newStores(t)) })
+	t.Run("checklists", func(t *testing.T) { testChecklists(t, newStores(t)) })
+	t.Run("imports", func(t *testing.T) { testImports(t, newStores(t)) })
+	t.Run("transactions", func(t *testing.T) { testTransactions(t, newStores(t)) })
+}
+
+func createUser(t *testing.T, stores *models.Stores, email string) *models.User {
+	t.Helper()
+	user := &models.User{Name: "Mock User", Email: email}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func testUsers(t *testing.T, stores *models.Stores) {
+	users := stores.Users
+
+	user, err := users.RegisterUser(auth.RegisterForm{
+		Credentials: auth.Credentials{Email: "user@email.com", Password: "mockpassword"},
+		Name:        "Mock User",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	t.Run("register_sets_the_id_and_hashes_the_password", func(t *testing.T) {
+		assert.True(t, validID(user.ID))
+		assert.False(t, user.CreatedAt.IsZero())
+		assert.True(t, auth.PasswordMatch(user.Password, "mockpassword"))
+	})
+
+	t.Run("emails_are_unique", func(t *testing.T) {
+		assert.NotNil(t, users.Create(&models.User{Name: "Another User", Email: "user@email.com"}))
+		assert.True(t, users.EmailTaken("user@email.com"))
+		assert.False(t, users.EmailTaken("another@email.com"))
+	})
+
+	t.Run("finds_users", func(t *testing.T) {
+		found, err := users.RetrieveUser(user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, user.Email, found.Email)
+		}
+		found, err = users.FindByEmail("user@email.com")
+		if assert.Nil(t, err) {
+			assert.Equal(t, user.ID, found.ID)
+		}
+
+		_, err = users.RetrieveUser(uuid.NewString())
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = users.RetrieveUser("not an id")
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = users.FindByEmail("another@email.com")
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("find_many_skips_missing_users", func(t *testing.T) {
+		other := createUser(t, stores, "other@email.com")
+		found, err := users.FindMany([]string{user.ID, other.ID, uuid.NewString(), "not an id"})
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{user.ID, other.ID}, userIDs(found))
+
+		found, err = users.FindMany(nil)
+		assert.Nil(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("set_password_bumps_the_token_version", func(t *testing.T) {
+		assert.Nil(t, users.SetPassword(user, "newpassword"))
+
+		found, _ := users.RetrieveUser(user.ID)
+		assert.True(t, auth.PasswordMatch(found.Password, "newpassword"))
+		assert.Equal(t, 1, found.TokenVersion)
+	})
+
+	t.Run("set_disabled", func(t *testing.T) {
+		found, _ := users.RetrieveUser(user.ID)
+		assert.Nil(t, users.SetDisabled(found, true))
+		found, _ = users.RetrieveUser(user.ID)
+		assert.True(t, found.Disabled())
+		assert.Equal(t, 2, found.TokenVersion)
+
+		assert.Nil(t, users.SetDisabled(found, false))
+		found, _ = users.RetrieveUser(user.ID)
+		assert.False(t, found.Disabled())
+		assert.Equal(t, 2, found.TokenVersion)
+	})
+
+	t.Run("set_plan", func(t *testing.T) {
+		found, _ := users.RetrieveUser(user.ID)
+		assert.Nil(t, users.SetPlan(found, "pro"))
+		assert.Equal(t, "pro", found.Plan)
+		found, _ = users.RetrieveUser(user.ID)
+		assert.Equal(t, "pro", found.Plan)
+	})
+}
+
+func testNotes(t *testing.T, stores *models.Stores) {
+	notes := stores.Notes
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+
+	// the update times are set so that the order is known.
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	create := func(userID, title, content string, age int) *models.Note {
+		t.Helper()
+		note := &models.Note{Title: title, Content: content, UserID: userID}
+		note.CreatedAt = start.Add(time.Duration(-age) * time.Minute)
+		note.UpdatedAt = note.CreatedAt
+		if err := notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	groceries := create(user.ID, "Groceries", "Milk and eggs", 3)
+	ideas := create(user.ID, "Ideas", "A NOTE app", 2)
+	discount := create(user.ID, "Discount", "50% off", 1)
+	secret := create(other.ID, "Secret", "a note of another user", 0)
+
+	t.Run("create_sets_the_id", func(t *testing.T) {
+		assert.True(t, validID(groceries.ID))
+		assert.NotEqual(t, groceries.ID, ideas.ID)
+	})
+
+	t.Run("finds_notes", func(t *testing.T) {
+		found, err := notes.Find(secret.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "Secret", found.Title)
+			assert.Equal(t, other.ID, found.UserID)
+		}
+
+		found, err = notes.FindForUser(groceries.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "Milk and eggs", found.Content)
+		}
+
+		_, err = notes.FindForUser(secret.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = notes.Find(uuid.NewString())
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = notes.Find("not an id")
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("find_many_skips_missing_and_other_users_notes", func(t *testing.T) {
+		found, err := notes.FindManyForUser(user.ID, []string{groceries.ID, ideas.ID, secret.ID, uuid.NewString(), "not an id"})
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{groceries.ID, ideas.ID}, noteIDs(found))
+	})
+
+	t.Run("lists_the_most_recently_updated_first", func(t *testing.T) {
+		found, err := notes.ListForUser(user.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{discount.ID, ideas.ID, groceries.ID}, noteIDs(found))
+	})
+
+	t.Run("search", func(t *testing.T) {
+		after := start.Add(-150 * time.Second)
+		tests := []struct {
+			name   string
+			filter models.NoteFilter
+			offset int
+			limit  int
+			want   []string
+			total  int64
+		}{
+			{"all", models.NoteFilter{}, 0, 10, []string{discount.ID, ideas.ID, groceries.ID}, 3},
+			{"page", models.NoteFilter{}, 1, 1, []string{ideas.ID}, 3},
+			{"past_the_end", models.NoteFilter{}, 5, 10, []string{}, 3},
+			{"title_or_content_case_insensitively", models.NoteFilter{Search: "note"}, 0, 10, []string{ideas.ID}, 1},
+			{"escapes_the_wildcards", models.NoteFilter{Search: "50%"}, 0, 10, []string{discount.ID}, 1},
+			{"wildcards_match_literally", models.NoteFilter{Search: "%"}, 0, 10, []string{discount.ID}, 1},
+			{"updated_after", models.NoteFilter{UpdatedAfter: &after}, 0, 10, []string{discount.ID, ideas.ID}, 2},
+			{"updated_before", models.NoteFilter{UpdatedBefore: &after}, 0, 10, []string{groceries.ID}, 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, total, err := notes.Search(user.ID, tt.filter, tt.offset, tt.limit)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, noteIDs(found))
+				assert.Equal(t, tt.total, total)
+			})
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		note, _ := notes.FindForUser(ideas.ID, user.ID)
+		note.Title = "Better ideas"
+		note.Content = ""
+		assert.Nil(t, notes.Update(note))
+
+		found, _ := notes.Find(ideas.ID)
+		assert.Equal(t, "Better ideas", found.Title)
+		assert.Empty(t, found.Content)
+		assert.True(t, found.UpdatedAt.After(start))
+		assert.WithinDuration(t, note.UpdatedAt, found.UpdatedAt, time.Millisecond)
+
+		list, _ := notes.ListForUser(user.ID)
+		assert.Equal(t, ideas.ID, list[0].ID)
+	})
+
+	t.Run("update_checks_the_owner", func(t *testing.T) {
+		note, _ := notes.Find(secret.ID)
+		note.UserID = user.ID
+		note.Title = "Stolen"
+		assert.ErrorIs(t, notes.Update(note), models.ErrNotFound)
+
+		found, _ := notes.Find(secret.ID)
+		assert.Equal(t, "Secret", found.Title)
+		assert.Equal(t, other.ID, found.UserID)
+	})
+
+	t.Run("move", func(t *testing.T) {
+		note, _ := notes.FindForUser(ideas.ID, user.ID)
+		note.Folder = "work/ideas"
+		assert.Nil(t, notes.Move(note))
+		note.Title = "Moved ideas"
+		assert.Nil(t, notes.Update(note))
+
+		found, _ := notes.Find(ideas.ID)
+		assert.Equal(t, "work/ideas", found.Folder, "the updates keep the folder")
+		assert.Equal(t, note.Version, found.Version)
+
+		for _, folder := range []string{"/work", "work/", "work//ideas", "../work", "work/.", `work\ideas`} {
+			note.Folder = folder
+			assert.ErrorIs(t, notes.Move(note), models.ErrInvalidFolder, folder)
+		}
+		assert.ErrorIs(t, notes.Create(&models.Note{Title: "Invalid", UserID: user.ID, Folder: "/"}), models.ErrInvalidFolder)
+		stolen := &models.Note{Model: models.Model{ID: secret.ID}, UserID: user.ID, Folder: "stolen"}
+		assert.ErrorIs(t, notes.Move(stolen), models.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.ErrorIs(t, notes.Delete(&models.Note{Model: models.Model{ID: secret.ID}, UserID: user.ID}), models.ErrNotFound)
+		_, err := notes.Find(secret.ID)
+		assert.Nil(t, err)
+
+		assert.Nil(t, notes.Delete(&models.Note{Model: models.Model{ID: groceries.ID}, UserID: user.ID}))
+		_, err = notes.Find(groceries.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		assert.ErrorIs(t, notes.Update(groceries), models.ErrNotFound)
+		assert.ErrorIs(t, notes.Delete(groceries), models.ErrNotFound)
+
+		found, total, _ := notes.Search(user.ID, models.NoteFilter{}, 0, 10)
+		assert.NotContains(t, noteIDs(found), groceries.ID)
+		assert.EqualValues(t, 2, total)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		assert.ErrorIs(t, notes.Restore(&models.Note{Model: models.Model{ID: groceries.ID}, UserID: other.ID}), models.ErrNotFound)
+		assert.ErrorIs(t, notes.Restore(&models.Note{Model: models.Model{ID: ideas.ID}, UserID: user.ID}), models.ErrNotFound)
+		assert.ErrorIs(t, notes.Restore(&models.Note{Model: models.Model{ID: "not an id"}, UserID: user.ID}), models.ErrNotFound)
+
+		restored := &models.Note{Model: models.Model{ID: groceries.ID}, UserID: user.ID}
+		assert.Nil(t, notes.Restore(restored))
+		assert.Equal(t, "Groceries", restored.Title)
+		assert.Equal(t, "Milk and eggs", restored.Content)
+		found, err := notes.FindForUser(groceries.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "Groceries", found.Title)
+		}
+		assert.ErrorIs(t, notes.Restore(restored), models.ErrNotFound)
+	})
+}
+
+func testNoteVersions(t *testing.T, stores *models.Stores) {
+	notes := stores.Notes
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+	create := func(userID, title string) *models.Note {
+		t.Helper()
+		note := &models.Note{Title: title, UserID: userID}
+		if err := notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	versions := func(changes []models.Note) []int64 {
+		v := make([]int64, len(changes))
+		for i, note := range changes {
+			v[i] = note.Version
+		}
+		return v
+	}
+	first, second := create(user.ID, "first"), create(user.ID, "second")
+	create(other.ID, "other")
+
+	t.Run("every_change_gives_the_note_the_next_version_of_its_user", func(t *testing.T) {
+		assert.Equal(t, []int64{1, 2}, []int64{first.Version, second.Version})
+		first.Title = "first v3"
+		assert.Nil(t, notes.Update(first))
+		assert.EqualValues(t, 3, first.Version)
+
+		changes, err := notes.Changes(user.ID, 0, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{2, 3}, versions(changes), "a note is listed once at its last version")
+		assert.Equal(t, "first v3", changes[1].Title)
+		changes, _ = notes.Changes(user.ID, 2, 10)
+		assert.Equal(t, []int64{3}, versions(changes))
+		changes, _ = notes.Changes(user.ID, 0, 1)
+		assert.Equal(t, []int64{2}, versions(changes))
+	})
+
+	t.Run("the_conditional_changes_conflict_with_the_other_versions", func(t *testing.T) {
+		second.Title = "stale"
+		assert.ErrorIs(t, notes.UpdateIfVersion(second, 1), models.ErrConflict)
+		assert.Nil(t, notes.UpdateIfVersion(second, 2))
+		assert.EqualValues(t, 4, second.Version)
+		assert.ErrorIs(t, notes.DeleteIfVersion(&models.Note{Model: models.Model{ID: first.ID}, UserID: user.ID}, 1), models.ErrConflict)
+		assert.ErrorIs(t, notes.UpdateIfVersion(&models.Note{Model: models.Model{ID: first.ID}, UserID: other.ID, Title: "x"}, 3),
+			models.ErrNotFound)
+	})
+
+	t.Run("the_deleted_notes_are_listed_as_changes", func(t *testing.T) {
+		deleted := &models.Note{Model: models.Model{ID: first.ID}, UserID: user.ID}
+		assert.Nil(t, notes.DeleteIfVersion(deleted, 3))
+		assert.EqualValues(t, 5, deleted.Version)
+		assert.Nil(t, notes.DeleteIfVersion(&models.Note{Model: models.Model{ID: first.ID}, UserID: user.ID}, 3),
+			"deleting a deleted note does nothing")
+		changes, _ := notes.Changes(user.ID, 4, 10)
+		if assert.Len(t, changes, 1) {
+			assert.True(t, changes[0].Deleted())
+			assert.EqualValues(t, 5, changes[0].Version)
+		}
+		assert.ErrorIs(t, notes.UpdateIfVersion(first, 5), models.ErrConflict)
+		found, err := notes.FindForUserWithDeleted(first.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.True(t, found.Deleted())
+		}
+		_, err = notes.FindForUserWithDeleted(first.ID, other.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+
+		restored := &models.Note{Model: models.Model{ID: first.ID}, UserID: user.ID}
+		assert.Nil(t, notes.Restore(restored))
+		assert.EqualValues(t, 6, restored.Version)
+	})
+
+	t.Run("the_versions_are_unique_under_concurrent_changes", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := notes.Create(&models.Note{Title: "concurrent", UserID: user.ID}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		changes, _ := notes.Changes(user.ID, 0, 100)
+		assert.Equal(t, []int64{4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, versions(changes))
+	})
+}
+
+func testLoginLinks(t *testing.T, stores *models.Stores) {
+	links := stores.LoginLinks
+	user := createUser(t, stores, "user@email.com")
+	now := time.Now()
+
+	create := func(token string, expiresAt time.Time) *models.LoginLink {
+		t.Helper()
+		link := &models.LoginLink{UserID: user.ID, TokenHash: auth.HashToken(token), NonceHash: auth.HashToken("nonce"), ExpiresAt: expiresAt}
+		if err := links.Create(link); err != nil {
+			t.Fatal(err)
+		}
+		return link
+	}
+	valid := create("valid", now.Add(time.Hour))
+	create("expired", now.Add(-time.Minute))
+
+	t.Run("token_hashes_are_unique", func(t *testing.T) {
+		assert.NotNil(t, links.Create(&models.LoginLink{UserID: user.ID, TokenHash: valid.TokenHash, ExpiresAt: now}))
+	})
+
+	t.Run("counts_the_recent_links", func(t *testing.T) {
+		count, err := links.CountSince(user.ID, now.Add(-time.Minute))
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, count)
+
+		count, _ = links.CountSince(user.ID, now.Add(time.Minute))
+		assert.Zero(t, count)
+	})
+
+	t.Run("links_are_consumed_once", func(t *testing.T) {
+		_, err := links.Consume(auth.HashToken("valid"), auth.HashToken("wrong"))
+		assert.ErrorIs(t, err, models.ErrNotFound, "the wrong nonce doesn't use the link up")
+
+		link, err := links.Consume(auth.HashToken("valid"), auth.HashToken("nonce"))
+		if assert.Nil(t, err) {
+			assert.Equal(t, valid.ID, link.ID)
+			assert.Equal(t, user.ID, link.UserID)
+			assert.Equal(t, auth.HashToken("nonce"), link.NonceHash)
+			assert.NotNil(t, link.UsedAt)
+		}
+
+		_, err = links.Consume(auth.HashToken("valid"), auth.HashToken("nonce"))
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = links.Consume(auth.HashToken("expired"), auth.HashToken("nonce"))
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = links.Consume(auth.HashToken("unknown"), auth.HashToken("nonce"))
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("deletes_the_expired_links", func(t *testing.T) {
+		count, err := links.DeleteExpired(now)
+		assert.Nil(t, err)
+		assert.EqualValues(t, 1, count)
+
+		count, _ = links.CountSince(user.ID, now.Add(-time.Minute))
+		assert.EqualValues(t, 1, count)
+	})
+}
+
+func testCredentials(t *testing.T, stores *models.Stores) {
+	creds := stores.Credentials
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	create := func(userID, name, id string, age int) *models.Credential {
+		t.Helper()
+		cred := models.NewCredential(userID, name, &webauthn.Credential{ID: []byte(id), PublicKey: []byte("key")})
+		cred.CreatedAt = start.Add(time.Duration(-age) * time.Minute)
+		if err := creds.Create(cred); err != nil {
+			t.Fatal(err)
+		}
+		return cred
+	}
+	laptop := create(user.ID, "laptop", "laptop-id", 2)
+	phone := create(user.ID, "phone", "phone-id", 1)
+	others := create(other.ID, "other", "other-id", 0)
+
+	t.Run("credential_ids_are_unique", func(t *testing.T) {
+		dup := models.NewCredential(other.ID, "dup", &webauthn.Credential{ID: []byte("laptop-id")})
+		assert.NotNil(t, creds.Create(dup))
+	})
+
+	t.Run("lists_the_most_recently_created_first", func(t *testing.T) {
+		found, err := creds.ListForUser(user.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{phone.ID, laptop.ID}, credentialIDs(found))
+	})
+
+	t.Run("finds_the_user_credentials", func(t *testing.T) {
+		found, err := creds.FindForUser(laptop.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, []byte("laptop-id"), found.CredentialID)
+		}
+
+		_, err = creds.FindForUser(others.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = creds.FindForUser("not an id", user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("retrieves_the_user_with_their_credentials", func(t *testing.T) {
+		found, err := creds.RetrieveUserWithCredentials(user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, user.Email, found.Email)
+			assert.Equal(t, []string{phone.ID, laptop.ID}, credentialIDs(found.Credentials))
+		}
+
+		_, err = creds.RetrieveUserWithCredentials(uuid.NewString())
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("records_the_logins", func(t *testing.T) {
+		found, _ := creds.RetrieveUserWithCredentials(user.ID)
+		wc := laptop.WebAuthn()
+		wc.Authenticator.SignCount = 7
+		assert.Nil(t, creds.RecordLogin(found, &wc))
+
+		stored, _ := creds.FindForUser(laptop.ID, user.ID)
+		assert.EqualValues(t, 7, stored.SignCount)
+		assert.NotNil(t, stored.LastUsedAt)
+
+		unknown := webauthn.Credential{ID: []byte("unknown")}
+		assert.ErrorIs(t, creds.RecordLogin(found, &unknown), models.ErrNotFound)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		assert.Nil(t, creds.Rename(phone, "old phone"))
+		assert.Equal(t, "old phone", phone.Name)
+
+		stored, _ := creds.FindForUser(phone.ID, user.ID)
+		assert.Equal(t, "old phone", stored.Name)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, creds.Delete(phone))
+		_, err := creds.FindForUser(phone.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+
+		// the credential id can be registered again.
+		assert.Nil(t, creds.Create(models.NewCredential(user.ID, "phone", &webauthn.Credential{ID: []byte("phone-id")})))
+	})
+}
+
+func testAttachments(t *testing.T, stores *models.Stores) {
+	atts := stores.Attachments
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+	note := &models.Note{Title: "note", UserID: user.ID}
+	othersNote := &models.Note{Title: "other", UserID: other.ID}
+	for _, n := range []*models.Note{note, othersNote} {
+		if err := stores.Notes.Create(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	create := func(n *models.Note, filename string, age int) *models.Attachment {
+		t.Helper()
+		att := &models.Attachment{
+			NoteID: n.ID, UserID: n.UserID, Filename: filename, MimeType: "text/plain", Size: 5,
+			Checksum: "checksum", StorageKey: n.UserID + "/" + n.ID + "/" + filename,
+		}
+		att.CreatedAt = start.Add(time.Duration(-age) * time.Minute)
+		if err := atts.Create(att); err != nil {
+			t.Fatal(err)
+		}
+		return att
+	}
+	first := create(note, "first.txt", 2)
+	second := create(note, "second.txt", 1)
+	others := create(othersNote, "other.txt", 0)
+
+	t.Run("create_sets_the_id", func(t *testing.T) {
+		assert.True(t, validID(first.ID))
+	})
+
+	t.Run("lists_the_oldest_first", func(t *testing.T) {
+		found, err := atts.ListForNote(note.ID, user.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{first.ID, second.ID}, attachmentIDs(found))
+
+		found, err = atts.ListForNote(othersNote.ID, user.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, found)
+		found, err = atts.ListForNote("not an id", user.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("finds_the_note_attachments", func(t *testing.T) {
+		found, err := atts.FindForNote(first.ID, note.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "first.txt", found.Filename)
+			assert.EqualValues(t, 5, found.Size)
+			assert.Equal(t, first.StorageKey, found.StorageKey)
+		}
+
+		_, err = atts.FindForNote(others.ID, othersNote.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = atts.FindForNote(first.ID, othersNote.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = atts.FindForNote("not an id", note.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, atts.Delete(second))
+		_, err := atts.FindForNote(second.ID, note.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		assert.ErrorIs(t, atts.Delete(second), models.ErrNotFound)
+
+		stolen := *others
+		stolen.UserID = user.ID
+		assert.ErrorIs(t, atts.Delete(&stolen), models.ErrNotFound)
+	})
+}
+
+func testUsage(t *testing.T, stores *models.Stores) {
+	quotas := models.Quotas{
+		Default: models.Quota{MaxNotes: 5, MaxContentBytes: 80, MaxAttachmentBytes: 10, MaxNoteSize: 50},
+		Plans:   map[string]models.Quota{"pro": {MaxNotes: 10, MaxNoteSize: 100}},
+	}
+	notes := stores.Notes.WithQuota(quotas)
+	atts := stores.Attachments.WithQuota(quotas)
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+
+	usage := func(t *testing.T, userID string) models.Usage {
+		t.Helper()
+		u, err := stores.Usage.Get(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *u
+	}
+	quotaErr := func(t *testing.T, err error, resource string) {
+		t.Helper()
+		var qe *models.QuotaError
+		if assert.ErrorAs(t, err, &qe) {
+			assert.Equal(t, resource, qe.Resource)
+		}
+		assert.ErrorIs(t, err, models.ErrQuotaExceeded)
+	}
+
+	t.Run("starts_at_zero", func(t *testing.T) {
+		assert.Equal(t, models.Usage{UserID: user.ID}, usage(t, user.ID))
+	})
+
+	note := &models.Note{Title: "title", Content: "content", UserID: user.ID}
+	t.Run("counts_the_notes_and_their_size", func(t *testing.T) {
+		assert.Nil(t, notes.Create(note))
+		assert.Nil(t, notes.Create(&models.Note{Title: "other", UserID: other.ID}))
+
+		u := usage(t, user.ID)
+		assert.EqualValues(t, 1, u.Notes)
+		assert.EqualValues(t, 12, u.ContentBytes)
+
+		note.Content = "new content ü"
+		assert.Nil(t, notes.Update(note))
+		assert.EqualValues(t, 19, usage(t, user.ID).ContentBytes)
+		assert.EqualValues(t, 1, usage(t, other.ID).Notes)
+	})
+
+	t.Run("rejects_the_notes_exceeding_the_quota", func(t *testing.T) {
+		quotaErr(t, notes.Create(&models.Note{Title: strings.Repeat("a", 51), UserID: user.ID}), models.QuotaNoteSize)
+
+		large := &models.Note{Title: strings.Repeat("a", 40), UserID: user.ID}
+		assert.Nil(t, notes.Create(large))
+		large.Title = strings.Repeat("b", 40)
+		assert.Nil(t, notes.Update(large), "a note can be changed without growing")
+		quotaErr(t, notes.Create(&models.Note{Title: strings.Repeat("a", 40), UserID: user.ID}), models.QuotaContentBytes)
+
+		note.Content += strings.Repeat("c", 25)
+		quotaErr(t, notes.Update(note), models.QuotaContentBytes)
+		found, _ := notes.Find(note.ID)
+		assert.Equal(t, "new content ü", found.Content)
+
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, notes.Create(&models.Note{Title: "n", UserID: user.ID}))
+		}
+		quotaErr(t, notes.Create(&models.Note{Title: "n", UserID: user.ID}), models.QuotaNotes)
+		assert.EqualValues(t, 5, usage(t, user.ID).Notes)
+
+		assert.Nil(t, notes.Delete(large))
+		u := usage(t, user.ID)
+		assert.EqualValues(t, 4, u.Notes)
+		assert.EqualValues(t, 22, u.ContentBytes)
+		assert.ErrorIs(t, notes.Delete(large), models.ErrNotFound)
+		assert.EqualValues(t, 4, usage(t, user.ID).Notes, "deleting twice doesn't count twice")
+
+		assert.Nil(t, notes.Restore(&models.Note{Model: models.Model{ID: large.ID}, UserID: user.ID}))
+		u = usage(t, user.ID)
+		assert.EqualValues(t, 5, u.Notes)
+		assert.EqualValues(t, 62, u.ContentBytes)
+		assert.Nil(t, notes.Delete(large))
+		filler := &models.Note{Title: "n", UserID: user.ID}
+		assert.Nil(t, notes.Create(filler))
+		quotaErr(t, notes.Restore(&models.Note{Model: models.Model{ID: large.ID}, UserID: user.ID}), models.QuotaNotes)
+		assert.Nil(t, notes.Delete(filler))
+		assert.Equal(t, models.Usage{UserID: user.ID, Notes: 4, ContentBytes: 22}, stripTime(usage(t, user.ID)))
+	})
+
+	t.Run("counts_the_attachments", func(t *testing.T) {
+		att := &models.Attachment{NoteID: note.ID, UserID: user.ID, Filename: "a.txt", Size: 6, StorageKey: "a"}
+		assert.Nil(t, atts.Create(att))
+		quotaErr(t, atts.Create(&models.Attachment{NoteID: note.ID, UserID: user.ID, Filename: "b.txt", Size: 5, StorageKey: "b"}),
+			models.QuotaAttachmentBytes)
+		assert.EqualValues(t, 6, usage(t, user.ID).AttachmentBytes)
+
+		assert.Nil(t, atts.Delete(att))
+		assert.ErrorIs(t, atts.Delete(att), models.ErrNotFound)
+		assert.Zero(t, usage(t, user.ID).AttachmentBytes)
+	})
+
+	t.Run("the_users_get_the_quota_of_their_plan", func(t *testing.T) {
+		pro := createUser(t, stores, "pro@email.com")
+		assert.Nil(t, stores.Users.SetPlan(pro, "pro"))
+		large := &models.Note{Title: strings.Repeat("a", 80), UserID: pro.ID}
+		assert.Nil(t, notes.Create(large))
+		for i := 0; i < 9; i++ {
+			assert.Nil(t, notes.Create(&models.Note{Title: "n", UserID: pro.ID}))
+		}
+		quotaErr(t, notes.Create(&models.Note{Title: "n", UserID: pro.ID}), models.QuotaNotes)
+
+		assert.Nil(t, stores.Users.SetPlan(pro, "unknown"))
+		large.Title += "a"
+		quotaErr(t, notes.Update(large), models.QuotaNoteSize)
+	})
+
+	t.Run("stays_correct_under_concurrent_changes", func(t *testing.T) {
+		owner := createUser(t, stores, "concurrent@email.com")
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var created []*models.Note
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n := &models.Note{Title: "note", UserID: owner.ID}
+				if err := notes.Create(n); err == nil {
+					mu.Lock()
+					created = append(created, n)
+					mu.Unlock()
+				} else if !errors.Is(err, models.ErrQuotaExceeded) {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, created, 5)
+		assert.Equal(t, models.Usage{UserID: owner.ID, Notes: 5, ContentBytes: 20}, stripTime(usage(t, owner.ID)))
+
+		// every note is deleted twice at the same time, only one of the deletes counts.
+		for _, n := range append(created, created...) {
+			wg.Add(1)
+			go func(n models.Note) {
+				defer wg.Done()
+				if err := notes.Delete(&n); err != nil && !errors.Is(err, models.ErrNotFound) {
+					t.Error(err)
+				}
+			}(*n)
+		}
+		wg.Wait()
+		assert.Equal(t, models.Usage{UserID: owner.ID}, stripTime(usage(t, owner.ID)))
+	})
+}
+
+func testReminders(t *testing.T, stores *models.Stores) {
+	rems := stores.Reminders
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+	createNote := func(userID string) *models.Note {
+		t.Helper()
+		note := &models.Note{Title: "note", UserID: userID}
+		if err := stores.Notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	note, second, deleted, othersNote := createNote(user.ID), createNote(user.ID), createNote(user.ID), createNote(other.ID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	set := func(note *models.Note, next time.Time) *models.Reminder {
+		t.Helper()
+		rem := &models.Reminder{
+			NoteID: note.ID, UserID: note.UserID, At: next, Timezone: "UTC", Channel: models.ChannelEmail, NextAt: &next,
+		}
+		if err := rems.Set(rem); err != nil {
+			t.Fatal(err)
+		}
+		return rem
+	}
+	first := set(note, now.Add(time.Hour))
+
+	t.Run("set_creates_the_reminder", func(t *testing.T) {
+		assert.True(t, validID(first.ID))
+		found, err := rems.FindForNote(note.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, first.ID, found.ID)
+			assert.True(t, now.Add(time.Hour).Equal(*found.NextAt))
+			assert.Equal(t, models.ChannelEmail, found.Channel)
+		}
+
+		_, err = rems.FindForNote(note.ID, other.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = rems.FindForNote("not an id", user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("set_replaces_the_note_reminder", func(t *testing.T) {
+		replaced := set(note, now.Add(2*time.Hour))
+		assert.Equal(t, first.ID, replaced.ID)
+		found, _ := rems.FindForNote(note.ID, user.ID)
+		assert.True(t, now.Add(2*time.Hour).Equal(*found.NextAt))
+	})
+
+	set(second, now.Add(30*time.Minute))
+	set(deleted, now.Add(10*time.Minute))
+	set(othersNote, now.Add(10*time.Minute))
+	if err := stores.Notes.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("upcoming_lists_the_soonest_first", func(t *testing.T) {
+		found, err := rems.Upcoming(user.ID, now.Add(3*time.Hour), 10)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{second.ID, note.ID}, reminderNoteIDs(found))
+
+		found, _ = rems.Upcoming(user.ID, now.Add(time.Hour), 10)
+		assert.Equal(t, []string{second.ID}, reminderNoteIDs(found))
+		found, _ = rems.Upcoming(user.ID, now.Add(3*time.Hour), 1)
+		assert.Len(t, found, 1)
+	})
+
+	t.Run("claims_the_due_reminders_once", func(t *testing.T) {
+		_, err := rems.Claim(now, time.Minute)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+
+		later := now.Add(3 * time.Hour)
+		var claimed []*models.Due
+		var noteIDs []string
+		for len(claimed) < 5 {
+			due, err := rems.Claim(later, time.Minute)
+			if err != nil {
+				assert.ErrorIs(t, err, models.ErrNotFound)
+				break
+			}
+			assert.NotNil(t, due.Reminder.ClaimedUntil)
+			claimed = append(claimed, due)
+			noteIDs = append(noteIDs, due.Note.ID)
+		}
+		assert.Equal(t, []string{othersNote.ID, second.ID, note.ID}, noteIDs,
+			"the reminders due the longest are claimed first and the deleted notes are skipped")
+		if len(claimed) != 3 {
+			return
+		}
+		assert.Equal(t, other.Email, claimed[0].User.Email)
+
+		again, err := rems.Claim(later.Add(time.Minute), time.Minute)
+		if !assert.Nil(t, err, "the expired claims can be claimed again") {
+			return
+		}
+		assert.Equal(t, othersNote.ID, again.Note.ID)
+
+		rem := claimed[0].Reminder
+		until := *rem.ClaimedUntil
+		rem.Advance(later, nil)
+		assert.ErrorIs(t, rems.Complete(rem, until), models.ErrNotFound, "the claim was lost")
+
+		rem = again.Reminder
+		until = *rem.ClaimedUntil
+		rem.Advance(later, nil)
+		assert.Nil(t, rems.Complete(rem, until))
+		found, _ := rems.FindForNote(othersNote.ID, other.ID)
+		assert.Nil(t, found.NextAt, "the one time reminder is done")
+		assert.NotNil(t, found.LastFiredAt)
+		assert.Nil(t, found.ClaimedUntil)
+
+		set(note, now.Add(4*time.Hour))
+		rem = claimed[2].Reminder
+		assert.ErrorIs(t, rems.Complete(rem, *rem.ClaimedUntil), models.ErrNotFound, "setting the reminder releases the claim")
+	})
+
+	t.Run("concurrent_claims_get_different_reminders", func(t *testing.T) {
+		owner := createUser(t, stores, "concurrent@email.com")
+		for i := 0; i < 5; i++ {
+			set(createNote(owner.ID), now.Add(-time.Duration(i)*time.Minute))
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		claimed := map[string]int{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				due, err := rems.Claim(now, time.Minute)
+				if err != nil {
+					if !errors.Is(err, models.ErrNotFound) {
+						t.Error(err)
+					}
+					return
+				}
+				mu.Lock()
+				claimed[due.Reminder.ID]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, claimed, 5)
+		for id, n := range claimed {
+			assert.Equal(t, 1, n, id)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, rems.DeleteForNote(note.ID, user.ID))
+		_, err := rems.FindForNote(note.ID, user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		assert.ErrorIs(t, rems.DeleteForNote(note.ID, user.ID), models.ErrNotFound)
+		assert.ErrorIs(t, rems.DeleteForNote(othersNote.ID, user.ID), models.ErrNotFound)
+	})
+}
+
+func testChecklists(t *testing.T, stores *models.Stores) {
+	checklists := stores.Checklists
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+	note := &models.Note{Title: "groceries", UserID: user.ID}
+	othersNote := &models.Note{Title: "note", UserID: other.ID}
+	for _, n := range []*models.Note{note, othersNote} {
+		if err := stores.Notes.Create(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add := func(text string, position int) *models.ChecklistItem {
+		t.Helper()
+		item := &models.ChecklistItem{NoteID: note.ID, UserID: user.ID, Text: text}
+		if err := checklists.Add(item, position); err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+	milk, eggs := add("milk", -1), add("eggs", -1)
+	bread := add("bread", 0)
+	butter := add("butter", 2)
+
+	t.Run("add_inserts_at_the_position", func(t *testing.T) {
+		assert.True(t, validID(milk.ID))
+		assert.Equal(t, 0, bread.Position)
+		assert.Equal(t, 2, butter.Position)
+		items, err := checklists.ListForNote(note.ID, user.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{bread.ID, milk.ID, butter.ID, eggs.ID}, checklistIDs(items))
+		assert.Equal(t, []int{0, 1, 2, 3}, checklistPositions(items))
+
+		items, _ = checklists.ListForNote(note.ID, other.ID)
+		assert.Empty(t, items)
+	})
+
+	t.Run("add_checks_the_note_owner", func(t *testing.T) {
+		item := &models.ChecklistItem{NoteID: note.ID, UserID: other.ID, Text: "milk"}
+		assert.ErrorIs(t, checklists.Add(item, 0), models.ErrNotFound)
+		item.NoteID = "not an id"
+		assert.ErrorIs(t, checklists.Add(item, 0), models.ErrNotFound)
+	})
+
+	t.Run("update_checks_the_items", func(t *testing.T) {
+		milk.Done = true
+		milk.Text = "oat milk"
+		assert.Nil(t, checklists.Update(milk))
+		found, err := checklists.FindForNote(milk.ID, note.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.True(t, found.Done)
+			assert.Equal(t, "oat milk", found.Text)
+			assert.Equal(t, 1, found.Position)
+		}
+
+		stolen := *milk
+		stolen.UserID = other.ID
+		assert.ErrorIs(t, checklists.Update(&stolen), models.ErrNotFound)
+		_, err = checklists.FindForNote(milk.ID, othersNote.ID, other.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		items, err := checklists.Reorder(note.ID, user.ID, []string{eggs.ID, milk.ID, bread.ID, butter.ID})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{eggs.ID, milk.ID, bread.ID, butter.ID}, checklistIDs(items))
+		items, _ = checklists.ListForNote(note.ID, user.ID)
+		assert.Equal(t, []string{eggs.ID, milk.ID, bread.ID, butter.ID}, checklistIDs(items))
+		assert.Equal(t, []int{0, 1, 2, 3}, checklistPositions(items))
+
+		for _, ids := range [][]string{
+			{eggs.ID, milk.ID, bread.ID},
+			{eggs.ID, milk.ID, bread.ID, bread.ID},
+			{eggs.ID, milk.ID, bread.ID, uuid.NewString()},
+		} {
+			_, err := checklists.Reorder(note.ID, user.ID, ids)
+			assert.ErrorIs(t, err, models.ErrChecklistOrder)
+		}
+		_, err = checklists.Reorder(note.ID, other.ID, checklistIDs(items))
+		assert.ErrorIs(t, err, models.ErrNotFound)
+
+		items, _ = checklists.ListForNote(note.ID, user.ID)
+		assert.Equal(t, []string{eggs.ID, milk.ID, bread.ID, butter.ID}, checklistIDs(items), "a rejected order changes nothing")
+	})
+
+	t.Run("counts", func(t *testing.T) {
+		other := &models.ChecklistItem{NoteID: othersNote.ID, UserID: other.ID, Text: "other", Done: true}
+		if err := checklists.Add(other, 0); err != nil {
+			t.Fatal(err)
+		}
+		counts, err := checklists.Counts(user.ID, []string{note.ID, othersNote.ID, "not an id"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]models.ChecklistCount{note.ID: {Done: 1, Total: 4}}, counts)
+	})
+
+	t.Run("delete_moves_the_following_items_up", func(t *testing.T) {
+		stolen := *milk
+		stolen.UserID = other.ID
+		assert.ErrorIs(t, checklists.Delete(&stolen), models.ErrNotFound)
+
+		assert.Nil(t, checklists.Delete(milk))
+		items, _ := checklists.ListForNote(note.ID, user.ID)
+		assert.Equal(t, []string{eggs.ID, bread.ID, butter.ID}, checklistIDs(items))
+		assert.Equal(t, []int{0, 1, 2}, checklistPositions(items))
+		assert.ErrorIs(t, checklists.Delete(milk), models.ErrNotFound)
+	})
+
+	t.Run("full_checklists_are_rejected", func(t *testing.T) {
+		for i := 3; i < models.MaxChecklistItems; i++ {
+			add("item", -1)
+		}
+		item := &models.ChecklistItem{NoteID: note.ID, UserID: user.ID, Text: "one too many"}
+		assert.ErrorIs(t, checklists.Add(item, -1), models.ErrChecklistFull)
+	})
+
+	t.Run("deleted_notes_can_not_be_changed", func(t *testing.T) {
+		if err := stores.Notes.Delete(note); err != nil {
+			t.Fatal(err)
+		}
+		item := &models.ChecklistItem{NoteID: note.ID, UserID: user.ID, Text: "milk"}
+		assert.ErrorIs(t, checklists.Add(item, -1), models.ErrNotFound)
+		_, err := checklists.Reorder(note.ID, user.ID, []string{})
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+}
+
+func checklistIDs(items []models.ChecklistItem) []string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func checklistPositions(items []models.ChecklistItem) []int {
+	positions := []int{}
+	for _, item := range items {
+		positions = append(positions, item.Position)
+	}
+	return positions
+}
+
+func testImports(t *testing.T, stores *models.Stores) {
+	imports := stores.Imports
+	user := createUser(t, stores, "user@email.com")
+	other := createUser(t, stores, "other@email.com")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	create := func(userID string, createdAt time.Time) *models.ImportJob {
+		t.Helper()
+		job := &models.ImportJob{UserID: userID, Format: "enex", Status: models.ImportPending, StorageKey: "imports/key"}
+		job.CreatedAt = createdAt
+		if err := imports.Create(job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	first := create(user.ID, now.Add(-2*time.Minute))
+	second := create(other.ID, now.Add(-time.Minute))
+
+	t.Run("create_sets_the_id", func(t *testing.T) {
+		assert.True(t, validID(first.ID))
+	})
+
+	t.Run("finds_the_user_jobs", func(t *testing.T) {
+		found, err := imports.FindForUser(first.ID, user.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, models.ImportPending, found.Status)
+			assert.Equal(t, []models.ImportFailure{}, found.Failures)
+		}
+		_, err = imports.FindForUser(first.ID, other.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		_, err = imports.FindForUser("not an id", user.ID)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("claims_the_oldest_jobs_once", func(t *testing.T) {
+		claimed, err := imports.Claim(now, time.Minute)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, first.ID, claimed.ID)
+		assert.Equal(t, models.ImportRunning, claimed.Status)
+		next, err := imports.Claim(now, time.Minute)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, second.ID, next.ID)
+		_, err = imports.Claim(now, time.Minute)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+
+		again, err := imports.Claim(now.Add(time.Minute), time.Minute)
+		if !assert.Nil(t, err, "the expired claims can be claimed again") {
+			return
+		}
+		assert.Equal(t, first.ID, again.ID)
+		claimed.Processed = 1
+		assert.ErrorIs(t, imports.Update(claimed, *claimed.ClaimedUntil, nil), models.ErrNotFound, "the claim was lost")
+	})
+
+	t.Run("update_saves_the_progress_and_the_failures", func(t *testing.T) {
+		job, err := imports.Claim(now.Add(time.Hour), time.Minute)
+		if !assert.Nil(t, err) {
+			return
+		}
+		until := *job.ClaimedUntil
+		renewed := until.Add(time.Minute)
+		job.Total, job.Processed, job.Imported, job.Failed = 3, 2, 0, 2
+		job.ClaimedUntil = &renewed
+		failures := []models.ImportFailure{{Index: 1, Title: "b", Reason: "too large"}, {Index: 0, Title: "a", Reason: "invalid"}}
+		assert.Nil(t, imports.Update(job, until, failures))
+
+		finished := now.Add(time.Hour)
+		job.Status, job.Processed, job.Imported = models.ImportDone, 3, 1
+		job.ClaimedUntil, job.FinishedAt = nil, &finished
+		assert.Nil(t, imports.Update(job, renewed, nil))
+
+		found, err := imports.FindForUser(job.ID, job.UserID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, models.ImportDone, found.Status)
+			assert.Equal(t, []int{3, 3, 1, 2}, []int{found.Total, found.Processed, found.Imported, found.Failed})
+			assert.Nil(t, found.ClaimedUntil)
+			assert.True(t, finished.Equal(*found.FinishedAt))
+			if assert.Len(t, found.Failures, 2) {
+				assert.Equal(t, "a", found.Failures[0].Title)
+				assert.Equal(t, "too large", found.Failures[1].Reason)
+			}
+		}
+		_, err = imports.Claim(now.Add(2*time.Hour), time.Minute)
+		if assert.Nil(t, err) {
+			_, err = imports.Claim(now.Add(2*time.Hour), time.Minute)
+			assert.ErrorIs(t, err, models.ErrNotFound, "the finished jobs aren't claimed")
+		}
+	})
+}
+
+func testTransactions(t *testing.T, stores *models.Stores) {
+	user := createUser(t, stores, "user@email.com")
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	t.Run("commits_the_changes", func(t *testing.T) {
+		err := stores.Transaction(ctx, func(tx *models.Stores) error {
+			return tx.Notes.Create(&models.Note{Title: "committed", UserID: user.ID})
+		})
+		assert.Nil(t, err)
+		assert.Len(t, mustList(t, stores, user.ID), 1)
+	})
+
+	t.Run("rolls_back_the_changes_when_it_fails", func(t *testing.T) {
+		err := stores.Transaction(ctx, func(tx *models.Stores) error {
+			if err := tx.Notes.Create(&models.Note{Title: "rolled back", UserID: user.ID}); err != nil {
+				return err
+			}
+			assert.Len(t, mustList(t, tx, user.ID), 2, "the transaction sees its changes")
+			return errRollback
+		})
+		assert.ErrorIs(t, err, errRollback)
+		assert.Len(t, mustList(t, stores, user.ID), 1)
+		usage, _ := stores.Usage.Get(user.ID)
+		assert.EqualValues(t, 1, usage.Notes, "the usage is rolled back too")
+	})
+
+	t.Run("nested_transactions_roll_back_by_themselves", func(t *testing.T) {
+		err := stores.Transaction(ctx, func(tx *models.Stores) error {
+			if err := tx.Notes.Create(&models.Note{Title: "outer", UserID: user.ID}); err != nil {
+				return err
+			}
+			err := tx.Transaction(ctx, func(tx *models.Stores) error {
+				if err := tx.Notes.Create(&models.Note{Title: "inner", UserID: user.ID}); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			assert.ErrorIs(t, err, errRollback)
+			return nil
+		})
+		assert.Nil(t, err)
+		titles := []string{}
+		for _, note := range mustList(t, stores, user.ID) {
+			titles = append(titles, note.Title)
+		}
+		assert.ElementsMatch(t, []string{"committed", "outer"}, titles)
+	})
+}
+
+func mustList(t *testing.T, stores *models.Stores, userID string) []models.Note {
+	t.Helper()
+	notes, err := stores.Notes.ListForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notes
+}
+
+func stripTime(u models.Usage) models.Usage {
+	u.UpdatedAt = time.Time{}
+	return u
+}
+
+func validID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+func userIDs(users []models.User) []string {
+	ids := []string{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func noteIDs(notes []models.Note) []string {
+	ids := []string{}
+	for _, n := range notes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func credentialIDs(creds []models.Credential) []string {
+	ids := []string{}
+	for _, c := range creds {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func reminderNoteIDs(rems []models.Reminder) []string {
+	ids := []string{}
+	for _, r := range rems {
+		ids = append(ids, r.NoteID)
+	}
+	return ids
+}
+
+func attachmentIDs(atts []models.Attachment) []string {
+	ids := []string{}
+	for _, a := range atts {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/msal4/toastnotes/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The resources limited by the quota.
+const (
+	QuotaNotes           = "notes"
+	QuotaContentBytes    = "contentBytes"
+	QuotaAttachmentBytes = "attachmentBytes"
+	QuotaNoteSize        = "noteSize"
+)
+
+// ErrQuotaExceeded is matched by the *QuotaError returned when a change would exceed the user quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Usage is what a user stores, the deleted notes don't count. It's kept up to date by the note and attachment stores
+// in the same transaction as the changes.
+type Usage struct {
+	UserID          string    `json:"-" gorm:"type:uuid;primaryKey"`
+	Notes           int64     `json:"notes"`
+	ContentBytes    int64     `json:"contentBytes"`
+	AttachmentBytes int64     `json:"attachmentBytes"`
+	UpdatedAt       time.Time `json:"-"`
+}
+
+// Quota limits what each user can store, the zero limits are unlimited.
+type Quota struct {
+	MaxNotes           int64
+	MaxContentBytes    int64
+	MaxAttachmentBytes int64
+	// MaxNoteSize is the maximum size of a single note, see NoteSize.
+	MaxNoteSize int64
+}
+
+// Quotas holds the quotas of the plans, the users without a plan or on an unknown one get the default quota.
+type Quotas struct {
+	Default Quota
+	Plans   map[string]Quota
+}
+
+// NewQuotas creates the quotas of the configured limits and plans.
+func NewQuotas(cfg config.Quota) Quotas {
+	quotas := Quotas{Default: Quota{
+		MaxNotes:           int64(cfg.MaxNotes),
+		MaxContentBytes:    int64(cfg.MaxContentBytes),
+		MaxAttachmentBytes: int64(cfg.MaxAttachmentBytes),
+		MaxNoteSize:        int64(cfg.MaxNoteSize),
+	}}
+	if len(cfg.Plans) > 0 {
+		quotas.Plans = map[string]Quota{}
+	}
+	for name, plan := range cfg.Plans {
+		quotas.Plans[name] = Quota{
+			MaxNotes:           int64(plan.MaxNotes),
+			MaxContentBytes:    int64(plan.MaxContentBytes),
+			MaxAttachmentBytes: int64(plan.MaxAttachmentBytes),
+			MaxNoteSize:        int64(plan.MaxNoteSize),
+		}
+	}
+	return quotas
+}
+
+// For returns the quota of the plan.
+func (q Quotas) For(plan string) Quota {
+	if quota, ok := q.Plans[plan]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+// QuotaError describes the exceeded limit.
+type QuotaError struct {
+	Resource string
+	Limit    int64
+	// Used is the current usage of the resource and Requested is how much more was requested.
+	Used      int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d used, %d more requested", e.Resource, e.Used, e.Limit, e.Requested)
+}
+
+// Message describes the exceeded limit to the user.
+func (e *QuotaError) Message() string {
+	switch e.Resource {
+	case QuotaNotes:
+		return fmt.Sprintf("You have reached the limit of %d notes", e.Limit)
+	case QuotaContentBytes:
+		return fmt.Sprintf("Your notes would exceed the limit of %d bytes of content", e.Limit)
+	case QuotaAttachmentBytes:
+		return fmt.Sprintf("Your attachments would exceed the limit of %d bytes", e.Limit)
+	case QuotaNoteSize:
+		return fmt.Sprintf("The note is larger than the limit of %d bytes", e.Limit)
+	}
+	return "Quota exceeded"
+}
+
+// Is makes the quota errors match ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// NoteSize is the size of the note counted against the quota, the bytes of its title and content.
+func NoteSize(note *Note) int64 {
+	return int64(len(note.Title) + len(note.Content))
+}
+
+// Check returns a *QuotaError if adding delta to usage exceeds the quota, the decreases are always allowed even if
+// the usage is over the quota.
+func (q Quota) Check(usage Usage, delta Usage) error {
+	limits := []struct {
+		resource     string
+		limit        int64
+		used, change int64
+	}{
+		{QuotaNotes, q.MaxNotes, usage.Notes, delta.Notes},
+		{QuotaContentBytes, q.MaxContentBytes, usage.ContentBytes, delta.ContentBytes},
+		{QuotaAttachmentBytes, q.MaxAttachmentBytes, usage.AttachmentBytes, delta.AttachmentBytes},
+	}
+	for _, l := range limits {
+		if l.limit > 0 && l.change > 0 && l.used+l.change > l.limit {
+			return &QuotaError{Resource: l.resource, Limit: l.limit, Used: l.used, Requested: l.change}
+		}
+	}
+	return nil
+}
+
+// CheckNote returns a *QuotaError if the note is larger than the maximum note size.
+func (q Quota) CheckNote(note *Note) error {
+	if size := NoteSize(note); q.MaxNoteSize > 0 && size > q.MaxNoteSize {
+		return &QuotaError{Resource: QuotaNoteSize, Limit: q.MaxNoteSize, Requested: size}
+	}
+	return nil
+}
+
+// UsageRepository holds the usage actions.
+type UsageRepository struct {
+	*Repository
+}
+
+// NewUsageRepository creates a new usage repo.
+func NewUsageRepository(db *gorm.DB) *UsageRepository {
+	return &UsageRepository{Repository: &Repository{DB: db}}
+}
+
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *UsageRepository) WithContext(ctx context.Context) UsageStore {
+	return NewUsageRepository(rep.DB.WithContext(ctx))
+}
+
+// Get gets the usage of the user, it's zero if they haven't stored anything yet.
+func (rep *UsageRepository) Get(userID string) (*Usage, error) {
+	usage := &Usage{UserID: userID}
+	if !validID(userID) {
+		return usage, nil
+	}
+	err := rep.DB.First(usage, "user_id = ?", userID).Error
+	if errors.Is(err, ErrNotFound) {
+		return &Usage{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// lockUsage returns the usage of the user and locks it until the transaction ends, so that the concurrent changes of
+// the user usage wait for each other. The stores lock it before the changed records to avoid deadlocks.
+func lockUsage(tx *gorm.DB, userID string) (*Usage, error) {
+	now := tx.NowFunc()
+	usage := &Usage{UserID: userID, UpdatedAt: now}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(usage).Error; err != nil {
+		return nil, err
+	}
+	// inserting a missing row locks it but an existing one has to be updated to be locked.
+	if err := tx.Model(&Usage{}).Where("user_id = ?", userID).Update("updated_at", now).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.First(usage, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// addUsage adds delta to the locked usage of the user.
+func addUsage(tx *gorm.DB, userID string, delta Usage) error {
+	return tx.Model(&Usage{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"notes":            gorm.Expr("notes + ?", delta.Notes),
+		"content_bytes":    gorm.Expr("content_bytes + ?", delta.ContentBytes),
+		"attachment_bytes": gorm.Expr("attachment_bytes + ?", delta.AttachmentBytes),
+	}).Error
+}
+
+// quotaOf returns the quota of the plan of the user, the plan is only looked up when there are plans.
+func quotaOf(tx *gorm.DB, quotas Quotas, userID string) (Quota, error) {
+	if len(quotas.Plans) == 0 || !validID(userID) {
+		return quotas.Default, nil
+	}
+	var user User
+	err := tx.Select("plan").First(&user, "id = ?", userID).Error
+	if errors.Is(err, ErrNotFound) {
+		return quotas.Default, nil
+	}
+	if err != nil {
+		return Quota{}, err
+	}
+	return quotas.For(user.Plan), nil
+}
+
+// chargeUsage adds delta to the usage of the user if it stays within the quota.
+func chargeUsage(tx *gorm.DB, userID string, quota Quota, delta Usage) error {
+	usage, err := lockUsage(tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := quota.Check(*usage, delta); err != nil {
+		return err
+	}
+	return addUsage(tx, userID, delta)
+}
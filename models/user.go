@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/msal4/toastnotes/auth"
 	"gorm.io/gorm"
@@ -11,11 +13,20 @@ import (
 // User is the model representing standard users.
 type User struct {
 	Model
-	Name         string `json:"name"`
-	Email        string `json:"email" gorm:"unique"`
-	Password     string `json:"-"`
-	TokenVersion int    `json:"-" gorm:"default:0"`
-	Notes        []Note `json:"-"`
+	Name         string     `json:"name"`
+	Email        string     `json:"email" gorm:"unique"`
+	Password     string     `json:"-"`
+	TokenVersion int        `json:"-" gorm:"default:0"`
+	DisabledAt   *time.Time `json:"-"`
+	// Plan is the quota plan of the user, see Quotas.
+	Plan        string       `json:"plan"`
+	Notes       []Note       `json:"-"`
+	Credentials []Credential `json:"-"`
+}
+
+// Disabled reports whether the user has been disabled by an operator, disabled users can't log in.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
 }
 
 // UserRepository holds all the database operations related to the user.
@@ -28,6 +39,16 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{Repository: &Repository{DB: db}}
 }
 
+// WithContext returns a copy of the repository that runs its queries with ctx.
+func (rep *UserRepository) WithContext(ctx context.Context) UserStore {
+	return NewUserRepository(rep.DB.WithContext(ctx))
+}
+
+// Create creates the user.
+func (rep *UserRepository) Create(user *User) error {
+	return rep.DB.Create(user).Error
+}
+
 // RegisterUser creates a new user record using a SignUpForm.
 func (rep *UserRepository) RegisterUser(data auth.RegisterForm) (*User, error) {
 	password, err := auth.HashPassword(data.Password)
@@ -44,6 +65,10 @@ func (rep *UserRepository) RegisterUser(data auth.RegisterForm) (*User, error) {
 
 // RetrieveUser finds the user with the given id.
 func (rep *UserRepository) RetrieveUser(id string) (*User, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
 	var user User
 	if err := rep.FindByID(&user, id); err != nil {
 		return nil, err
@@ -51,9 +76,58 @@ func (rep *UserRepository) RetrieveUser(id string) (*User, error) {
 	return &user, nil
 }
 
+// FindMany finds the users with the given ids, missing users are skipped.
+func (rep *UserRepository) FindMany(ids []string) ([]User, error) {
+	users := []User{}
+	ids = validIDs(ids)
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := rep.DB.Find(&users, "id IN ?", ids).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // EmailTaken check if a user has already registered with the given email.
 func (rep *UserRepository) EmailTaken(email string) bool {
 	err := rep.DB.First(&User{}, "email = ?", email).Error
 
 	return !errors.Is(err, gorm.ErrRecordNotFound)
 }
+
+// FindByEmail finds the user with the given email.
+func (rep *UserRepository) FindByEmail(email string) (*User, error) {
+	var user User
+	if err := rep.DB.First(&user, "email = ?", email).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetPassword hashes and sets the user password and bumps the token version to revoke the user refresh tokens.
+func (rep *UserRepository) SetPassword(user *User, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return rep.DB.Model(user).Updates(User{Password: hash, TokenVersion: user.TokenVersion + 1}).Error
+}
+
+// SetPlan puts the user on the quota plan, the empty plan is the default quota.
+func (rep *UserRepository) SetPlan(user *User, plan string) error {
+	return rep.DB.Model(user).Update("plan", plan).Error
+}
+
+// SetDisabled disables or re-enables the user, disabling also bumps the token version to revoke the user refresh
+// tokens.
+func (rep *UserRepository) SetDisabled(user *User, disabled bool) error {
+	updates := map[string]interface{}{"disabled_at": nil}
+	if disabled {
+		updates["disabled_at"] = time.Now()
+		updates["token_version"] = user.TokenVersion + 1
+	}
+
+	return rep.DB.Model(user).Updates(updates).Error
+}
@@ -0,0 +1,355 @@
+// Package openapi builds OpenAPI 3 documents with schemas derived from the Go types of the request and response
+// bodies.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// defined holds the component names of the defined types.
+	defined map[reflect.Type]string
+}
+
+// Info describes the api.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a server the api is served from.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations in the docs.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path by their lowercase method.
+type PathItem map[string]*Operation
+
+// Operation describes a single api operation.
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query, header or cookie parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable schemas and the security schemes.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests are authenticated.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is a JSON schema.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// New creates an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+		defined: map[reflect.Type]string{},
+	}
+}
+
+// Define registers the schema of v's type as a component and returns a reference to it, the fields of the types
+// defined before it are references as well.
+func (d *Document) Define(name string, v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	d.Components.Schemas[name] = schemaOf(t, d.defined)
+	d.defined[t] = name
+	return Ref(name)
+}
+
+// Ref references the component schema with the given name.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ArrayOf creates an array schema of the given items.
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+var ginParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// Path converts a gin route path to an OpenAPI path (e.g. /notes/:id to /notes/{id}).
+func Path(route string) string {
+	return ginParam.ReplaceAllString(route, "{$1}")
+}
+
+// Add adds the operation of the gin route, the path parameters are added if they're not defined already.
+func (d *Document) Add(method, route string, op *Operation) {
+	for _, m := range ginParam.FindAllStringSubmatch(route, -1) {
+		defined := false
+		for _, p := range op.Parameters {
+			defined = defined || (p.In == "path" && p.Name == m[1])
+		}
+		if !defined {
+			op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	path := Path(route)
+	if d.Paths[path] == nil {
+		d.Paths[path] = PathItem{}
+	}
+	d.Paths[path][strings.ToLower(method)] = op
+}
+
+// Operation finds the operation of the gin route.
+func (d *Document) Operation(method, route string) *Operation {
+	return d.Paths[Path(route)][strings.ToLower(method)]
+}
+
+// Handler serves the document as json.
+func (d *Document) Handler() http.Handler {
+	body, err := json.Marshal(d)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// JSON is a json body with the given schema.
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf derives the schema of v's type from its json and binding tags, embedded structs are flattened.
+func SchemaOf(v interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(v), nil)
+}
+
+func schemaOf(t reflect.Type, defined map[reflect.Type]string) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := schemaOf(t.Elem(), defined)
+		s.Nullable = true
+		return s
+	}
+	if name, ok := defined[t]; ok {
+		return Ref(name)
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(schemaOf(t.Elem(), defined))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), defined)}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t, defined)
+		return s
+	}
+
+	// interfaces and the other kinds can be anything.
+	return &Schema{}
+}
+
+func addFields(s *Schema, t reflect.Type, defined map[reflect.Type]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("json"))
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, defined)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := schemaOf(f.Type, defined)
+		if applyBinding(fs, f.Tag.Get("binding")) && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+func parseTag(tag string) (name, opts string) {
+	parts := strings.SplitN(tag, ",", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// applyBinding adds the validation rules of the binding tag to the schema, it reports whether the field is required.
+func applyBinding(s *Schema, tag string) (required bool) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		n, _ := strconv.Atoi(param)
+
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		case "min", "max":
+			switch s.Type {
+			case "string":
+				if name == "min" {
+					s.MinLength = &n
+				} else {
+					s.MaxLength = &n
+				}
+			case "integer", "number":
+				f := float64(n)
+				if name == "min" {
+					s.Minimum = &f
+				} else {
+					s.Maximum = &f
+				}
+			}
+		}
+	}
+	return required
+}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>%s</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: %q, dom_id: "#docs", withCredentials: true });
+  </script>
+</body>
+</html>
+`
+
+// DocsHandler serves a Swagger UI page rendering the document at specURL.
+func DocsHandler(title, specURL string) http.Handler {
+	page := fmt.Sprintf(docsPage, html.EscapeString(title), specURL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+}
@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type item struct {
+	base
+	Name     string     `json:"name" binding:"required,max=64"`
+	Email    string     `json:"email,omitempty" binding:"email"`
+	Count    int        `json:"count" binding:"min=1"`
+	Secret   string     `json:"-"`
+	Tags     []string   `json:"tags"`
+	Data     []byte     `json:"data"`
+	Deleted  *time.Time `json:"deleted"`
+	internal string
+}
+
+type list struct {
+	Result []item `json:"result"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(item{})
+
+	assert.Equal(t, "object", s.Type)
+	assert.ElementsMatch(t, []string{"id", "createdAt", "name", "email", "count", "tags", "data", "deleted"}, keys(s.Properties))
+	assert.Equal(t, []string{"name"}, s.Required)
+
+	assert.Equal(t, "date-time", s.Properties["createdAt"].Format)
+	assert.Equal(t, 64, *s.Properties["name"].MaxLength)
+	assert.Equal(t, "email", s.Properties["email"].Format)
+	assert.Equal(t, 1.0, *s.Properties["count"].Minimum)
+	assert.Equal(t, "string", s.Properties["tags"].Items.Type)
+	assert.Equal(t, "byte", s.Properties["data"].Format)
+	assert.True(t, s.Properties["deleted"].Nullable)
+}
+
+func TestDocument(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	ref := doc.Define("Item", item{})
+	doc.Define("List", list{})
+
+	t.Run("references_defined_types", func(t *testing.T) {
+		assert.Equal(t, "#/components/schemas/Item", ref.Ref)
+		assert.Equal(t, ref, doc.Components.Schemas["List"].Properties["result"].Items)
+	})
+
+	t.Run("converts_gin_paths", func(t *testing.T) {
+		doc.Add(http.MethodGet, "/items/:id/files/*path", &Operation{Responses: map[string]*Response{"200": {Description: "ok"}}})
+
+		op := doc.Operation(http.MethodGet, "/items/:id/files/*path")
+		if assert.NotNil(t, op) {
+			assert.Len(t, op.Parameters, 2)
+			assert.Equal(t, "id", op.Parameters[0].Name)
+			assert.Equal(t, "path", op.Parameters[0].In)
+		}
+		assert.Contains(t, doc.Paths, "/items/{id}/files/{path}")
+		assert.Nil(t, doc.Operation(http.MethodPost, "/items/:id/files/*path"))
+	})
+
+	t.Run("serves_the_document", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		doc.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		served := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &served))
+		assert.Equal(t, Version, served["openapi"])
+	})
+}
+
+func keys(m map[string]*Schema) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+// Package reminder delivers the due note reminders, the scheduler claims them from the store and delivers them
+// through the channel of each reminder.
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/mail"
+	"github.com/msal4/toastnotes/models"
+)
+
+// maxExcerpt is the maximum length of the note content included in the reminder emails in bytes.
+const maxExcerpt = 500
+
+// ErrPrivateAddress is returned when a webhook resolves to a private, loopback or link local address and those
+// aren't allowed.
+var ErrPrivateAddress = errors.New("the webhook address is not public")
+
+// Channel delivers the reminders.
+type Channel interface {
+	// Deliver delivers the due reminder, an error means it should be retried.
+	Deliver(ctx context.Context, due *models.Due) error
+}
+
+// Email delivers the reminders by emailing the users.
+type Email struct {
+	Mailer mail.Mailer
+}
+
+// Deliver emails the reminder to the user.
+func (e *Email) Deliver(ctx context.Context, due *models.Due) error {
+	body := fmt.Sprintf("Hi %s,\n\nThis is your reminder of the note %q.\n", due.User.Name, due.Note.Title)
+	if excerpt := excerpt(due.Note.Content); excerpt != "" {
+		body += "\n" + excerpt + "\n"
+	}
+	return e.Mailer.Send(mail.Message{To: due.User.Email, Subject: "Reminder: " + due.Note.Title, Body: body})
+}
+
+// excerpt returns the start of the content, cut at a rune boundary.
+func excerpt(content string) string {
+	if len(content) <= maxExcerpt {
+		return content
+	}
+	cut := maxExcerpt
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + "…"
+}
+
+// WebhookPayload is the body posted to the reminder webhooks.
+type WebhookPayload struct {
+	Event    string           `json:"event"`
+	FiredAt  time.Time        `json:"firedAt"`
+	Reminder *models.Reminder `json:"reminder"`
+	Note     *models.Note     `json:"note"`
+}
+
+// Webhook delivers the reminders by posting a WebhookPayload to their webhook url. The bodies are signed with
+// HMAC-SHA256 using Secret in the X-Toastnotes-Signature header, "sha256=" followed by the hex encoded signature, so
+// that the receivers can check where they come from. The X-Toastnotes-Delivery header identifies the delivery, it's
+// the same if a delivery is repeated because its scheduler stopped before saving it.
+type Webhook struct {
+	Client *http.Client
+	Secret string
+}
+
+// NewWebhook creates the webhook channel, the requests to the private addresses fail unless they're allowed and the
+// redirects aren't followed.
+func NewWebhook(cfg config.Reminders) *Webhook {
+	dialer := &net.Dialer{Timeout: cfg.WebhookTimeout}
+	if !cfg.WebhookAllowPrivate {
+		// the resolved addresses are checked so that a public name can't resolve to a private address.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &Webhook{
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.WebhookTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Secret: cfg.WebhookSecret,
+	}
+}
+
+func public(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// Deliver posts the reminder to its webhook, the responses other than 2xx are failures.
+func (w *Webhook) Deliver(ctx context.Context, due *models.Due) error {
+	rem := due.Reminder
+	if rem.WebhookURL == "" {
+		return errors.New("the reminder has no webhook url")
+	}
+
+	body, err := json.Marshal(WebhookPayload{Event: "reminder", FiredAt: time.Now().UTC(), Reminder: rem, Note: due.Note})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rem.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "toastnotes-reminders")
+	req.Header.Set("X-Toastnotes-Event", "reminder")
+	if rem.NextAt != nil {
+		req.Header.Set("X-Toastnotes-Delivery", fmt.Sprintf("%s-%d", rem.ID, rem.NextAt.Unix()))
+	}
+	if w.Secret != "" {
+		req.Header.Set("X-Toastnotes-Signature", "sha256="+Sign(w.Secret, body))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
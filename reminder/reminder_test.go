@@ -0,0 +1,183 @@
+package reminder_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/mail"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/memory"
+	"github.com/msal4/toastnotes/reminder"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup(t *testing.T) (*models.Stores, *models.User) {
+	t.Helper()
+	stores := memory.NewStores()
+	user := &models.User{Name: "Mock User", Email: "user@email.com"}
+	if err := stores.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return stores, user
+}
+
+func setReminder(t *testing.T, stores *models.Stores, rem *models.Reminder, now time.Time) *models.Reminder {
+	t.Helper()
+	note := &models.Note{Title: "Water the plants", Content: "the ones on the balcony", UserID: rem.UserID}
+	if err := stores.Notes.Create(note); err != nil {
+		t.Fatal(err)
+	}
+	rem.NoteID = note.ID
+	if rem.Timezone == "" {
+		rem.Timezone = "UTC"
+	}
+	if err := rem.Schedule(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Reminders.Set(rem); err != nil {
+		t.Fatal(err)
+	}
+	return rem
+}
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	t.Run("delivers_the_due_reminders_once", func(t *testing.T) {
+		stores, user := setup(t)
+		mailer := &mail.MemoryMailer{}
+		once := setReminder(t, stores, &models.Reminder{UserID: user.ID, At: now.Add(time.Minute), Channel: models.ChannelEmail}, now)
+		daily := setReminder(t, stores, &models.Reminder{
+			UserID: user.ID, At: now.Add(2 * time.Minute), Recurrence: "FREQ=DAILY", Channel: models.ChannelEmail,
+		}, now)
+		setReminder(t, stores, &models.Reminder{UserID: user.ID, At: now.Add(time.Hour), Channel: models.ChannelEmail}, now)
+
+		// the schedulers of several instances run at the same time.
+		var delivered int64
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s := reminder.NewScheduler(stores.Reminders, map[string]reminder.Channel{models.ChannelEmail: &reminder.Email{Mailer: mailer}})
+				s.Now = func() time.Time { return now.Add(5 * time.Minute) }
+				atomic.AddInt64(&delivered, int64(s.Run(context.Background())))
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 2, delivered)
+		msgs := mailer.Messages()
+		if assert.Len(t, msgs, 2) {
+			assert.Equal(t, user.Email, msgs[0].To)
+			assert.Equal(t, "Reminder: Water the plants", msgs[0].Subject)
+			assert.Contains(t, msgs[0].Body, "the ones on the balcony")
+		}
+
+		found, _ := stores.Reminders.FindForNote(once.NoteID, user.ID)
+		assert.Nil(t, found.NextAt)
+		assert.True(t, now.Add(5*time.Minute).Equal(*found.LastFiredAt))
+		found, _ = stores.Reminders.FindForNote(daily.NoteID, user.ID)
+		assert.True(t, now.Add(24*time.Hour+2*time.Minute).Equal(*found.NextAt), "the recurring reminder is rescheduled")
+	})
+
+	t.Run("retries_the_failed_deliveries", func(t *testing.T) {
+		stores, user := setup(t)
+		var calls int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		rem := setReminder(t, stores, &models.Reminder{
+			UserID: user.ID, At: now.Add(time.Minute), Recurrence: "FREQ=DAILY", Channel: models.ChannelWebhook, WebhookURL: srv.URL,
+		}, now)
+		webhook := reminder.NewWebhook(config.Reminders{WebhookTimeout: time.Second, WebhookAllowPrivate: true})
+		s := reminder.NewScheduler(stores.Reminders, map[string]reminder.Channel{models.ChannelWebhook: webhook})
+
+		at := now.Add(time.Minute)
+		for attempt := 1; attempt < models.MaxReminderAttempts; attempt++ {
+			s.Now = func() time.Time { return at }
+			assert.Zero(t, s.Run(context.Background()))
+			found, _ := stores.Reminders.FindForNote(rem.NoteID, user.ID)
+			assert.Equal(t, attempt, found.Attempts)
+			assert.Contains(t, found.LastError, "503")
+			retry := at.Add(models.ReminderRetryDelay << (attempt - 1))
+			assert.True(t, retry.Equal(*found.NextAt), "the retries back off")
+			at = retry
+		}
+
+		s.Now = func() time.Time { return at }
+		s.Run(context.Background())
+		found, _ := stores.Reminders.FindForNote(rem.NoteID, user.ID)
+		assert.Zero(t, found.Attempts)
+		assert.Nil(t, found.LastFiredAt)
+		assert.True(t, now.Add(24*time.Hour+time.Minute).Equal(*found.NextAt), "the occurrence is skipped after the last attempt")
+		assert.EqualValues(t, models.MaxReminderAttempts, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("unknown_channels_fail", func(t *testing.T) {
+		stores, user := setup(t)
+		rem := setReminder(t, stores, &models.Reminder{UserID: user.ID, At: now.Add(time.Minute), Channel: "pigeon"}, now)
+		s := reminder.NewScheduler(stores.Reminders, nil)
+		s.Now = func() time.Time { return now.Add(time.Minute) }
+		assert.Zero(t, s.Run(context.Background()))
+		found, _ := stores.Reminders.FindForNote(rem.NoteID, user.ID)
+		assert.Contains(t, found.LastError, "unknown reminder channel")
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	rem := &models.Reminder{Channel: models.ChannelWebhook, Timezone: "UTC"}
+	rem.ID = "reminder-id"
+	next := time.Now().UTC()
+	rem.NextAt = &next
+	due := &models.Due{Reminder: rem, Note: &models.Note{Title: "note"}, User: &models.User{Email: "user@email.com"}}
+
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		if strings.HasSuffix(r.URL.Path, "/redirect") {
+			http.Redirect(w, r, "/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	rem.WebhookURL = srv.URL + "/hook"
+
+	t.Run("posts_the_signed_payload", func(t *testing.T) {
+		webhook := reminder.NewWebhook(config.Reminders{WebhookTimeout: time.Second, WebhookSecret: "secret", WebhookAllowPrivate: true})
+		assert.Nil(t, webhook.Deliver(context.Background(), due))
+
+		var payload reminder.WebhookPayload
+		assert.Nil(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, "reminder", payload.Event)
+		assert.Equal(t, "note", payload.Note.Title)
+		assert.Equal(t, "application/json", header.Get("Content-Type"))
+		assert.Equal(t, "sha256="+reminder.Sign("secret", body), header.Get("X-Toastnotes-Signature"))
+		assert.NotEmpty(t, header.Get("X-Toastnotes-Delivery"))
+	})
+
+	t.Run("redirects_are_failures", func(t *testing.T) {
+		webhook := reminder.NewWebhook(config.Reminders{WebhookTimeout: time.Second, WebhookAllowPrivate: true})
+		redirected := *rem
+		redirected.WebhookURL = srv.URL + "/redirect"
+		assert.Error(t, webhook.Deliver(context.Background(), &models.Due{Reminder: &redirected, Note: due.Note, User: due.User}))
+	})
+
+	t.Run("private_addresses_are_rejected", func(t *testing.T) {
+		webhook := reminder.NewWebhook(config.Reminders{WebhookTimeout: time.Second})
+		assert.ErrorIs(t, webhook.Deliver(context.Background(), due), reminder.ErrPrivateAddress)
+	})
+}
@@ -0,0 +1,86 @@
+package reminder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/msal4/toastnotes/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Lease is how long a scheduler owns the reminder it's delivering, the other schedulers skip it until then. The
+// deliveries must take less, a reminder is delivered again if its lease expires before it's completed.
+const Lease = 5 * time.Minute
+
+// Scheduler delivers the due reminders. Any number of schedulers can share a store, every occurrence is claimed by
+// one of them, and a failed delivery is retried as described by models.Reminder.Advance.
+type Scheduler struct {
+	Store models.ReminderStore
+	// Channels maps the reminder channels to their implementations.
+	Channels map[string]Channel
+	// Batch is the maximum number of reminders delivered by a run, the rest are left to the next one.
+	Batch int
+	Now   func() time.Time
+}
+
+// NewScheduler creates a scheduler delivering the reminders of the store through the channels.
+func NewScheduler(store models.ReminderStore, channels map[string]Channel) *Scheduler {
+	return &Scheduler{Store: store, Channels: channels, Batch: 100, Now: time.Now}
+}
+
+// Run delivers the due reminders one at a time until there are none left or the batch is done, it returns how many
+// were delivered.
+func (s *Scheduler) Run(ctx context.Context) int {
+	delivered := 0
+	for i := 0; i < s.Batch && ctx.Err() == nil; i++ {
+		due, err := s.Store.WithContext(ctx).Claim(s.Now(), Lease)
+		if errors.Is(err, models.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("Failed to claim the due reminders")
+			}
+			break
+		}
+		if s.fire(ctx, due) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// fire delivers the claimed reminder and schedules its next occurrence or retry, it reports whether it was delivered.
+func (s *Scheduler) fire(ctx context.Context, due *models.Due) bool {
+	rem := due.Reminder
+	claimedUntil := *rem.ClaimedUntil
+
+	err := s.deliver(ctx, due)
+	delivered := err == nil
+	if err != nil {
+		log.Warn().Err(err).Str("reminder", rem.ID).Str("channel", rem.Channel).Int("attempt", rem.Attempts+1).
+			Msg("Failed to deliver a reminder")
+	}
+	rem.Advance(s.Now(), err)
+
+	// the schedule is saved even if the scheduler is stopping so that the delivery isn't repeated.
+	err = s.Store.WithContext(context.WithoutCancel(ctx)).Complete(rem, claimedUntil)
+	if errors.Is(err, models.ErrNotFound) {
+		log.Warn().Str("reminder", rem.ID).Msg("The reminder changed while it was being delivered")
+	} else if err != nil {
+		log.Error().Err(err).Str("reminder", rem.ID).Msg("Failed to schedule a delivered reminder")
+	}
+	return delivered
+}
+
+func (s *Scheduler) deliver(ctx context.Context, due *models.Due) error {
+	channel, ok := s.Channels[due.Reminder.Channel]
+	if !ok {
+		return fmt.Errorf("unknown reminder channel %q", due.Reminder.Channel)
+	}
+	ctx, cancel := context.WithTimeout(ctx, Lease/2)
+	defer cancel()
+	return channel.Deliver(ctx, due)
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/models"
+	pb "github.com/msal4/toastnotes/proto/toastnotes/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AuthService validates the access tokens for the other services.
+type AuthService struct {
+	pb.UnimplementedAuthServiceServer
+
+	Store  models.UserStore
+	Tokens *auth.Tokens
+}
+
+// NewAuthService creates a new auth service.
+func NewAuthService(store models.UserStore, tokens *auth.Tokens) *AuthService {
+	return &AuthService{Store: store, Tokens: tokens}
+}
+
+// ValidateToken checks the access token and returns the user it was issued to, the tokens of deleted and disabled
+// users are rejected.
+func (s *AuthService) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
+	claims, err := parseAccessToken(s.Tokens, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Store.WithContext(ctx).RetrieveUser(claims.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		return nil, internal(ctx, err, "Failed to find the user")
+	}
+	if user.Disabled() {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	return &pb.ValidateTokenResponse{
+		User: &pb.User{
+			Id:        user.ID,
+			Name:      user.Name,
+			Email:     user.Email,
+			CreatedAt: timestamppb.New(user.CreatedAt),
+			UpdatedAt: timestamppb.New(user.UpdatedAt),
+		},
+		ExpiresAt: timestamppb.New(time.Unix(claims.ExpiresAt, 0)),
+	}, nil
+}
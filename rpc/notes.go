@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	pb "github.com/msal4/toastnotes/proto/toastnotes/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var errNoteNotFound = status.Error(codes.NotFound, "Note not found")
+
+// NoteService serves the notes of the authenticated user.
+type NoteService struct {
+	pb.UnimplementedNoteServiceServer
+
+	Store      models.NoteStore
+	Pagination config.Pagination
+	Metrics    *metrics.Metrics
+}
+
+// NewNoteService creates a new note service.
+func NewNoteService(store models.NoteStore, pagination config.Pagination, m *metrics.Metrics) *NoteService {
+	return &NoteService{Store: store, Pagination: pagination, Metrics: m}
+}
+
+// CreateNote creates a note for the authenticated user.
+func (s *NoteService) CreateNote(ctx context.Context, req *pb.CreateNoteRequest) (*pb.Note, error) {
+	if strings.TrimSpace(req.Title) == "" {
+		return nil, status.Error(codes.InvalidArgument, "The title is required")
+	}
+
+	note := models.Note{Title: req.Title, Content: req.Content, UserID: UserID(ctx)}
+	if err := s.Store.WithContext(ctx).Create(&note); err != nil {
+		return nil, internal(ctx, err, "Could not create note")
+	}
+	s.Metrics.NotesCreated.Inc()
+
+	return toNote(&note), nil
+}
+
+// GetNote gets a note of the authenticated user.
+func (s *NoteService) GetNote(ctx context.Context, req *pb.GetNoteRequest) (*pb.Note, error) {
+	note, err := s.findNote(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return toNote(note), nil
+}
+
+// ListNotes lists a page of the authenticated user notes matching the search.
+func (s *NoteService) ListNotes(ctx context.Context, req *pb.ListNotesRequest) (*pb.ListNotesResponse, error) {
+	page := int(req.Page)
+	if page <= 0 {
+		page = 1
+	}
+	size := pageSize(int(req.PageSize), s.Pagination)
+
+	filter := models.NoteFilter{Search: req.Search}
+	notes, total, err := s.Store.WithContext(ctx).Search(UserID(ctx), filter, (page-1)*size, size)
+	if err != nil {
+		return nil, internal(ctx, err, "Failed to retrieve notes")
+	}
+
+	resp := &pb.ListNotesResponse{Notes: make([]*pb.Note, len(notes)), Total: total, Page: int32(page), PageSize: int32(size)}
+	for i := range notes {
+		resp.Notes[i] = toNote(&notes[i])
+	}
+	return resp, nil
+}
+
+// UpdateNote updates the set fields of a note of the authenticated user.
+func (s *NoteService) UpdateNote(ctx context.Context, req *pb.UpdateNoteRequest) (*pb.Note, error) {
+	note, err := s.findNote(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Title == nil && req.Content == nil {
+		return toNote(note), nil
+	}
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			return nil, status.Error(codes.InvalidArgument, "The title can't be empty")
+		}
+		note.Title = *req.Title
+	}
+	if req.Content != nil {
+		note.Content = *req.Content
+	}
+
+	if err := s.Store.WithContext(ctx).Update(note); err != nil {
+		return nil, internal(ctx, err, "Could not update note")
+	}
+	return toNote(note), nil
+}
+
+// DeleteNote deletes a note of the authenticated user.
+func (s *NoteService) DeleteNote(ctx context.Context, req *pb.DeleteNoteRequest) (*pb.DeleteNoteResponse, error) {
+	note, err := s.findNote(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.WithContext(ctx).Delete(note); err != nil {
+		return nil, internal(ctx, err, "Could not delete the note")
+	}
+	return &pb.DeleteNoteResponse{}, nil
+}
+
+// findNote finds the authenticated user note with the given id.
+func (s *NoteService) findNote(ctx context.Context, noteID string) (*models.Note, error) {
+	note, err := s.Store.WithContext(ctx).FindForUser(noteID, UserID(ctx))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errNoteNotFound
+		}
+		return nil, internal(ctx, err, "Failed to find the note")
+	}
+	return note, nil
+}
+
+func toNote(note *models.Note) *pb.Note {
+	return &pb.Note{
+		Id:        note.ID,
+		Title:     note.Title,
+		Content:   note.Content,
+		UserId:    note.UserID,
+		CreatedAt: timestamppb.New(note.CreatedAt),
+		UpdatedAt: timestamppb.New(note.UpdatedAt),
+	}
+}
@@ -0,0 +1,167 @@
+// Package rpc serves the notes and the access token validation over gRPC using the model repositories.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/middleware"
+	"github.com/msal4/toastnotes/models"
+	pb "github.com/msal4/toastnotes/proto/toastnotes/v1"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationKey is the metadata key holding the access token as "Bearer <token>".
+const AuthorizationKey = "authorization"
+
+// RequestIDKey is the metadata key the request id is read from and sent back in.
+var RequestIDKey = strings.ToLower(middleware.RequestIDHeader)
+
+// publicMethods are the methods that don't require the authorization metadata.
+var publicMethods = map[string]bool{
+	pb.AuthService_ValidateToken_FullMethodName: true,
+}
+
+// New creates a gRPC server serving the note and auth services, the calls are logged using l and authenticated
+// with the same access tokens as the http api.
+func New(stores *models.Stores, cfg *config.Config, m *metrics.Metrics, l zerolog.Logger) *grpc.Server {
+	tokens := auth.NewTokens(cfg.Auth)
+	stores = stores.WithQuota(models.NewQuotas(cfg.Quota))
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(logging(l), recovery, authenticate(tokens)))
+	pb.RegisterNoteServiceServer(srv, NewNoteService(stores.Notes, cfg.Pagination, m))
+	pb.RegisterAuthServiceServer(srv, NewAuthService(stores.Users, tokens))
+	return srv
+}
+
+type userIDKey struct{}
+
+// UserID returns the id of the user authenticated by the call metadata.
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// authenticate rejects the calls to the non public methods without a valid access token in the authorization
+// metadata and sets the user id in the context of the others.
+func authenticate(tokens *auth.Tokens) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(AuthorizationKey)
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		tokenStr, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+
+		claims, err := parseAccessToken(tokens, tokenStr)
+		if err != nil {
+			return nil, err
+		}
+		zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str(auth.UserIDKey, claims.UserID)
+		})
+		return handler(context.WithValue(ctx, userIDKey{}, claims.UserID), req)
+	}
+}
+
+// parseAccessToken parses the token and returns its claims or an Unauthenticated error.
+func parseAccessToken(tokens *auth.Tokens, tokenStr string) (*auth.AccessTokenClaims, error) {
+	claims := auth.AccessTokenClaims{}
+	token, err := tokens.ParseToken(tokenStr, &claims)
+	if err != nil || !token.Valid || claims.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return &claims, nil
+}
+
+// logging sets up a call scoped logger with the request id and logs each call once it's handled, the request id is
+// taken from the x-request-id metadata or generated if it's missing and is sent back in the response headers.
+func logging(l zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		id := ""
+		if values := md.Get(RequestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+		if !middleware.ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+		rl := l.With().Str(middleware.RequestIDKey, id).Logger()
+		ctx = rl.WithContext(ctx)
+
+		resp, err := handler(ctx, req)
+
+		// the logger in the context has the user id added by the authentication.
+		cl := zerolog.Ctx(ctx)
+		code := status.Code(err)
+		var event *zerolog.Event
+		switch code {
+		case codes.OK:
+			event = cl.Info()
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+			event = cl.Error()
+		default:
+			event = cl.Warn()
+		}
+		event.
+			Str("method", info.FullMethod).
+			Str("code", code.String()).
+			Dur("latency", time.Since(start)).
+			Msg("Handled call")
+		return resp, err
+	}
+}
+
+// recovery turns the panics of the handlers into Internal errors.
+func recovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(ctx).Error().Interface("panic", r).Str("method", info.FullMethod).Msg("Recovered from a panic")
+			err = status.Error(codes.Internal, "Could not handle your request")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// internal logs err using the call logger and returns the error sent to the client, the quota errors are sent as
+// ResourceExhausted.
+func internal(ctx context.Context, err error, msg string) error {
+	var qe *models.QuotaError
+	if errors.As(err, &qe) {
+		return status.Error(codes.ResourceExhausted, qe.Message())
+	}
+	zerolog.Ctx(ctx).Error().Err(err).Msg(msg)
+	return status.Error(codes.Internal, msg)
+}
+
+// pageSize applies the default and maximum page sizes the same way the rest api does.
+func pageSize(size int, pagination config.Pagination) int {
+	switch {
+	case size > pagination.MaxPageSize:
+		return pagination.MaxPageSize
+	case size <= 0:
+		return pagination.PageSize
+	}
+	return size
+}
@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/auth"
+	"github.com/msal4/toastnotes/config"
+	"github.com/msal4/toastnotes/metrics"
+	"github.com/msal4/toastnotes/models"
+	"github.com/msal4/toastnotes/models/memory"
+	pb "github.com/msal4/toastnotes/proto/toastnotes/v1"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+const userID = "0b7e3b4c-4bd4-4f4e-9a53-0d6c8f0a4c11"
+
+func newTestConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "mysecretkeygoeshere"
+	return cfg
+}
+
+// dial serves the grpc api on an in-process listener and returns a connection to it.
+func dial(t *testing.T, stores *models.Stores, cfg *config.Config) *grpc.ClientConn {
+	ln := bufconn.Listen(1 << 20)
+	srv := New(stores, cfg, metrics.New(), zerolog.Nop())
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withToken returns a context sending the access token of the user in the call metadata.
+func withToken(t *testing.T, cfg *config.Config, userID string) context.Context {
+	token, err := auth.NewTokens(cfg.Auth).GenerateAccessToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), AuthorizationKey, "Bearer "+token)
+}
+
+func TestAuthentication(t *testing.T) {
+	cfg := newTestConfig()
+	notes := pb.NewNoteServiceClient(dial(t, memory.NewStores(), cfg))
+
+	expired := newTestConfig()
+	expired.Auth.AccessTokenAge = -time.Minute
+	other := newTestConfig()
+	other.Auth.JWTSecret = "someothersecret"
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"missing_metadata", context.Background()},
+		{"missing_bearer_scheme", metadata.AppendToOutgoingContext(context.Background(), AuthorizationKey, "token")},
+		{"invalid_token", metadata.AppendToOutgoingContext(context.Background(), AuthorizationKey, "Bearer token")},
+		{"expired_token", withToken(t, expired, userID)},
+		{"token_signed_with_another_secret", withToken(t, other, userID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := notes.ListNotes(tt.ctx, &pb.ListNotesRequest{})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+
+	t.Run("valid_token", func(t *testing.T) {
+		_, err := notes.ListNotes(withToken(t, cfg, userID), &pb.ListNotesRequest{})
+		assert.Nil(t, err)
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	cfg := newTestConfig()
+	notes := pb.NewNoteServiceClient(dial(t, memory.NewStores(), cfg))
+
+	var header metadata.MD
+	_, err := notes.ListNotes(withToken(t, cfg, userID), &pb.ListNotesRequest{}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Len(t, header.Get(RequestIDKey), 1)
+	assert.NotEmpty(t, header.Get(RequestIDKey)[0])
+
+	ctx := metadata.AppendToOutgoingContext(withToken(t, cfg, userID), RequestIDKey, "my-request-id")
+	_, err = notes.ListNotes(ctx, &pb.ListNotesRequest{}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"my-request-id"}, header.Get(RequestIDKey))
+}
+
+func TestNoteServiceValidation(t *testing.T) {
+	cfg := newTestConfig()
+	notes := pb.NewNoteServiceClient(dial(t, memory.NewStores(), cfg))
+	ctx := withToken(t, cfg, userID)
+
+	t.Run("caps_the_page_size", func(t *testing.T) {
+		resp, err := notes.ListNotes(ctx, &pb.ListNotesRequest{Page: 2, PageSize: 1000, Search: "groceries"})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, resp.Page)
+		assert.EqualValues(t, cfg.Pagination.MaxPageSize, resp.PageSize)
+	})
+
+	t.Run("invalid_ids_are_not_found", func(t *testing.T) {
+		_, err := notes.GetNote(ctx, &pb.GetNoteRequest{Id: "not an id"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = notes.DeleteNote(ctx, &pb.DeleteNoteRequest{Id: ""})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("requires_a_title", func(t *testing.T) {
+		_, err := notes.CreateNote(ctx, &pb.CreateNoteRequest{Title: "  ", Content: "content"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestValidateTokenRequiresAValidToken(t *testing.T) {
+	cfg := newTestConfig()
+	users := pb.NewAuthServiceClient(dial(t, memory.NewStores(), cfg))
+
+	// it doesn't require the authorization metadata but the token must be valid.
+	_, err := users.ValidateToken(context.Background(), &pb.ValidateTokenRequest{AccessToken: "token"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func registerUser(t *testing.T, stores *models.Stores, email string) *models.User {
+	user, err := stores.Users.RegisterUser(auth.RegisterForm{
+		Credentials: auth.Credentials{Email: email, Password: "mockpassword"},
+		Name:        "Mock User",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestNoteService(t *testing.T) {
+	stores := memory.NewStores()
+	cfg := newTestConfig()
+	notes := pb.NewNoteServiceClient(dial(t, stores, cfg))
+
+	user := registerUser(t, stores, "grpc@email.com")
+	other := registerUser(t, stores, "grpc-other@email.com")
+	ctx := withToken(t, cfg, user.ID)
+
+	created, err := notes.CreateNote(ctx, &pb.CreateNoteRequest{Title: "Groceries", Content: "milk"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotEmpty(t, created.Id)
+	assert.Equal(t, user.ID, created.UserId)
+	_, err = notes.CreateNote(ctx, &pb.CreateNoteRequest{Title: "Todo"})
+	assert.Nil(t, err)
+
+	got, err := notes.GetNote(ctx, &pb.GetNoteRequest{Id: created.Id})
+	if assert.Nil(t, err) {
+		assert.Equal(t, created.Id, got.Id)
+		assert.Equal(t, "Groceries", got.Title)
+		assert.Equal(t, "milk", got.Content)
+	}
+
+	_, err = notes.GetNote(withToken(t, cfg, other.ID), &pb.GetNoteRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := notes.ListNotes(ctx, &pb.ListNotesRequest{Search: "grocer"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, list.Total)
+	if assert.Len(t, list.Notes, 1) {
+		assert.Equal(t, created.Id, list.Notes[0].Id)
+	}
+
+	updated, err := notes.UpdateNote(ctx, &pb.UpdateNoteRequest{Id: created.Id, Content: proto.String("")})
+	assert.Nil(t, err)
+	assert.Equal(t, "Groceries", updated.Title)
+	assert.Empty(t, updated.Content)
+
+	_, err = notes.UpdateNote(ctx, &pb.UpdateNoteRequest{Id: created.Id, Title: proto.String("")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = notes.DeleteNote(withToken(t, cfg, other.ID), &pb.DeleteNoteRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = notes.DeleteNote(ctx, &pb.DeleteNoteRequest{Id: created.Id})
+	assert.Nil(t, err)
+	_, err = notes.GetNote(ctx, &pb.GetNoteRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestValidateToken(t *testing.T) {
+	stores := memory.NewStores()
+	cfg := newTestConfig()
+	users := pb.NewAuthServiceClient(dial(t, stores, cfg))
+	user := registerUser(t, stores, "grpc@email.com")
+
+	token, err := auth.NewTokens(cfg.Auth).GenerateAccessToken(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := users.ValidateToken(context.Background(), &pb.ValidateTokenRequest{AccessToken: token})
+	if assert.Nil(t, err) {
+		assert.Equal(t, user.ID, resp.User.Id)
+		assert.Equal(t, user.Email, resp.User.Email)
+		assert.True(t, resp.ExpiresAt.AsTime().After(time.Now()))
+	}
+
+	// the tokens of disabled users are rejected.
+	if err := stores.Users.SetDisabled(user, true); err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.ValidateToken(context.Background(), &pb.ValidateTokenRequest{AccessToken: token})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,224 @@
+// Package rrule implements the subset of the iCalendar (RFC 5545) recurrence rules used by the note reminders, the
+// FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL, COUNT, UNTIL and BYDAY (weekly rules only) parts.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The supported frequencies.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the search for the next occurrence so that a rule without occurrences can't loop forever.
+const maxPeriods = 100000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Rule is a recurrence rule, its occurrences repeat the wall clock time of the start in its location so that they
+// don't shift with the daylight saving time.
+type Rule struct {
+	Freq     string
+	Interval int
+	// Count limits the number of occurrences including the start, 0 is unlimited.
+	Count int
+	// Until is the time of the last possible occurrence, the zero time is unlimited.
+	Until time.Time
+	// ByDay lists the days of the week the weekly rules repeat on, the day of the start if empty.
+	ByDay []time.Weekday
+}
+
+// Parse parses a rule like "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", the "RRULE:" prefix is optional.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate recurrence rule part %s", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			switch rule.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				err = fmt.Errorf("unsupported frequency %s", value)
+			}
+		case "INTERVAL":
+			rule.Interval, err = positive(name, value)
+		case "COUNT":
+			rule.Count, err = positive(name, value)
+		case "UNTIL":
+			rule.Until, err = parseUntil(value)
+		case "BYDAY":
+			rule.ByDay, err = parseDays(value)
+		default:
+			err = fmt.Errorf("unsupported recurrence rule part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return nil, errors.New("the recurrence rule FREQ is required")
+	case rule.Count > 0 && !rule.Until.IsZero():
+		return nil, errors.New("the recurrence rule can't have both COUNT and UNTIL")
+	case len(rule.ByDay) > 0 && rule.Freq != Weekly:
+		return nil, errors.New("BYDAY is only supported by the weekly recurrence rules")
+	}
+	return rule, nil
+}
+
+func positive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
+
+// parseUntil parses the UTC date-time (20261231T090000Z) or date (20261231) forms, a date includes the whole day.
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, errors.New("UNTIL must be a UTC date-time like 20261231T090000Z or a date like 20261231")
+}
+
+func parseDays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	seen := map[time.Weekday]bool{}
+	for _, name := range strings.Split(value, ",") {
+		day, ok := weekdays[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid BYDAY day %q", name)
+		}
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// String formats the rule in its canonical form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		names := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			names[i] = strings.ToUpper(day.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(names, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the rule starting at start that is after the given time, it reports false if
+// there are no more occurrences. The rule repeats in the location of the start, which is its first occurrence unless
+// it's on a day a weekly rule doesn't list in ByDay.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	n := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.occurrences(start, period) {
+			n++
+			if r.Count > 0 && n > r.Count || !r.Until.IsZero() && t.After(r.Until) {
+				return time.Time{}, false
+			}
+			if t.After(after) {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// occurrences returns the occurrences in the nth period of the rule, in order. The dates that don't exist in a period,
+// like the 31st of a shorter month, are skipped.
+func (r *Rule) occurrences(start time.Time, n int) []time.Time {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, start.Nanosecond(), start.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		return []time.Time{at(y, m, d+n*interval)}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{at(y, m, d+7*n*interval)}
+		}
+		// the weeks start on monday.
+		monday := d - (int(start.Weekday())+6)%7 + 7*n*interval
+		var times []time.Time
+		for offset := 0; offset < 7; offset++ {
+			t := at(y, m, monday+offset)
+			if r.onDay(t.Weekday()) && !t.Before(start) {
+				times = append(times, t)
+			}
+		}
+		return times
+	case Monthly:
+		first := at(y, m+time.Month(n*interval), 1)
+		if t := at(first.Year(), first.Month(), d); t.Month() == first.Month() {
+			return []time.Time{t}
+		}
+	case Yearly:
+		if t := at(y+n*interval, m, d); t.Month() == m {
+			return []time.Time{t}
+		}
+	}
+	return nil
+}
+
+func (r *Rule) onDay(day time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package rrule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/rrule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule      string
+		canonical string
+		ok        bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", true},
+		{"RRULE:freq=weekly;interval=2;byday=MO,fr,MO", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", true},
+		{"FREQ=MONTHLY;COUNT=3", "FREQ=MONTHLY;COUNT=3", true},
+		{"FREQ=YEARLY;UNTIL=20301231T090000Z", "FREQ=YEARLY;UNTIL=20301231T090000Z", true},
+		{"FREQ=DAILY;UNTIL=20301231", "FREQ=DAILY;UNTIL=20301231T235959Z", true},
+		{"", "", false},
+		{"INTERVAL=2", "", false},
+		{"FREQ=HOURLY", "", false},
+		{"FREQ=DAILY;INTERVAL=0", "", false},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20301231", "", false},
+		{"FREQ=DAILY;BYDAY=MO", "", false},
+		{"FREQ=WEEKLY;BYDAY=XX", "", false},
+		{"FREQ=DAILY;FREQ=WEEKLY", "", false},
+		{"FREQ=DAILY;BYMONTH=1", "", false},
+		{"FREQ=DAILY;UNTIL=tomorrow", "", false},
+	}
+
+	for _, tt := range tests {
+		rule, err := rrule.Parse(tt.rule)
+		if !tt.ok {
+			assert.Error(t, err, tt.rule)
+			continue
+		}
+		if assert.Nil(t, err, tt.rule) {
+			assert.Equal(t, tt.canonical, rule.String())
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("the time zone database isn't available")
+	}
+
+	occurrences := func(t *testing.T, rule string, start time.Time, n int) []string {
+		t.Helper()
+		r, err := rrule.Parse(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var times []string
+		after := start.Add(-time.Second)
+		for i := 0; i < n; i++ {
+			next, ok := r.Next(start, after)
+			if !ok {
+				break
+			}
+			times = append(times, next.Format("2006-01-02 15:04 Mon"))
+			after = next
+		}
+		return times
+	}
+
+	t.Run("daily_keeps_the_wall_clock_time_across_dst", func(t *testing.T) {
+		start := time.Date(2026, 3, 28, 9, 0, 0, 0, berlin)
+		assert.Equal(t, []string{"2026-03-28 09:00 Sat", "2026-03-29 09:00 Sun", "2026-03-30 09:00 Mon"},
+			occurrences(t, "FREQ=DAILY", start, 3))
+	})
+
+	t.Run("weekly_by_day", func(t *testing.T) {
+		start := time.Date(2026, 10, 21, 8, 30, 0, 0, time.UTC) // a wednesday
+		assert.Equal(t, []string{
+			"2026-10-21 08:30 Wed", "2026-10-23 08:30 Fri", "2026-11-02 08:30 Mon", "2026-11-04 08:30 Wed",
+		}, occurrences(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE,FR", start, 4))
+	})
+
+	t.Run("monthly_skips_the_missing_days", func(t *testing.T) {
+		start := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+		assert.Equal(t, []string{"2026-01-31 12:00 Sat", "2026-03-31 12:00 Tue", "2026-05-31 12:00 Sun"},
+			occurrences(t, "FREQ=MONTHLY", start, 3))
+	})
+
+	t.Run("yearly_on_leap_days", func(t *testing.T) {
+		start := time.Date(2024, 2, 29, 7, 0, 0, 0, time.UTC)
+		assert.Equal(t, []string{"2024-02-29 07:00 Thu", "2028-02-29 07:00 Tue"}, occurrences(t, "FREQ=YEARLY", start, 2))
+	})
+
+	t.Run("count_and_until_end_the_rule", func(t *testing.T) {
+		start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+		assert.Len(t, occurrences(t, "FREQ=DAILY;COUNT=3", start, 10), 3)
+		assert.Len(t, occurrences(t, "FREQ=DAILY;UNTIL=20260104T090000Z", start, 10), 4)
+		assert.Len(t, occurrences(t, "FREQ=DAILY;UNTIL=20260103", start, 10), 3)
+	})
+
+	t.Run("skips_to_the_first_occurrence_after_the_time", func(t *testing.T) {
+		r, _ := rrule.Parse("FREQ=WEEKLY;COUNT=5")
+		start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+		next, ok := r.Next(start, time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC))
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2026, 1, 22, 9, 0, 0, 0, time.UTC), next)
+
+		_, ok = r.Next(start, time.Date(2026, 1, 29, 9, 0, 0, 0, time.UTC))
+		assert.False(t, ok, "the fifth occurrence was the last one")
+	})
+}
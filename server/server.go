@@ -0,0 +1,168 @@
+// Package server runs the http server and the background workers and shuts them down gracefully.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Server is an http server with background workers and shutdown hooks.
+type Server struct {
+	HTTP            *http.Server
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+
+	drains  []func()
+	workers []worker
+	hooks   []hook
+}
+
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+type hook struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// New creates a server for the handler using the timeouts and limits in cfg.
+func New(cfg config.Server, handler http.Handler) *Server {
+	return &Server{
+		HTTP: &http.Server{
+			Addr:              cfg.Addr(),
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		},
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		DrainDelay:      cfg.DrainDelay,
+	}
+}
+
+// OnDrain registers a func that's called as soon as the shutdown starts, before the server stops accepting
+// requests (e.g. failing the readiness probe).
+func (s *Server) OnDrain(fn func()) {
+	s.drains = append(s.drains, fn)
+}
+
+// Go registers a background worker, it's started with the server and its context is canceled at shutdown after
+// the http server stops accepting requests. The worker should return once the context is done.
+func (s *Server) Go(name string, run func(ctx context.Context)) {
+	s.workers = append(s.workers, worker{name: name, run: run})
+}
+
+// OnShutdown registers a hook that runs after the http server and the workers are stopped, hooks run in the
+// reverse order of their registration (e.g. closing the database).
+func (s *Server) OnShutdown(name string, run func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, hook{name: name, run: run})
+}
+
+// ListenAndServe listens on the server address and serves until ctx is done, then shuts down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves the requests on ln until ctx is done, then calls the drain funcs and keeps serving for the drain
+// delay so that load balancers stop sending traffic, stops accepting new connections, waits for the in-flight
+// requests to finish within the shutdown timeout, stops the workers and runs the shutdown hooks.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			w.run(workersCtx)
+			log.Debug().Str("worker", w.name).Msg("Worker stopped")
+		}(w)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.HTTP.Serve(ln)
+	}()
+	log.Info().Str("addr", ln.Addr().String()).Msg("Server started")
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// the server failed before a shutdown was requested.
+	case <-ctx.Done():
+		log.Info().Msg("Shutting down")
+		for _, drain := range s.drains {
+			drain()
+		}
+		if s.DrainDelay > 0 {
+			log.Info().Dur("delay", s.DrainDelay).Msg("Draining traffic")
+			time.Sleep(s.DrainDelay)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	if e := s.HTTP.Shutdown(shutdownCtx); e != nil {
+		log.Error().Err(e).Msg("Failed to drain the connections before the shutdown timeout")
+		s.HTTP.Close()
+		err = errors.Join(err, e)
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Error().Msg("Background workers did not stop before the shutdown timeout")
+		err = errors.Join(err, shutdownCtx.Err())
+	}
+
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		h := s.hooks[i]
+		if e := h.run(shutdownCtx); e != nil {
+			log.Error().Err(e).Str("hook", h.name).Msg("Shutdown hook failed")
+			err = errors.Join(err, e)
+		}
+	}
+
+	log.Info().Msg("Server stopped")
+	return err
+}
+
+// Every returns a worker that calls fn every interval until its context is done.
+func Every(interval time.Duration, fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// start serves the handler on a random port until the returned cancel func is called.
+func start(t *testing.T, srv *Server) (url string, cancel context.CancelFunc, done <-chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Serve(ctx, ln) }()
+
+	return "http://" + ln.Addr().String(), cancel, errs
+}
+
+func newTestServer(handler http.Handler) *Server {
+	return New(config.Default().Server, handler)
+}
+
+func TestServe(t *testing.T) {
+	t.Run("in_flight_requests_complete_during_shutdown", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		srv := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("saved"))
+		}))
+		url, shutdown, done := start(t, srv)
+
+		resp := make(chan *http.Response, 1)
+		go func() {
+			res, err := http.Get(url)
+			assert.Nil(t, err)
+			resp <- res
+		}()
+
+		<-started
+		shutdown()
+
+		// the server stops accepting new connections while the request is in flight.
+		assert.Eventually(t, func() bool {
+			_, err := http.Get(url)
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+
+		close(release)
+		res := <-resp
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "saved", string(body))
+
+		assert.Nil(t, <-done)
+	})
+
+	t.Run("stops_the_workers_and_runs_the_hooks_in_reverse_order", func(t *testing.T) {
+		srv := newTestServer(http.NotFoundHandler())
+
+		running, stopped := make(chan struct{}), make(chan struct{})
+		srv.Go("worker", func(ctx context.Context) {
+			close(running)
+			<-ctx.Done()
+			close(stopped)
+		})
+
+		var order []string
+		srv.OnShutdown("database", func(ctx context.Context) error {
+			select {
+			case <-stopped:
+			default:
+				t.Error("the hook ran before the worker stopped")
+			}
+			order = append(order, "database")
+			return nil
+		})
+		srv.OnShutdown("cache", func(ctx context.Context) error {
+			order = append(order, "cache")
+			return nil
+		})
+
+		_, shutdown, done := start(t, srv)
+		<-running
+		shutdown()
+
+		assert.Nil(t, <-done)
+		assert.Equal(t, []string{"cache", "database"}, order)
+	})
+
+	t.Run("drains_before_it_stops_accepting_requests", func(t *testing.T) {
+		ready := true
+		srv := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		drained := make(chan struct{})
+		srv.OnDrain(func() {
+			ready = false
+			close(drained)
+		})
+		srv.DrainDelay = 200 * time.Millisecond
+		url, shutdown, done := start(t, srv)
+
+		shutdown()
+		<-drained
+
+		// requests are still served during the drain delay.
+		res, err := http.Get(url)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+		assert.Nil(t, <-done)
+	})
+
+	t.Run("gives_up_after_the_shutdown_timeout", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+
+		srv := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}))
+		srv.ShutdownTimeout = 50 * time.Millisecond
+		url, shutdown, done := start(t, srv)
+
+		go http.Get(url)
+		<-started
+		shutdown()
+
+		assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	})
+}
+
+func TestEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+
+	stopped := make(chan struct{})
+	go func() {
+		Every(time.Millisecond, func(ctx context.Context) {
+			select {
+			case calls <- struct{}{}:
+			default:
+			}
+		})(ctx)
+		close(stopped)
+	}()
+
+	<-calls
+	<-calls
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the worker did not stop")
+	}
+}
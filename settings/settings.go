@@ -1,7 +0,0 @@
-package settings
-
-// Constants used for pagination.
-const (
-	PageSize    = 20  // default pagination size
-	MaxPageSize = 100 // 100 seems like a reasonable number, its not too high and not too low.
-)
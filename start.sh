@@ -14,5 +14,7 @@ URL=${URL#?}
 URL=${URL%?}
 # wait for the db to start
 ./wait-for-it.sh $URL
+# apply the pending migrations
+./app migrate up
 # start the app
-./app
+./app serve
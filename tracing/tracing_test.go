@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msal4/toastnotes/auth"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type note struct {
+	ID    string
+	Title string
+}
+
+func newProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+func attr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tp, exporter := newProvider()
+
+	// a dry run db runs the callbacks without connecting to the database.
+	db, err := gorm.Open(postgres.Open("postgres://localhost/toastnotes"), &gorm.Config{
+		DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, InstrumentDB(db, tp))
+
+	router := gin.New()
+	router.Use(Middleware(tp))
+	router.GET("/notes/:id", func(c *gin.Context) {
+		c.Set(auth.UserIDKey, "user-id")
+		db.WithContext(c.Request.Context()).Find(&[]note{})
+		c.String(http.StatusOK, "note")
+	})
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	t.Run("creates_a_span_per_request", func(t *testing.T) {
+		exporter.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/notes/1", nil))
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 2) {
+			return
+		}
+		query, request := spans[0], spans[1]
+
+		assert.Equal(t, "GET /notes/:id", request.Name)
+		assert.Equal(t, trace.SpanKindServer, request.SpanKind)
+		assert.Equal(t, "/notes/:id", attr(request, "http.route").AsString())
+		assert.Equal(t, "/notes/1", attr(request, "url.path").AsString())
+		assert.Equal(t, int64(http.StatusOK), attr(request, "http.response.status_code").AsInt64())
+		assert.Equal(t, "user-id", attr(request, auth.UserIDKey).AsString())
+		assert.False(t, request.Parent.IsValid())
+
+		assert.Equal(t, "db.query notes", query.Name)
+		assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+		assert.Equal(t, request.SpanContext.TraceID(), query.Parent.TraceID())
+		assert.Equal(t, request.SpanContext.SpanID(), query.Parent.SpanID())
+		assert.Equal(t, "notes", attr(query, "db.collection.name").AsString())
+		assert.Contains(t, attr(query, "db.query.text").AsString(), `SELECT * FROM "notes"`)
+	})
+
+	t.Run("continues_the_traceparent_trace", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest("GET", "/notes/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 2) {
+			return
+		}
+		for _, span := range spans {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+		}
+		assert.Equal(t, "00f067aa0ba902b7", spans[1].Parent.SpanID().String())
+		assert.True(t, spans[1].Parent.IsRemote())
+	})
+
+	t.Run("marks_server_errors", func(t *testing.T) {
+		exporter.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 1) {
+			return
+		}
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, attribute.INVALID, attr(spans[0], auth.UserIDKey).Type())
+	})
+
+	t.Run("names_unmatched_requests", func(t *testing.T) {
+		exporter.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "GET unmatched", spans[0].Name)
+		}
+	})
+}
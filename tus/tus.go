@@ -0,0 +1,345 @@
+// Package tus stores the partial uploads of the tus resumable upload protocol (https://tus.io) on the local disk until
+// they're complete.
+package tus
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The protocol version and the supported extensions.
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,termination,expiration"
+)
+
+var (
+	// ErrNotFound is returned when an upload doesn't exist.
+	ErrNotFound = errors.New("upload not found")
+	// ErrExpired is returned when an upload has expired and is waiting to be cleaned up.
+	ErrExpired = errors.New("upload expired")
+	// ErrOffsetMismatch is returned when appending at an offset other than the current one of the upload.
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrLocked is returned when an upload is being appended to by another request.
+	ErrLocked = errors.New("upload locked")
+)
+
+// Upload is a partial upload, its data is appended until Offset reaches Length.
+type Upload struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"userId"`
+	Length    int64             `json:"length"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	// Offset is the number of bytes received so far, it's the size of the data file.
+	Offset int64 `json:"-"`
+}
+
+// Complete reports whether all the data of the upload has been received.
+func (up *Upload) Complete() bool {
+	return up.Offset == up.Length
+}
+
+// Store keeps the uploads in a directory, each upload has an <id>.info file with its details and an <id>.bin file
+// with the data received so far.
+type Store struct {
+	Dir string
+	// Expiry is how long an upload is kept after it was last appended to.
+	Expiry time.Duration
+
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+// NewStore creates a store keeping the uploads in dir, it's created with the first upload.
+func NewStore(dir string, expiry time.Duration) *Store {
+	return &Store{Dir: dir, Expiry: expiry, locked: map[string]bool{}}
+}
+
+func (s *Store) infoPath(id string) string { return filepath.Join(s.Dir, id+".info") }
+func (s *Store) dataPath(id string) string { return filepath.Join(s.Dir, id+".bin") }
+
+// Create creates the upload with no data and sets its id and expiry.
+func (s *Store) Create(up *Upload) error {
+	if err := os.MkdirAll(s.Dir, 0o750); err != nil {
+		return err
+	}
+
+	up.ID = uuid.NewString()
+	up.CreatedAt = time.Now()
+	up.ExpiresAt = up.CreatedAt.Add(s.Expiry)
+	up.Offset = 0
+
+	f, err := os.OpenFile(s.dataPath(up.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := s.writeInfo(up); err != nil {
+		os.Remove(s.dataPath(up.ID))
+		return err
+	}
+	return nil
+}
+
+// Get finds the upload with the given id, the expired uploads fail with ErrExpired.
+func (s *Store) Get(id string) (*Upload, error) {
+	up, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(up.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return up, nil
+}
+
+func (s *Store) get(id string) (*Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	b, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	up := &Upload{}
+	if err := json.Unmarshal(b, up); err != nil {
+		return nil, fmt.Errorf("invalid upload info %s: %w", id, err)
+	}
+
+	fi, err := os.Stat(s.dataPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	up.Offset = fi.Size()
+	return up, nil
+}
+
+// Append appends the data read from r to the upload at offset, which must be its current offset, until the upload is
+// complete. The data received before r fails is kept so that the client can resume from there, the upload is
+// returned with its new offset along with the error. Each append extends the upload expiry.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Upload, error) {
+	if !s.lock(id) {
+		return nil, ErrLocked
+	}
+	defer s.unlock(id)
+
+	up, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != up.Offset {
+		return nil, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r, up.Length-up.Offset))
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+	up.Offset += n
+
+	up.ExpiresAt = time.Now().Add(s.Expiry)
+	if err := s.writeInfo(up); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	return up, copyErr
+}
+
+// Open opens the data of the upload.
+func (s *Store) Open(id string) (*os.File, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.dataPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Finish calls fn with the complete upload and its data and deletes the upload if fn succeeds. The upload stays
+// locked until then so that it's only finished once.
+func (s *Store) Finish(id string, fn func(up *Upload, data *os.File) error) error {
+	if !s.lock(id) {
+		return ErrLocked
+	}
+	defer s.unlock(id)
+
+	up, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if !up.Complete() {
+		return fmt.Errorf("upload %s is not complete, %d of %d bytes received", id, up.Offset, up.Length)
+	}
+
+	f, err := s.Open(id)
+	if err != nil {
+		return err
+	}
+	err = fn(up, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// Delete deletes the upload and its data, it fails with ErrLocked while data is being appended to it.
+func (s *Store) Delete(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	if !s.lock(id) {
+		return ErrLocked
+	}
+	defer s.unlock(id)
+
+	return s.remove(id)
+}
+
+func (s *Store) remove(id string) error {
+	err := os.Remove(s.infoPath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.dataPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired deletes the uploads that expired before the given time and returns how many were deleted, the ones
+// being appended to are skipped.
+func (s *Store) DeleteExpired(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".info")
+		if _, err := uuid.Parse(id); !ok || err != nil || !s.lock(id) {
+			continue
+		}
+
+		// the uploads missing their data are deleted too, the unreadable ones are left alone.
+		up, err := s.get(id)
+		if err == nil && up.ExpiresAt.Before(before) || errors.Is(err, ErrNotFound) {
+			err = s.remove(id)
+			if err == nil {
+				count++
+			}
+		} else {
+			err = nil
+		}
+		s.unlock(id)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// writeInfo replaces the info file of the upload, it's written to a temporary file first so that it's never read
+// partially written.
+func (s *Store) writeInfo(up *Upload) error {
+	b, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(up.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(up.ID))
+}
+
+func (s *Store) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[id] {
+		return false
+	}
+	s.locked[id] = true
+	return true
+}
+
+func (s *Store) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locked, id)
+}
+
+// ParseMetadata parses the Upload-Metadata header, a comma separated list of keys and their optional base64 encoded
+// values separated by a space.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value of %q: %w", key, err)
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, nil
+}
+
+// FormatMetadata formats the metadata as an Upload-Metadata header, the keys are sorted.
+func FormatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k
+		if v := metadata[k]; v != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,154 @@
+package tus_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/msal4/toastnotes/tus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	store := tus.NewStore(t.TempDir(), time.Hour)
+
+	create := func(t *testing.T, length int64) *tus.Upload {
+		t.Helper()
+		up := &tus.Upload{UserID: "user", Length: length, Metadata: map[string]string{"filename": "notes.txt"}}
+		if err := store.Create(up); err != nil {
+			t.Fatal(err)
+		}
+		return up
+	}
+
+	t.Run("create_and_get", func(t *testing.T) {
+		up := create(t, 10)
+		found, err := store.Get(up.ID)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "user", found.UserID)
+			assert.EqualValues(t, 10, found.Length)
+			assert.Zero(t, found.Offset)
+			assert.Equal(t, "notes.txt", found.Metadata["filename"])
+			assert.WithinDuration(t, time.Now().Add(time.Hour), found.ExpiresAt, time.Minute)
+		}
+
+		_, err = store.Get("../../etc/passwd")
+		assert.ErrorIs(t, err, tus.ErrNotFound)
+	})
+
+	t.Run("append_until_complete", func(t *testing.T) {
+		up := create(t, 10)
+		up, err := store.Append(up.ID, 0, strings.NewReader("hello"))
+		assert.Nil(t, err)
+		assert.EqualValues(t, 5, up.Offset)
+		assert.False(t, up.Complete())
+
+		_, err = store.Append(up.ID, 0, strings.NewReader("hello"))
+		assert.ErrorIs(t, err, tus.ErrOffsetMismatch)
+
+		// the data past the length is ignored.
+		up, err = store.Append(up.ID, 5, strings.NewReader(", world"))
+		assert.Nil(t, err)
+		assert.True(t, up.Complete())
+
+		f, err := store.Open(up.ID)
+		if assert.Nil(t, err) {
+			b, _ := io.ReadAll(f)
+			f.Close()
+			assert.Equal(t, "hello, wor", string(b))
+		}
+	})
+
+	t.Run("the_data_received_before_a_failure_is_kept", func(t *testing.T) {
+		up := create(t, 10)
+		r := io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(errors.New("connection reset")))
+		up, err := store.Append(up.ID, 0, r)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, 3, up.Offset)
+
+		found, _ := store.Get(up.ID)
+		assert.EqualValues(t, 3, found.Offset)
+	})
+
+	t.Run("finish", func(t *testing.T) {
+		up := create(t, 5)
+		err := store.Finish(up.ID, func(*tus.Upload, *os.File) error { return nil })
+		assert.NotNil(t, err, "the upload isn't complete")
+
+		store.Append(up.ID, 0, strings.NewReader("hello"))
+		failed := errors.New("failed")
+		err = store.Finish(up.ID, func(*tus.Upload, *os.File) error { return failed })
+		assert.ErrorIs(t, err, failed)
+		_, err = store.Get(up.ID)
+		assert.Nil(t, err, "the upload is kept when finishing it fails")
+
+		err = store.Finish(up.ID, func(found *tus.Upload, data *os.File) error {
+			_, err := store.Append(up.ID, 5, strings.NewReader(""))
+			assert.ErrorIs(t, err, tus.ErrLocked)
+			b, _ := io.ReadAll(data)
+			assert.Equal(t, "hello", string(b))
+			return nil
+		})
+		assert.Nil(t, err)
+		_, err = store.Get(up.ID)
+		assert.ErrorIs(t, err, tus.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		up := create(t, 10)
+		assert.Nil(t, store.Delete(up.ID))
+		_, err := store.Get(up.ID)
+		assert.ErrorIs(t, err, tus.ErrNotFound)
+		_, err = store.Open(up.ID)
+		assert.ErrorIs(t, err, tus.ErrNotFound)
+	})
+
+	t.Run("expired_uploads_are_deleted", func(t *testing.T) {
+		expiring := tus.NewStore(t.TempDir(), -time.Minute)
+		up := &tus.Upload{UserID: "user", Length: 10}
+		assert.Nil(t, expiring.Create(up))
+		_, err := expiring.Get(up.ID)
+		assert.ErrorIs(t, err, tus.ErrExpired)
+		_, err = expiring.Append(up.ID, 0, strings.NewReader("hello"))
+		assert.ErrorIs(t, err, tus.ErrExpired)
+
+		active := create(t, 10)
+		n, err := store.DeleteExpired(time.Now())
+		assert.Nil(t, err)
+		assert.Zero(t, n)
+		_, err = store.Get(active.ID)
+		assert.Nil(t, err)
+
+		n, err = expiring.DeleteExpired(time.Now())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		_, err = expiring.Get(up.ID)
+		assert.ErrorIs(t, err, tus.ErrNotFound)
+	})
+
+	t.Run("missing_directory", func(t *testing.T) {
+		n, err := tus.NewStore(t.TempDir()+"/missing", time.Hour).DeleteExpired(time.Now())
+		assert.Nil(t, err)
+		assert.Zero(t, n)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	metadata, err := tus.ParseMetadata("filename bm90ZXMudHh0,noteId ZGFkYmM3MWE=, is_confidential")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"filename": "notes.txt", "noteId": "dadbc71a", "is_confidential": ""}, metadata)
+	assert.Equal(t, "filename bm90ZXMudHh0,is_confidential,noteId ZGFkYmM3MWE=", tus.FormatMetadata(metadata))
+
+	for _, header := range []string{"filename not-base64!", "filename YQ==,filename YQ==", ",", "a b c"} {
+		_, err := tus.ParseMetadata(header)
+		assert.NotNil(t, err, header)
+	}
+
+	metadata, err = tus.ParseMetadata("")
+	assert.Nil(t, err)
+	assert.Empty(t, metadata)
+}
@@ -1,6 +1,15 @@
 package utils
 
-import "github.com/gin-gonic/gin"
+import (
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFilenameLength is the maximum length of the stored file names in bytes.
+const maxFilenameLength = 255
 
 // Msg generates a success response with the provided message.
 func Msg(msg string) gin.H {
@@ -11,3 +20,27 @@ func Msg(msg string) gin.H {
 func Err(msg string) gin.H {
 	return gin.H{"error": msg}
 }
+
+// SanitizeFilename strips the directories and the control characters of a file name sent by a client.
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if len(name) > maxFilenameLength {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxFilenameLength-len(ext)], "") + ext
+	}
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "attachment"
+	}
+	return name
+}
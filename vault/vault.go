@@ -0,0 +1,270 @@
+// Package vault reads and writes the Markdown vaults of the notes, the zip archives of Markdown files with YAML front
+// matter that Obsidian and the other Markdown editors open as folders.
+//
+// The links between the notes are Markdown links to note:<id> in the notes and wiki links to the note files in the
+// vaults, e.g. [Groceries](note:0b5c...) and [[Groceries]].
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ext is the extension of the note files.
+const Ext = ".md"
+
+// AttachmentsDir is the folder of the attachments, every note has a folder of its own in it named as its file.
+const AttachmentsDir = "attachments"
+
+// FrontMatter is the YAML front matter of a note file. The notes don't have tags of their own, the tags are the
+// hashtags of the content.
+type FrontMatter struct {
+	ID    string `yaml:"id,omitempty"`
+	Title string `yaml:"title,omitempty"`
+	// Folder is the folder of the note file in the vault, the files moved to other folders of the vault are imported
+	// in their new folders and the note files imported by themselves in this one.
+	Folder    string          `yaml:"folder,omitempty"`
+	Created   time.Time       `yaml:"created,omitempty"`
+	Updated   time.Time       `yaml:"updated,omitempty"`
+	Tags      []string        `yaml:"tags,omitempty"`
+	Checklist []ChecklistItem `yaml:"checklist,omitempty"`
+	// Attachments are the paths of the attachments in the vault.
+	Attachments []string `yaml:"attachments,omitempty"`
+}
+
+// ChecklistItem is a checklist item in the front matter.
+type ChecklistItem struct {
+	Text string `yaml:"text"`
+	Done bool   `yaml:"done"`
+}
+
+// rawFrontMatter is the front matter as it's written by hand, the dates and tags are parsed leniently.
+type rawFrontMatter struct {
+	ID          string          `yaml:"id"`
+	Title       string          `yaml:"title"`
+	Folder      string          `yaml:"folder"`
+	Created     string          `yaml:"created"`
+	Updated     string          `yaml:"updated"`
+	Tags        yaml.Node       `yaml:"tags"`
+	Checklist   []ChecklistItem `yaml:"checklist"`
+	Attachments []string        `yaml:"attachments"`
+}
+
+// dateLayouts are the accepted layouts of the dates of the front matter.
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Marshal formats the note file with the front matter followed by the body.
+func Marshal(fm FrontMatter, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(fm); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("---\n")
+	buf.WriteString(body)
+	return buf.Bytes(), nil
+}
+
+// Parse splits the note file into its front matter and body, the files without front matter only have a body.
+func Parse(data []byte) (FrontMatter, string, error) {
+	text := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+	if !strings.HasPrefix(text, "---\n") {
+		return FrontMatter{}, text, nil
+	}
+	rest := text[len("---\n"):]
+	var head, body string
+	switch {
+	case strings.HasPrefix(rest, "---\n") || rest == "---":
+		body = strings.TrimPrefix(strings.TrimPrefix(rest, "---"), "\n")
+	default:
+		end := strings.Index(rest, "\n---\n")
+		if end < 0 {
+			if !strings.HasSuffix(rest, "\n---") {
+				return FrontMatter{}, text, nil
+			}
+			end = len(rest) - len("\n---")
+			head = rest[:end]
+		} else {
+			head, body = rest[:end], rest[end+len("\n---\n"):]
+		}
+	}
+
+	var raw rawFrontMatter
+	if err := yaml.Unmarshal([]byte(head), &raw); err != nil {
+		return FrontMatter{}, body, fmt.Errorf("invalid front matter: %w", err)
+	}
+	fm := FrontMatter{ID: raw.ID, Title: raw.Title, Folder: raw.Folder, Checklist: raw.Checklist, Attachments: raw.Attachments}
+	fm.Created, fm.Updated = parseDate(raw.Created), parseDate(raw.Updated)
+	switch raw.Tags.Kind {
+	case yaml.SequenceNode:
+		for _, n := range raw.Tags.Content {
+			fm.Tags = append(fm.Tags, strings.TrimPrefix(n.Value, "#"))
+		}
+	case yaml.ScalarNode:
+		for _, tag := range strings.FieldsFunc(raw.Tags.Value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			fm.Tags = append(fm.Tags, strings.TrimPrefix(tag, "#"))
+		}
+	}
+	return fm, body, nil
+}
+
+func parseDate(s string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+var hashtag = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+
+// Hashtags returns the distinct hashtags of the content in order, the ones made of digits only aren't tags.
+func Hashtags(content string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, m := range hashtag.FindAllStringSubmatch(content, -1) {
+		tag := m[1]
+		if seen[tag] || strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// NoteURL is the url of the links to a note.
+func NoteURL(id string) string {
+	return "note:" + id
+}
+
+// noteLink matches the links to the notes, [label](note:id).
+var noteLink = regexp.MustCompile(`\[((?:[^\[\]\\]|\\.)*)\]\(note:([0-9a-fA-F-]{36})\)`)
+
+// wikiLink matches the wiki links and embeds, [[target#heading|label]] and ![[file]].
+var wikiLink = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+
+// ToWikiLinks replaces the links to the notes with the wiki links to their files, name returns the file name of a
+// note without the extension. The links to the notes without a file are left as they are.
+func ToWikiLinks(content string, name func(id string) (string, bool)) string {
+	return noteLink.ReplaceAllStringFunc(content, func(link string) string {
+		m := noteLink.FindStringSubmatch(link)
+		target, ok := name(strings.ToLower(m[2]))
+		if !ok {
+			return link
+		}
+		label := strings.NewReplacer(`\[`, "[", `\]`, "]").Replace(m[1])
+		if label == target || strings.ContainsAny(label, "[]|") {
+			return "[[" + target + "]]"
+		}
+		return "[[" + target + "|" + label + "]]"
+	})
+}
+
+// Link is a link of a note to another note of a vault.
+type Link struct {
+	// Start and End are the offsets of the link in the content.
+	Start, End int
+	Label      string
+	// Target is the file name of the linked note without the extension, with its folders if they were in the link,
+	// or its id if it's a link to a note.
+	Target string
+}
+
+// Links returns the wiki links and the links to the notes of the content in order, the embeds aren't listed.
+func Links(content string) []Link {
+	links := []Link{}
+	for _, m := range wikiLink.FindAllStringSubmatchIndex(content, -1) {
+		if m[3] > m[2] {
+			continue // an embed
+		}
+		target := strings.TrimSpace(content[m[4]:m[5]])
+		if target == "" {
+			continue
+		}
+		label := target
+		if m[8] >= 0 {
+			label = content[m[8]:m[9]]
+		} else if m[6] >= 0 {
+			label = target + content[m[6]:m[7]]
+		}
+		links = append(links, Link{Start: m[0], End: m[1], Label: label, Target: strings.TrimSuffix(target, Ext)})
+	}
+	for _, m := range noteLink.FindAllStringSubmatchIndex(content, -1) {
+		links = append(links, Link{Start: m[0], End: m[1], Label: content[m[2]:m[3]], Target: strings.ToLower(content[m[4]:m[5]])})
+	}
+	slices.SortFunc(links, func(a, b Link) int { return a.Start - b.Start })
+	return links
+}
+
+// Embeds returns the targets of the embeds of the content, ![[file.png]].
+func Embeds(content string) []string {
+	embeds := []string{}
+	for _, m := range wikiLink.FindAllStringSubmatch(content, -1) {
+		if m[1] == "!" && strings.TrimSpace(m[2]) != "" {
+			embeds = append(embeds, strings.TrimSpace(m[2]))
+		}
+	}
+	return embeds
+}
+
+// MarkdownLink formats a link to the note with the given id.
+func MarkdownLink(label, id string) string {
+	return "[" + strings.NewReplacer("[", `\[`, "]", `\]`).Replace(label) + "](" + NoteURL(id) + ")"
+}
+
+// unsafeName are the characters that can't be in the file names or that break the wiki links.
+var unsafeName = strings.NewReplacer(
+	"/", "-", `\`, "-", ":", "-", "*", "-", "?", "-", `"`, "-", "<", "-", ">", "-", "|", "-", "#", "-", "^", "-",
+	"[", "(", "]", ")",
+)
+
+// maxNameLength is the maximum length of the file names in bytes.
+const maxNameLength = 200
+
+// Names gives the notes unique file names derived from their titles, the names differ by more than their case.
+type Names struct {
+	taken map[string]bool
+}
+
+// NewNames creates an empty set of names.
+func NewNames() *Names {
+	return &Names{taken: map[string]bool{}}
+}
+
+// Name reserves a file name for the title without the extension.
+func (n *Names) Name(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, unsafeName.Replace(title))
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if len(name) > maxNameLength {
+		name = strings.ToValidUTF8(name[:maxNameLength], "")
+	}
+	if name == "" {
+		name = "Untitled"
+	}
+
+	unique := name
+	for i := 2; n.taken[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+	n.taken[strings.ToLower(unique)] = true
+	return unique
+}
@@ -0,0 +1,73 @@
+package vault_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msal4/toastnotes/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	fm := vault.FrontMatter{
+		ID:          "0b5c4a3e-6a0f-4c1e-9a59-3d1c0f6d3a11",
+		Title:       "Groceries: week 1",
+		Folder:      "Home/Shopping",
+		Created:     time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		Updated:     time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC),
+		Tags:        []string{"shopping"},
+		Checklist:   []vault.ChecklistItem{{Text: "Milk", Done: true}, {Text: "- eggs"}},
+		Attachments: []string{"attachments/Groceries- week 1/list.txt"},
+	}
+	body := "\nmilk and eggs #shopping\n"
+	data, err := vault.Marshal(fm, body)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	parsed, parsedBody, err := vault.Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, fm, parsed, "the front matter round trips")
+	assert.Equal(t, body, parsedBody)
+
+	parsed, parsedBody, err = vault.Parse([]byte("---\r\ntags: a, b\r\ncreated: 2026-01-02 03:04\r\n---\r\ntext"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, parsed.Tags)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC), parsed.Created)
+	assert.Equal(t, "text", parsedBody)
+
+	_, parsedBody, err = vault.Parse([]byte("no front matter\n---\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "no front matter\n---\n", parsedBody)
+	_, _, err = vault.Parse([]byte("---\ntitle: [\n---\n"))
+	assert.NotNil(t, err)
+}
+
+func TestLinks(t *testing.T) {
+	id := "0b5c4a3e-6a0f-4c1e-9a59-3d1c0f6d3a11"
+	names := func(linked string) (string, bool) { return "Groceries", linked == id }
+	content := "See [Groceries](note:" + id + "), [the list](note:" + id + ") and [gone](note:1b5c4a3e-6a0f-4c1e-9a59-3d1c0f6d3a11)."
+	assert.Equal(t, "See [[Groceries]], [[Groceries|the list]] and [gone](note:1b5c4a3e-6a0f-4c1e-9a59-3d1c0f6d3a11).",
+		vault.ToWikiLinks(content, names))
+
+	content = "[[Work/Trip#Day 1]] ![[photo.png]] [[Groceries.md|list]] [a](note:" + id + ")"
+	assert.Equal(t, []vault.Link{
+		{Start: 0, End: 19, Label: "Work/Trip#Day 1", Target: "Work/Trip"},
+		{Start: 35, End: 56, Label: "list", Target: "Groceries"},
+		{Start: 57, End: 103, Label: "a", Target: id},
+	}, vault.Links(content))
+	assert.Equal(t, []string{"photo.png"}, vault.Embeds(content))
+	assert.Equal(t, `[\[draft\]](note:`+id+`)`, vault.MarkdownLink("[draft]", id))
+}
+
+func TestHashtags(t *testing.T) {
+	assert.Equal(t, []string{"work", "trip/day-1"}, vault.Hashtags("# Heading\n#work on #trip/day-1, #work #123 a#b"))
+}
+
+func TestNames(t *testing.T) {
+	names := vault.NewNames()
+	assert.Equal(t, "Groceries", names.Name("Groceries"))
+	assert.Equal(t, "groceries 2", names.Name("groceries"), "the names are unique regardless of their case")
+	assert.Equal(t, "a-b- (c)", names.Name(" a/b: [c] "))
+	assert.Equal(t, "Untitled", names.Name("..."))
+}
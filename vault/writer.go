@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Writer writes a vault to a zip archive, the notes are in their folders and their attachments are in the folders of
+// AttachmentsDir.
+type Writer struct {
+	zw    *zip.Writer
+	paths map[string]bool
+}
+
+// NewWriter creates a writer of a vault to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w), paths: map[string]bool{}}
+}
+
+// NotePath returns the path of the note file with the given name in the folder, the empty folder is the root.
+func NotePath(folder, name string) string {
+	return path.Join(folder, name+Ext)
+}
+
+// AttachmentPath reserves a unique path for an attachment of the note with the given name.
+func (w *Writer) AttachmentPath(name, filename string) string {
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	p := path.Join(AttachmentsDir, name, filename)
+	for i := 2; w.paths[strings.ToLower(p)]; i++ {
+		p = path.Join(AttachmentsDir, name, fmt.Sprintf("%s %d%s", base, i, ext))
+	}
+	w.paths[strings.ToLower(p)] = true
+	return p
+}
+
+// WriteNote writes the note file with the given name in the folder of the front matter.
+func (w *Writer) WriteNote(name string, fm FrontMatter, body string) error {
+	data, err := Marshal(fm, body)
+	if err != nil {
+		return err
+	}
+	f, err := w.create(NotePath(fm.Folder, name), fm.Updated)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// WriteFile writes the content of r to the file at the path.
+func (w *Writer) WriteFile(p string, modified time.Time, r io.Reader) error {
+	f, err := w.create(p, modified)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (w *Writer) create(p string, modified time.Time) (io.Writer, error) {
+	return w.zw.CreateHeader(&zip.FileHeader{Name: p, Method: zip.Deflate, Modified: modified})
+}
+
+// Close finishes writing the archive, it doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}